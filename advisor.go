@@ -0,0 +1,214 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	// minAdviceConnections is the number of connections under which the
+	// traffic of a service is too thin for AdviseScheduler.
+	minAdviceConnections = 50
+
+	// longLivedShare is the share of closing connections under which the
+	// connections of a service are considered long lived.
+	longLivedShare = 0.2
+
+	// maxLoadDeviation is the coefficient of variation of the connections
+	// per weight unit of the destinations above which the load is skewed.
+	maxLoadDeviation = 0.5
+
+	// minTemplateReuse is the average number of connections per
+	// persistence template under which persistence buys little.
+	minTemplateReuse = 1.5
+)
+
+// TrafficProfile is the traffic of a service observed in the connection
+// table, see GetTrafficProfile.
+type TrafficProfile struct {
+	Service      *Service
+	Destinations []*Destination
+	// Connections counts the connections of the service, Closing the ones
+	// closing, e.g. in TIME_WAIT, and Templates its persistence templates.
+	Connections int
+	Closing     int
+	Templates   int
+}
+
+// closingStates are the states of the connections closing, numerous
+// relatively to the established ones when connections are short lived.
+var closingStates = map[ConnectionState]bool{
+	ConnectionStateFinWait:   true,
+	ConnectionStateTimeWait:  true,
+	ConnectionStateClose:     true,
+	ConnectionStateCloseWait: true,
+	ConnectionStateLastAck:   true,
+}
+
+// GetTrafficProfile returns the traffic profile of s, walking the
+// connection table, see VisitConnections. The connections of a firewall
+// mark service are told apart by their destination.
+func (i *Handle) GetTrafficProfile(s *Service) (*TrafficProfile, error) {
+	return trafficProfile(i, s)
+}
+
+func trafficProfile(h Handler, s *Service) (*TrafficProfile, error) {
+	dsts, err := h.GetDestinations(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &TrafficProfile{Service: s, Destinations: dsts}
+
+	f := ConnectionFilter{Protocol: s.Protocol, Virtual: Endpoint{Address: s.Address, Port: s.Port}}
+	destinations := make(map[string]bool)
+	for _, d := range dsts {
+		destinations[Endpoint{Address: d.Address, Port: d.Port}.String()] = true
+	}
+	err = VisitConnections(func(c *Connection) bool {
+		switch {
+		case c.IsTemplate:
+			if templateOf(c, s) {
+				p.Templates++
+			}
+		case s.FWMark > 0 && destinations[c.Destination.String()], s.FWMark == 0 && f.Match(c):
+			p.Connections++
+			if closingStates[c.State] {
+				p.Closing++
+			}
+		}
+		return true
+	})
+	return p, err
+}
+
+// SchedulerAdvice is a scheduler recommendation of AdviseScheduler.
+type SchedulerAdvice struct {
+	// Service is the service of the profile with the recommended
+	// scheduler and flags, to pass to UpdateService if Change is set.
+	Service *Service
+	Change  bool
+	// Rationale explains the recommendation.
+	Rationale []string
+}
+
+// Command returns the ipvsadm command applying the advice.
+func (a *SchedulerAdvice) Command() string {
+	return "ipvsadm -E " + serviceRule(a.Service) + serviceOptions(a.Service)
+}
+
+// AdviseScheduler recommends a scheduler and scheduler flags for the
+// traffic profile p:
+//
+//   - mh with mh-fallback for persistent services whose templates are
+//     seldom reused, keeping clients on their destination without the
+//     template table;
+//   - the fallback flag for sh and mh, so that the clients of unavailable
+//     destinations are rescheduled;
+//   - lc or wlc for rr and wrr services whose connections are long lived, or
+//     whose load per weight unit is skewed across destinations;
+//   - the weighted variant of rr and lc for destinations of unequal weights.
+//
+// It is a heuristic: the rationale tells what was observed.
+func AdviseScheduler(p *TrafficProfile) *SchedulerAdvice {
+	svc := *p.Service
+	a := &SchedulerAdvice{Service: &svc}
+	change := func(sched string, flags ServiceFlags, why string, args ...interface{}) {
+		svc.SchedName, svc.Flags = sched, flags
+		a.Change = true
+		a.Rationale = append(a.Rationale, fmt.Sprintf(why, args...))
+	}
+	noSchedFlags := svc.Flags &^ (SvcFlagSched1 | SvcFlagSched2 | SvcFlagSched3)
+
+	if svc.Flags.Has(SvcFlagPersistent) && p.Templates > 0 {
+		reuse := float64(p.Connections) / float64(p.Templates)
+		if reuse < minTemplateReuse {
+			change(MaglevHashing, noSchedFlags&^SvcFlagPersistent|SvcFlagMHFallback,
+				"persistence templates are reused by %.1f connections on average: mh keeps clients on their destination without templates, mh-fallback reschedules the ones of unavailable destinations", reuse)
+			return a
+		}
+	}
+
+	switch svc.SchedName {
+	case SourceHashing:
+		if !svc.Flags.Has(SvcFlagSHFallback) {
+			change(SourceHashing, svc.Flags|SvcFlagSHFallback, "sh-fallback reschedules the clients of unavailable destinations")
+		}
+		return a
+	case MaglevHashing:
+		if !svc.Flags.Has(SvcFlagMHFallback) {
+			change(MaglevHashing, svc.Flags|SvcFlagMHFallback, "mh-fallback reschedules the clients of unavailable destinations")
+		}
+		return a
+	}
+
+	if p.Connections < minAdviceConnections {
+		a.Rationale = append(a.Rationale, fmt.Sprintf("%d connections are too few to profile the traffic", p.Connections))
+		return a
+	}
+
+	weighted := unequalWeights(p.Destinations)
+	leastConn := LeastConnection
+	if weighted {
+		leastConn = WeightedLeastConnection
+	}
+	switch svc.SchedName {
+	case RoundRobin, WeightedRoundRobin:
+		if share := float64(p.Closing) / float64(p.Connections); share < longLivedShare {
+			change(leastConn, noSchedFlags, "%.0f%% of the connections are closing: connections are long lived, and round robin lets them pile up on some destinations", 100*share)
+		} else if dev := loadDeviation(p.Destinations); dev > maxLoadDeviation {
+			change(leastConn, noSchedFlags, "the connections per weight unit of the destinations deviate by %.0f%%: the load is skewed", 100*dev)
+		} else if weighted && svc.SchedName == RoundRobin {
+			change(WeightedRoundRobin, noSchedFlags, "the destinations have unequal weights, which rr ignores")
+		}
+	case LeastConnection:
+		if weighted {
+			change(WeightedLeastConnection, noSchedFlags, "the destinations have unequal weights, which lc ignores")
+		}
+	}
+	if !a.Change {
+		a.Rationale = append(a.Rationale, fmt.Sprintf("%s suits the traffic observed", svc.SchedName))
+	}
+	return a
+}
+
+// unequalWeights reports whether the available destinations of dsts have
+// different weights.
+func unequalWeights(dsts []*Destination) bool {
+	weight := 0
+	for _, d := range dsts {
+		if d.Weight <= 0 {
+			continue
+		}
+		if weight > 0 && d.Weight != weight {
+			return true
+		}
+		weight = d.Weight
+	}
+	return false
+}
+
+// loadDeviation returns the coefficient of variation of the active
+// connections per weight unit of the available destinations of dsts.
+func loadDeviation(dsts []*Destination) float64 {
+	var loads []float64
+	sum := 0.0
+	for _, d := range dsts {
+		if d.Weight > 0 {
+			load := float64(d.ActiveConnections) / float64(d.Weight)
+			loads = append(loads, load)
+			sum += load
+		}
+	}
+	if len(loads) < 2 || sum == 0 {
+		return 0
+	}
+
+	mean := sum / float64(len(loads))
+	variance := 0.0
+	for _, load := range loads {
+		variance += (load - mean) * (load - mean)
+	}
+	return math.Sqrt(variance/float64(len(loads))) / mean
+}
@@ -0,0 +1,73 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAdviseScheduler(t *testing.T) {
+	svc := &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.1"), Port: 80, SchedName: RoundRobin, Timeout: 300}
+	dsts := []*Destination{
+		{Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 1, ActiveConnections: 50},
+		{Address: net.ParseIP("10.1.0.2"), Port: 80, Weight: 1, ActiveConnections: 50},
+	}
+
+	// Short lived connections, evenly spread: rr is fine.
+	a := AdviseScheduler(&TrafficProfile{Service: svc, Destinations: dsts, Connections: 100, Closing: 60})
+	assert.Assert(t, !a.Change)
+	assert.Equal(t, a.Service.SchedName, RoundRobin)
+
+	// Long lived connections.
+	a = AdviseScheduler(&TrafficProfile{Service: svc, Destinations: dsts, Connections: 100, Closing: 5})
+	assert.Assert(t, a.Change)
+	assert.Equal(t, a.Service.SchedName, LeastConnection)
+	assert.Equal(t, a.Command(), "ipvsadm -E -t 10.0.0.1:80 -s lc")
+	assert.Equal(t, svc.SchedName, RoundRobin)
+
+	// Skewed load.
+	skewed := []*Destination{
+		{Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 1, ActiveConnections: 90},
+		{Address: net.ParseIP("10.1.0.2"), Port: 80, Weight: 2, ActiveConnections: 10},
+	}
+	a = AdviseScheduler(&TrafficProfile{Service: svc, Destinations: skewed, Connections: 100, Closing: 60})
+	assert.Equal(t, a.Service.SchedName, WeightedLeastConnection)
+	assert.Assert(t, strings.Contains(a.Rationale[0], "skewed"))
+
+	// Too few connections.
+	a = AdviseScheduler(&TrafficProfile{Service: svc, Destinations: dsts, Connections: 10})
+	assert.Assert(t, !a.Change)
+
+	// Persistence seldom reused.
+	persistent := *svc
+	persistent.Flags = SvcFlagPersistent
+	a = AdviseScheduler(&TrafficProfile{Service: &persistent, Destinations: dsts, Connections: 100, Templates: 90})
+	assert.Equal(t, a.Command(), "ipvsadm -E -t 10.0.0.1:80 -s mh -b mh-fallback")
+
+	// Hashing without fallback.
+	sh := *svc
+	sh.SchedName = SourceHashing
+	a = AdviseScheduler(&TrafficProfile{Service: &sh, Destinations: dsts})
+	assert.Equal(t, a.Command(), "ipvsadm -E -t 10.0.0.1:80 -s sh -b sh-fallback")
+}
+
+func TestGetTrafficProfile(t *testing.T) {
+	defer withConnTables(t, testTemplateTable, testConnSyncTable)()
+
+	f := &fakeHandler{destinations: []*Destination{{Address: net.ParseIP("10.1.0.1"), Port: 8080}}}
+	p, err := trafficProfile(f, &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.2"), Port: 80})
+	assert.NilError(t, err)
+	assert.Equal(t, p.Connections, 1)
+	assert.Equal(t, p.Templates, 1)
+	assert.Equal(t, len(p.Destinations), 1)
+
+	f.destinations = []*Destination{{Address: net.ParseIP("10.1.0.2"), Port: 8080}}
+	p, err = trafficProfile(f, &Service{FWMark: 1})
+	assert.NilError(t, err)
+	assert.Equal(t, p.Connections, 0)
+	assert.Equal(t, p.Templates, 1)
+}
@@ -0,0 +1,112 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"sort"
+	"syscall"
+	"time"
+)
+
+// AffinityReport tells which destination the clients of a persistent
+// service are pinned to.
+type AffinityReport struct {
+	Service *Service
+	// Timeout is the persistence timeout of the service, for which a
+	// template outlives the last connection of its clients.
+	Timeout time.Duration
+	// Entries are sorted by client network.
+	Entries []*AffinityEntry
+}
+
+// AffinityEntry pins the clients of a network, sized by the persistence
+// netmask of the service, to a destination.
+type AffinityEntry struct {
+	Clients     *net.IPNet
+	Destination Endpoint
+	// Expires is the time left before the template expires, as of the
+	// read of the table. The template is kept while its clients have
+	// connections to the service.
+	Expires time.Duration
+	// Assured reports whether the template saw traffic, only known by
+	// kernels 5.0 and later.
+	Assured bool
+}
+
+// Lookup returns the entry pinning client to a destination, nil if client
+// is not pinned: its next connection is scheduled.
+func (r *AffinityReport) Lookup(client net.IP) *AffinityEntry {
+	for _, e := range r.Entries {
+		if e.Clients.Contains(client) {
+			return e
+		}
+	}
+	return nil
+}
+
+// GetAffinityReports walks the persistence templates of the connection
+// table, see VisitConnections, and returns the report of every persistent
+// service of svcs, in the order of svcs. Services which are not persistent
+// are skipped.
+func GetAffinityReports(svcs []*Service) ([]*AffinityReport, error) {
+	var reports []*AffinityReport
+	for _, s := range svcs {
+		if s.Flags.Has(SvcFlagPersistent) {
+			reports = append(reports, &AffinityReport{Service: s, Timeout: time.Duration(s.Timeout) * time.Second})
+		}
+	}
+	if len(reports) == 0 {
+		return nil, nil
+	}
+
+	err := VisitConnections(func(c *Connection) bool {
+		if !c.IsTemplate {
+			return true
+		}
+		for _, r := range reports {
+			if templateOf(c, r.Service) {
+				r.Entries = append(r.Entries, &AffinityEntry{
+					Clients:     persistenceNetwork(r.Service, c.Client.Address),
+					Destination: c.Destination,
+					Expires:     c.Expires,
+					Assured:     c.State == ConnectionStateAssured,
+				})
+				break
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, r := range reports {
+		entries := r.Entries
+		sort.Slice(entries, func(a, b int) bool {
+			return entries[a].Clients.String() < entries[b].Clients.String()
+		})
+	}
+	return reports, nil
+}
+
+// persistenceNetwork returns the network of the clients sharing the
+// persistence template of client for s.
+func persistenceNetwork(s *Service, client net.IP) *net.IPNet {
+	var mask net.IPMask
+	if v4 := client.To4(); v4 != nil {
+		client = v4
+		m := s.Netmask
+		if s.AddressFamily == syscall.AF_INET6 {
+			m = fullNetmask(syscall.AF_INET)
+		}
+		mask = net.IPv4Mask(byte(m>>24), byte(m>>16), byte(m>>8), byte(m))
+	} else {
+		plen := int(s.Netmask)
+		if s.AddressFamily != syscall.AF_INET6 || plen > 8*net.IPv6len {
+			plen = 8 * net.IPv6len
+		}
+		mask = net.CIDRMask(plen, 8*net.IPv6len)
+	}
+	return &net.IPNet{IP: client.Mask(mask), Mask: mask}
+}
@@ -0,0 +1,42 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestGetAffinityReports(t *testing.T) {
+	defer withConnTables(t, testTemplateTable, testConnSyncTable)()
+
+	svcs := []*Service{
+		{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.2"), Port: 80, Flags: SvcFlagPersistent, Timeout: 300, Netmask: 0xFFFFFF00},
+		{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.3"), Port: 80},
+		{FWMark: 1, Flags: SvcFlagPersistent, Timeout: 60, Netmask: 0xFFFFFFFF},
+	}
+	reports, err := GetAffinityReports(svcs)
+	assert.NilError(t, err)
+	assert.Equal(t, len(reports), 2)
+
+	r := reports[0]
+	assert.Equal(t, r.Service, svcs[0])
+	assert.Equal(t, r.Timeout, 300*time.Second)
+	assert.Equal(t, len(r.Entries), 1)
+	assert.Equal(t, r.Entries[0].Clients.String(), "10.0.0.0/24")
+	assert.Equal(t, r.Entries[0].Destination.String(), "10.1.0.1:8080")
+	assert.Equal(t, r.Lookup(net.ParseIP("10.0.0.42")), r.Entries[0])
+	assert.Assert(t, r.Lookup(net.ParseIP("10.0.1.1")) == nil)
+
+	r = reports[1]
+	assert.Equal(t, len(r.Entries), 1)
+	assert.Equal(t, r.Entries[0].Clients.String(), "10.0.0.6/32")
+	assert.Assert(t, r.Entries[0].Assured)
+
+	reports, err = GetAffinityReports(svcs[1:2])
+	assert.NilError(t, err)
+	assert.Equal(t, len(reports), 0)
+}
@@ -0,0 +1,131 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+// AlertRule is a user supplied condition on the statistics of services or
+// destinations. Predicates are passed the sample of the previous snapshot,
+// nil if the service or destination was not in it, and the current one.
+type AlertRule struct {
+	Name string
+
+	// Service, if set, is evaluated on every service.
+	Service func(prev, cur *Service) bool
+
+	// Destination, if set, is evaluated on every destination of every
+	// service.
+	Destination func(s *Service, prev, cur *Destination) bool
+}
+
+// Alert reports a rule whose predicate became true for a service, or one of
+// its destinations.
+type Alert struct {
+	Rule    string
+	Time    time.Time
+	Service *Service
+
+	// Destination is nil for the alerts raised by service predicates.
+	Destination *Destination
+}
+
+// String returns a string representation of an alert
+func (a *Alert) String() string {
+	if a.Destination != nil {
+		return fmt.Sprintf("%s: %s destination %s", a.Rule, a.Service, destinationAddr(a.Destination, a.Destination.Port))
+	}
+	return fmt.Sprintf("%s: %s", a.Rule, a.Service)
+}
+
+// InactiveConnectionsAbove returns a rule matching the destinations with more
+// than n inactive connections, e.g. real servers accepting connections but
+// never answering, which health checks connecting to them miss.
+func InactiveConnectionsAbove(n int) AlertRule {
+	return AlertRule{
+		Name: fmt.Sprintf("InactiveConnectionsAbove(%d)", n),
+		Destination: func(_ *Service, _, cur *Destination) bool {
+			return cur.InactiveConnections > n
+		},
+	}
+}
+
+// CPSDropAbove returns a rule matching the services whose rate of new
+// connections dropped by more than fraction, e.g. 0.5 for 50%, since the
+// previous snapshot.
+func CPSDropAbove(fraction float64) AlertRule {
+	return AlertRule{
+		Name: fmt.Sprintf("CPSDropAbove(%g)", fraction),
+		Service: func(prev, cur *Service) bool {
+			return prev != nil && prev.Stats.CPS > 0 &&
+				float64(cur.Stats.CPS) < float64(prev.Stats.CPS)*(1-fraction)
+		},
+	}
+}
+
+// AlertWatcher evaluates rules against successive stats snapshots, e.g. fed
+// by a Poller. An alert is raised when a predicate becomes true, and again
+// only once it has been false in between.
+//
+// The zero value is ready to use with no rules.
+type AlertWatcher struct {
+	Rules []AlertRule
+
+	// Bus, if set, receives an EventAlert event for every alert.
+	Bus *EventBus
+
+	mu     sync.Mutex
+	prev   *StatsSnapshot
+	firing map[string]bool
+}
+
+// Observe evaluates the rules against snap and returns the alerts raised.
+func (w *AlertWatcher) Observe(snap *StatsSnapshot) []*Alert {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	firing := make(map[string]bool)
+	var alerts []*Alert
+	check := func(rule string, s *Service, d *Destination, match bool) {
+		if !match {
+			return
+		}
+		key := rule + "|" + seriesKey(s, d)
+		firing[key] = true
+		if !w.firing[key] {
+			alerts = append(alerts, &Alert{Rule: rule, Time: snap.Time, Service: s, Destination: d})
+		}
+	}
+
+	for _, sd := range snap.Services {
+		before := w.prev.service(sd.Service)
+		var prev *Service
+		if before != nil {
+			prev = before.Service
+		}
+
+		for _, r := range w.Rules {
+			if r.Service != nil {
+				check(r.Name, sd.Service, nil, r.Service(prev, sd.Service))
+			}
+			if r.Destination == nil {
+				continue
+			}
+			for _, d := range sd.Destinations {
+				check(r.Name, sd.Service, d, r.Destination(sd.Service, before.destination(d), d))
+			}
+		}
+	}
+
+	w.prev = snap
+	w.firing = firing
+	if w.Bus != nil {
+		for _, a := range alerts {
+			w.Bus.Publish(Event{Type: EventAlert, Time: a.Time, Service: a.Service, Destination: a.Destination, Alert: a})
+		}
+	}
+	return alerts
+}
@@ -0,0 +1,55 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAlertWatcher(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	snapshot := func(cps uint64, inactive int) *StatsSnapshot {
+		s := *svc
+		s.Stats.CPS = cps
+		return &StatsSnapshot{
+			Time: time.Now(),
+			Services: []*ServiceDestinations{{
+				Service: &s,
+				Destinations: []*Destination{
+					{Address: net.ParseIP("10.1.0.1"), Port: 80, InactiveConnections: inactive},
+					{Address: net.ParseIP("10.1.0.2"), Port: 80},
+				},
+			}},
+		}
+	}
+
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(10)
+	defer cancel()
+
+	w := &AlertWatcher{Rules: []AlertRule{InactiveConnectionsAbove(100), CPSDropAbove(0.5)}, Bus: bus}
+	assert.Equal(t, len(w.Observe(snapshot(100, 10))), 0)
+
+	alerts := w.Observe(snapshot(40, 500))
+	assert.Equal(t, len(alerts), 2)
+	assert.Equal(t, alerts[0].Rule, "InactiveConnectionsAbove(100)")
+	assert.Equal(t, alerts[0].Destination.Address.String(), "10.1.0.1")
+	assert.Equal(t, alerts[1].Rule, "CPSDropAbove(0.5)")
+	assert.Assert(t, alerts[1].Destination == nil)
+	assert.Equal(t, alerts[1].String(), "CPSDropAbove(0.5): TCP 10.0.0.1:80 ()")
+
+	e := <-events
+	assert.Equal(t, e.Type, EventAlert)
+	assert.Equal(t, e.Alert, alerts[0])
+
+	// Still firing: no new alert until the condition clears.
+	assert.Equal(t, len(w.Observe(snapshot(40, 500))), 0)
+	assert.Equal(t, len(w.Observe(snapshot(40, 10))), 0)
+	alerts = w.Observe(snapshot(40, 500))
+	assert.Equal(t, len(alerts), 1)
+	assert.Equal(t, alerts[0].Rule, "InactiveConnectionsAbove(100)")
+}
@@ -0,0 +1,271 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+// AnomalyMetric identifies the service metric an anomaly was detected on.
+type AnomalyMetric int
+
+const (
+	// AnomalyCPS is the rate of new connections of the service, as
+	// estimated by the kernel.
+	AnomalyCPS AnomalyMetric = iota + 1
+
+	// AnomalyInactiveRatio is the fraction of the service connections, over
+	// all destinations, which are inactive.
+	AnomalyInactiveRatio
+
+	// AnomalyLaddrConflicts is the rate at which the local addresses of a
+	// fullnat service run into port conflicts.
+	AnomalyLaddrConflicts
+)
+
+var anomalyMetricNames = map[AnomalyMetric]string{
+	AnomalyCPS:            "CPS",
+	AnomalyInactiveRatio:  "InactiveRatio",
+	AnomalyLaddrConflicts: "LaddrConflicts",
+}
+
+// String returns the name of the metric
+func (m AnomalyMetric) String() string {
+	if name, ok := anomalyMetricNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("AnomalyMetric(%d)", int(m))
+}
+
+// Anomaly describes a sample deviating sharply from the recent baseline of a
+// service metric.
+type Anomaly struct {
+	Service *Service
+	Metric  AnomalyMetric
+
+	// Value is the observed sample, Mean and StdDev describe the baseline
+	// it was compared with.
+	Value  float64
+	Mean   float64
+	StdDev float64
+
+	// ZScore is the distance between Value and Mean in standard
+	// deviations, positive for an increase.
+	ZScore float64
+}
+
+// String returns a string representation of an anomaly
+func (a *Anomaly) String() string {
+	return fmt.Sprintf("%s: %s %.2f (baseline %.2f, z-score %.1f)", a.Service, a.Metric, a.Value, a.Mean, a.ZScore)
+}
+
+// Default anomaly detector settings.
+const (
+	DefaultAnomalyAlpha      = 0.1
+	DefaultAnomalyThreshold  = 3.0
+	DefaultAnomalyMinSamples = 10
+)
+
+// AnomalyDetector tracks an exponentially weighted moving average and
+// variance of service metrics and flags the samples whose z-score against
+// that baseline exceeds a threshold. Samples are fed from stats snapshots
+// with Observe, and from local address dumps with ObserveLocalAddresses.
+// The baselines of the services missing from a snapshot are dropped by
+// Observe.
+//
+// The zero value is ready to use with the default settings.
+type AnomalyDetector struct {
+	// Alpha is the weight of a new sample in the moving average, between 0
+	// and 1. Defaults to DefaultAnomalyAlpha.
+	Alpha float64
+
+	// Threshold is the absolute z-score above which a sample is anomalous.
+	// Defaults to DefaultAnomalyThreshold.
+	Threshold float64
+
+	// MinSamples is the number of samples a baseline needs before samples
+	// are checked against it. Defaults to DefaultAnomalyMinSamples.
+	MinSamples int
+
+	// Bus, if set, receives an EventAnomaly event for every anomaly.
+	Bus *EventBus
+
+	mu        sync.Mutex
+	baselines map[string]map[AnomalyMetric]*baseline
+	conflicts map[string]laddrSample
+}
+
+// baseline is the exponentially weighted mean and variance of a metric.
+type baseline struct {
+	n        int
+	mean     float64
+	variance float64
+}
+
+// laddrSample is the total of the conflict counters of the local addresses
+// of a service at a given time.
+type laddrSample struct {
+	time      time.Time
+	conflicts uint64
+}
+
+// Observe checks the CPS and inactive connection ratio of every service of
+// snap against their baseline, updates the baselines and returns the
+// anomalies found.
+func (ad *AnomalyDetector) Observe(snap *StatsSnapshot) []*Anomaly {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	var anomalies []*Anomaly
+	present := make(map[string]bool, len(snap.Services))
+	for _, sd := range snap.Services {
+		present[serviceKey(sd.Service)] = true
+		if a := ad.observe(sd.Service, AnomalyCPS, float64(sd.Service.Stats.CPS)); a != nil {
+			anomalies = append(anomalies, a)
+		}
+
+		var active, inactive int
+		for _, d := range sd.Destinations {
+			active += d.ActiveConnections
+			inactive += d.InactiveConnections
+		}
+		if active+inactive == 0 {
+			continue
+		}
+		ratio := float64(inactive) / float64(active+inactive)
+		if a := ad.observe(sd.Service, AnomalyInactiveRatio, ratio); a != nil {
+			anomalies = append(anomalies, a)
+		}
+	}
+
+	for key := range ad.baselines {
+		if !present[key] {
+			delete(ad.baselines, key)
+		}
+	}
+	for key := range ad.conflicts {
+		if !present[key] {
+			delete(ad.conflicts, key)
+		}
+	}
+
+	ad.publish(snap.Time, anomalies)
+	return anomalies
+}
+
+// ObserveLocalAddresses checks the rate of local address conflicts of s,
+// computed from the conflict counters of laddrs sampled at t, against its
+// baseline. The first call for a service only records the counters.
+func (ad *AnomalyDetector) ObserveLocalAddresses(t time.Time, s *Service, laddrs []*LocalAddress) *Anomaly {
+	ad.mu.Lock()
+	defer ad.mu.Unlock()
+
+	var total uint64
+	for _, l := range laddrs {
+		total += l.Conflicts
+	}
+
+	if ad.conflicts == nil {
+		ad.conflicts = make(map[string]laddrSample)
+	}
+	key := serviceKey(s)
+	prev, ok := ad.conflicts[key]
+	ad.conflicts[key] = laddrSample{time: t, conflicts: total}
+	if !ok || !t.After(prev.time) {
+		return nil
+	}
+
+	rate := float64(counterDelta(prev.conflicts, total)) / t.Sub(prev.time).Seconds()
+	a := ad.observe(s, AnomalyLaddrConflicts, rate)
+	if a != nil {
+		ad.publish(t, []*Anomaly{a})
+	}
+	return a
+}
+
+// minAnomalyStdDev is the smallest standard deviation assumed for the
+// baseline of each metric, so that the small changes of a flat baseline,
+// e.g. the first connection of an idle service, are not anomalous.
+var minAnomalyStdDev = map[AnomalyMetric]float64{
+	AnomalyCPS:            1,
+	AnomalyInactiveRatio:  0.05,
+	AnomalyLaddrConflicts: 1,
+}
+
+// observe checks v against the baseline of metric m of s, then folds v into
+// the baseline.
+func (ad *AnomalyDetector) observe(s *Service, m AnomalyMetric, v float64) *Anomaly {
+	if ad.baselines == nil {
+		ad.baselines = make(map[string]map[AnomalyMetric]*baseline)
+	}
+	key := serviceKey(s)
+	metrics, ok := ad.baselines[key]
+	if !ok {
+		metrics = make(map[AnomalyMetric]*baseline)
+		ad.baselines[key] = metrics
+	}
+	b, ok := metrics[m]
+	if !ok {
+		metrics[m] = &baseline{n: 1, mean: v}
+		return nil
+	}
+
+	var a *Anomaly
+	if b.n >= ad.minSamples() {
+		stddev := math.Sqrt(b.variance)
+		z := (v - b.mean) / math.Max(stddev, minAnomalyStdDev[m])
+		if math.Abs(z) > ad.threshold() {
+			svc := *s
+			a = &Anomaly{Service: &svc, Metric: m, Value: v, Mean: b.mean, StdDev: stddev, ZScore: z}
+		}
+	}
+
+	// The first samples are averaged evenly, so that the baseline does not
+	// start with a variance biased towards zero.
+	b.n++
+	diff := v - b.mean
+	if b.n <= ad.minSamples() {
+		b.mean += diff / float64(b.n)
+		b.variance = (float64(b.n-1)*b.variance + diff*(v-b.mean)) / float64(b.n)
+	} else {
+		alpha := ad.alpha()
+		incr := alpha * diff
+		b.mean += incr
+		b.variance = (1 - alpha) * (b.variance + diff*incr)
+	}
+
+	return a
+}
+
+func (ad *AnomalyDetector) publish(t time.Time, anomalies []*Anomaly) {
+	if ad.Bus == nil {
+		return
+	}
+	for _, a := range anomalies {
+		ad.Bus.Publish(Event{Type: EventAnomaly, Time: t, Service: a.Service, Anomaly: a})
+	}
+}
+
+func (ad *AnomalyDetector) alpha() float64 {
+	if ad.Alpha <= 0 || ad.Alpha > 1 {
+		return DefaultAnomalyAlpha
+	}
+	return ad.Alpha
+}
+
+func (ad *AnomalyDetector) threshold() float64 {
+	if ad.Threshold <= 0 {
+		return DefaultAnomalyThreshold
+	}
+	return ad.Threshold
+}
+
+func (ad *AnomalyDetector) minSamples() int {
+	if ad.MinSamples <= 0 {
+		return DefaultAnomalyMinSamples
+	}
+	return ad.MinSamples
+}
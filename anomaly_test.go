@@ -0,0 +1,97 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAnomalyDetector(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	snapshot := func(cps uint64, active, inactive int) *StatsSnapshot {
+		s := *svc
+		s.Stats.CPS = cps
+		return &StatsSnapshot{
+			Time: time.Now(),
+			Services: []*ServiceDestinations{{
+				Service: &s,
+				Destinations: []*Destination{
+					{Address: net.ParseIP("10.1.0.1"), Port: 80, ActiveConnections: active, InactiveConnections: inactive},
+				},
+			}},
+		}
+	}
+
+	bus := NewEventBus()
+	events, cancel := bus.Subscribe(10)
+	defer cancel()
+
+	ad := &AnomalyDetector{MinSamples: 5, Bus: bus}
+	for n := 0; n < 10; n++ {
+		cps := uint64(100 + n%3)
+		anomalies := ad.Observe(snapshot(cps, 90+n%3, 10))
+		assert.Equal(t, len(anomalies), 0, "sample %d", n)
+	}
+
+	anomalies := ad.Observe(snapshot(1000, 90, 10))
+	assert.Equal(t, len(anomalies), 1)
+	assert.Equal(t, anomalies[0].Metric, AnomalyCPS)
+	assert.Equal(t, anomalies[0].Value, 1000.0)
+	assert.Assert(t, anomalies[0].ZScore > 3)
+
+	e := <-events
+	assert.Equal(t, e.Type, EventAnomaly)
+	assert.Equal(t, e.Anomaly, anomalies[0])
+
+	anomalies = ad.Observe(snapshot(101, 10, 90))
+	assert.Equal(t, len(anomalies), 1)
+	assert.Equal(t, anomalies[0].Metric, AnomalyInactiveRatio)
+}
+
+func TestAnomalyDetectorLocalAddresses(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	laddrs := func(conflicts uint64) []*LocalAddress {
+		return []*LocalAddress{
+			{Address: net.ParseIP("10.2.0.1"), Conflicts: conflicts / 2},
+			{Address: net.ParseIP("10.2.0.2"), Conflicts: conflicts - conflicts/2},
+		}
+	}
+
+	ad := &AnomalyDetector{MinSamples: 3}
+	now := time.Now()
+	var conflicts uint64
+	for n := 0; n < 6; n++ {
+		conflicts += 10 + uint64(n%2)
+		now = now.Add(time.Second)
+		assert.Assert(t, ad.ObserveLocalAddresses(now, svc, laddrs(conflicts)) == nil, "sample %d", n)
+	}
+
+	conflicts += 500
+	a := ad.ObserveLocalAddresses(now.Add(time.Second), svc, laddrs(conflicts))
+	assert.Assert(t, a != nil)
+	assert.Equal(t, a.Metric, AnomalyLaddrConflicts)
+	assert.Equal(t, a.Value, 500.0)
+}
+
+func TestAnomalyDetectorFlatBaseline(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	snapshot := func(cps uint64) *StatsSnapshot {
+		s := *svc
+		s.Stats.CPS = cps
+		return &StatsSnapshot{Time: time.Now(), Services: []*ServiceDestinations{{Service: &s}}}
+	}
+
+	ad := &AnomalyDetector{MinSamples: 3}
+	for n := 0; n < 5; n++ {
+		assert.Equal(t, len(ad.Observe(snapshot(0))), 0, "sample %d", n)
+	}
+	assert.Equal(t, len(ad.Observe(snapshot(1))), 0)
+	assert.Equal(t, len(ad.Observe(snapshot(100))), 1)
+
+	ad.Observe(&StatsSnapshot{Time: time.Now()})
+	assert.Equal(t, len(ad.baselines), 0)
+}
@@ -0,0 +1,88 @@
+// +build linux
+
+package ipvs
+
+// HealthFunc reports the health check result of a destination of s. known
+// is false when no result is available for it.
+type HealthFunc func(s *Service, d *Destination) (healthy, known bool)
+
+// AvailabilityScore rates how able a destination is to serve traffic, from
+// 0 (unavailable) to 100 (fully available).
+type AvailabilityScore struct {
+	Service     *Service
+	Destination *Destination
+	Score       int
+}
+
+// Scorer computes availability scores from stats snapshots. The collector
+// of package github.com/kwanhur/ipvs/prometheus exports them as a gauge.
+type Scorer struct {
+	// Health, if set, provides health check results. A destination known
+	// to be unhealthy always scores 0.
+	Health HealthFunc
+}
+
+const (
+	// inactivePenalty is the score lost by a destination whose
+	// connections are all inactive.
+	inactivePenalty = 40
+
+	// trendPenalty is the score lost by a destination which lost all its
+	// active connections while still being sent new ones.
+	trendPenalty = 40
+)
+
+// Score returns the availability score of every destination of cur. prev is
+// used to compute connection trends and may be nil.
+//
+// A destination with a null weight does not receive new connections and
+// scores 0. Otherwise the score starts at 100 and decreases with the ratio
+// of inactive connections, and with the fraction of active connections lost
+// since prev while new connections kept being scheduled to the destination,
+// the usual symptoms of a real server accepting but not serving requests.
+func (sc *Scorer) Score(prev, cur *StatsSnapshot) []*AvailabilityScore {
+	var scores []*AvailabilityScore
+
+	for _, sd := range cur.Services {
+		var before *ServiceDestinations
+		if prev != nil {
+			before = prev.service(sd.Service)
+		}
+
+		for _, d := range sd.Destinations {
+			scores = append(scores, &AvailabilityScore{
+				Service:     sd.Service,
+				Destination: d,
+				Score:       sc.score(sd.Service, before.destination(d), d),
+			})
+		}
+	}
+
+	return scores
+}
+
+func (sc *Scorer) score(s *Service, prev, d *Destination) int {
+	if d.Weight <= 0 {
+		return 0
+	}
+	if sc.Health != nil {
+		if healthy, known := sc.Health(s, d); known && !healthy {
+			return 0
+		}
+	}
+
+	score := 100.0
+	if total := d.ActiveConnections + d.InactiveConnections; total > 0 {
+		score -= inactivePenalty * float64(d.InactiveConnections) / float64(total)
+	}
+	if prev != nil && prev.ActiveConnections > d.ActiveConnections &&
+		d.Stats.Connections > prev.Stats.Connections {
+		lost := prev.ActiveConnections - d.ActiveConnections
+		score -= trendPenalty * float64(lost) / float64(prev.ActiveConnections)
+	}
+
+	if score < 0 {
+		return 0
+	}
+	return int(score + 0.5)
+}
@@ -0,0 +1,63 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestScorer(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	dst := func(ip string, weight, active, inactive int, conns uint64) *Destination {
+		return &Destination{
+			Address:             net.ParseIP(ip),
+			Port:                80,
+			Weight:              weight,
+			ActiveConnections:   active,
+			InactiveConnections: inactive,
+			Stats:               DstStats{Connections: conns},
+		}
+	}
+	snapshot := func(dsts ...*Destination) *StatsSnapshot {
+		return &StatsSnapshot{Services: []*ServiceDestinations{{Service: svc, Destinations: dsts}}}
+	}
+
+	prev := snapshot(
+		dst("10.1.0.1", 1, 10, 0, 100),
+		dst("10.1.0.2", 1, 10, 0, 100),
+		dst("10.1.0.3", 1, 10, 0, 100),
+		dst("10.1.0.4", 0, 10, 0, 100),
+		dst("10.1.0.5", 1, 10, 0, 100),
+	)
+	cur := snapshot(
+		dst("10.1.0.1", 1, 10, 0, 200), // healthy
+		dst("10.1.0.2", 1, 5, 5, 200),  // half inactive, lost half its active connections
+		dst("10.1.0.3", 1, 0, 10, 200), // lost every active connection
+		dst("10.1.0.4", 0, 10, 0, 100), // quiesced
+		dst("10.1.0.5", 1, 10, 0, 200), // failing health checks
+	)
+
+	sc := &Scorer{
+		Health: func(s *Service, d *Destination) (bool, bool) {
+			if d.Address.Equal(net.ParseIP("10.1.0.5")) {
+				return false, true
+			}
+			return false, false
+		},
+	}
+
+	var got []int
+	for _, s := range sc.Score(prev, cur) {
+		got = append(got, s.Score)
+	}
+	assert.DeepEqual(t, got, []int{100, 60, 20, 0, 0})
+
+	got = nil
+	for _, s := range (&Scorer{}).Score(nil, cur) {
+		got = append(got, s.Score)
+	}
+	assert.DeepEqual(t, got, []int{100, 80, 60, 0, 100})
+}
@@ -0,0 +1,348 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"net"
+	"sync"
+	"time"
+)
+
+// CachedHandler is a Handler serving service, destination and local address
+// reads from a cache, for read heavy components like exporters. Entries are
+// populated by dumps and expire after a TTL. Mutations made through the
+// CachedHandler invalidate the entries they affect; mutations made by other
+// handles of the process can be followed with Watch, and any other change
+// is only seen once the entries expire.
+//
+// Objects returned from the cache are copies and may be modified by the
+// caller.
+type CachedHandler struct {
+	Handler
+
+	ttl time.Duration
+	now func() time.Time
+
+	// mu guards the entries, but is not held during the dumps filling them:
+	// gen counts the invalidations, so that a dump which may have missed
+	// one is not cached.
+	mu           sync.Mutex
+	gen          uint64
+	services     *cacheEntry
+	destinations map[string]*cacheEntry
+	laddrs       map[string]*cacheEntry
+}
+
+var _ Handler = (*CachedHandler)(nil)
+
+type cacheEntry struct {
+	expires time.Time
+	value   interface{}
+}
+
+// NewCachedHandler returns a CachedHandler caching the reads of h for ttl.
+func NewCachedHandler(h Handler, ttl time.Duration) *CachedHandler {
+	return &CachedHandler{
+		Handler:      h,
+		ttl:          ttl,
+		now:          time.Now,
+		destinations: make(map[string]*cacheEntry),
+		laddrs:       make(map[string]*cacheEntry),
+	}
+}
+
+// fresh returns the value of e if it has not expired.
+func (c *CachedHandler) fresh(e *cacheEntry) (interface{}, bool) {
+	if e == nil || !c.now().Before(e.expires) {
+		return nil, false
+	}
+	return e.value, true
+}
+
+func (c *CachedHandler) entry(v interface{}) *cacheEntry {
+	return &cacheEntry{expires: c.now().Add(c.ttl), value: v}
+}
+
+// load returns the value of the entry returned by get if fresh. Otherwise
+// it returns the value dumped by dump, and caches it with set unless the
+// cache was invalidated during the dump. The cached values are shared and
+// must be copied before being returned to the caller.
+func (c *CachedHandler) load(get func() *cacheEntry, set func(*cacheEntry), dump func() (interface{}, error)) (interface{}, error) {
+	c.mu.Lock()
+	v, ok := c.fresh(get())
+	gen := c.gen
+	c.mu.Unlock()
+	if ok {
+		return v, nil
+	}
+
+	v, err := dump()
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	if c.gen == gen {
+		set(c.entry(v))
+	}
+	c.mu.Unlock()
+	return v, nil
+}
+
+// GetServices returns the services, from the cache if fresh.
+func (c *CachedHandler) GetServices() ([]*Service, error) {
+	v, err := c.load(
+		func() *cacheEntry { return c.services },
+		func(e *cacheEntry) { c.services = e },
+		func() (interface{}, error) { return c.Handler.GetServices() })
+	if err != nil {
+		return nil, err
+	}
+	return copyServices(v.([]*Service)), nil
+}
+
+// GetService returns the service matching s, from the cache if fresh.
+func (c *CachedHandler) GetService(s *Service) (*Service, error) {
+	c.mu.Lock()
+	v, ok := c.fresh(c.services)
+	if ok {
+		key := serviceKey(s)
+		for _, svc := range v.([]*Service) {
+			if serviceKey(svc) == key {
+				c.mu.Unlock()
+				return copyService(svc), nil
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	// Let the handler report the error of a missing service.
+	return c.Handler.GetService(s)
+}
+
+// IsServicePresent reports whether s exists, from the cache if fresh.
+func (c *CachedHandler) IsServicePresent(s *Service) bool {
+	c.mu.Lock()
+	v, ok := c.fresh(c.services)
+	c.mu.Unlock()
+	if !ok {
+		return c.Handler.IsServicePresent(s)
+	}
+
+	key := serviceKey(s)
+	for _, svc := range v.([]*Service) {
+		if serviceKey(svc) == key {
+			return true
+		}
+	}
+	return false
+}
+
+// GetDestinations returns the destinations of s, from the cache if fresh.
+func (c *CachedHandler) GetDestinations(s *Service) ([]*Destination, error) {
+	key := serviceKey(s)
+	v, err := c.load(
+		func() *cacheEntry { return c.destinations[key] },
+		func(e *cacheEntry) { c.destinations[key] = e },
+		func() (interface{}, error) { return c.Handler.GetDestinations(s) })
+	if err != nil {
+		return nil, err
+	}
+	return copyDestinations(v.([]*Destination)), nil
+}
+
+// GetLocalAddresses returns the local addresses of s, from the cache if
+// fresh.
+func (c *CachedHandler) GetLocalAddresses(s *Service) ([]*LocalAddress, error) {
+	key := serviceKey(s)
+	v, err := c.load(
+		func() *cacheEntry { return c.laddrs[key] },
+		func(e *cacheEntry) { c.laddrs[key] = e },
+		func() (interface{}, error) { return c.Handler.GetLocalAddresses(s) })
+	if err != nil {
+		return nil, err
+	}
+	return copyLocalAddresses(v.([]*LocalAddress)), nil
+}
+
+// NewService creates s and invalidates the cached services.
+func (c *CachedHandler) NewService(s *Service) error {
+	defer c.invalidateService(s)
+	return c.Handler.NewService(s)
+}
+
+// UpdateService updates s and invalidates the cached services.
+func (c *CachedHandler) UpdateService(s *Service) error {
+	defer c.invalidateService(s)
+	return c.Handler.UpdateService(s)
+}
+
+// DelService deletes s and invalidates the cached services and the entries
+// of s.
+func (c *CachedHandler) DelService(s *Service) error {
+	defer c.invalidateService(s)
+	return c.Handler.DelService(s)
+}
+
+// Flush deletes every service and invalidates the whole cache.
+func (c *CachedHandler) Flush() error {
+	defer c.Invalidate()
+	return c.Handler.Flush()
+}
+
+// ZeroService zeroes the counters of s and invalidates the entries holding
+// them.
+func (c *CachedHandler) ZeroService(s *Service) error {
+	defer c.invalidateService(s)
+	return c.Handler.ZeroService(s)
+}
+
+// Zero zeroes every counter and invalidates the whole cache.
+func (c *CachedHandler) Zero() error {
+	defer c.Invalidate()
+	return c.Handler.Zero()
+}
+
+// NewDestination creates d and invalidates the cached destinations of s.
+func (c *CachedHandler) NewDestination(s *Service, d *Destination) error {
+	defer c.invalidateDestinations(s)
+	return c.Handler.NewDestination(s, d)
+}
+
+// UpdateDestination updates d and invalidates the cached destinations of s.
+func (c *CachedHandler) UpdateDestination(s *Service, d *Destination) error {
+	defer c.invalidateDestinations(s)
+	return c.Handler.UpdateDestination(s, d)
+}
+
+// DelDestination deletes d and invalidates the cached destinations of s.
+func (c *CachedHandler) DelDestination(s *Service, d *Destination) error {
+	defer c.invalidateDestinations(s)
+	return c.Handler.DelDestination(s, d)
+}
+
+// NewLocalAddress creates l and invalidates the cached local addresses of s.
+func (c *CachedHandler) NewLocalAddress(s *Service, l *LocalAddress) error {
+	defer c.invalidateLocalAddresses(s)
+	return c.Handler.NewLocalAddress(s, l)
+}
+
+// DelLocalAddress deletes l and invalidates the cached local addresses of s.
+func (c *CachedHandler) DelLocalAddress(s *Service, l *LocalAddress) error {
+	defer c.invalidateLocalAddresses(s)
+	return c.Handler.DelLocalAddress(s, l)
+}
+
+// Invalidate empties the cache.
+func (c *CachedHandler) Invalidate() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.gen++
+	c.services = nil
+	c.destinations = make(map[string]*cacheEntry)
+	c.laddrs = make(map[string]*cacheEntry)
+}
+
+func (c *CachedHandler) invalidateService(s *Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := serviceKey(s)
+	c.gen++
+	c.services = nil
+	delete(c.destinations, key)
+	delete(c.laddrs, key)
+}
+
+func (c *CachedHandler) invalidateDestinations(s *Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	delete(c.destinations, serviceKey(s))
+}
+
+func (c *CachedHandler) invalidateLocalAddresses(s *Service) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.gen++
+	delete(c.laddrs, serviceKey(s))
+}
+
+// Watch invalidates the entries affected by the events received on events,
+// typically subscribed to the EventBus of the other handles of the process,
+// until the channel is closed or ctx is done.
+func (c *CachedHandler) Watch(ctx context.Context, events <-chan Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			c.invalidateEvent(e)
+		}
+	}
+}
+
+func (c *CachedHandler) invalidateEvent(e Event) {
+	switch e.Type {
+	case EventServiceAdded, EventServiceUpdated, EventServiceDeleted:
+		c.invalidateService(e.Service)
+	case EventDestinationAdded, EventDestinationUpdated, EventDestinationDeleted:
+		c.invalidateDestinations(e.Service)
+	case EventLocalAddressAdded, EventLocalAddressDeleted:
+		c.invalidateLocalAddresses(e.Service)
+	case EventZeroed:
+		if e.Service != nil {
+			c.invalidateService(e.Service)
+		} else {
+			c.Invalidate()
+		}
+	case EventFlushed:
+		c.Invalidate()
+	}
+}
+
+// copyService returns a deep copy of s, which does not share its address.
+func copyService(s *Service) *Service {
+	svc := *s
+	svc.Address = copyIP(s.Address)
+	return &svc
+}
+
+func copyServices(svcs []*Service) []*Service {
+	res := make([]*Service, len(svcs))
+	for n, s := range svcs {
+		res[n] = copyService(s)
+	}
+	return res
+}
+
+func copyDestinations(dsts []*Destination) []*Destination {
+	res := make([]*Destination, len(dsts))
+	for n, d := range dsts {
+		dst := *d
+		dst.Address = copyIP(d.Address)
+		res[n] = &dst
+	}
+	return res
+}
+
+func copyLocalAddresses(laddrs []*LocalAddress) []*LocalAddress {
+	res := make([]*LocalAddress, len(laddrs))
+	for n, l := range laddrs {
+		laddr := *l
+		laddr.Address = copyIP(l.Address)
+		res[n] = &laddr
+	}
+	return res
+}
+
+func copyIP(ip net.IP) net.IP {
+	if ip == nil {
+		return nil
+	}
+	return append(net.IP(nil), ip...)
+}
@@ -0,0 +1,145 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// fakeHandler records the dumps it serves. Unimplemented methods panic.
+type fakeHandler struct {
+	Handler
+
+	services     []*Service
+	destinations []*Destination
+	dumps        int
+	// onDump, if set, is called during the dumps.
+	onDump func()
+}
+
+func (f *fakeHandler) GetServices() ([]*Service, error) {
+	f.dumps++
+	if f.onDump != nil {
+		f.onDump()
+	}
+	return f.services, nil
+}
+
+func (f *fakeHandler) GetDestinations(s *Service) ([]*Destination, error) {
+	f.dumps++
+	return f.destinations, nil
+}
+
+func (f *fakeHandler) NewService(s *Service) error {
+	f.services = append(f.services, s)
+	return nil
+}
+
+func (f *fakeHandler) NewDestination(s *Service, d *Destination) error {
+	f.destinations = append(f.destinations, d)
+	return nil
+}
+
+func TestCachedHandler(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	f := &fakeHandler{services: []*Service{svc}}
+
+	now := time.Now()
+	c := NewCachedHandler(f, time.Minute)
+	c.now = func() time.Time { return now }
+
+	svcs, err := c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, len(svcs), 1)
+	svcs[0].Port = 8080
+
+	s, err := c.GetService(svc)
+	assert.NilError(t, err)
+	assert.Equal(t, s.Port, uint16(80))
+	assert.Assert(t, c.IsServicePresent(svc))
+	assert.Equal(t, f.dumps, 1)
+
+	// Local mutations invalidate the cache.
+	other := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.2"), Port: 80}
+	assert.NilError(t, c.NewService(other))
+	svcs, err = c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, len(svcs), 2)
+	assert.Equal(t, f.dumps, 2)
+
+	_, err = c.GetDestinations(svc)
+	assert.NilError(t, err)
+	assert.NilError(t, c.NewDestination(svc, &Destination{Address: net.ParseIP("10.1.0.1"), Port: 80}))
+	dsts, err := c.GetDestinations(svc)
+	assert.NilError(t, err)
+	assert.Equal(t, len(dsts), 1)
+	assert.Equal(t, f.dumps, 4)
+
+	// Entries expire.
+	now = now.Add(time.Minute)
+	_, err = c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, f.dumps, 5)
+
+	// Events of other handles invalidate the cache.
+	events := make(chan Event, 1)
+	events <- Event{Type: EventDestinationDeleted, Service: svc}
+	close(events)
+	c.Watch(context.Background(), events)
+	_, err = c.GetDestinations(svc)
+	assert.NilError(t, err)
+	_, err = c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, f.dumps, 6)
+}
+
+func TestCachedHandlerCopies(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	f := &fakeHandler{
+		services:     []*Service{svc},
+		destinations: []*Destination{{Address: net.ParseIP("10.1.0.1"), Port: 80}},
+	}
+	c := NewCachedHandler(f, time.Minute)
+
+	svcs, err := c.GetServices()
+	assert.NilError(t, err)
+	svcs[0].Address[15] = 2
+	s, err := c.GetService(svc)
+	assert.NilError(t, err)
+	s.Address[15] = 3
+	dsts, err := c.GetDestinations(svc)
+	assert.NilError(t, err)
+	dsts[0].Address[15] = 2
+
+	svcs, err = c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, svcs[0].Address.String(), "10.0.0.1")
+	dsts, err = c.GetDestinations(svc)
+	assert.NilError(t, err)
+	assert.Equal(t, dsts[0].Address.String(), "10.1.0.1")
+	assert.Equal(t, f.dumps, 2)
+}
+
+func TestCachedHandlerInvalidatedDump(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	f := &fakeHandler{services: []*Service{svc}}
+	c := NewCachedHandler(f, time.Minute)
+
+	// The dump does not hold the lock, and is not cached if the cache was
+	// invalidated meanwhile.
+	f.onDump = func() { c.invalidateService(svc) }
+	_, err := c.GetServices()
+	assert.NilError(t, err)
+	f.onDump = nil
+	_, err = c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, f.dumps, 2)
+	_, err = c.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, f.dumps, 2)
+}
@@ -0,0 +1,287 @@
+// +build linux
+
+// Package config loads the IPVS configuration of a host from a YAML file
+// and applies it with Reconcile, for deployments small enough not to need a
+// controller of their own. A configuration lists services with their
+// destinations and local addresses, using the keys of their JSON encoding:
+//
+//	services:
+//	- address: 10.0.0.1
+//	  protocol: TCP
+//	  port: 80
+//	  scheduler: wrr
+//	  flags: [Persistent]
+//	  timeout: 5m
+//	  destinations:
+//	  - address: 10.1.0.1
+//	    port: 8080
+//	    weight: 2
+//	    forwarding_method: DirectRoute
+//
+// Only the first document of the file is read.
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/kwanhur/ipvs"
+)
+
+// Config is the desired IPVS configuration of a host.
+type Config struct {
+	Services []*ipvs.ServiceSpec
+}
+
+var (
+	configKeys = []string{"services"}
+
+	serviceKeys = []string{
+		"address", "protocol", "port", "fwmark", "scheduler", "flags", "timeout",
+		"netmask", "address_family", "pe_name", "destinations", "local_addresses",
+	}
+
+	destinationKeys = []string{
+		"address", "port", "weight", "forwarding_method", "connection_flags",
+		"address_family", "upper_threshold", "lower_threshold", "tunnel_type",
+		"tunnel_port", "tunnel_flags",
+	}
+
+	localAddressKeys = []string{"address"}
+)
+
+// Load reads the configuration file path, see Parse.
+func Load(path string) (*Config, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return c, nil
+}
+
+// Parse parses and validates the YAML configuration data. Services default
+// to the address family of their address, IPv4 for firewall mark services,
+// and to the wlc scheduler like ipvsadm does; destinations default to the
+// address family of their address and to a weight of 1.
+func Parse(data []byte) (*Config, error) {
+	doc, err := parseYAML(data)
+	if err != nil {
+		return nil, err
+	}
+	// The YAML document is converted to JSON to be decoded with the JSON
+	// encoding of the objects.
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	var raw map[string]json.RawMessage
+	if err := decode(b, &raw, configKeys); err != nil {
+		return nil, err
+	}
+	var services []json.RawMessage
+	if err := decodeField(raw, "services", &services); err != nil {
+		return nil, err
+	}
+
+	c := &Config{}
+	for n, b := range services {
+		spec, err := decodeService(b)
+		if err != nil {
+			return nil, fmt.Errorf("services[%d]: %w", n, err)
+		}
+		c.Services = append(c.Services, spec)
+	}
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func decodeService(b []byte) (*ipvs.ServiceSpec, error) {
+	var raw map[string]json.RawMessage
+	if err := decode(b, &raw, serviceKeys); err != nil {
+		return nil, err
+	}
+
+	spec := &ipvs.ServiceSpec{Service: &ipvs.Service{}}
+	if err := json.Unmarshal(b, spec.Service); err != nil {
+		return nil, err
+	}
+	if spec.Service.AddressFamily == 0 {
+		spec.Service.AddressFamily = addressFamily(spec.Service.Address)
+	}
+	if spec.Service.SchedName == "" {
+		spec.Service.SchedName = ipvs.WeightedLeastConnection
+	}
+
+	var dsts, laddrs []json.RawMessage
+	if err := decodeField(raw, "destinations", &dsts); err != nil {
+		return nil, err
+	}
+	if err := decodeField(raw, "local_addresses", &laddrs); err != nil {
+		return nil, err
+	}
+
+	for n, b := range dsts {
+		d, err := decodeDestination(b)
+		if err != nil {
+			return nil, fmt.Errorf("destinations[%d]: %w", n, err)
+		}
+		spec.Destinations = append(spec.Destinations, d)
+	}
+	for n, b := range laddrs {
+		if err := decode(b, nil, localAddressKeys); err != nil {
+			return nil, fmt.Errorf("local_addresses[%d]: %w", n, err)
+		}
+		l := &ipvs.LocalAddress{}
+		if err := json.Unmarshal(b, l); err != nil {
+			return nil, fmt.Errorf("local_addresses[%d]: %w", n, err)
+		}
+		spec.LocalAddresses = append(spec.LocalAddresses, l)
+	}
+	return spec, nil
+}
+
+func decodeDestination(b []byte) (*ipvs.Destination, error) {
+	var raw map[string]json.RawMessage
+	if err := decode(b, &raw, destinationKeys); err != nil {
+		return nil, err
+	}
+
+	d := &ipvs.Destination{}
+	if err := json.Unmarshal(b, d); err != nil {
+		return nil, err
+	}
+	if d.AddressFamily == 0 {
+		d.AddressFamily = addressFamily(d.Address)
+	}
+	if _, ok := raw["weight"]; !ok {
+		d.Weight = 1
+	}
+	return d, nil
+}
+
+// decode checks that the JSON object b only has the keys allowed and decodes
+// it into raw, if not nil.
+func decode(b []byte, raw *map[string]json.RawMessage, allowed []string) error {
+	var m map[string]json.RawMessage
+	if err := json.Unmarshal(b, &m); err != nil || m == nil {
+		return fmt.Errorf("expected a mapping")
+	}
+	for _, key := range sortedKeys(m) {
+		if !contains(allowed, key) {
+			return fmt.Errorf("unknown key %q, expected one of %s", key, strings.Join(allowed, ", "))
+		}
+	}
+	if raw != nil {
+		*raw = m
+	}
+	return nil
+}
+
+// decodeField decodes the field key of raw into v, if set.
+func decodeField(raw map[string]json.RawMessage, key string, v interface{}) error {
+	b, ok := raw[key]
+	if !ok {
+		return nil
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return fmt.Errorf("%s: %w", key, err)
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// addressFamily returns the address family of ip, IPv4 if not set.
+func addressFamily(ip net.IP) uint16 {
+	if ip != nil && ip.To4() == nil {
+		return syscall.AF_INET6
+	}
+	return syscall.AF_INET
+}
+
+// Validate checks the services of c with ValidateService, their
+// destinations with ValidateDestination, and that no service, destination
+// or local address is listed twice.
+func (c *Config) Validate() error {
+	services := make(map[string]bool)
+	for n, spec := range c.Services {
+		if err := validateService(spec); err != nil {
+			return fmt.Errorf("services[%d]: %w", n, err)
+		}
+		s := spec.Service
+		key := fmt.Sprintf("%d/%d/%s/%d/%d", s.AddressFamily, s.Protocol, s.Address, s.Port, s.FWMark)
+		if services[key] {
+			return fmt.Errorf("services[%d]: duplicate service %s", n, s)
+		}
+		services[key] = true
+	}
+	return nil
+}
+
+func validateService(spec *ipvs.ServiceSpec) error {
+	if err := ipvs.ValidateService(spec.Service); err != nil {
+		return err
+	}
+
+	dsts := make(map[string]bool)
+	for n, d := range spec.Destinations {
+		if err := ipvs.ValidateDestination(spec.Service, d, spec.LocalAddresses); err != nil {
+			return fmt.Errorf("destinations[%d]: %w", n, err)
+		}
+		key := fmt.Sprintf("%s/%d", d.Address, d.Port)
+		if dsts[key] {
+			return fmt.Errorf("destinations[%d]: duplicate destination %s:%d", n, d.Address, d.Port)
+		}
+		dsts[key] = true
+	}
+
+	laddrs := make(map[string]bool)
+	for n, l := range spec.LocalAddresses {
+		if l.Address == nil {
+			return fmt.Errorf("local_addresses[%d]: missing address", n)
+		}
+		if laddrs[l.Address.String()] {
+			return fmt.Errorf("local_addresses[%d]: duplicate local address %s", n, l.Address)
+		}
+		laddrs[l.Address.String()] = true
+	}
+	return nil
+}
+
+// Apply validates c and converges the configuration of h to it with
+// Reconcile. Services of h missing from c are deleted.
+func Apply(h *ipvs.Handle, c *Config) (*ipvs.ReconcileReport, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	return h.Reconcile(c.Services)
+}
+
+// sortedKeys returns the keys of m, sorted.
+func sortedKeys(m map[string]json.RawMessage) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,92 @@
+// +build linux
+
+package config
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+const testConfig = `
+---
+# Web frontends.
+services:
+- address: 10.0.0.1
+  protocol: TCP
+  port: 80
+  scheduler: wrr
+  flags: [Persistent]
+  timeout: 5m
+  destinations:
+  - address: 10.1.0.1
+    port: 8080
+    weight: 2
+    forwarding_method: DirectRoute
+  - address: "10.1.0.2" # default weight
+    port: 8080
+
+- fwmark: 7
+  local_addresses:
+  - address: 10.2.0.1
+  destinations:
+    - address: 2001:db8::1
+      forwarding_method: FullNat
+`
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(testConfig))
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(c.Services, 2))
+
+	web := c.Services[0]
+	assert.DeepEqual(t, *web.Service, ipvs.Service{
+		Address:       net.ParseIP("10.0.0.1").To4(),
+		Protocol:      ipvs.ProtocolTCP,
+		Port:          80,
+		SchedName:     ipvs.WeightedRoundRobin,
+		Flags:         ipvs.SvcFlagPersistent,
+		Timeout:       300,
+		AddressFamily: syscall.AF_INET,
+	})
+	assert.Assert(t, is.Len(web.Destinations, 2))
+	assert.Equal(t, web.Destinations[0].Weight, 2)
+	assert.Equal(t, web.Destinations[0].ConnectionFlags, ipvs.ConnectionFlags(ipvs.ConnectionFlagDirectRoute))
+	assert.Equal(t, web.Destinations[1].Weight, 1)
+	assert.Equal(t, web.Destinations[1].AddressFamily, uint16(syscall.AF_INET))
+
+	fwm := c.Services[1]
+	assert.Equal(t, fwm.Service.FWMark, uint32(7))
+	assert.Equal(t, fwm.Service.SchedName, ipvs.WeightedLeastConnection)
+	assert.Equal(t, fwm.Service.AddressFamily, uint16(syscall.AF_INET))
+	assert.Equal(t, fwm.Destinations[0].AddressFamily, uint16(syscall.AF_INET6))
+	assert.Equal(t, fwm.LocalAddresses[0].Address.String(), "10.2.0.1")
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []struct {
+		name string
+		doc  string
+		err  string
+	}{
+		{"syntax", "services:\n  - port: 80\n   weight: 1\n", "did not find expected '-' indicator"},
+		{"unknown key", "services:\n- address: 10.0.0.1\n  prot: TCP\n", `services[0]: unknown key "prot"`},
+		{"bad value", "services:\n- protocol: ICMP\n", `services[0]: unknown protocol "ICMP"`},
+		{"invalid service", "services:\n- address: 10.0.0.1\n  protocol: TCP\n  flags: [OnePacket]\n", "one-packet scheduling is only supported with UDP"},
+		{"fullnat without laddrs", "services:\n- fwmark: 1\n  destinations:\n  - address: 10.1.0.1\n    forwarding_method: FullNat\n", "requires local addresses"},
+		{"duplicate service", "services:\n- fwmark: 1\n- fwmark: 1\n", "services[1]: duplicate service"},
+		{"duplicate destination", "services:\n- fwmark: 1\n  destinations:\n  - address: 10.1.0.1\n  - address: 10.1.0.1\n", "destinations[1]: duplicate destination"},
+		{"not a mapping", "- fwmark: 1\n", "expected a mapping"},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, err := Parse([]byte(tc.doc))
+			assert.ErrorContains(t, err, tc.err)
+		})
+	}
+}
@@ -0,0 +1,235 @@
+// +build linux
+
+package config
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/sirupsen/logrus"
+)
+
+// GitOps applies a configuration file kept in a git repository, pulling it
+// every Interval or when triggered, e.g. by the webhook of the repository
+// hosting, so that every change of the load balancers is a reviewed and
+// audited commit. A revision is applied once it succeeded: a configuration
+// failing to load or to apply is retried with an exponential backoff until
+// it succeeds or a new revision is pulled.
+type GitOps struct {
+	Handle *ipvs.Handle
+
+	// Repository is the URL of the repository, or its path, cloned with
+	// the git command into Dir, and Branch the branch followed.
+	Repository string
+	Branch     string
+	Dir        string
+	// Path is the path of the configuration file in the repository.
+	Path string
+
+	// Interval is the interval at which the repository is pulled. It is
+	// only pulled when triggered if zero.
+	Interval time.Duration
+
+	// Backoff is the delay before the first retry of a failed revision,
+	// doubled on every subsequent one up to MaxBackoff. They default to
+	// DefaultGitOpsBackoff and DefaultGitOpsMaxBackoff.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+
+	// OnApply, if set, is called with the revision of every configuration
+	// applied and the changes made.
+	OnApply func(rev string, report *ipvs.ReconcileReport)
+
+	// OnError, if set, is called with the error of every failed pull or
+	// apply, which are logged otherwise.
+	OnError func(err error)
+
+	// apply applies the configuration, with Apply on Handle if nil.
+	apply func(c *Config) (*ipvs.ReconcileReport, error)
+	now   func() time.Time
+
+	once    sync.Once
+	trigger chan struct{}
+	applied string
+
+	// failed is the last revision which failed, retried at retryAt, and
+	// backoff the delay since its previous attempt.
+	failed  string
+	retryAt time.Time
+	backoff time.Duration
+}
+
+// Defaults of the backoff of the failed revisions.
+const (
+	DefaultGitOpsBackoff    = 10 * time.Second
+	DefaultGitOpsMaxBackoff = 5 * time.Minute
+)
+
+func (g *GitOps) triggers() chan struct{} {
+	g.once.Do(func() {
+		g.trigger = make(chan struct{}, 1)
+	})
+	return g.trigger
+}
+
+// Trigger makes Run pull the repository without waiting for the interval.
+func (g *GitOps) Trigger() {
+	select {
+	case g.triggers() <- struct{}{}:
+	default:
+	}
+}
+
+// ServeHTTP triggers a pull on POST requests, to be the target of the
+// push webhook of the repository hosting.
+func (g *GitOps) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	g.Trigger()
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// Run pulls and applies the configuration until ctx is done, starting
+// immediately.
+func (g *GitOps) Run(ctx context.Context) error {
+	var tick <-chan time.Time
+	if g.Interval > 0 {
+		ticker := time.NewTicker(g.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		var retry <-chan time.Time
+		if _, err := g.Sync(ctx); err != nil {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if g.OnError != nil {
+				g.OnError(err)
+			} else {
+				logrus.Warnf("Failed to apply the ipvs configuration of %s: %v", g.Repository, err)
+			}
+		}
+		if g.failed != "" {
+			retry = time.After(g.retryAt.Sub(g.clock()))
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-tick:
+		case <-retry:
+		case <-g.triggers():
+		}
+	}
+}
+
+// Sync pulls the repository and applies the configuration of its revision
+// if it was not applied yet, unless the revision failed and its backoff has
+// not elapsed. It returns the revision pulled. Sync must not be called
+// concurrently with itself or Run.
+func (g *GitOps) Sync(ctx context.Context) (string, error) {
+	if err := g.pull(ctx); err != nil {
+		return "", err
+	}
+	rev, err := g.git(ctx, "rev-parse", "HEAD")
+	if err != nil {
+		return "", err
+	}
+	if rev == g.applied {
+		return rev, nil
+	}
+	if rev == g.failed && g.clock().Before(g.retryAt) {
+		return rev, nil
+	}
+
+	report, err := g.applyRevision(rev)
+	if err != nil {
+		g.fail(rev)
+		return rev, fmt.Errorf("revision %s: %w", rev, err)
+	}
+	g.applied, g.failed = rev, ""
+	if g.OnApply != nil {
+		g.OnApply(rev, report)
+	}
+	return rev, nil
+}
+
+// applyRevision loads and applies the configuration of the clone.
+func (g *GitOps) applyRevision(rev string) (*ipvs.ReconcileReport, error) {
+	c, err := Load(filepath.Join(g.Dir, g.Path))
+	if err != nil {
+		return nil, err
+	}
+	if g.apply != nil {
+		return g.apply(c)
+	}
+	return Apply(g.Handle, c)
+}
+
+// fail schedules the retry of the failed revision rev.
+func (g *GitOps) fail(rev string) {
+	if rev != g.failed {
+		g.failed = rev
+		g.backoff = g.Backoff
+		if g.backoff <= 0 {
+			g.backoff = DefaultGitOpsBackoff
+		}
+	} else {
+		max := g.MaxBackoff
+		if max <= 0 {
+			max = DefaultGitOpsMaxBackoff
+		}
+		if g.backoff *= 2; g.backoff > max {
+			g.backoff = max
+		}
+	}
+	g.retryAt = g.clock().Add(g.backoff)
+}
+
+func (g *GitOps) clock() time.Time {
+	if g.now != nil {
+		return g.now()
+	}
+	return time.Now()
+}
+
+// pull clones the branch of the repository into Dir, or updates the clone.
+func (g *GitOps) pull(ctx context.Context) error {
+	if _, err := os.Stat(filepath.Join(g.Dir, ".git")); os.IsNotExist(err) {
+		_, err := g.git(ctx, "clone", "--quiet", "--single-branch", "--branch", g.Branch, "--", g.Repository, g.Dir)
+		return err
+	}
+	if _, err := g.git(ctx, "fetch", "--quiet", "--", "origin", g.Branch); err != nil {
+		return err
+	}
+	_, err := g.git(ctx, "reset", "--quiet", "--hard", "FETCH_HEAD")
+	return err
+}
+
+// git runs the git command in Dir, returning its trimmed output.
+func (g *GitOps) git(ctx context.Context, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	if args[0] != "clone" {
+		cmd.Dir = g.Dir
+	}
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s: %v: %s", args[0], err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
@@ -0,0 +1,101 @@
+// +build linux
+
+package config
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func TestGitOps(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir, err := ioutil.TempDir("", "gitops")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	origin := filepath.Join(dir, "origin")
+	git := func(args ...string) {
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = origin
+		out, err := cmd.CombinedOutput()
+		assert.NilError(t, err, string(out))
+	}
+	commit := func(config string) {
+		assert.NilError(t, ioutil.WriteFile(filepath.Join(origin, "ipvs.yaml"), []byte(config), 0644))
+		git("add", "ipvs.yaml")
+		git("commit", "--quiet", "-m", "Update")
+	}
+	assert.NilError(t, os.Mkdir(origin, 0755))
+	git("init", "--quiet", "--initial-branch", "main")
+	commit(testConfig)
+
+	var applied []*Config
+	now := time.Now()
+	g := &GitOps{
+		Repository: origin,
+		Branch:     "main",
+		Dir:        filepath.Join(dir, "clone"),
+		Path:       "ipvs.yaml",
+		Backoff:    time.Second,
+		MaxBackoff: 3 * time.Second,
+		now:        func() time.Time { return now },
+		apply: func(c *Config) (*ipvs.ReconcileReport, error) {
+			applied = append(applied, c)
+			return &ipvs.ReconcileReport{}, nil
+		},
+	}
+	ctx := context.Background()
+	rev, err := g.Sync(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(rev), 40)
+	assert.Equal(t, len(applied), 1)
+	assert.Equal(t, len(applied[0].Services), 2)
+
+	// Revisions are applied once.
+	_, err = g.Sync(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(applied), 1)
+
+	// Invalid configurations are not applied, and retried with a backoff.
+	commit("services: [{port: 80}]\n")
+	_, err = g.Sync(ctx)
+	assert.ErrorContains(t, err, "revision ")
+	_, err = g.Sync(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(applied), 1)
+	for _, backoff := range []time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second} {
+		assert.Equal(t, g.retryAt, now.Add(backoff))
+		now = now.Add(backoff)
+		_, err = g.Sync(ctx)
+		assert.ErrorContains(t, err, "revision ")
+	}
+	assert.Equal(t, len(applied), 1)
+
+	commit("services: []\n")
+	_, err = g.Sync(ctx)
+	assert.NilError(t, err)
+	assert.Equal(t, len(applied), 2)
+	assert.Equal(t, len(applied[1].Services), 0)
+	assert.Equal(t, g.failed, "")
+
+	// The webhook triggers a pull.
+	w := httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodPost, "/", nil))
+	assert.Equal(t, w.Code, http.StatusAccepted)
+	assert.Equal(t, len(g.triggers()), 1)
+	w = httptest.NewRecorder()
+	g.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil))
+	assert.Equal(t, w.Code, http.StatusMethodNotAllowed)
+}
@@ -0,0 +1,58 @@
+// +build linux
+
+package config
+
+import (
+	"fmt"
+
+	"gopkg.in/yaml.v3"
+)
+
+// parseYAML returns the value of the first document of data, made of
+// map[string]interface{}, []interface{} and scalar values so that it can be
+// encoded in JSON.
+func parseYAML(data []byte) (interface{}, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	return jsonValue(doc)
+}
+
+// jsonValue converts the mappings of v with keys other than strings, which
+// JSON objects cannot have, to map[string]interface{}.
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for k, e := range v {
+			e, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[k] = e
+		}
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for k, e := range v {
+			s, ok := k.(string)
+			if !ok {
+				return nil, fmt.Errorf("key %v is not a string", k)
+			}
+			e, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			m[s] = e
+		}
+		return m, nil
+	case []interface{}:
+		for n, e := range v {
+			e, err := jsonValue(e)
+			if err != nil {
+				return nil, err
+			}
+			v[n] = e
+		}
+	}
+	return v, nil
+}
@@ -0,0 +1,63 @@
+// +build linux
+
+package config
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseYAML(t *testing.T) {
+	testcases := []struct {
+		name string
+		doc  string
+		want interface{}
+	}{
+		{"empty", "# nothing\n", nil},
+		{"scalars", "a: 1\nb: -2\nc: true\nd: ~\ne: 'it''s'\nf: \"x\\ty\"\ng: fe80::1 # comment\nh: a#b\n", map[string]interface{}{
+			"a": 1, "b": -2, "c": true, "d": nil, "e": "it's", "f": "x\ty", "g": "fe80::1", "h": "a#b",
+		}},
+		{"flow collections", "a: [x, 'y, z', 3]\nb: []\nc: {d: 1}\n", map[string]interface{}{
+			"a": []interface{}{"x", "y, z", 3}, "b": []interface{}{}, "c": map[string]interface{}{"d": 1},
+		}},
+		{"nested", "a:\n  b:\n    c: 1\n  d:\n  - 1\n  -\n    e: 2\n  - - 3\n", map[string]interface{}{
+			"a": map[string]interface{}{
+				"b": map[string]interface{}{"c": 1},
+				"d": []interface{}{1, map[string]interface{}{"e": 2}, []interface{}{3}},
+			},
+		}},
+		{"anchors", "a: &x {b: 1}\nc: *x\nd: {<<: *x, e: 2}\n", map[string]interface{}{
+			"a": map[string]interface{}{"b": 1},
+			"c": map[string]interface{}{"b": 1},
+			"d": map[string]interface{}{"b": 1, "e": 2},
+		}},
+		{"block scalar", "a: |\n  text\n", map[string]interface{}{"a": "text\n"}},
+		{"documents", "---\na: 1\n---\nb: 2\n", map[string]interface{}{"a": 1}},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			v, err := parseYAML([]byte(tc.doc))
+			assert.NilError(t, err)
+			assert.DeepEqual(t, v, tc.want)
+		})
+	}
+}
+
+func TestParseYAMLErrors(t *testing.T) {
+	testcases := []struct {
+		doc string
+		err string
+	}{
+		{"a: 1\na: 2\n", `mapping key "a" already defined`},
+		{"a:\n\t- 1\n", "found character that cannot start any token"},
+		{"a: 1\n  b: 2\n", "line 2"},
+		{"a: {1: b}\n", "key 1 is not a string"},
+	}
+
+	for _, tc := range testcases {
+		_, err := parseYAML([]byte(tc.doc))
+		assert.ErrorContains(t, err, tc.err, tc.doc)
+	}
+}
@@ -0,0 +1,420 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwanhur/ipvs/types"
+)
+
+var (
+	procNetIPVSConn     = "/proc/net/ip_vs_conn"
+	procNetIPVSConnSync = "/proc/net/ip_vs_conn_sync"
+)
+
+// Endpoint is an address and port of a connection.
+type Endpoint struct {
+	Address net.IP
+	Port    uint16
+}
+
+// String returns the host:port form of e
+func (e Endpoint) String() string {
+	return net.JoinHostPort(e.Address.String(), strconv.Itoa(int(e.Port)))
+}
+
+// ConnectionState is the protocol state of a connection, as named by the
+// kernel. States of protocols without one, e.g. ICMP, are reported as
+// ConnectionStateNone.
+type ConnectionState string
+
+// TCP connection states, ConnectionStateNone is also used by persistence
+// templates.
+const (
+	ConnectionStateNone        ConnectionState = "NONE"
+	ConnectionStateEstablished ConnectionState = "ESTABLISHED"
+	ConnectionStateSynSent     ConnectionState = "SYN_SENT"
+	ConnectionStateSynRecv     ConnectionState = "SYN_RECV"
+	ConnectionStateFinWait     ConnectionState = "FIN_WAIT"
+	ConnectionStateTimeWait    ConnectionState = "TIME_WAIT"
+	ConnectionStateClose       ConnectionState = "CLOSE"
+	ConnectionStateCloseWait   ConnectionState = "CLOSE_WAIT"
+	ConnectionStateLastAck     ConnectionState = "LAST_ACK"
+	ConnectionStateListen      ConnectionState = "LISTEN"
+	ConnectionStateSynAck      ConnectionState = "SYNACK"
+)
+
+// ConnectionStateAssured is the state of the persistence templates which saw
+// traffic. Kernels older than 5.0 report every template as
+// ConnectionStateNone.
+const ConnectionStateAssured ConnectionState = "ASSURED"
+
+// ConnectionStateUDP is the state of every UDP connection.
+const ConnectionStateUDP ConnectionState = "UDP"
+
+// SCTP connection states.
+const (
+	ConnectionStateSCTPInit1            ConnectionState = "INIT1"
+	ConnectionStateSCTPInit             ConnectionState = "INIT"
+	ConnectionStateSCTPCookieSent       ConnectionState = "COOKIE_SENT"
+	ConnectionStateSCTPCookieReplied    ConnectionState = "COOKIE_REPLIED"
+	ConnectionStateSCTPCookieWait       ConnectionState = "COOKIE_WAIT"
+	ConnectionStateSCTPCookieEchoed     ConnectionState = "COOKIE_ECHOED"
+	ConnectionStateSCTPShutdownSent     ConnectionState = "SHUTDOWN_SENT"
+	ConnectionStateSCTPShutdownReceived ConnectionState = "SHUTDOWN_RECEIVED"
+	ConnectionStateSCTPShutdownAckSent  ConnectionState = "SHUTDOWN_ACK_SENT"
+	ConnectionStateSCTPRejected         ConnectionState = "REJECTED"
+	ConnectionStateSCTPClosed           ConnectionState = "CLOSED"
+)
+
+// String returns the kernel name of the state
+func (s ConnectionState) String() string {
+	return string(s)
+}
+
+// Connection is an entry of the IPVS connection table: a connection, or a
+// persistence template, from Client to the service at Virtual, forwarded
+// to Destination.
+type Connection struct {
+	Protocol    IPProto
+	Client      Endpoint
+	Virtual     Endpoint
+	Destination Endpoint
+
+	// Local is the address the director connects to Destination from,
+	// only reported by kernels supporting fullnat.
+	Local Endpoint
+
+	State ConnectionState
+	// Expires is the time left before the connection expires, as of the
+	// read of the table. It is reset by every packet of the connection.
+	Expires time.Duration
+
+	// PEName and PEData are the persistence engine of the connection and
+	// its data, e.g. a SIP Call-ID.
+	PEName string
+	PEData string
+
+	// IsTemplate reports whether the entry is a persistence template,
+	// pinning Client to Destination for the persistence timeout of the
+	// service rather than a connection. Templates have no client port.
+	IsTemplate bool
+
+	// Synced reports whether the connection was synchronized from a
+	// master director, only set by GetSyncConnections.
+	Synced bool
+}
+
+// GetConnections returns the connections of /proc/net/ip_vs_conn, i.e. of
+// the network namespace of the calling process rather than the one of a
+// handle. The table may hold millions of entries on busy directors.
+func GetConnections() ([]*Connection, error) {
+	return readConnectionsFile(procNetIPVSConn)
+}
+
+// VisitConnections parses the connection table line by line, calling fn
+// with every connection until fn returns false, without holding the table
+// in memory, see GetConnections. fn owns the connections it is passed.
+func VisitConnections(fn func(c *Connection) bool) error {
+	return visitConnectionsFile(procNetIPVSConn, fn)
+}
+
+// GetSyncConnections returns the connections of /proc/net/ip_vs_conn_sync,
+// which tells connections synchronized from a master apart from the local
+// ones, see GetConnections.
+func GetSyncConnections() ([]*Connection, error) {
+	return readConnectionsFile(procNetIPVSConnSync)
+}
+
+// ConnectionFilter selects connections. Zero fields match any connection.
+type ConnectionFilter struct {
+	Protocol IPProto
+	// Virtual and Destination match the address and the port of the
+	// service and the destination of connections. A nil Address or a zero
+	// Port matches any.
+	Virtual     Endpoint
+	Destination Endpoint
+	State       ConnectionState
+}
+
+// Match reports whether c is selected by f.
+func (f *ConnectionFilter) Match(c *Connection) bool {
+	return (f.Protocol == 0 || c.Protocol == f.Protocol) &&
+		f.Virtual.match(c.Virtual) &&
+		f.Destination.match(c.Destination) &&
+		(f.State == "" || c.State == f.State)
+}
+
+// match reports whether e, used as a filter, matches o.
+func (e Endpoint) match(o Endpoint) bool {
+	return (e.Address == nil || e.Address.Equal(o.Address)) && (e.Port == 0 || e.Port == o.Port)
+}
+
+// GetConnectionsFiltered returns the connections selected by f, see
+// GetConnections. The table is filtered while it is read, so only the
+// selected connections are held in memory.
+func GetConnectionsFiltered(f ConnectionFilter) ([]*Connection, error) {
+	var conns []*Connection
+	err := VisitConnections(func(c *Connection) bool {
+		if f.Match(c) {
+			conns = append(conns, c)
+		}
+		return true
+	})
+	return conns, err
+}
+
+// DestinationConnections counts the connections of the table to a
+// destination, by protocol state.
+type DestinationConnections struct {
+	Destination Endpoint
+	Total       int
+	// States maps the protocol states to their connection count.
+	// Persistence templates are counted as ConnectionStateNone.
+	States map[ConnectionState]int
+}
+
+// CountDestinationConnections walks the connections selected by f, see
+// GetConnectionsFiltered, and returns their counts per destination, sorted
+// by destination. Unlike the ActiveConnections and InactiveConnections of
+// destinations, the counts tell apart every state, e.g. the connections of
+// a draining destination still closing.
+func CountDestinationConnections(f ConnectionFilter) ([]*DestinationConnections, error) {
+	counts := make(map[string]*DestinationConnections)
+	err := VisitConnections(func(c *Connection) bool {
+		if !f.Match(c) {
+			return true
+		}
+		key := c.Destination.String()
+		dc, ok := counts[key]
+		if !ok {
+			dc = &DestinationConnections{Destination: c.Destination, States: make(map[ConnectionState]int)}
+			counts[key] = dc
+		}
+		dc.Total++
+		dc.States[c.State]++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*DestinationConnections, 0, len(counts))
+	for _, dc := range counts {
+		res = append(res, dc)
+	}
+	sort.Slice(res, func(a, b int) bool {
+		return res[a].Destination.String() < res[b].Destination.String()
+	})
+	return res, nil
+}
+
+// GetPersistenceTemplates returns the persistence templates of s, telling
+// which clients are pinned to which destination, see GetConnections.
+func GetPersistenceTemplates(s *Service) ([]*Connection, error) {
+	var conns []*Connection
+	err := VisitConnections(func(c *Connection) bool {
+		if c.IsTemplate && templateOf(c, s) {
+			conns = append(conns, c)
+		}
+		return true
+	})
+	return conns, err
+}
+
+// templateOf reports whether the template c belongs to s. The templates of
+// firewall mark services have no protocol and hold the mark in the first
+// four bytes of their virtual address.
+func templateOf(c *Connection, s *Service) bool {
+	if s.FWMark > 0 {
+		addr := c.Virtual.Address
+		if v4 := addr.To4(); v4 != nil {
+			addr = v4
+		}
+		return c.Protocol == 0 && len(addr) >= 4 && binary.BigEndian.Uint32(addr) == s.FWMark
+	}
+	return c.Protocol == s.Protocol && c.Virtual.Address.Equal(s.Address) && c.Virtual.Port == s.Port
+}
+
+func readConnectionsFile(path string) ([]*Connection, error) {
+	var conns []*Connection
+	err := visitConnectionsFile(path, func(c *Connection) bool {
+		conns = append(conns, c)
+		return true
+	})
+	return conns, err
+}
+
+// visitConnectionsFile parses the connection table at path line by line,
+// calling fn with every connection until it returns false.
+func visitConnectionsFile(path string, fn func(c *Connection) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	if !scanner.Scan() {
+		return scanner.Err()
+	}
+	columns, err := parseConnectionHeader(scanner.Text())
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+
+	for scanner.Scan() {
+		c, err := columns.parse(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s: %v", path, err)
+		}
+		if !fn(c) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
+
+// connectionColumns holds the index of the columns of a connection table,
+// which depend on the kernel, -1 for missing ones.
+type connectionColumns struct {
+	proto, fromIP, fromPort, toIP, toPort, localIP, localPort, destIP, destPort,
+	state, origin, expires, peName, peData int
+}
+
+func parseConnectionHeader(header string) (*connectionColumns, error) {
+	index := make(map[string]int)
+	for n, name := range strings.Fields(header) {
+		index[name] = n
+	}
+	column := func(name string) int {
+		if n, ok := index[name]; ok {
+			return n
+		}
+		return -1
+	}
+
+	c := &connectionColumns{
+		proto:     column("Pro"),
+		fromIP:    column("FromIP"),
+		fromPort:  column("FPrt"),
+		toIP:      column("ToIP"),
+		toPort:    column("TPrt"),
+		localIP:   column("LocalIP"),
+		localPort: column("LPrt"),
+		destIP:    column("DestIP"),
+		destPort:  column("DPrt"),
+		state:     column("State"),
+		origin:    column("Origin"),
+		expires:   column("Expires"),
+		peName:    column("PEName"),
+		peData:    column("PEData"),
+	}
+	for _, n := range []int{c.proto, c.fromIP, c.fromPort, c.toIP, c.toPort, c.destIP, c.destPort, c.state, c.expires} {
+		if n < 0 {
+			return nil, fmt.Errorf("unexpected header %q", header)
+		}
+	}
+	return c, nil
+}
+
+// parse parses a line of the connection table. The persistence engine
+// columns are only present for connections having one.
+func (cols *connectionColumns) parse(line string) (*Connection, error) {
+	fields := strings.Fields(line)
+	field := func(n int) string {
+		if n < 0 || n >= len(fields) {
+			return ""
+		}
+		return fields[n]
+	}
+	if len(fields) <= cols.expires {
+		return nil, fmt.Errorf("truncated connection %q", line)
+	}
+
+	var c Connection
+	var err error
+	if c.Protocol, err = parseConnectionProtocol(field(cols.proto)); err != nil {
+		return nil, err
+	}
+	if c.Client, err = parseEndpoint(field(cols.fromIP), field(cols.fromPort)); err != nil {
+		return nil, err
+	}
+	if c.Virtual, err = parseEndpoint(field(cols.toIP), field(cols.toPort)); err != nil {
+		return nil, err
+	}
+	if c.Destination, err = parseEndpoint(field(cols.destIP), field(cols.destPort)); err != nil {
+		return nil, err
+	}
+	if cols.localIP >= 0 {
+		if c.Local, err = parseEndpoint(field(cols.localIP), field(cols.localPort)); err != nil {
+			return nil, err
+		}
+	}
+
+	expires, err := strconv.ParseUint(field(cols.expires), 10, 32)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiry in %q", line)
+	}
+	c.Expires = time.Duration(expires) * time.Second
+	c.State = ConnectionState(field(cols.state))
+	c.IsTemplate = c.Client.Port == 0 && (c.State == ConnectionStateNone || c.State == ConnectionStateAssured)
+	c.Synced = field(cols.origin) == "SYNC"
+	c.PEName = field(cols.peName)
+	c.PEData = field(cols.peData)
+
+	return &c, nil
+}
+
+// parseConnectionProtocol parses the protocol names of ip_vs_proto_name.
+func parseConnectionProtocol(name string) (IPProto, error) {
+	switch name {
+	case "IP":
+		return 0, nil
+	case "ICMP":
+		return 1, nil
+	case "ICMPv6":
+		return 58, nil
+	}
+	if strings.HasPrefix(name, "IP_") {
+		p, err := strconv.ParseUint(name[3:], 10, 8)
+		if err != nil {
+			return 0, fmt.Errorf("invalid protocol %q", name)
+		}
+		return IPProto(p), nil
+	}
+	return types.ParseIPProto(name)
+}
+
+// parseEndpoint parses an address, in hexadecimal for IPv4 or in the
+// uncompressed textual form for IPv6, and a port in hexadecimal.
+func parseEndpoint(addr, port string) (Endpoint, error) {
+	var e Endpoint
+
+	if len(addr) == 2*net.IPv4len {
+		b, err := hex.DecodeString(addr)
+		if err != nil {
+			return e, fmt.Errorf("invalid address %q", addr)
+		}
+		e.Address = net.IP(b)
+	} else if e.Address = net.ParseIP(addr); e.Address == nil {
+		return e, fmt.Errorf("invalid address %q", addr)
+	}
+
+	p, err := strconv.ParseUint(port, 16, 16)
+	if err != nil {
+		return e, fmt.Errorf("invalid port %q", port)
+	}
+	e.Port = uint16(p)
+	return e, nil
+}
@@ -0,0 +1,172 @@
+// +build linux
+
+package ipvs
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+const testConnTable = `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+TCP 0A000001 D431 0A000002 0050 0A010001 1F90 ESTABLISHED     899
+UDP 0A000003 0035 0A000002 0035 0A010002 0035 UDP             298
+IP  0A000001 0000 0A000002 0050 0A010001 1F90 NONE            359 sip 1234@host
+TCP 2001:0db8:0000:0000:0000:0000:0000:0001 C350 2001:0db8:0000:0000:0000:0000:0000:0002 01BB 2001:0db8:0000:0000:0000:0000:0001:0001 01BB FIN_WAIT         60
+`
+
+const testConnSyncTable = `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Origin Expires
+TCP 0A000001 D431 0A000002 0050 0A010001 1F90 ESTABLISHED SYNC       899
+SCTP 0A000004 0BB8 0A000002 0B84 0A010001 0B84 ESTABLISHED LOCAL      10
+`
+
+// withConnTables points the connection table paths to files holding conn
+// and sync until the returned function is called.
+func withConnTables(t *testing.T, conn, sync string) func() {
+	dir, err := ioutil.TempDir("", "conn")
+	assert.NilError(t, err)
+
+	prevConn, prevSync := procNetIPVSConn, procNetIPVSConnSync
+	procNetIPVSConn = filepath.Join(dir, "ip_vs_conn")
+	procNetIPVSConnSync = filepath.Join(dir, "ip_vs_conn_sync")
+	assert.NilError(t, ioutil.WriteFile(procNetIPVSConn, []byte(conn), 0644))
+	assert.NilError(t, ioutil.WriteFile(procNetIPVSConnSync, []byte(sync), 0644))
+
+	return func() {
+		procNetIPVSConn, procNetIPVSConnSync = prevConn, prevSync
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGetConnections(t *testing.T) {
+	defer withConnTables(t, testConnTable, testConnSyncTable)()
+
+	conns, err := GetConnections()
+	assert.NilError(t, err)
+	assert.Equal(t, len(conns), 4)
+
+	c := conns[0]
+	assert.Equal(t, c.Protocol, ProtocolTCP)
+	assert.Equal(t, c.Client.String(), "10.0.0.1:54321")
+	assert.Equal(t, c.Virtual.String(), "10.0.0.2:80")
+	assert.Equal(t, c.Destination.String(), "10.1.0.1:8080")
+	assert.Equal(t, c.State, ConnectionStateEstablished)
+	assert.Equal(t, c.Expires, 899*time.Second)
+	assert.Equal(t, c.PEName, "")
+
+	assert.Equal(t, conns[1].Protocol, ProtocolUDP)
+	assert.Equal(t, conns[2].Protocol, IPProto(0))
+	assert.Equal(t, conns[2].PEName, "sip")
+	assert.Equal(t, conns[2].PEData, "1234@host")
+
+	c = conns[3]
+	assert.Assert(t, c.Client.Address.Equal(net.ParseIP("2001:db8::1")))
+	assert.Equal(t, c.Virtual.Port, uint16(443))
+	assert.Equal(t, c.Destination.String(), "[2001:db8::1:1]:443")
+	assert.Equal(t, c.State, ConnectionStateFinWait)
+
+	conns, err = GetSyncConnections()
+	assert.NilError(t, err)
+	assert.Equal(t, len(conns), 2)
+	assert.Assert(t, conns[0].Synced)
+	assert.Equal(t, conns[0].Expires, 899*time.Second)
+	assert.Assert(t, !conns[1].Synced)
+	assert.Equal(t, conns[1].Protocol, ProtocolSCTP)
+}
+
+func TestGetConnectionsMalformed(t *testing.T) {
+	defer withConnTables(t, "bogus header\n", testConnTable+"TCP 0A000001 D431\n")()
+
+	_, err := GetConnections()
+	assert.ErrorContains(t, err, "unexpected header")
+	_, err = GetSyncConnections()
+	assert.ErrorContains(t, err, "truncated connection")
+}
+
+func TestGetConnectionsFiltered(t *testing.T) {
+	defer withConnTables(t, testConnTable, testConnSyncTable)()
+
+	testcases := []struct {
+		name     string
+		filter   ConnectionFilter
+		expected int
+	}{
+		{"all", ConnectionFilter{}, 4},
+		{"tcp", ConnectionFilter{Protocol: ProtocolTCP}, 2},
+		{"virtual address", ConnectionFilter{Virtual: Endpoint{Address: net.ParseIP("10.0.0.2")}}, 3},
+		{"virtual port", ConnectionFilter{Virtual: Endpoint{Address: net.ParseIP("10.0.0.2"), Port: 53}}, 1},
+		{"destination", ConnectionFilter{Destination: Endpoint{Address: net.ParseIP("10.1.0.1"), Port: 8080}}, 2},
+		{"state", ConnectionFilter{Destination: Endpoint{Address: net.ParseIP("10.1.0.1")}, State: ConnectionStateEstablished}, 1},
+		{"none", ConnectionFilter{Protocol: ProtocolSCTP}, 0},
+	}
+
+	for _, tc := range testcases {
+		conns, err := GetConnectionsFiltered(tc.filter)
+		assert.NilError(t, err)
+		assert.Equal(t, len(conns), tc.expected, tc.name)
+	}
+}
+
+func TestCountDestinationConnections(t *testing.T) {
+	defer withConnTables(t, testConnTable, testConnSyncTable)()
+
+	counts, err := CountDestinationConnections(ConnectionFilter{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(counts), 3)
+
+	dc := counts[0]
+	assert.Equal(t, dc.Destination.String(), "10.1.0.1:8080")
+	assert.Equal(t, dc.Total, 2)
+	assert.DeepEqual(t, dc.States, map[ConnectionState]int{ConnectionStateEstablished: 1, ConnectionStateNone: 1})
+
+	counts, err = CountDestinationConnections(ConnectionFilter{Protocol: ProtocolUDP})
+	assert.NilError(t, err)
+	assert.Equal(t, len(counts), 1)
+	assert.DeepEqual(t, counts[0].States, map[ConnectionState]int{ConnectionStateUDP: 1})
+}
+
+func TestVisitConnections(t *testing.T) {
+	defer withConnTables(t, testConnTable, testConnSyncTable)()
+
+	var visited []string
+	err := VisitConnections(func(c *Connection) bool {
+		visited = append(visited, c.Client.String())
+		return len(visited) < 2
+	})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, visited, []string{"10.0.0.1:54321", "10.0.0.3:53"})
+}
+
+const testTemplateTable = `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+TCP 0A000005 0000 0A000002 0050 0A010001 1F90 NONE            300
+TCP 0A000005 D431 0A000002 0050 0A010001 1F90 ESTABLISHED     899
+IP  0A000006 0000 00000001 0000 0A010002 0000 ASSURED         300
+TCP 0A000007 0000 0A000003 0050 0A010002 1F90 NONE            300
+`
+
+func TestGetPersistenceTemplates(t *testing.T) {
+	defer withConnTables(t, testTemplateTable, testConnSyncTable)()
+
+	conns, err := GetConnections()
+	assert.NilError(t, err)
+	assert.Assert(t, conns[0].IsTemplate)
+	assert.Assert(t, !conns[1].IsTemplate)
+	assert.Assert(t, conns[2].IsTemplate)
+
+	templates, err := GetPersistenceTemplates(&Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.2"), Port: 80})
+	assert.NilError(t, err)
+	assert.Equal(t, len(templates), 1)
+	assert.Equal(t, templates[0].Client.Address.String(), "10.0.0.5")
+	assert.Equal(t, templates[0].Destination.String(), "10.1.0.1:8080")
+
+	templates, err = GetPersistenceTemplates(&Service{FWMark: 1})
+	assert.NilError(t, err)
+	assert.Equal(t, len(templates), 1)
+	assert.Equal(t, templates[0].Client.Address.String(), "10.0.0.6")
+	assert.Equal(t, templates[0].State, ConnectionStateAssured)
+}
@@ -0,0 +1,215 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// ConnectionField is a field of the connections written by
+// ExportConnections.
+type ConnectionField string
+
+// Fields of the connection exports.
+const (
+	ConnectionFieldProtocol    ConnectionField = "protocol"
+	ConnectionFieldClient      ConnectionField = "client"
+	ConnectionFieldVirtual     ConnectionField = "virtual"
+	ConnectionFieldDestination ConnectionField = "destination"
+	ConnectionFieldLocal       ConnectionField = "local"
+	ConnectionFieldState       ConnectionField = "state"
+	// ConnectionFieldExpires is the time left before the connection
+	// expires, in seconds.
+	ConnectionFieldExpires  ConnectionField = "expires"
+	ConnectionFieldPEName   ConnectionField = "pe_name"
+	ConnectionFieldPEData   ConnectionField = "pe_data"
+	ConnectionFieldTemplate ConnectionField = "template"
+	ConnectionFieldSynced   ConnectionField = "synced"
+
+	// ConnectionFieldClientCountry and ConnectionFieldClientASN locate
+	// the client with ConnectionExportOptions.Geo.
+	ConnectionFieldClientCountry ConnectionField = "client_country"
+	ConnectionFieldClientASN     ConnectionField = "client_asn"
+)
+
+// ConnectionFields are the fields exported when none are selected, the ones
+// of the connection table.
+var ConnectionFields = []ConnectionField{
+	ConnectionFieldProtocol,
+	ConnectionFieldClient,
+	ConnectionFieldVirtual,
+	ConnectionFieldDestination,
+	ConnectionFieldLocal,
+	ConnectionFieldState,
+	ConnectionFieldExpires,
+	ConnectionFieldPEName,
+	ConnectionFieldPEData,
+	ConnectionFieldTemplate,
+	ConnectionFieldSynced,
+}
+
+// connectionFieldValues returns the value of every field, as written to
+// JSON, from a connection and the location of its client.
+var connectionFieldValues = map[ConnectionField]func(c *Connection, l *GeoLocation) interface{}{
+	ConnectionFieldProtocol:      func(c *Connection, _ *GeoLocation) interface{} { return c.Protocol.String() },
+	ConnectionFieldClient:        func(c *Connection, _ *GeoLocation) interface{} { return endpointString(c.Client) },
+	ConnectionFieldVirtual:       func(c *Connection, _ *GeoLocation) interface{} { return endpointString(c.Virtual) },
+	ConnectionFieldDestination:   func(c *Connection, _ *GeoLocation) interface{} { return endpointString(c.Destination) },
+	ConnectionFieldLocal:         func(c *Connection, _ *GeoLocation) interface{} { return endpointString(c.Local) },
+	ConnectionFieldState:         func(c *Connection, _ *GeoLocation) interface{} { return c.State.String() },
+	ConnectionFieldExpires:       func(c *Connection, _ *GeoLocation) interface{} { return int64(c.Expires.Seconds()) },
+	ConnectionFieldPEName:        func(c *Connection, _ *GeoLocation) interface{} { return c.PEName },
+	ConnectionFieldPEData:        func(c *Connection, _ *GeoLocation) interface{} { return c.PEData },
+	ConnectionFieldTemplate:      func(c *Connection, _ *GeoLocation) interface{} { return c.IsTemplate },
+	ConnectionFieldSynced:        func(c *Connection, _ *GeoLocation) interface{} { return c.Synced },
+	ConnectionFieldClientCountry: func(_ *Connection, l *GeoLocation) interface{} { return l.Country },
+	ConnectionFieldClientASN:     func(_ *Connection, l *GeoLocation) interface{} { return int64(l.ASN) },
+}
+
+// endpointString returns the host:port form of e, or an empty string for an
+// endpoint the kernel did not report.
+func endpointString(e Endpoint) string {
+	if e.Address == nil {
+		return ""
+	}
+	return e.String()
+}
+
+// ConnectionExportFormat is the format of ExportConnections.
+type ConnectionExportFormat int
+
+const (
+	// ExportJSONLines writes every connection as a JSON object on a line
+	// of its own, keyed by field name.
+	ExportJSONLines ConnectionExportFormat = iota
+	// ExportCSV writes a header line naming the fields, then a line per
+	// connection.
+	ExportCSV
+)
+
+// ConnectionExportOptions configures ExportConnections.
+type ConnectionExportOptions struct {
+	Format ConnectionExportFormat
+	// Fields are the fields exported, in order, ConnectionFields if
+	// empty.
+	Fields []ConnectionField
+	// Filter selects the connections exported.
+	Filter ConnectionFilter
+	// Geo locates the clients for ConnectionFieldClientCountry and
+	// ConnectionFieldClientASN, which are left empty if nil.
+	Geo GeoLookup
+}
+
+// ExportConnections streams the connections of the table selected by
+// opts.Filter to w, see VisitConnections, and returns the number of
+// connections written. The table is written while it is read, so exports
+// of busy directors do not hold it in memory.
+func ExportConnections(w io.Writer, opts ConnectionExportOptions) (int, error) {
+	fields := opts.Fields
+	if len(fields) == 0 {
+		fields = ConnectionFields
+	}
+	locate := false
+	for _, f := range fields {
+		if _, ok := connectionFieldValues[f]; !ok {
+			return 0, fmt.Errorf("unknown connection field %q", f)
+		}
+		locate = locate || f == ConnectionFieldClientCountry || f == ConnectionFieldClientASN
+	}
+	geo := newGeoCache(opts.Geo)
+
+	var write func(c *Connection, l *GeoLocation) error
+	var flush func() error
+	switch opts.Format {
+	case ExportJSONLines:
+		bw := bufio.NewWriter(w)
+		write = func(c *Connection, l *GeoLocation) error { return writeConnectionJSON(bw, fields, c, l) }
+		flush = bw.Flush
+	case ExportCSV:
+		cw := csv.NewWriter(w)
+		header := make([]string, len(fields))
+		for n, f := range fields {
+			header[n] = string(f)
+		}
+		if err := cw.Write(header); err != nil {
+			return 0, err
+		}
+		record := make([]string, len(fields))
+		write = func(c *Connection, l *GeoLocation) error {
+			for n, f := range fields {
+				record[n] = csvValue(connectionFieldValues[f](c, l))
+			}
+			return cw.Write(record)
+		}
+		flush = func() error {
+			cw.Flush()
+			return cw.Error()
+		}
+	default:
+		return 0, fmt.Errorf("unknown export format %d", opts.Format)
+	}
+
+	n := 0
+	var werr error
+	err := VisitConnections(func(c *Connection) bool {
+		if !opts.Filter.Match(c) {
+			return true
+		}
+		l := &GeoLocation{}
+		if locate {
+			if l, werr = geo.lookup(c.Client.Address); werr != nil {
+				return false
+			}
+		}
+		if werr = write(c, l); werr != nil {
+			return false
+		}
+		n++
+		return true
+	})
+	if err == nil {
+		err = werr
+	}
+	if ferr := flush(); err == nil {
+		err = ferr
+	}
+	return n, err
+}
+
+// writeConnectionJSON writes the fields of c as a JSON object, keeping the
+// order of fields.
+func writeConnectionJSON(w *bufio.Writer, fields []ConnectionField, c *Connection, l *GeoLocation) error {
+	w.WriteByte('{')
+	for n, f := range fields {
+		if n > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(strconv.Quote(string(f)))
+		w.WriteByte(':')
+		b, err := json.Marshal(connectionFieldValues[f](c, l))
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+	}
+	_, err := w.WriteString("}\n")
+	return err
+}
+
+// csvValue formats a field value of connectionFieldValues.
+func csvValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	return fmt.Sprint(v)
+}
@@ -0,0 +1,60 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestExportConnections(t *testing.T) {
+	defer withConnTables(t, testConnTable, testConnSyncTable)()
+
+	var b bytes.Buffer
+	n, err := ExportConnections(&b, ConnectionExportOptions{
+		Fields: []ConnectionField{ConnectionFieldClient, ConnectionFieldState, ConnectionFieldExpires, ConnectionFieldTemplate},
+		Filter: ConnectionFilter{Destination: Endpoint{Address: net.ParseIP("10.1.0.1")}},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+	assert.Equal(t, b.String(),
+		`{"client":"10.0.0.1:54321","state":"ESTABLISHED","expires":899,"template":false}`+"\n"+
+			`{"client":"10.0.0.1:0","state":"NONE","expires":359,"template":true}`+"\n")
+
+	b.Reset()
+	n, err = ExportConnections(&b, ConnectionExportOptions{
+		Format: ExportCSV,
+		Fields: []ConnectionField{ConnectionFieldProtocol, ConnectionFieldVirtual, ConnectionFieldLocal, ConnectionFieldPEData},
+		Filter: ConnectionFilter{Virtual: Endpoint{Port: 80}},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+	assert.Equal(t, b.String(), "protocol,virtual,local,pe_data\n"+
+		"TCP,10.0.0.2:80,,\n"+
+		"IP(0),10.0.0.2:80,,1234@host\n")
+
+	lookups := 0
+	b.Reset()
+	_, err = ExportConnections(&b, ConnectionExportOptions{
+		Fields: []ConnectionField{ConnectionFieldClient, ConnectionFieldClientCountry, ConnectionFieldClientASN},
+		Filter: ConnectionFilter{Protocol: ProtocolTCP},
+		Geo: GeoLookupFunc(func(addr net.IP) (*GeoLocation, error) {
+			lookups++
+			if addr.To4() == nil {
+				return nil, nil
+			}
+			return &GeoLocation{Country: "FR", ASN: 64496}, nil
+		}),
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, lookups, 2)
+	assert.Equal(t, b.String(),
+		`{"client":"10.0.0.1:54321","client_country":"FR","client_asn":64496}`+"\n"+
+			`{"client":"[2001:db8::1]:50000","client_country":"","client_asn":0}`+"\n")
+
+	_, err = ExportConnections(&b, ConnectionExportOptions{Fields: []ConnectionField{"port"}})
+	assert.ErrorContains(t, err, `unknown connection field "port"`)
+}
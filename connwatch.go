@@ -0,0 +1,123 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ConnectionEventType is the type of a ConnectionEvent.
+type ConnectionEventType int
+
+const (
+	// ConnectionNew reports a connection which appeared in the table.
+	ConnectionNew ConnectionEventType = iota + 1
+
+	// ConnectionExpired reports a connection which left the table.
+	ConnectionExpired
+)
+
+// String returns the name of the event type
+func (t ConnectionEventType) String() string {
+	switch t {
+	case ConnectionNew:
+		return "New"
+	case ConnectionExpired:
+		return "Expired"
+	}
+	return "Unknown"
+}
+
+// ConnectionEvent is a change of the connection table seen by a
+// ConnectionWatcher.
+type ConnectionEvent struct {
+	Type ConnectionEventType
+	Time time.Time
+	// Connection is the connection as last seen, i.e. before it expired
+	// for ConnectionExpired.
+	Connection *Connection
+}
+
+// ConnectionWatcher polls the connection table and reports the connections
+// appearing and expiring in between, to trace flows while debugging. Short
+// lived connections may appear and expire between two polls unnoticed.
+//
+// Every poll reads the whole table and the watcher holds the connections
+// selected by Filter in memory, so a Filter is advised on busy directors.
+type ConnectionWatcher struct {
+	Interval time.Duration
+	Filter   ConnectionFilter
+
+	conns map[string]*Connection
+}
+
+// connectionKey returns a string identifying c in the table.
+func connectionKey(c *Connection) string {
+	return c.Protocol.String() + " " + c.Client.String() + " " + c.Virtual.String() + " " +
+		c.Local.String() + " " + c.Destination.String()
+}
+
+// Run polls the connection table every Interval and sends the changes on
+// events until ctx is done. The connections present at the first poll are
+// not reported. Failed polls are logged and skipped.
+func (w *ConnectionWatcher) Run(ctx context.Context, events chan<- ConnectionEvent) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := w.poll(time.Now())
+		if err != nil {
+			logrus.Warnf("Failed to read ipvs connection table: %v", err)
+		}
+		for _, e := range changes {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads the table and returns its changes since the previous poll,
+// none for the first one.
+func (w *ConnectionWatcher) poll(now time.Time) ([]ConnectionEvent, error) {
+	conns := make(map[string]*Connection)
+	err := VisitConnections(func(c *Connection) bool {
+		if w.Filter.Match(c) {
+			conns[connectionKey(c)] = c
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	prev := w.conns
+	w.conns = conns
+	if prev == nil {
+		return nil, nil
+	}
+
+	var events []ConnectionEvent
+	for key, c := range conns {
+		if _, ok := prev[key]; !ok {
+			events = append(events, ConnectionEvent{Type: ConnectionNew, Time: now, Connection: c})
+		}
+	}
+	for key, c := range prev {
+		if _, ok := conns[key]; !ok {
+			events = append(events, ConnectionEvent{Type: ConnectionExpired, Time: now, Connection: c})
+		}
+	}
+	return events, nil
+}
@@ -0,0 +1,57 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"io/ioutil"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestConnectionWatcher(t *testing.T) {
+	defer withConnTables(t, testConnTable, testConnSyncTable)()
+
+	w := &ConnectionWatcher{Interval: 10 * time.Millisecond, Filter: ConnectionFilter{Protocol: ProtocolTCP}}
+	events, err := w.poll(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 0)
+
+	// The IPv6 connection expires, another one appears and the UDP one,
+	// filtered out, expires too.
+	table := `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+TCP 0A000001 D431 0A000002 0050 0A010001 1F90 ESTABLISHED     800
+TCP 0A000009 D431 0A000002 0050 0A010001 1F90 SYN_RECV         30
+`
+	assert.NilError(t, ioutil.WriteFile(procNetIPVSConn, []byte(table), 0644))
+	events, err = w.poll(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 2)
+	for _, e := range events {
+		switch e.Type {
+		case ConnectionNew:
+			assert.Equal(t, e.Connection.Client.String(), "10.0.0.9:54321")
+		case ConnectionExpired:
+			assert.Equal(t, e.Connection.Client.String(), "[2001:db8::1]:50000")
+		default:
+			t.Errorf("unexpected event %v", e.Type)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := make(chan ConnectionEvent)
+	done := make(chan error)
+	go func() { done <- w.Run(ctx, ch) }()
+
+	assert.NilError(t, ioutil.WriteFile(procNetIPVSConn, []byte(testConnTable), 0644))
+	select {
+	case e := <-ch:
+		assert.Assert(t, e.Type == ConnectionNew || e.Type == ConnectionExpired)
+	case <-time.After(time.Second):
+		t.Fatal("no event received")
+	}
+	cancel()
+	assert.Equal(t, <-done, context.Canceled)
+}
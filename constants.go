@@ -2,221 +2,172 @@
 
 package ipvs
 
-const (
-	genlCtrlID = 0x10
-)
-
-// GENL control commands
-const (
-	genlCtrlCmdUnspec uint8 = iota
-	genlCtrlCmdNewFamily
-	genlCtrlCmdDelFamily
-	genlCtrlCmdGetFamily
-)
-
-// GENL family attributes
-const (
-	genlCtrlAttrUnspec int = iota
-	genlCtrlAttrFamilyID
-	genlCtrlAttrFamilyName
-)
-
-// IPVS genl commands
-const (
-	ipvsCmdUnspec uint8 = iota
-	ipvsCmdNewService
-	ipvsCmdSetService
-	ipvsCmdDelService
-	ipvsCmdGetService
-	ipvsCmdNewDest
-	ipvsCmdSetDest
-	ipvsCmdDelDest
-	ipvsCmdGetDest
-	ipvsCmdNewDaemon
-	ipvsCmdDelDaemon
-	ipvsCmdGetDaemon
-	ipvsCmdSetConfig
-	ipvsCmdGetConfig
-	ipvsCmdSetInfo
-	ipvsCmdGetInfo
-	ipvsCmdZero
-	ipvsCmdFlush
-	ipvsCmdNewLaddr
-	ipvsCmdDelLaddr
-	ipvsCmdGetLaddr
-)
-
-// Attributes used in the first level of commands
-const (
-	ipvsCmdAttrUnspec int = iota
-	ipvsCmdAttrService
-	ipvsCmdAttrDest
-	ipvsCmdAttrDaemon
-	ipvsCmdAttrTimeoutTCP
-	ipvsCmdAttrTimeoutTCPFin
-	ipvsCmdAttrTimeoutUDP
-	ipvsCmdAttrLaddr
-)
-
-// Attributes used to describe an info
-const (
-	ipvsCmdAttrInfoUnspec int = iota
-	ipvsCmdAttrInfoVersion
-	ipvsCmdAttrInfoConnTableSize
-)
+import "github.com/kwanhur/ipvs/types"
 
-// Attributes used to describe a service. Used inside nested attribute
-// ipvsCmdAttrService
+// Connection flags set by the kernel.
 const (
-	ipvsSvcAttrUnspec int = iota
-	ipvsSvcAttrAddressFamily
-	ipvsSvcAttrProtocol
-	ipvsSvcAttrAddress
-	ipvsSvcAttrPort
-	ipvsSvcAttrFWMark
-	ipvsSvcAttrSchedName
-	ipvsSvcAttrFlags
-	ipvsSvcAttrTimeout
-	ipvsSvcAttrNetmask
-	ipvsSvcAttrStats
-	ipvsSvcAttrPEName
+	ConnectionFlagSync         = types.ConnectionFlagSync
+	ConnectionFlagHashed       = types.ConnectionFlagHashed
+	ConnectionFlagNoOutput     = types.ConnectionFlagNoOutput
+	ConnectionFlagInactive     = types.ConnectionFlagInactive
+	ConnectionFlagOutSeq       = types.ConnectionFlagOutSeq
+	ConnectionFlagInSeq        = types.ConnectionFlagInSeq
+	ConnectionFlagNoClientPort = types.ConnectionFlagNoClientPort
+	ConnectionFlagTemplate     = types.ConnectionFlagTemplate
+	ConnectionFlagOnePacket    = types.ConnectionFlagOnePacket
 )
 
-// Attributes used to describe a destination (real server). Used
-// inside nested attribute ipvsCmdAttrDest.
+// Destination forwarding methods, see Destination.SetForwardingMethod.
 const (
-	ipvsDestAttrUnspec int = iota
-	ipvsDestAttrAddress
-	ipvsDestAttrPort
-	ipvsDestAttrForwardingMethod
-	ipvsDestAttrWeight
-	ipvsDestAttrUpperThreshold
-	ipvsDestAttrLowerThreshold
-	ipvsDestAttrActiveConnections
-	ipvsDestAttrInactiveConnections
-	ipvsDestAttrPersistentConnections
-	ipvsDestAttrStats
-	ipvsDestAttrAddressFamily
+	ForwardMasq        = types.ForwardMasq
+	ForwardLocalNode   = types.ForwardLocalNode
+	ForwardTunnel      = types.ForwardTunnel
+	ForwardDirectRoute = types.ForwardDirectRoute
+	ForwardBypass      = types.ForwardBypass
+	ForwardFullNat     = types.ForwardFullNat
 )
 
-// Attributes used to describe a local address. Used
-// inside nested attribute ipvsCmdAttrLaddr
+// Tunnel destination encapsulations.
 const (
-	ipvsLaddrAttrUnspec int = iota
-	ipvsLaddrAttrAddress
-	ipvsLaddrAttrPortConflict
-	ipvsladdrAttrConnections
+	TunnelTypeIPIP = types.TunnelTypeIPIP
+	TunnelTypeGUE  = types.TunnelTypeGUE
+	TunnelTypeGRE  = types.TunnelTypeGRE
 )
 
-// IPVS Statistics constants
-
+// Tunnel destination encapsulation flags.
 const (
-	ipvsStatsUnspec int = iota
-	ipvsStatsConns
-	ipvsStatsPktsIn
-	ipvsStatsPktsOut
-	ipvsStatsBytesIn
-	ipvsStatsBytesOut
-	ipvsStatsCPS
-	ipvsStatsPPSIn
-	ipvsStatsPPSOut
-	ipvsStatsBPSIn
-	ipvsStatsBPSOut
+	TunnelFlagNoChecksum     = types.TunnelFlagNoChecksum
+	TunnelFlagChecksum       = types.TunnelFlagChecksum
+	TunnelFlagRemoteChecksum = types.TunnelFlagRemoteChecksum
 )
 
+// Protocols supported by IPVS services.
 const (
-	ipvsDaemonAttrUnspec int = iota
-	ipvsDaemonAttrState
-	ipvsDaemonAttrMcastIfn
-	ipvsDaemonAttrSyncId
+	ProtocolTCP  = types.ProtocolTCP
+	ProtocolUDP  = types.ProtocolUDP
+	ProtocolSCTP = types.ProtocolSCTP
 )
 
 // Destination forwarding methods
 const (
 	// ConnectionFlagFwdmask indicates the mask in the connection
 	// flags which is used by forwarding method bits.
-	ConnectionFlagFwdMask = 0x0007
+	ConnectionFlagFwdMask = types.ConnectionFlagFwdMask
 
 	// ConnectionFlagMasq is used for masquerade forwarding method.
-	ConnectionFlagMasq = 0x0000
+	ConnectionFlagMasq = types.ConnectionFlagMasq
 
 	// ConnectionFlagLocalNode is used for local node forwarding
 	// method.
-	ConnectionFlagLocalNode = 0x0001
+	ConnectionFlagLocalNode = types.ConnectionFlagLocalNode
 
 	// ConnectionFlagTunnel is used for tunnel mode forwarding
 	// method.
-	ConnectionFlagTunnel = 0x0002
+	ConnectionFlagTunnel = types.ConnectionFlagTunnel
 
 	// ConnectionFlagDirectRoute is used for direct routing
 	// forwarding method.
-	ConnectionFlagDirectRoute = 0x0003
+	ConnectionFlagDirectRoute = types.ConnectionFlagDirectRoute
 
 	// ConnectionFlagFullNat is used for fullnat(snat+dnat) forwarding method.
-	ConnectionFlagFullNat = 0x0005
+	ConnectionFlagFullNat = types.ConnectionFlagFullNat
 )
 
 const (
 	// RoundRobin distributes jobs equally amongst the available
 	// real servers.
-	RoundRobin = "rr"
+	RoundRobin = types.RoundRobin
 
 	// LeastConnection assigns more jobs to real servers with
 	// fewer active jobs.
-	LeastConnection = "lc"
+	LeastConnection = types.LeastConnection
 
 	// DestinationHashing assigns jobs to servers through looking
 	// up a statically assigned hash table by their destination IP
 	// addresses.
-	DestinationHashing = "dh"
+	DestinationHashing = types.DestinationHashing
 
 	// SourceHashing assigns jobs to servers through looking up
 	// a statically assigned hash table by their source IP
 	// addresses.
-	SourceHashing = "sh"
+	SourceHashing = types.SourceHashing
 
 	// WeightedRoundRobin assigns jobs to real servers proportionally
 	// to there real servers' weight. Servers with higher weights
 	// receive new jobs first and get more jobs than servers
 	// with lower weights. Servers with equal weights get
 	// an equal distribution of new jobs
-	WeightedRoundRobin = "wrr"
+	WeightedRoundRobin = types.WeightedRoundRobin
 
 	// WeightedLeastConnection assigns more jobs to servers
 	// with fewer jobs and relative to the real servers' weight
-	WeightedLeastConnection = "wlc"
+	WeightedLeastConnection = types.WeightedLeastConnection
+
+	// MaglevHashing assigns jobs to servers through looking up
+	// a Maglev consistent hashing table by their source IP
+	// addresses.
+	MaglevHashing = types.MaglevHashing
+)
+
+// Virtual service flags
+const (
+	// SvcFlagPersistent makes the service persistent.
+	SvcFlagPersistent = types.SvcFlagPersistent
+
+	// SvcFlagHashed is set by the kernel on hashed services.
+	SvcFlagHashed = types.SvcFlagHashed
+
+	// SvcFlagOnePacket schedules every UDP datagram independently.
+	SvcFlagOnePacket = types.SvcFlagOnePacket
+
+	// SvcFlagSched1, SvcFlagSched2 and SvcFlagSched3 are scheduler
+	// specific: sh-fallback, sh-port and unused for sh, mh-fallback,
+	// mh-port and unused for mh.
+	SvcFlagSched1 = types.SvcFlagSched1
+	SvcFlagSched2 = types.SvcFlagSched2
+	SvcFlagSched3 = types.SvcFlagSched3
+
+	// SvcFlagSHFallback and SvcFlagSHPort enable the fallback and source
+	// port hashing of the sh scheduler.
+	SvcFlagSHFallback = types.SvcFlagSHFallback
+	SvcFlagSHPort     = types.SvcFlagSHPort
+
+	// SvcFlagMHFallback and SvcFlagMHPort enable the fallback and source
+	// port hashing of the mh scheduler.
+	SvcFlagMHFallback = types.SvcFlagMHFallback
+	SvcFlagMHPort     = types.SvcFlagMHPort
 )
 
 const (
 	// ConnFwdMask is a mask for the fwd methods
-	ConnFwdMask = 0x0007
+	ConnFwdMask = types.ConnFwdMask
 
 	// ConnFwdMasq denotes forwarding via masquerading/NAT
-	ConnFwdMasq = 0x0000
+	ConnFwdMasq = types.ConnFwdMasq
 
 	// ConnFwdLocalNode denotes forwarding to a local node
-	ConnFwdLocalNode = 0x0001
+	ConnFwdLocalNode = types.ConnFwdLocalNode
 
 	// ConnFwdTunnel denotes forwarding via a tunnel
-	ConnFwdTunnel = 0x0002
+	ConnFwdTunnel = types.ConnFwdTunnel
 
 	// ConnFwdDirectRoute denotes forwarding via direct routing
-	ConnFwdDirectRoute = 0x0003
+	ConnFwdDirectRoute = types.ConnFwdDirectRoute
 
 	// ConnFwdBypass denotes forwarding while bypassing the cache
-	ConnFwdBypass = 0x0004
+	ConnFwdBypass = types.ConnFwdBypass
 
 	// ConnFwdFullNat denotes forwarding via snat+dnat
-	ConnFwdFullNat = 0x0005
+	ConnFwdFullNat = types.ConnFwdFullNat
 )
 
 const (
 	// daemon in stop state
-	DaemonStateNone = 0x0000
+	DaemonStateNone = types.DaemonStateNone
 
 	// daemon in master state
-	DaemonStateMaster = 0x0001
+	DaemonStateMaster = types.DaemonStateMaster
 
 	// daemon in backup state
-	DaemonStateBackup = 0x0002
-)
\ No newline at end of file
+	DaemonStateBackup = types.DaemonStateBackup
+)
@@ -0,0 +1,149 @@
+// +build linux
+
+package ipvs
+
+import (
+	"sort"
+)
+
+// Changeset is the difference between two configurations, see Diff.
+type Changeset struct {
+	ServicesAdded   []*ServiceSpec
+	ServicesRemoved []*ServiceSpec
+	// ServicesModified lists the services present in both configurations
+	// whose options changed.
+	ServicesModified []*ServiceDiff
+	// Destinations lists the destinations added, removed or changed in the
+	// services present in both configurations.
+	Destinations []*DestinationDiff
+
+	// Changes lists the mutations converging the first configuration to
+	// the second, in the order Reconcile and Restore make them, including
+	// the local address, sync daemon and timeout changes.
+	Changes []Event
+}
+
+// ServiceDiff is a service whose options changed.
+type ServiceDiff struct {
+	Service  *Service
+	Previous *Service
+}
+
+// DestinationDiff is a destination of Service which was added, removed or
+// changed. Destination is nil for removed destinations and Previous for
+// added ones.
+type DestinationDiff struct {
+	Service     *Service
+	Destination *Destination
+	Previous    *Destination
+}
+
+// WeightDelta returns the change of the weight of the destination, from or
+// to zero for added and removed destinations.
+func (d *DestinationDiff) WeightDelta() int {
+	var prev, cur int
+	if d.Previous != nil {
+		prev = d.Previous.Weight
+	}
+	if d.Destination != nil {
+		cur = d.Destination.Weight
+	}
+	return cur - prev
+}
+
+// Empty reports whether the two configurations are the same.
+func (c *Changeset) Empty() bool {
+	return len(c.Changes) == 0
+}
+
+// Diff returns the changes from the configuration a to b, e.g. two
+// snapshots taken by Handle.Snapshot, compared the way Reconcile does.
+// Services are sorted by key and destinations by service then address.
+func Diff(a, b *Snapshot) *Changeset {
+	c := &Changeset{}
+
+	if b.Config != nil && (a.Config == nil || *a.Config != *b.Config) {
+		c.Changes = append(c.Changes, Event{Type: EventConfigUpdated, Config: b.Config})
+	}
+	c.Changes = append(c.Changes, planReconcile(a.Services, b.Services)...)
+	c.Changes = append(c.Changes, planDaemons(a.Daemons, b.Daemons)...)
+
+	before := make(map[string]*ServiceSpec, len(a.Services))
+	for _, spec := range a.Services {
+		before[serviceKey(spec.Service)] = spec
+	}
+	after := make(map[string]*ServiceSpec, len(b.Services))
+	for _, spec := range b.Services {
+		after[serviceKey(spec.Service)] = spec
+	}
+
+	for key, spec := range after {
+		prev, ok := before[key]
+		if !ok {
+			c.ServicesAdded = append(c.ServicesAdded, spec)
+			continue
+		}
+		if serviceChanged(prev.Service, spec.Service) {
+			c.ServicesModified = append(c.ServicesModified, &ServiceDiff{Service: spec.Service, Previous: prev.Service})
+		}
+		c.Destinations = append(c.Destinations, diffDestinations(prev, spec)...)
+	}
+	for key, spec := range before {
+		if _, ok := after[key]; !ok {
+			c.ServicesRemoved = append(c.ServicesRemoved, spec)
+		}
+	}
+
+	sortSpecs(c.ServicesAdded)
+	sortSpecs(c.ServicesRemoved)
+	sort.Slice(c.ServicesModified, func(i, j int) bool {
+		return serviceKey(c.ServicesModified[i].Service) < serviceKey(c.ServicesModified[j].Service)
+	})
+	sort.Slice(c.Destinations, func(i, j int) bool {
+		a, b := c.Destinations[i], c.Destinations[j]
+		if ka, kb := serviceKey(a.Service), serviceKey(b.Service); ka != kb {
+			return ka < kb
+		}
+		return destinationKey(a.destination()) < destinationKey(b.destination())
+	})
+	return c
+}
+
+// diffDestinations returns the destination changes from prev to spec.
+func diffDestinations(prev, spec *ServiceSpec) []*DestinationDiff {
+	var diffs []*DestinationDiff
+
+	before := make(map[string]*Destination, len(prev.Destinations))
+	for _, d := range prev.Destinations {
+		before[destinationKey(d)] = d
+	}
+	after := make(map[string]bool, len(spec.Destinations))
+	for _, d := range spec.Destinations {
+		after[destinationKey(d)] = true
+		p, ok := before[destinationKey(d)]
+		if !ok || destinationChanged(p, d) {
+			diffs = append(diffs, &DestinationDiff{Service: spec.Service, Destination: d, Previous: p})
+		}
+	}
+	for _, d := range prev.Destinations {
+		if !after[destinationKey(d)] {
+			diffs = append(diffs, &DestinationDiff{Service: spec.Service, Previous: d})
+		}
+	}
+	return diffs
+}
+
+// destination returns the destination of d, or the previous one if it was
+// removed.
+func (d *DestinationDiff) destination() *Destination {
+	if d.Destination != nil {
+		return d.Destination
+	}
+	return d.Previous
+}
+
+func sortSpecs(specs []*ServiceSpec) {
+	sort.Slice(specs, func(a, b int) bool {
+		return serviceKey(specs[a].Service) < serviceKey(specs[b].Service)
+	})
+}
@@ -0,0 +1,58 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDiff(t *testing.T) {
+	spec := func(port uint16, weights ...int) *ServiceSpec {
+		s := &ServiceSpec{Service: &Service{
+			AddressFamily: syscall.AF_INET,
+			Protocol:      syscall.IPPROTO_TCP,
+			Address:       net.ParseIP("10.0.0.1"),
+			Port:          port,
+			SchedName:     RoundRobin,
+		}}
+		for n, w := range weights {
+			s.Destinations = append(s.Destinations, &Destination{
+				Address: net.IPv4(10, 1, 0, byte(n+1)),
+				Port:    80,
+				Weight:  w,
+			})
+		}
+		return s
+	}
+
+	a := &Snapshot{Services: []*ServiceSpec{spec(80, 1, 2), spec(443, 1)}, Config: &Config{TimeoutTCP: 900}}
+	assert.Assert(t, Diff(a, a).Empty())
+
+	modified := spec(443, 4, 1)
+	modified.Service.SchedName = WeightedRoundRobin
+	b := &Snapshot{Services: []*ServiceSpec{modified, spec(8080, 1)}, Config: &Config{TimeoutTCP: 900}}
+
+	c := Diff(a, b)
+	assert.Assert(t, !c.Empty())
+	assert.Equal(t, len(c.ServicesAdded), 1)
+	assert.Equal(t, c.ServicesAdded[0].Service.Port, uint16(8080))
+	assert.Equal(t, len(c.ServicesRemoved), 1)
+	assert.Equal(t, c.ServicesRemoved[0].Service.Port, uint16(80))
+	assert.Equal(t, len(c.ServicesModified), 1)
+	assert.Equal(t, c.ServicesModified[0].Previous.SchedName, RoundRobin)
+
+	assert.Equal(t, len(c.Destinations), 2)
+	assert.Equal(t, c.Destinations[0].Destination.Address.String(), "10.1.0.1")
+	assert.Equal(t, c.Destinations[0].WeightDelta(), 3)
+	assert.Assert(t, c.Destinations[1].Previous == nil)
+	assert.Equal(t, c.Destinations[1].WeightDelta(), 1)
+
+	// Service added with its destination, updated, destinations changed
+	// and removed service.
+	assert.Equal(t, len(c.Changes), 6)
+	assert.Equal(t, c.Changes[len(c.Changes)-1].Type, EventServiceDeleted)
+}
@@ -0,0 +1,113 @@
+// +build linux
+
+package ipvs
+
+import (
+	"math"
+	"time"
+)
+
+// DestinationShare describes the part of a service's traffic handled by one
+// of its destinations over an interval.
+type DestinationShare struct {
+	Destination *Destination
+
+	// Connections and Bytes are the increase of the destination counters
+	// over the interval, Bytes counting both directions.
+	Connections uint64
+	Bytes       uint64
+
+	// ConnectionShare and BytesShare are the fractions (0 to 1) of the
+	// service's new connections and bytes handled by the destination.
+	ConnectionShare float64
+	BytesShare      float64
+
+	// ExpectedShare is the fraction of the traffic the destination should
+	// receive according to its weight.
+	ExpectedShare float64
+
+	// Skewed is set when ConnectionShare differs from ExpectedShare by more
+	// than the analysis threshold.
+	Skewed bool
+}
+
+// DistributionReport describes how the traffic of a service was spread over
+// its destinations between two snapshots.
+type DistributionReport struct {
+	Service      *Service
+	Interval     time.Duration
+	Connections  uint64
+	Bytes        uint64
+	Destinations []*DestinationShare
+}
+
+// Skewed reports whether any destination of the service is skewed.
+func (r *DistributionReport) Skewed() bool {
+	for _, ds := range r.Destinations {
+		if ds.Skewed {
+			return true
+		}
+	}
+	return false
+}
+
+// AnalyzeDistribution computes, for every service of cur, the share of the
+// connections and bytes handled by each destination since prev and compares
+// it with the share implied by the destination weights. A destination is
+// flagged as skewed when its connection share differs from the expected one
+// by more than threshold, expressed as a fraction (0.1 for 10 points).
+// Services which got no new connections are never flagged. It returns nil
+// if prev or cur is nil, e.g. for the first snapshot of a poller.
+func AnalyzeDistribution(prev, cur *StatsSnapshot, threshold float64) []*DistributionReport {
+	if prev == nil || cur == nil {
+		return nil
+	}
+
+	var reports []*DistributionReport
+
+	for _, sd := range cur.Services {
+		r := &DistributionReport{
+			Service:  sd.Service,
+			Interval: cur.Time.Sub(prev.Time),
+		}
+		before := prev.service(sd.Service)
+
+		var weights int
+		for _, d := range sd.Destinations {
+			if d.Weight > 0 {
+				weights += d.Weight
+			}
+		}
+
+		for _, d := range sd.Destinations {
+			ds := &DestinationShare{Destination: d}
+			var p DstStats
+			if pd := before.destination(d); pd != nil {
+				p = pd.Stats
+			}
+			ds.Connections = counterDelta(p.Connections, d.Stats.Connections)
+			ds.Bytes = counterDelta(p.BytesIn, d.Stats.BytesIn) + counterDelta(p.BytesOut, d.Stats.BytesOut)
+			if weights > 0 && d.Weight > 0 {
+				ds.ExpectedShare = float64(d.Weight) / float64(weights)
+			}
+
+			r.Connections += ds.Connections
+			r.Bytes += ds.Bytes
+			r.Destinations = append(r.Destinations, ds)
+		}
+
+		for _, ds := range r.Destinations {
+			if r.Connections > 0 {
+				ds.ConnectionShare = float64(ds.Connections) / float64(r.Connections)
+				ds.Skewed = math.Abs(ds.ConnectionShare-ds.ExpectedShare) > threshold
+			}
+			if r.Bytes > 0 {
+				ds.BytesShare = float64(ds.Bytes) / float64(r.Bytes)
+			}
+		}
+
+		reports = append(reports, r)
+	}
+
+	return reports
+}
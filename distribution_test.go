@@ -0,0 +1,80 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestAnalyzeDistribution(t *testing.T) {
+	svc := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      syscall.IPPROTO_TCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     WeightedRoundRobin,
+	}
+	dst := func(ip string, weight int, conns, bytes uint64) *Destination {
+		return &Destination{
+			Address: net.ParseIP(ip),
+			Port:    8080,
+			Weight:  weight,
+			Stats:   DstStats{Connections: conns, BytesIn: bytes, BytesOut: bytes},
+		}
+	}
+
+	now := time.Now()
+	prev := &StatsSnapshot{
+		Time: now.Add(-10 * time.Second),
+		Services: []*ServiceDestinations{{
+			Service:      svc,
+			Destinations: []*Destination{dst("10.1.0.1", 3, 100, 1000), dst("10.1.0.2", 1, 100, 1000)},
+		}},
+	}
+	cur := &StatsSnapshot{
+		Time: now,
+		Services: []*ServiceDestinations{{
+			Service: svc,
+			Destinations: []*Destination{
+				dst("10.1.0.1", 3, 175, 1750),
+				dst("10.1.0.2", 1, 125, 1250),
+				// new destination, not in prev
+				dst("10.1.0.3", 0, 0, 0),
+			},
+		}},
+	}
+
+	reports := AnalyzeDistribution(prev, cur, 0.1)
+	assert.Equal(t, len(reports), 1)
+
+	r := reports[0]
+	assert.Equal(t, r.Interval, 10*time.Second)
+	assert.Equal(t, r.Connections, uint64(100))
+	assert.Equal(t, r.Bytes, uint64(2000))
+	assert.Equal(t, len(r.Destinations), 3)
+	assert.Assert(t, !r.Skewed())
+
+	assert.Equal(t, r.Destinations[0].ConnectionShare, 0.75)
+	assert.Equal(t, r.Destinations[0].ExpectedShare, 0.75)
+	assert.Equal(t, r.Destinations[1].BytesShare, 0.25)
+	assert.Equal(t, r.Destinations[2].ExpectedShare, 0.0)
+
+	// Send everything to the light destination.
+	cur.Services[0].Destinations[0].Stats.Connections = 100
+	cur.Services[0].Destinations[1].Stats.Connections = 200
+
+	r = AnalyzeDistribution(prev, cur, 0.1)[0]
+	assert.Assert(t, r.Skewed())
+	assert.Assert(t, r.Destinations[0].Skewed)
+	assert.Assert(t, r.Destinations[1].Skewed)
+	assert.Assert(t, !r.Destinations[2].Skewed)
+
+	// The first snapshot has nothing to be compared with.
+	assert.Assert(t, AnalyzeDistribution(nil, cur, 0.1) == nil)
+	assert.Assert(t, AnalyzeDistribution(prev, nil, 0.1) == nil)
+}
@@ -0,0 +1,213 @@
+// +build linux
+
+// Package docker resolves IPVS destinations from Docker containers and keeps
+// them up to date as containers restart or stop.
+package docker
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/sirupsen/logrus"
+)
+
+// DefaultSocket is the path of the Docker Engine API socket.
+const DefaultSocket = "/var/run/docker.sock"
+
+// Destinations is the subset of *ipvs.Handle used by a Resolver.
+type Destinations interface {
+	NewDestination(s *ipvs.Service, d *ipvs.Destination) error
+	DelDestination(s *ipvs.Service, d *ipvs.Destination) error
+}
+
+// ParseSpec parses a destination spec of the form container:name:port.
+func ParseSpec(spec string) (name string, port uint16, err error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 3 || parts[0] != "container" || parts[1] == "" {
+		return "", 0, fmt.Errorf("invalid container destination %q, expected container:name:port", spec)
+	}
+	p, err := strconv.ParseUint(parts[2], 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in container destination %q: %v", spec, err)
+	}
+	return parts[1], uint16(p), nil
+}
+
+// Resolver maps containers to real server addresses through the Docker
+// Engine API.
+type Resolver struct {
+	// Endpoint is the base URL of the Docker Engine API. When empty the
+	// API is reached over DefaultSocket.
+	Endpoint string
+
+	// Network selects the container network to take the address from.
+	// When empty the default bridge address is preferred, then the
+	// networks are tried in name order.
+	Network string
+
+	// Interval between two inspections of a watched container. Defaults
+	// to five seconds.
+	Interval time.Duration
+
+	// Client is used to talk to the API. Defaults to a client dialing
+	// DefaultSocket when Endpoint is empty.
+	Client *http.Client
+
+	once          sync.Once
+	defaultClient *http.Client
+}
+
+type containerJSON struct {
+	State struct {
+		Running bool
+	}
+	NetworkSettings struct {
+		IPAddress         string
+		GlobalIPv6Address string
+		Networks          map[string]struct {
+			IPAddress         string
+			GlobalIPv6Address string
+		}
+	}
+}
+
+// Resolve returns the address of the running container name. A nil address
+// and no error are returned when the container is stopped or does not exist.
+func (r *Resolver) Resolve(ctx context.Context, name string) (net.IP, error) {
+	endpoint := r.Endpoint
+	if endpoint == "" {
+		endpoint = "http://docker"
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, endpoint+"/containers/"+url.PathEscape(name)+"/json", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.client().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("inspecting container %s: unexpected status %s", name, resp.Status)
+	}
+
+	var c containerJSON
+	if err := json.NewDecoder(resp.Body).Decode(&c); err != nil {
+		return nil, fmt.Errorf("inspecting container %s: %v", name, err)
+	}
+	if !c.State.Running {
+		return nil, nil
+	}
+
+	var addrs []string
+	if r.Network == "" {
+		addrs = append(addrs, c.NetworkSettings.IPAddress, c.NetworkSettings.GlobalIPv6Address)
+	}
+	networks := make([]string, 0, len(c.NetworkSettings.Networks))
+	for network := range c.NetworkSettings.Networks {
+		if r.Network == "" || network == r.Network {
+			networks = append(networks, network)
+		}
+	}
+	sort.Strings(networks)
+	for _, network := range networks {
+		settings := c.NetworkSettings.Networks[network]
+		addrs = append(addrs, settings.IPAddress, settings.GlobalIPv6Address)
+	}
+	for _, addr := range addrs {
+		if ip := net.ParseIP(addr); ip != nil {
+			return ip, nil
+		}
+	}
+	return nil, fmt.Errorf("container %s has no address", name)
+}
+
+// client returns Client, or the default client, built once so that its
+// idle connections are reused across resolutions.
+func (r *Resolver) client() *http.Client {
+	if r.Client != nil {
+		return r.Client
+	}
+	r.once.Do(func() {
+		r.defaultClient = &http.Client{Timeout: 10 * time.Second}
+		if r.Endpoint == "" {
+			r.defaultClient.Transport = &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", DefaultSocket)
+				},
+			}
+		}
+	})
+	return r.defaultClient
+}
+
+// Watch keeps a destination of svc pointing at the container described by
+// spec (container:name:port) until ctx is done. The destination is created
+// from template, whose address and port are overridden, once the container
+// runs; it is moved when the container comes back with another address and
+// removed when the container stops. Resolution errors are logged and retried
+// at the next interval.
+func (r *Resolver) Watch(ctx context.Context, h Destinations, svc *ipvs.Service, spec string, template ipvs.Destination) error {
+	name, port, err := ParseSpec(spec)
+	if err != nil {
+		return err
+	}
+
+	interval := r.Interval
+	if interval <= 0 {
+		interval = 5 * time.Second
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var current *ipvs.Destination
+	for {
+		ip, err := r.Resolve(ctx, name)
+		switch {
+		case err != nil:
+			logrus.Warnf("docker: %v", err)
+		case current != nil && current.Address.Equal(ip):
+		default:
+			if current != nil {
+				if err := h.DelDestination(svc, current); err != nil {
+					logrus.Warnf("docker: removing %s for container %s: %v", current.Address, name, err)
+				} else {
+					current = nil
+				}
+			}
+			if ip != nil && current == nil {
+				d := template
+				d.Address = ip
+				d.Port = port
+				if err := h.NewDestination(svc, &d); err != nil {
+					logrus.Warnf("docker: adding %s for container %s: %v", ip, name, err)
+				} else {
+					current = &d
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
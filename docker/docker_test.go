@@ -0,0 +1,154 @@
+// +build linux
+
+package docker
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func TestParseSpec(t *testing.T) {
+	name, port, err := ParseSpec("container:web:8080")
+	assert.NilError(t, err)
+	assert.Equal(t, name, "web")
+	assert.Equal(t, port, uint16(8080))
+
+	for _, spec := range []string{"web:8080", "container::80", "container:web:http", "container:web:70000"} {
+		_, _, err := ParseSpec(spec)
+		assert.Assert(t, err != nil, spec)
+	}
+}
+
+type fakeDestinations struct {
+	mu    sync.Mutex
+	dests map[string]*ipvs.Destination
+}
+
+func (f *fakeDestinations) NewDestination(s *ipvs.Service, d *ipvs.Destination) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.dests[d.Address.String()] = d
+	return nil
+}
+
+func (f *fakeDestinations) DelDestination(s *ipvs.Service, d *ipvs.Destination) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	delete(f.dests, d.Address.String())
+	return nil
+}
+
+func (f *fakeDestinations) addresses() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var res []string
+	for addr := range f.dests {
+		res = append(res, addr)
+	}
+	return res
+}
+
+func TestWatch(t *testing.T) {
+	var mu sync.Mutex
+	state := `{"State":{"Running":true},"NetworkSettings":{"IPAddress":"172.17.0.2"}}`
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, r.URL.Path, "/containers/web/json")
+		mu.Lock()
+		defer mu.Unlock()
+		if state == "" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, state)
+	}))
+	defer srv.Close()
+
+	setState := func(s string) {
+		mu.Lock()
+		state = s
+		mu.Unlock()
+	}
+
+	r := &Resolver{Endpoint: srv.URL, Interval: 5 * time.Millisecond}
+	h := &fakeDestinations{dests: map[string]*ipvs.Destination{}}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Watch(ctx, h, &ipvs.Service{}, "container:web:80", ipvs.Destination{Weight: 1})
+	}()
+
+	waitFor := func(expected ...string) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			got := h.addresses()
+			if fmt.Sprint(got) == fmt.Sprint(expected) || (len(got) == 0 && len(expected) == 0) {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got destinations %v, expected %v", got, expected)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+
+	waitFor("172.17.0.2")
+	h.mu.Lock()
+	d := h.dests["172.17.0.2"]
+	h.mu.Unlock()
+	assert.Equal(t, d.Port, uint16(80))
+	assert.Equal(t, d.Weight, 1)
+
+	// restarted with a new address
+	setState(`{"State":{"Running":true},"NetworkSettings":{"Networks":{"app":{"IPAddress":"172.18.0.5"}}}}`)
+	waitFor("172.18.0.5")
+
+	// stopped
+	setState(`{"State":{"Running":false}}`)
+	waitFor()
+
+	// removed, then started again
+	setState("")
+	waitFor()
+	setState(`{"State":{"Running":true},"NetworkSettings":{"IPAddress":"172.17.0.3"}}`)
+	waitFor("172.17.0.3")
+
+	cancel()
+	assert.Equal(t, <-done, context.Canceled)
+}
+
+func TestResolveNetwork(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"State":{"Running":true},"NetworkSettings":{"IPAddress":"172.17.0.2",
+			"Networks":{"a":{"IPAddress":"10.0.0.2"},"b":{"GlobalIPv6Address":"2001:db8::2"}}}}`)
+	}))
+	defer srv.Close()
+
+	r := &Resolver{Endpoint: srv.URL}
+	ip, err := r.Resolve(context.Background(), "web")
+	assert.NilError(t, err)
+	assert.Assert(t, ip.Equal(net.ParseIP("172.17.0.2")))
+
+	r.Network = "b"
+	ip, err = r.Resolve(context.Background(), "web")
+	assert.NilError(t, err)
+	assert.Assert(t, ip.Equal(net.ParseIP("2001:db8::2")))
+}
+
+func TestDefaultClient(t *testing.T) {
+	r := &Resolver{}
+	assert.Equal(t, r.client(), r.client())
+
+	c := &http.Client{}
+	r = &Resolver{Client: c}
+	assert.Equal(t, r.client(), c)
+}
@@ -0,0 +1,53 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// WriteDOT writes the services of snap and their destinations as a
+// Graphviz DOT graph, with an edge from every service to each of its
+// destinations labelled with the forwarding method, weight and active
+// connections. Destinations shared by several services are drawn once;
+// edges of destinations with a null weight, which get no new connections,
+// are dashed.
+func WriteDOT(w io.Writer, snap *Snapshot) error {
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "digraph ipvs {\n\trankdir=LR;\n")
+
+	dsts := make(map[string]string)
+	for n, spec := range snap.Services {
+		svc := fmt.Sprintf("svc%d", n)
+		fmt.Fprintf(bw, "\t%s [shape=box, label=%s];\n", svc, dotQuote(spec.Service.String()))
+
+		for _, d := range spec.Destinations {
+			addr := destinationAddr(d, d.Port)
+			dst, ok := dsts[addr]
+			if !ok {
+				dst = fmt.Sprintf("dst%d", len(dsts))
+				dsts[addr] = dst
+				fmt.Fprintf(bw, "\t%s [shape=ellipse, label=%s];\n", dst, dotQuote(addr))
+			}
+
+			label := fmt.Sprintf("%s\nweight %d\nactive %d", d.ForwardingMethod(), d.Weight, d.ActiveConnections)
+			style := ""
+			if d.Weight <= 0 {
+				style = ", style=dashed"
+			}
+			fmt.Fprintf(bw, "\t%s -> %s [label=%s%s];\n", svc, dst, dotQuote(label), style)
+		}
+	}
+
+	fmt.Fprintf(bw, "}\n")
+	return bw.Flush()
+}
+
+// dotQuote returns s as a DOT quoted string, its newlines as line breaks.
+func dotQuote(s string) string {
+	r := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	return `"` + r.Replace(s) + `"`
+}
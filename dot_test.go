@@ -0,0 +1,43 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bytes"
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteDOT(t *testing.T) {
+	shared := &Destination{Address: net.ParseIP("10.1.0.1").To4(), Port: 80, Weight: 1, ConnectionFlags: ConnectionFlagMasq, ActiveConnections: 3}
+	snap := &Snapshot{Services: []*ServiceSpec{
+		{
+			Service: &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.1").To4(), Port: 80, SchedName: RoundRobin},
+			Destinations: []*Destination{
+				shared,
+				{Address: net.ParseIP("10.1.0.2").To4(), Port: 80, Weight: 0, ConnectionFlags: ConnectionFlagDirectRoute},
+			},
+		},
+		{
+			Service:      &Service{FWMark: 7, SchedName: WeightedRoundRobin},
+			Destinations: []*Destination{shared},
+		},
+	}}
+
+	var b bytes.Buffer
+	assert.NilError(t, WriteDOT(&b, snap))
+	assert.Equal(t, b.String(), `digraph ipvs {
+	rankdir=LR;
+	svc0 [shape=box, label="TCP 10.0.0.1:80 (rr)"];
+	dst0 [shape=ellipse, label="10.1.0.1:80"];
+	svc0 -> dst0 [label="Masq\nweight 1\nactive 3"];
+	dst1 [shape=ellipse, label="10.1.0.2:80"];
+	svc0 -> dst1 [label="DirectRoute\nweight 0\nactive 0", style=dashed];
+	svc1 [shape=box, label="FMW 7 (wrr)"];
+	svc1 -> dst0 [label="Masq\nweight 1\nactive 3"];
+}
+`)
+	assert.Equal(t, dotQuote(`a "b" \c`), `"a \"b\" \\c"`)
+}
@@ -0,0 +1,119 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"time"
+)
+
+// defaultDrainInterval is the interval at which a draining destination is
+// checked when DrainOptions.Interval is not set.
+const defaultDrainInterval = time.Second
+
+// DrainOptions configures DrainDestination.
+type DrainOptions struct {
+	// Timeout bounds the wait for the connections of the destination to
+	// close, after which it is deleted anyway. The destination is deleted
+	// right after being quiesced if zero.
+	Timeout time.Duration
+	// Threshold is the number of connections under which, or at which,
+	// the destination is deleted without waiting further.
+	Threshold int
+	// Interval is the interval at which the connections are counted, one
+	// second if zero.
+	Interval time.Duration
+	// UseConnectionTable counts the entries of the connection table going
+	// to the destination, persistence templates excepted, instead of its
+	// ActiveConnections. The table is the one of the network namespace of
+	// the calling process, which must be the one of the handle.
+	UseConnectionTable bool
+}
+
+// DrainDestination takes the destination d of s out of service gracefully:
+// its weight is set to zero so that it gets no new connection, then, as
+// configured by opts, the existing connections are given time to close
+// before it is deleted. If ctx is done while waiting, the destination is
+// left quiesced and ctx.Err() is returned.
+func (i *Handle) DrainDestination(ctx context.Context, s *Service, d *Destination, opts DrainOptions) error {
+	cur, err := i.GetDestination(s, d)
+	if err != nil {
+		return err
+	}
+	if cur.Weight != 0 {
+		quiesced := *cur
+		quiesced.Weight = 0
+		if err := i.UpdateDestination(s, &quiesced); err != nil {
+			return err
+		}
+	}
+
+	if opts.Timeout > 0 {
+		if err := i.waitDrained(ctx, s, cur, opts); err != nil {
+			return err
+		}
+	}
+	return i.DelDestination(s, cur)
+}
+
+// waitDrained waits until the connections of d drop to opts.Threshold or
+// opts.Timeout passes.
+func (i *Handle) waitDrained(ctx context.Context, s *Service, d *Destination, opts DrainOptions) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = defaultDrainInterval
+	}
+	// A timer of its own rather than a derived context, so that the
+	// deadline of ctx is not mistaken for the end of the drain.
+	timeout := time.NewTimer(opts.Timeout)
+	defer timeout.Stop()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		var n int
+		var err error
+		if opts.UseConnectionTable {
+			n, err = liveConnections(s, d)
+		} else {
+			var dst *Destination
+			if dst, err = i.GetDestination(s, d); err == nil {
+				n = dst.ActiveConnections
+			}
+		}
+		if err != nil {
+			return err
+		}
+		if n <= opts.Threshold {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-timeout.C:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// liveConnections counts the entries of the connection table from s to d,
+// persistence templates excepted.
+func liveConnections(s *Service, d *Destination) (int, error) {
+	f := ConnectionFilter{Destination: Endpoint{Address: d.Address, Port: d.Port}}
+	if s.FWMark == 0 {
+		f.Protocol = s.Protocol
+		f.Virtual = Endpoint{Address: s.Address, Port: s.Port}
+	}
+
+	n := 0
+	err := VisitConnections(func(c *Connection) bool {
+		if !c.IsTemplate && f.Match(c) {
+			n++
+		}
+		return true
+	})
+	return n, err
+}
@@ -0,0 +1,48 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestLiveConnections(t *testing.T) {
+	defer withConnTables(t, testTemplateTable, testConnSyncTable)()
+
+	s := &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.2"), Port: 80}
+	n, err := liveConnections(s, &Destination{Address: net.ParseIP("10.1.0.1"), Port: 8080})
+	assert.NilError(t, err)
+	assert.Equal(t, n, 1)
+
+	n, err = liveConnections(s, &Destination{Address: net.ParseIP("10.1.0.2"), Port: 8080})
+	assert.NilError(t, err)
+	assert.Equal(t, n, 0)
+}
+
+func TestWaitDrained(t *testing.T) {
+	defer withConnTables(t, testTemplateTable, testConnSyncTable)()
+
+	i := &Handle{}
+	s := &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.2"), Port: 80}
+	d := &Destination{Address: net.ParseIP("10.1.0.1"), Port: 8080}
+	opts := DrainOptions{Interval: time.Millisecond, UseConnectionTable: true}
+
+	// The drain timeout passes: the destination can be deleted.
+	opts.Timeout = 10 * time.Millisecond
+	assert.NilError(t, i.waitDrained(context.Background(), s, d, opts))
+
+	// The deadline of the caller passes first: the drain is abandoned.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	opts.Timeout = time.Hour
+	assert.Equal(t, i.waitDrained(ctx, s, d, opts), context.DeadlineExceeded)
+
+	// Under the threshold: no wait.
+	opts.Threshold = 1
+	assert.NilError(t, i.waitDrained(context.Background(), s, d, opts))
+}
@@ -0,0 +1,59 @@
+// +build linux
+
+package ipvs
+
+// WithDryRun makes the handle record the commands changing the
+// configuration, e.g. NewService or those of Reconcile and Restore, in a
+// plan instead of sending them, so that they can be reviewed before being
+// applied with a regular handle. Reads are still sent and report the
+// current configuration, unaffected by the plan. Quotas are still checked
+// against the current configuration, so that a planned creation fails like
+// the one it stands for, but destinations are not probed, see
+// SetReachabilityCheck. Check hooks may veto the planned commands, the
+// other hooks and event buses are not notified of them.
+func WithDryRun() Option {
+	return func(o *options) {
+		o.dryRun = true
+	}
+}
+
+// DryRun reports whether the handle was created with WithDryRun.
+func (i *Handle) DryRun() bool {
+	return i.opts != nil && i.opts.dryRun
+}
+
+// Plan returns the commands recorded by a dry run handle, as the events
+// they would publish, in order.
+func (i *Handle) Plan() []Event {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	plan := make([]Event, len(i.plan))
+	copy(plan, i.plan)
+	return plan
+}
+
+// ResetPlan empties the plan of a dry run handle.
+func (i *Handle) ResetPlan() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.plan = nil
+}
+
+// recordPlan adds the command cmd to the plan and reports whether it must
+// not be sent, i.e. whether the handle is a dry run one and cmd changes the
+// configuration.
+func (i *Handle) recordPlan(cmd uint8, s *Service, obj interface{}) bool {
+	if !i.DryRun() {
+		return false
+	}
+	e, ok := newEvent(cmd, s, obj)
+	if !ok {
+		return false
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.plan = append(i.plan, e)
+	return true
+}
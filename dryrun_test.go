@@ -0,0 +1,68 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestDryRun(t *testing.T) {
+	i, err := NewWithOptions(WithDryRun())
+	assert.NilError(t, err)
+	defer i.Close()
+	assert.Assert(t, i.DryRun())
+
+	var hooked int
+	i.OnBefore(func(cmd Command, obj interface{}) { hooked++ })
+
+	s := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      syscall.IPPROTO_TCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     RoundRobin,
+	}
+	d := &Destination{Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 1}
+	assert.NilError(t, i.NewService(s))
+	assert.NilError(t, i.NewDestination(s, d))
+	assert.NilError(t, i.DelService(s))
+
+	plan := i.Plan()
+	assert.Equal(t, len(plan), 3)
+	assert.Equal(t, plan[0].Type, EventServiceAdded)
+	assert.Equal(t, plan[1].Type, EventDestinationAdded)
+	assert.Equal(t, plan[1].Destination.Address.String(), "10.1.0.1")
+	assert.Equal(t, plan[2].Type, EventServiceDeleted)
+	assert.Equal(t, hooked, 0)
+
+	i.ResetPlan()
+	assert.Equal(t, len(i.Plan()), 0)
+}
+
+func TestDryRunReachability(t *testing.T) {
+	i, err := NewWithOptions(WithDryRun())
+	assert.NilError(t, err)
+	defer i.Close()
+	i.SetReachabilityCheck(ReachabilityCheck{Mode: ReachabilityEnforce})
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	closedPort := uint16(l.Addr().(*net.TCPAddr).Port)
+	l.Close()
+
+	// The destination refuses connections, but is not probed.
+	s := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      syscall.IPPROTO_TCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     RoundRobin,
+	}
+	d := &Destination{Address: net.ParseIP("127.0.0.1"), Port: closedPort, ConnectionFlags: ConnectionFlagMasq}
+	assert.NilError(t, i.NewDestination(s, d))
+	assert.Equal(t, len(i.Plan()), 1)
+}
@@ -0,0 +1,56 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"syscall"
+)
+
+// EnsureService creates s if it does not exist, or updates it if its
+// options differ from the ones of s, as compared by Reconcile, and reports
+// whether anything changed.
+func (i *Handle) EnsureService(s *Service) (bool, error) {
+	cur, err := i.GetService(s)
+	if errors.Is(err, syscall.ESRCH) {
+		if err := i.NewService(s); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !serviceChanged(cur, s) {
+		return false, nil
+	}
+	if err := i.UpdateService(s); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// EnsureDestination adds d to s if s has no destination with its address
+// and port, or updates it if its configuration differs from d, as compared
+// by Reconcile, and reports whether anything changed. s must exist.
+func (i *Handle) EnsureDestination(s *Service, d *Destination) (bool, error) {
+	cur, err := i.GetDestination(s, d)
+	if errors.Is(err, syscall.ENOENT) {
+		if err := i.NewDestination(s, d); err != nil {
+			return false, err
+		}
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	if !destinationChanged(cur, d) {
+		return false, nil
+	}
+	if err := i.UpdateDestination(s, d); err != nil {
+		return false, err
+	}
+	return true, nil
+}
@@ -0,0 +1,207 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/kwanhur/ipvs/netlink"
+)
+
+// EventType describes the kind of change reported by an Event.
+type EventType int
+
+// Event types published for successful mutations.
+const (
+	EventServiceAdded EventType = iota + 1
+	EventServiceUpdated
+	EventServiceDeleted
+	EventDestinationAdded
+	EventDestinationUpdated
+	EventDestinationDeleted
+	EventLocalAddressAdded
+	EventLocalAddressDeleted
+	EventDaemonAdded
+	EventDaemonDeleted
+	EventConfigUpdated
+	EventZeroed
+	EventFlushed
+
+	// EventAnomaly is published by an AnomalyDetector rather than for a
+	// mutation.
+	EventAnomaly
+
+	// EventAlert is published by an AlertWatcher rather than for a
+	// mutation.
+	EventAlert
+)
+
+var eventTypeNames = map[EventType]string{
+	EventServiceAdded:        "ServiceAdded",
+	EventServiceUpdated:      "ServiceUpdated",
+	EventServiceDeleted:      "ServiceDeleted",
+	EventDestinationAdded:    "DestinationAdded",
+	EventDestinationUpdated:  "DestinationUpdated",
+	EventDestinationDeleted:  "DestinationDeleted",
+	EventLocalAddressAdded:   "LocalAddressAdded",
+	EventLocalAddressDeleted: "LocalAddressDeleted",
+	EventDaemonAdded:         "DaemonAdded",
+	EventDaemonDeleted:       "DaemonDeleted",
+	EventConfigUpdated:       "ConfigUpdated",
+	EventZeroed:              "Zeroed",
+	EventFlushed:             "Flushed",
+	EventAnomaly:             "Anomaly",
+	EventAlert:               "Alert",
+}
+
+// String returns the name of the event type
+func (t EventType) String() string {
+	if name, ok := eventTypeNames[t]; ok {
+		return name
+	}
+	return fmt.Sprintf("EventType(%d)", int(t))
+}
+
+// Event describes a successful mutation performed through a Handle. Only
+// the fields relevant to Type are set; Service is set for every event
+// scoped to a service, including destination and local address events.
+type Event struct {
+	Type         EventType
+	Time         time.Time
+	Service      *Service
+	Destination  *Destination
+	LocalAddress *LocalAddress
+	Daemon       *Daemon
+	Config       *Config
+	Anomaly      *Anomaly
+	Alert        *Alert
+}
+
+// EventBus fans events out to any number of subscribers within the same
+// process. Publishing never blocks: a subscriber whose channel is full misses
+// the event.
+type EventBus struct {
+	mu   sync.Mutex
+	subs map[chan Event]struct{}
+}
+
+// NewEventBus returns an EventBus without subscribers.
+func NewEventBus() *EventBus {
+	return &EventBus{subs: make(map[chan Event]struct{})}
+}
+
+// Subscribe returns a channel receiving the events published after the call,
+// buffered with size, and a function cancelling the subscription. The
+// channel is closed once cancelled.
+func (b *EventBus) Subscribe(size int) (<-chan Event, func()) {
+	ch := make(chan Event, size)
+
+	b.mu.Lock()
+	b.subs[ch] = struct{}{}
+	b.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			b.mu.Lock()
+			delete(b.subs, ch)
+			b.mu.Unlock()
+			close(ch)
+		})
+	}
+}
+
+// Publish delivers e to every subscriber.
+func (b *EventBus) Publish(e Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for ch := range b.subs {
+		select {
+		case ch <- e:
+		default:
+		}
+	}
+}
+
+// SetEventBus makes the handle publish an event on b for every mutation it
+// performs successfully. A nil bus stops publishing.
+func (i *Handle) SetEventBus(b *EventBus) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.bus = b
+}
+
+// publish reports the successful command cmd on the handle's event bus, if
+// any. Read-only commands are ignored.
+func (i *Handle) publish(cmd uint8, s *Service, obj interface{}) {
+	i.mu.RLock()
+	b := i.bus
+	i.mu.RUnlock()
+	if b == nil {
+		return
+	}
+
+	if e, ok := newEvent(cmd, s, obj); ok {
+		b.Publish(e)
+	}
+}
+
+// newEvent returns the event describing the command cmd, or false if cmd
+// is read-only. The objects are copied.
+func newEvent(cmd uint8, s *Service, obj interface{}) (Event, bool) {
+	e := Event{Time: time.Now()}
+	if s != nil {
+		svc := *s
+		e.Service = &svc
+	}
+
+	switch cmd {
+	case netlink.CmdNewService:
+		e.Type = EventServiceAdded
+	case netlink.CmdSetService:
+		e.Type = EventServiceUpdated
+	case netlink.CmdDelService:
+		e.Type = EventServiceDeleted
+	case netlink.CmdNewDest:
+		e.Type = EventDestinationAdded
+	case netlink.CmdSetDest:
+		e.Type = EventDestinationUpdated
+	case netlink.CmdDelDest:
+		e.Type = EventDestinationDeleted
+	case netlink.CmdNewLaddr:
+		e.Type = EventLocalAddressAdded
+	case netlink.CmdDelLaddr:
+		e.Type = EventLocalAddressDeleted
+	case netlink.CmdNewDaemon:
+		e.Type = EventDaemonAdded
+	case netlink.CmdDelDaemon:
+		e.Type = EventDaemonDeleted
+	case netlink.CmdSetConfig:
+		e.Type = EventConfigUpdated
+	case netlink.CmdZero:
+		e.Type = EventZeroed
+	case netlink.CmdFlush:
+		e.Type = EventFlushed
+	default:
+		return e, false
+	}
+
+	switch o := obj.(type) {
+	case *Destination:
+		d := *o
+		e.Destination = &d
+	case *LocalAddress:
+		l := *o
+		e.LocalAddress = &l
+	case *Daemon:
+		d := *o
+		e.Daemon = &d
+	case *Config:
+		c := *o
+		e.Config = &c
+	}
+	return e, true
+}
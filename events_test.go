@@ -0,0 +1,35 @@
+// +build linux
+
+package ipvs
+
+import (
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEventBus(t *testing.T) {
+	b := NewEventBus()
+
+	ch1, cancel1 := b.Subscribe(1)
+	ch2, cancel2 := b.Subscribe(1)
+	defer cancel2()
+
+	b.Publish(Event{Type: EventServiceAdded})
+	assert.Equal(t, (<-ch1).Type, EventServiceAdded)
+	assert.Equal(t, (<-ch2).Type, EventServiceAdded)
+
+	// A full subscriber misses events instead of blocking the publisher.
+	b.Publish(Event{Type: EventServiceUpdated})
+	b.Publish(Event{Type: EventServiceDeleted})
+	assert.Equal(t, (<-ch1).Type, EventServiceUpdated)
+
+	cancel1()
+	cancel1()
+	_, ok := <-ch1
+	assert.Assert(t, !ok)
+
+	assert.Equal(t, (<-ch2).Type, EventServiceUpdated)
+	b.Publish(Event{Type: EventFlushed})
+	assert.Equal(t, (<-ch2).Type, EventFlushed)
+}
@@ -0,0 +1,105 @@
+// +build linux
+
+// Package expvars publishes the state of IPVS with package expvar, served
+// as JSON under /debug/vars by the programs importing it.
+package expvars
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"syscall"
+
+	"github.com/kwanhur/ipvs"
+)
+
+// Vars is an expvar.Var reading the services and destinations of a handler
+// whenever it is read. Its JSON value holds:
+//
+//   - services and destinations: the number of services and destinations;
+//   - stats: the statistics of every service, by service;
+//   - errors: the number of failed netlink commands, by command, counted
+//     if the handler has an OnAfter method, like *ipvs.Handle;
+//   - error: the error of the read of the services and destinations, if
+//     it failed.
+type Vars struct {
+	h      ipvs.Handler
+	errors *expvar.Map
+}
+
+var _ expvar.Var = (*Vars)(nil)
+
+// hooker is implemented by the handlers running hooks, like *ipvs.Handle.
+type hooker interface {
+	OnAfter(h ipvs.AfterHook)
+}
+
+// New returns the variable describing h, without publishing it.
+func New(h ipvs.Handler) *Vars {
+	v := &Vars{h: h, errors: new(expvar.Map).Init()}
+	if hk, ok := h.(hooker); ok {
+		hk.OnAfter(func(cmd ipvs.Command, _ interface{}, err error) {
+			if err != nil {
+				v.errors.Add(cmd.String(), 1)
+			}
+		})
+	}
+	return v
+}
+
+// Publish publishes the variable describing h under name. Like
+// expvar.Publish, it panics if name is already in use.
+func Publish(name string, h ipvs.Handler) *Vars {
+	v := New(h)
+	expvar.Publish(name, v)
+	return v
+}
+
+type state struct {
+	Services     int                      `json:"services"`
+	Destinations int                      `json:"destinations"`
+	Stats        map[string]ipvs.SvcStats `json:"stats"`
+	Errors       json.RawMessage          `json:"errors"`
+	Error        string                   `json:"error,omitempty"`
+}
+
+// String returns the JSON value of the variable.
+func (v *Vars) String() string {
+	st := state{
+		Stats:  make(map[string]ipvs.SvcStats),
+		Errors: json.RawMessage(v.errors.String()),
+	}
+	if err := v.read(&st); err != nil {
+		st.Error = err.Error()
+	}
+
+	b, err := json.Marshal(&st)
+	if err != nil {
+		return "null"
+	}
+	return string(b)
+}
+
+// read counts the services and destinations of the handler and collects
+// the service statistics into st. Services removed in the meantime are
+// skipped.
+func (v *Vars) read(st *state) error {
+	svcs, err := v.h.GetServices()
+	if err != nil {
+		return err
+	}
+
+	for _, s := range svcs {
+		dsts, err := v.h.GetDestinations(s)
+		if errors.Is(err, syscall.ESRCH) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		st.Services++
+		st.Destinations += len(dsts)
+		st.Stats[s.String()] = s.Stats
+	}
+	return nil
+}
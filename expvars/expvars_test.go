@@ -0,0 +1,69 @@
+// +build linux
+
+package expvars
+
+import (
+	"encoding/json"
+	"errors"
+	"expvar"
+	"net"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+type fakeHandler struct {
+	ipvs.Handler
+
+	services     []*ipvs.Service
+	destinations []*ipvs.Destination
+	err          error
+	hooks        []ipvs.AfterHook
+}
+
+func (f *fakeHandler) GetServices() ([]*ipvs.Service, error) {
+	return f.services, f.err
+}
+
+func (f *fakeHandler) GetDestinations(s *ipvs.Service) ([]*ipvs.Destination, error) {
+	return f.destinations, nil
+}
+
+func (f *fakeHandler) OnAfter(h ipvs.AfterHook) {
+	f.hooks = append(f.hooks, h)
+}
+
+func TestVars(t *testing.T) {
+	f := &fakeHandler{
+		services: []*ipvs.Service{{
+			Address: net.ParseIP("10.0.0.1"), Protocol: ipvs.ProtocolTCP, Port: 80, SchedName: ipvs.RoundRobin,
+			Stats: ipvs.SvcStats{Connections: 5},
+		}},
+		destinations: []*ipvs.Destination{{Address: net.ParseIP("10.1.0.1")}, {Address: net.ParseIP("10.1.0.2")}},
+	}
+	v := Publish("ipvs_test", f)
+	assert.Equal(t, expvar.Get("ipvs_test"), expvar.Var(v))
+
+	assert.Equal(t, len(f.hooks), 1)
+	f.hooks[0](ipvs.CmdNewService, nil, errors.New("exists"))
+	f.hooks[0](ipvs.CmdNewService, nil, nil)
+
+	var st struct {
+		Services     int
+		Destinations int
+		Stats        map[string]map[string]uint64
+		Errors       map[string]int
+		Error        string
+	}
+	assert.NilError(t, json.Unmarshal([]byte(v.String()), &st))
+	assert.Equal(t, st.Services, 1)
+	assert.Equal(t, st.Destinations, 2)
+	assert.Equal(t, st.Stats["TCP 10.0.0.1:80 (rr)"]["connections"], uint64(5))
+	assert.DeepEqual(t, st.Errors, map[string]int{"NewService": 1})
+	assert.Equal(t, st.Error, "")
+
+	f.err = errors.New("dump failed")
+	assert.NilError(t, json.Unmarshal([]byte(v.String()), &st))
+	assert.Equal(t, st.Error, "dump failed")
+}
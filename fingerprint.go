@@ -0,0 +1,82 @@
+// +build linux
+
+package ipvs
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// ServiceSpec is the configuration of a service: the service itself, its
+// destinations and its local addresses. Statistics and connection counters
+// are not part of it.
+type ServiceSpec struct {
+	Service        *Service
+	Destinations   []*Destination
+	LocalAddresses []*LocalAddress
+}
+
+// Fingerprint returns a hash of the configuration of specs, independent of
+// the order of the services, destinations and local addresses and ignoring
+// statistics and the SvcFlagHashed flag maintained by the kernel. Reconcilers
+// can compare the fingerprint of their desired state with the one of
+// Handle.Fingerprint and skip a full diff when they match.
+//
+// Unset destination address families default to the one of their service,
+// like the kernel does; other fields must be described as the kernel
+// reports them to match.
+func Fingerprint(specs []*ServiceSpec) string {
+	sorted := make([]*ServiceSpec, len(specs))
+	copy(sorted, specs)
+	sort.Slice(sorted, func(a, b int) bool {
+		return serviceKey(sorted[a].Service) < serviceKey(sorted[b].Service)
+	})
+
+	h := sha256.New()
+	for _, spec := range sorted {
+		writeServiceSpec(h, spec)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func writeServiceSpec(w io.Writer, spec *ServiceSpec) {
+	s := spec.Service
+	fmt.Fprintf(w, "svc %s %s %#x %d %d %s\n",
+		serviceKey(s), s.SchedName, s.Flags&^SvcFlagHashed, s.Timeout, s.Netmask, s.PEName)
+
+	dsts := make([]string, len(spec.Destinations))
+	for n, d := range spec.Destinations {
+		family := d.AddressFamily
+		if family == 0 {
+			family = s.AddressFamily
+		}
+		dsts[n] = fmt.Sprintf("dst %s %d %d %#x %d %d\n",
+			destinationKey(d), family, d.Weight, d.ConnectionFlags, d.UpperThreshold, d.LowerThreshold)
+	}
+	sort.Strings(dsts)
+	for _, d := range dsts {
+		io.WriteString(w, d)
+	}
+
+	laddrs := make([]string, len(spec.LocalAddresses))
+	for n, l := range spec.LocalAddresses {
+		laddrs[n] = fmt.Sprintf("laddr %s\n", l.Address)
+	}
+	sort.Strings(laddrs)
+	for _, l := range laddrs {
+		io.WriteString(w, l)
+	}
+}
+
+// Fingerprint returns the fingerprint of the current configuration of every
+// service, see Fingerprint.
+func (i *Handle) Fingerprint() (string, error) {
+	specs, err := i.GetServicesWithDestinations(true)
+	if err != nil {
+		return "", err
+	}
+	return Fingerprint(specs), nil
+}
@@ -0,0 +1,52 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestFingerprint(t *testing.T) {
+	spec := func(port uint16, weights ...int) *ServiceSpec {
+		s := &ServiceSpec{Service: &Service{
+			AddressFamily: syscall.AF_INET,
+			Protocol:      syscall.IPPROTO_TCP,
+			Address:       net.ParseIP("10.0.0.1"),
+			Port:          port,
+			SchedName:     RoundRobin,
+			Netmask:       0xFFFFFFFF,
+		}}
+		for n, w := range weights {
+			s.Destinations = append(s.Destinations, &Destination{
+				Address: net.IPv4(10, 1, 0, byte(n+1)),
+				Port:    80,
+				Weight:  w,
+			})
+		}
+		return s
+	}
+
+	base := Fingerprint([]*ServiceSpec{spec(80, 1, 2), spec(443, 1)})
+	assert.Equal(t, len(base), 64)
+	assert.Equal(t, Fingerprint(nil), Fingerprint([]*ServiceSpec{}))
+
+	// Order, statistics, kernel flags and implicit families do not matter.
+	reordered := spec(80, 1, 2)
+	reordered.Destinations[0], reordered.Destinations[1] = reordered.Destinations[1], reordered.Destinations[0]
+	reordered.Service.Flags = SvcFlagHashed
+	reordered.Service.Stats.Connections = 42
+	reordered.Destinations[0].ActiveConnections = 3
+	reordered.Destinations[1].AddressFamily = syscall.AF_INET
+	assert.Equal(t, Fingerprint([]*ServiceSpec{spec(443, 1), reordered}), base)
+
+	assert.Assert(t, Fingerprint([]*ServiceSpec{spec(80, 1, 3), spec(443, 1)}) != base)
+	assert.Assert(t, Fingerprint([]*ServiceSpec{spec(80, 1, 2)}) != base)
+
+	laddrs := spec(80, 1, 2)
+	laddrs.LocalAddresses = []*LocalAddress{{Address: net.ParseIP("10.2.0.1")}}
+	assert.Assert(t, Fingerprint([]*ServiceSpec{laddrs, spec(443, 1)}) != base)
+}
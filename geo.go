@@ -0,0 +1,63 @@
+// +build linux
+
+package ipvs
+
+import "net"
+
+// GeoLocation is where an address is located.
+type GeoLocation struct {
+	// Country is the ISO 3166-1 alpha-2 code of the country, e.g. "FR".
+	Country string
+	// ASN is the number of the autonomous system announcing the address,
+	// and Organization the name of its operator.
+	ASN          uint32
+	Organization string
+}
+
+// GeoLookup locates addresses, e.g. with a MaxMind GeoLite2 Country and ASN
+// database. Lookup returns nil and no error for an address it cannot
+// locate.
+type GeoLookup interface {
+	Lookup(addr net.IP) (*GeoLocation, error)
+}
+
+// GeoLookupFunc adapts a function to the GeoLookup interface.
+type GeoLookupFunc func(addr net.IP) (*GeoLocation, error)
+
+// Lookup calls f(addr).
+func (f GeoLookupFunc) Lookup(addr net.IP) (*GeoLocation, error) {
+	return f(addr)
+}
+
+// geoCache memoizes the lookups of a GeoLookup, the same clients showing up
+// in many connections.
+type geoCache struct {
+	geo       GeoLookup
+	locations map[string]*GeoLocation
+}
+
+func newGeoCache(geo GeoLookup) *geoCache {
+	return &geoCache{geo: geo, locations: make(map[string]*GeoLocation)}
+}
+
+// lookup returns the location of addr, an empty one if unknown or if there
+// is no GeoLookup.
+func (c *geoCache) lookup(addr net.IP) (*GeoLocation, error) {
+	if c.geo == nil {
+		return &GeoLocation{}, nil
+	}
+	key := string(addr.To16())
+	if l, ok := c.locations[key]; ok {
+		return l, nil
+	}
+
+	l, err := c.geo.Lookup(addr)
+	if err != nil {
+		return nil, err
+	}
+	if l == nil {
+		l = &GeoLocation{}
+	}
+	c.locations[key] = l
+	return l, nil
+}
@@ -3,11 +3,14 @@ module github.com/kwanhur/ipvs
 go 1.13
 
 require (
-	github.com/moby/ipvs v1.0.1 // indirect
+	github.com/google/go-cmp v0.5.9 // indirect
+	github.com/moby/ipvs v1.0.1
 	github.com/pkg/errors v0.9.1 // indirect
 	github.com/sirupsen/logrus v1.4.2
 	github.com/vishvananda/netlink v1.1.0
 	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
 	golang.org/x/sys v0.0.0-20200302150141-5c8b2ff67527
+	google.golang.org/protobuf v1.27.1
+	gopkg.in/yaml.v3 v3.0.1
 	gotest.tools/v3 v3.0.3
 )
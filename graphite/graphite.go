@@ -0,0 +1,292 @@
+// +build linux
+
+// Package graphite writes IPVS statistics to Graphite, with the plaintext or
+// the pickle protocol.
+package graphite
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/sirupsen/logrus"
+)
+
+// Protocol is a Graphite carbon protocol.
+type Protocol string
+
+// Supported protocols.
+const (
+	Plaintext Protocol = "plaintext"
+	Pickle    Protocol = "pickle"
+)
+
+// Default metric path templates. The placeholders replaced in templates are
+// {service}, {protocol}, {address}, {port}, {fwmark}, {destination},
+// {destination_port} and {metric}. Dots and colons of the values are
+// replaced by underscores so that each one stays a single path node.
+const (
+	DefaultServiceTemplate     = "ipvs.services.{service}.{metric}"
+	DefaultDestinationTemplate = "ipvs.services.{service}.destinations.{destination}_{destination_port}.{metric}"
+)
+
+// DefaultBatchSize is the default number of metrics sent per pickle message.
+const DefaultBatchSize = 500
+
+// Metric is a Graphite data point.
+type Metric struct {
+	Path  string
+	Value float64
+	Time  time.Time
+}
+
+// Sink periodically writes stats snapshots to a carbon daemon.
+type Sink struct {
+	// Addr is the address of the carbon receiver, e.g. "localhost:2003"
+	// for plaintext or "localhost:2004" for pickle.
+	Addr string
+
+	// Network is "tcp" or "udp", defaults to "tcp". Pickle requires tcp.
+	Network string
+
+	// Protocol defaults to Plaintext.
+	Protocol Protocol
+
+	// ServiceTemplate and DestinationTemplate are the metric path templates
+	// of the service and destination metrics, see DefaultServiceTemplate and
+	// DefaultDestinationTemplate.
+	ServiceTemplate     string
+	DestinationTemplate string
+
+	// BatchSize is the maximum number of metrics per pickle message.
+	// Defaults to DefaultBatchSize.
+	BatchSize int
+
+	// Timeout bounds the connection and write of a snapshot. Defaults to
+	// 10 seconds.
+	Timeout time.Duration
+}
+
+// Run writes a snapshot of h every interval until ctx is done. Failures are
+// logged.
+func (s *Sink) Run(ctx context.Context, h *ipvs.Handle, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		snap, err := h.GetStatsSnapshot()
+		if err == nil {
+			err = s.Write(snap)
+		}
+		if err != nil {
+			logrus.Warnf("graphite: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write sends the metrics of snap.
+func (s *Sink) Write(snap *ipvs.StatsSnapshot) error {
+	network := s.Network
+	if network == "" {
+		network = "tcp"
+	}
+	protocol := s.Protocol
+	if protocol == "" {
+		protocol = Plaintext
+	}
+	if protocol == Pickle && network != "tcp" {
+		return fmt.Errorf("the pickle protocol requires tcp")
+	}
+	timeout := s.Timeout
+	if timeout <= 0 {
+		timeout = 10 * time.Second
+	}
+
+	var payloads [][]byte
+	metrics := s.Metrics(snap)
+	switch protocol {
+	case Plaintext:
+		payloads = append(payloads, EncodePlaintext(metrics))
+	case Pickle:
+		size := s.BatchSize
+		if size <= 0 {
+			size = DefaultBatchSize
+		}
+		for len(metrics) > 0 {
+			n := size
+			if n > len(metrics) {
+				n = len(metrics)
+			}
+			payloads = append(payloads, EncodePickle(metrics[:n]))
+			metrics = metrics[n:]
+		}
+	default:
+		return fmt.Errorf("unsupported protocol %q", protocol)
+	}
+
+	conn, err := net.DialTimeout(network, s.Addr, timeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if err := conn.SetWriteDeadline(time.Now().Add(timeout)); err != nil {
+		return err
+	}
+	for _, p := range payloads {
+		if _, err := conn.Write(p); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Metrics returns the metrics of snap, named after the sink templates.
+func (s *Sink) Metrics(snap *ipvs.StatsSnapshot) []Metric {
+	svcTemplate := s.ServiceTemplate
+	if svcTemplate == "" {
+		svcTemplate = DefaultServiceTemplate
+	}
+	dstTemplate := s.DestinationTemplate
+	if dstTemplate == "" {
+		dstTemplate = DefaultDestinationTemplate
+	}
+
+	var metrics []Metric
+	for _, sd := range snap.Services {
+		svc := sd.Service
+		vars := serviceVars(svc)
+		for _, f := range statsFields(svc.Stats) {
+			metrics = append(metrics, Metric{Path: expand(svcTemplate, vars, f.name), Value: f.value, Time: snap.Time})
+		}
+
+		for _, d := range sd.Destinations {
+			dvars := append(vars[:len(vars):len(vars)],
+				"{destination}", sanitize(d.Address.String()),
+				"{destination_port}", strconv.Itoa(int(d.Port)),
+			)
+			fields := append(statsFields(ipvs.SvcStats(d.Stats)),
+				field{"active_connections", float64(d.ActiveConnections)},
+				field{"inactive_connections", float64(d.InactiveConnections)},
+				field{"persistent_connections", float64(d.PersistentConnections)},
+				field{"weight", float64(d.Weight)},
+			)
+			for _, f := range fields {
+				metrics = append(metrics, Metric{Path: expand(dstTemplate, dvars, f.name), Value: f.value, Time: snap.Time})
+			}
+		}
+	}
+	return metrics
+}
+
+// serviceVars returns the template placeholders of svc and their values.
+func serviceVars(svc *ipvs.Service) []string {
+	protocol := strings.ToLower(svc.Protocol.String())
+	address := sanitize(svc.Address.String())
+	port := strconv.Itoa(int(svc.Port))
+	fwmark := strconv.FormatUint(uint64(svc.FWMark), 10)
+
+	service := protocol + "_" + address + "_" + port
+	if svc.FWMark > 0 {
+		service = "fwmark_" + fwmark
+	}
+
+	return []string{
+		"{service}", service,
+		"{protocol}", protocol,
+		"{address}", address,
+		"{port}", port,
+		"{fwmark}", fwmark,
+	}
+}
+
+func expand(template string, vars []string, metric string) string {
+	vars = append(vars[:len(vars):len(vars)], "{metric}", metric)
+	return strings.NewReplacer(vars...).Replace(template)
+}
+
+var sanitizer = strings.NewReplacer(".", "_", ":", "_", " ", "_")
+
+func sanitize(v string) string {
+	return sanitizer.Replace(v)
+}
+
+type field struct {
+	name  string
+	value float64
+}
+
+func statsFields(st ipvs.SvcStats) []field {
+	return []field{
+		{"connections", float64(st.Connections)},
+		{"packets_in", float64(st.PacketsIn)},
+		{"packets_out", float64(st.PacketsOut)},
+		{"bytes_in", float64(st.BytesIn)},
+		{"bytes_out", float64(st.BytesOut)},
+		{"cps", float64(st.CPS)},
+		{"pps_in", float64(st.PPSIn)},
+		{"pps_out", float64(st.PPSOut)},
+		{"bps_in", float64(st.BPSIn)},
+		{"bps_out", float64(st.BPSOut)},
+	}
+}
+
+// EncodePlaintext returns metrics in the plaintext protocol, one
+// "path value timestamp" line per metric.
+func EncodePlaintext(metrics []Metric) []byte {
+	var b bytes.Buffer
+	for _, m := range metrics {
+		fmt.Fprintf(&b, "%s %s %d\n", m.Path, strconv.FormatFloat(m.Value, 'f', -1, 64), m.Time.Unix())
+	}
+	return b.Bytes()
+}
+
+// Pickle opcodes, see Python's pickletools.
+const (
+	pickleProto      = 0x80
+	pickleEmptyList  = ']'
+	pickleMark       = '('
+	pickleAppends    = 'e'
+	pickleBinUnicode = 'X'
+	pickleBinFloat   = 'G'
+	pickleTuple2     = 0x86
+	pickleStop       = '.'
+)
+
+// EncodePickle returns metrics in the pickle protocol: a 4 bytes big endian
+// length header followed by the pickled list of (path, (timestamp, value))
+// tuples.
+func EncodePickle(metrics []Metric) []byte {
+	var p bytes.Buffer
+	p.Write([]byte{pickleProto, 2, pickleEmptyList, pickleMark})
+	for _, m := range metrics {
+		p.WriteByte(pickleBinUnicode)
+		binary.Write(&p, binary.LittleEndian, uint32(len(m.Path)))
+		p.WriteString(m.Path)
+
+		p.WriteByte(pickleBinFloat)
+		binary.Write(&p, binary.BigEndian, math.Float64bits(float64(m.Time.Unix())))
+		p.WriteByte(pickleBinFloat)
+		binary.Write(&p, binary.BigEndian, math.Float64bits(m.Value))
+
+		p.Write([]byte{pickleTuple2, pickleTuple2})
+	}
+	p.Write([]byte{pickleAppends, pickleStop})
+
+	res := make([]byte, 4, 4+p.Len())
+	binary.BigEndian.PutUint32(res, uint32(p.Len()))
+	return append(res, p.Bytes()...)
+}
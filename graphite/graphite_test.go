@@ -0,0 +1,94 @@
+// +build linux
+
+package graphite
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func testSnapshot() *ipvs.StatsSnapshot {
+	return &ipvs.StatsSnapshot{
+		Time: time.Unix(1577836800, 0),
+		Services: []*ipvs.ServiceDestinations{{
+			Service: &ipvs.Service{
+				Protocol: 6,
+				Address:  net.ParseIP("10.0.0.1"),
+				Port:     80,
+				Stats:    ipvs.SvcStats{Connections: 3},
+			},
+			Destinations: []*ipvs.Destination{{
+				Address:           net.ParseIP("10.1.0.1"),
+				Port:              8080,
+				ActiveConnections: 2,
+			}},
+		}},
+	}
+}
+
+func TestMetrics(t *testing.T) {
+	s := &Sink{
+		ServiceTemplate:     "lb.{protocol}.{address}.{port}.{metric}",
+		DestinationTemplate: "lb.{service}.{destination}.{metric}",
+	}
+
+	metrics := s.Metrics(testSnapshot())
+	assert.Equal(t, len(metrics), 24)
+	assert.Equal(t, metrics[0], Metric{Path: "lb.tcp.10_0_0_1.80.connections", Value: 3, Time: time.Unix(1577836800, 0)})
+	assert.Equal(t, metrics[20].Path, "lb.tcp_10_0_0_1_80.10_1_0_1.active_connections")
+	assert.Equal(t, metrics[20].Value, 2.0)
+
+	s = &Sink{}
+	metrics = s.Metrics(testSnapshot())
+	assert.Equal(t, metrics[10].Path, "ipvs.services.tcp_10_0_0_1_80.destinations.10_1_0_1_8080.connections")
+}
+
+func TestEncodePickle(t *testing.T) {
+	b := EncodePickle([]Metric{{Path: "a.b", Value: 1.5, Time: time.Unix(100, 0)}})
+	assert.DeepEqual(t, b, []byte{
+		0, 0, 0, 34,
+		0x80, 2, ']', '(',
+		'X', 3, 0, 0, 0, 'a', '.', 'b',
+		'G', 0x40, 0x59, 0, 0, 0, 0, 0, 0,
+		'G', 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0x86, 0x86,
+		'e', '.',
+	})
+}
+
+func TestWritePlaintext(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+
+	lines := make(chan []string, 1)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(lines)
+			return
+		}
+		defer conn.Close()
+
+		var res []string
+		scanner := bufio.NewScanner(conn)
+		for scanner.Scan() {
+			res = append(res, scanner.Text())
+		}
+		lines <- res
+	}()
+
+	s := &Sink{Addr: l.Addr().String()}
+	assert.NilError(t, s.Write(testSnapshot()))
+
+	got := <-lines
+	assert.Equal(t, len(got), 24)
+	assert.Equal(t, got[0], "ipvs.services.tcp_10_0_0_1_80.connections 3 1577836800")
+	assert.Assert(t, strings.HasSuffix(got[23], ".weight 0 1577836800"))
+}
@@ -0,0 +1,41 @@
+// +build linux
+
+package ipvs
+
+// Handler is the set of operations programming IPVS, implemented by Handle
+// and by the wrappers around it like CachedHandler. Components depending on
+// Handler rather than Handle can be given a wrapper, or a fake in tests.
+type Handler interface {
+	Close()
+
+	NewService(s *Service) error
+	IsServicePresent(s *Service) bool
+	UpdateService(s *Service) error
+	DelService(s *Service) error
+	GetServices() ([]*Service, error)
+	GetService(s *Service) (*Service, error)
+	Flush() error
+	ZeroService(s *Service) error
+	Zero() error
+
+	NewDestination(s *Service, d *Destination) error
+	UpdateDestination(s *Service, d *Destination) error
+	DelDestination(s *Service, d *Destination) error
+	GetDestinations(s *Service) ([]*Destination, error)
+
+	NewLocalAddress(s *Service, l *LocalAddress) error
+	DelLocalAddress(s *Service, l *LocalAddress) error
+	GetLocalAddresses(s *Service) ([]*LocalAddress, error)
+
+	GetConfig() (*Config, error)
+	SetConfig(c *Config) error
+	GetInfo() (*Info, error)
+
+	GetDaemons() ([]*Daemon, error)
+	NewDaemon(d *Daemon) error
+	DelDaemon(d *Daemon) error
+}
+
+var _ Handler = (*Handle)(nil)
+
+var _ StatsSource = (Handler)(nil)
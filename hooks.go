@@ -0,0 +1,141 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+
+	"github.com/kwanhur/ipvs/netlink"
+)
+
+// Command identifies an IPVS generic netlink command issued by a handle.
+type Command uint8
+
+// Commands passed to hooks registered with OnBefore and OnAfter.
+const (
+	CmdNewService = Command(netlink.CmdNewService)
+	CmdSetService = Command(netlink.CmdSetService)
+	CmdDelService = Command(netlink.CmdDelService)
+	CmdGetService = Command(netlink.CmdGetService)
+	CmdNewDest    = Command(netlink.CmdNewDest)
+	CmdSetDest    = Command(netlink.CmdSetDest)
+	CmdDelDest    = Command(netlink.CmdDelDest)
+	CmdGetDest    = Command(netlink.CmdGetDest)
+	CmdNewDaemon  = Command(netlink.CmdNewDaemon)
+	CmdDelDaemon  = Command(netlink.CmdDelDaemon)
+	CmdGetDaemon  = Command(netlink.CmdGetDaemon)
+	CmdSetConfig  = Command(netlink.CmdSetConfig)
+	CmdGetConfig  = Command(netlink.CmdGetConfig)
+	CmdGetInfo    = Command(netlink.CmdGetInfo)
+	CmdZero       = Command(netlink.CmdZero)
+	CmdFlush      = Command(netlink.CmdFlush)
+	CmdNewLaddr   = Command(netlink.CmdNewLaddr)
+	CmdDelLaddr   = Command(netlink.CmdDelLaddr)
+	CmdGetLaddr   = Command(netlink.CmdGetLaddr)
+)
+
+var commandNames = map[Command]string{
+	CmdNewService: "NewService",
+	CmdSetService: "SetService",
+	CmdDelService: "DelService",
+	CmdGetService: "GetService",
+	CmdNewDest:    "NewDest",
+	CmdSetDest:    "SetDest",
+	CmdDelDest:    "DelDest",
+	CmdGetDest:    "GetDest",
+	CmdNewDaemon:  "NewDaemon",
+	CmdDelDaemon:  "DelDaemon",
+	CmdGetDaemon:  "GetDaemon",
+	CmdSetConfig:  "SetConfig",
+	CmdGetConfig:  "GetConfig",
+	CmdGetInfo:    "GetInfo",
+	CmdZero:       "Zero",
+	CmdFlush:      "Flush",
+	CmdNewLaddr:   "NewLaddr",
+	CmdDelLaddr:   "DelLaddr",
+	CmdGetLaddr:   "GetLaddr",
+}
+
+// String returns the name of the command
+func (c Command) String() string {
+	if name, ok := commandNames[c]; ok {
+		return name
+	}
+	return fmt.Sprintf("Command(%d)", uint8(c))
+}
+
+// BeforeHook is called before a command is sent to the kernel. obj is the
+// most specific object carried by the command (a *Destination for destination
+// commands, a *Service for service commands, ...), or nil for commands
+// without one such as Flush or a dump.
+type BeforeHook func(cmd Command, obj interface{})
+
+// CheckHook is called before a command changing the configuration is sent
+// to the kernel, or recorded by a dry run handle. s is the service the
+// command applies to, if any, and obj is the object passed to BeforeHook. A
+// non-nil error vetoes the command: it is returned to the caller without
+// the command being sent, and the other hooks are not called.
+type CheckHook func(cmd Command, s *Service, obj interface{}) error
+
+// AfterHook is called once the kernel answered a command, with the error
+// returned to the caller.
+type AfterHook func(cmd Command, obj interface{}, err error)
+
+// OnBefore registers a hook called before every command issued by the
+// handle. Hooks run synchronously in registration order.
+func (i *Handle) OnBefore(h BeforeHook) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.beforeHooks = append(i.beforeHooks, h)
+}
+
+// OnCheck registers a hook called before every command of the handle
+// changing the configuration, which can veto it, e.g. the Check of a
+// Policy. Hooks run synchronously in registration order, until one returns
+// an error.
+func (i *Handle) OnCheck(h CheckHook) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.checkHooks = append(i.checkHooks, h)
+}
+
+// OnAfter registers a hook called after every command issued by the
+// handle. Hooks run synchronously in registration order.
+func (i *Handle) OnAfter(h AfterHook) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.afterHooks = append(i.afterHooks, h)
+}
+
+func (i *Handle) runBeforeHooks(cmd Command, obj interface{}) {
+	i.mu.RLock()
+	hooks := i.beforeHooks
+	i.mu.RUnlock()
+
+	for _, h := range hooks {
+		h(cmd, obj)
+	}
+}
+
+func (i *Handle) runCheckHooks(cmd Command, s *Service, obj interface{}) error {
+	i.mu.RLock()
+	hooks := i.checkHooks
+	i.mu.RUnlock()
+
+	for _, h := range hooks {
+		if err := h(cmd, s, obj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (i *Handle) runAfterHooks(cmd Command, obj interface{}, err error) {
+	i.mu.RLock()
+	hooks := i.afterHooks
+	i.mu.RUnlock()
+
+	for _, h := range hooks {
+		h(cmd, obj, err)
+	}
+}
@@ -0,0 +1,283 @@
+// +build linux
+
+// Package influx writes IPVS statistics in the InfluxDB line protocol, over
+// HTTP or UDP.
+package influx
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/sirupsen/logrus"
+)
+
+// Default measurement names.
+const (
+	ServiceMeasurement     = "ipvs_service"
+	DestinationMeasurement = "ipvs_destination"
+)
+
+// DefaultBatchSize is the default number of lines sent per write.
+const DefaultBatchSize = 500
+
+// Sink periodically writes stats snapshots to InfluxDB or any endpoint
+// speaking its line protocol, like Telegraf.
+type Sink struct {
+	// URL is the write endpoint, e.g.
+	// "http://localhost:8086/write?db=ipvs" or "udp://localhost:8089".
+	URL string
+
+	// ServiceMeasurement and DestinationMeasurement override the
+	// measurement names of the service and destination points.
+	ServiceMeasurement     string
+	DestinationMeasurement string
+
+	// Tags are added to every point.
+	Tags map[string]string
+
+	// ServiceTags, if set, returns additional tags for the points of a
+	// service and its destinations, e.g. to map a virtual address to an
+	// application name.
+	ServiceTags func(s *ipvs.Service) map[string]string
+
+	// BatchSize is the maximum number of lines per HTTP request or UDP
+	// datagram. Defaults to DefaultBatchSize; UDP batches should stay small
+	// enough to fit in a datagram.
+	BatchSize int
+
+	// Client is used for HTTP writes. Defaults to a client with a 10
+	// seconds timeout.
+	Client *http.Client
+}
+
+// Run writes a snapshot of h every interval until ctx is done. Failures are
+// logged.
+func (s *Sink) Run(ctx context.Context, h *ipvs.Handle, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		snap, err := h.GetStatsSnapshot()
+		if err == nil {
+			err = s.Write(ctx, snap)
+		}
+		if err != nil {
+			logrus.Warnf("influx: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Write sends the points of snap in batches of BatchSize lines.
+func (s *Sink) Write(ctx context.Context, snap *ipvs.StatsSnapshot) error {
+	u, err := url.Parse(s.URL)
+	if err != nil {
+		return err
+	}
+
+	lines := s.Encode(snap)
+	size := s.BatchSize
+	if size <= 0 {
+		size = DefaultBatchSize
+	}
+
+	for len(lines) > 0 {
+		n := size
+		if n > len(lines) {
+			n = len(lines)
+		}
+		batch := []byte(strings.Join(lines[:n], "\n") + "\n")
+		lines = lines[n:]
+
+		switch u.Scheme {
+		case "http", "https":
+			err = s.post(ctx, u.String(), batch)
+		case "udp":
+			err = send(u.Host, batch)
+		default:
+			err = fmt.Errorf("unsupported scheme %q", u.Scheme)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Sink) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+
+	client := s.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+func send(addr string, body []byte) error {
+	conn, err := net.Dial("udp", addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.Write(body)
+	return err
+}
+
+// Encode returns the line protocol representation of snap, one line per
+// service and destination.
+func (s *Sink) Encode(snap *ipvs.StatsSnapshot) []string {
+	svcMeasurement := s.ServiceMeasurement
+	if svcMeasurement == "" {
+		svcMeasurement = ServiceMeasurement
+	}
+	dstMeasurement := s.DestinationMeasurement
+	if dstMeasurement == "" {
+		dstMeasurement = DestinationMeasurement
+	}
+	ts := strconv.FormatInt(snap.Time.UnixNano(), 10)
+
+	var lines []string
+	for _, sd := range snap.Services {
+		tags := s.serviceTags(sd.Service)
+		lines = append(lines, line(svcMeasurement, tags, statsFields(sd.Service.Stats), ts))
+
+		for _, d := range sd.Destinations {
+			dtags := make(map[string]string, len(tags)+2)
+			for k, v := range tags {
+				dtags[k] = v
+			}
+			dtags["destination"] = d.Address.String()
+			dtags["destination_port"] = strconv.Itoa(int(d.Port))
+
+			fields := statsFields(ipvs.SvcStats(d.Stats))
+			fields = append(fields,
+				field{"active_connections", strconv.Itoa(d.ActiveConnections) + "i"},
+				field{"inactive_connections", strconv.Itoa(d.InactiveConnections) + "i"},
+				field{"persistent_connections", strconv.Itoa(d.PersistentConnections) + "i"},
+				field{"weight", strconv.Itoa(d.Weight) + "i"},
+			)
+			lines = append(lines, line(dstMeasurement, dtags, fields, ts))
+		}
+	}
+	return lines
+}
+
+func (s *Sink) serviceTags(svc *ipvs.Service) map[string]string {
+	tags := make(map[string]string)
+	for k, v := range s.Tags {
+		tags[k] = v
+	}
+	if svc.FWMark > 0 {
+		tags["fwmark"] = strconv.FormatUint(uint64(svc.FWMark), 10)
+	} else {
+		tags["protocol"] = strings.ToLower(svc.Protocol.String())
+		tags["address"] = svc.Address.String()
+		tags["port"] = strconv.Itoa(int(svc.Port))
+	}
+	if svc.SchedName != "" {
+		tags["scheduler"] = svc.SchedName
+	}
+	if s.ServiceTags != nil {
+		for k, v := range s.ServiceTags(svc) {
+			tags[k] = v
+		}
+	}
+	return tags
+}
+
+type field struct {
+	key, value string
+}
+
+// statsFields returns the counters of st as unsigned integer fields, which
+// InfluxDB supports since 1.8: the kernel counters do not fit in the signed
+// integers of older versions.
+func statsFields(st ipvs.SvcStats) []field {
+	u := func(v uint64) string {
+		return strconv.FormatUint(v, 10) + "u"
+	}
+	return []field{
+		{"connections", u(st.Connections)},
+		{"packets_in", u(st.PacketsIn)},
+		{"packets_out", u(st.PacketsOut)},
+		{"bytes_in", u(st.BytesIn)},
+		{"bytes_out", u(st.BytesOut)},
+		{"cps", u(st.CPS)},
+		{"pps_in", u(st.PPSIn)},
+		{"pps_out", u(st.PPSOut)},
+		{"bps_in", u(st.BPSIn)},
+		{"bps_out", u(st.BPSOut)},
+	}
+}
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	tagEscaper         = strings.NewReplacer(",", `\,`, " ", `\ `, "=", `\=`)
+)
+
+// line formats a point, with its tags sorted by key as recommended for
+// write performance. Empty tag values are not allowed by the protocol and
+// skipped.
+func line(measurement string, tags map[string]string, fields []field, ts string) string {
+	var b strings.Builder
+	b.WriteString(measurementEscaper.Replace(measurement))
+
+	keys := make([]string, 0, len(tags))
+	for k := range tags {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		if tags[k] == "" {
+			continue
+		}
+		b.WriteByte(',')
+		b.WriteString(tagEscaper.Replace(k))
+		b.WriteByte('=')
+		b.WriteString(tagEscaper.Replace(tags[k]))
+	}
+
+	for n, f := range fields {
+		if n == 0 {
+			b.WriteByte(' ')
+		} else {
+			b.WriteByte(',')
+		}
+		b.WriteString(tagEscaper.Replace(f.key))
+		b.WriteByte('=')
+		b.WriteString(f.value)
+	}
+
+	b.WriteByte(' ')
+	b.WriteString(ts)
+	return b.String()
+}
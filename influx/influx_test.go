@@ -0,0 +1,93 @@
+// +build linux
+
+package influx
+
+import (
+	"context"
+	"io/ioutil"
+	"math"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func testSnapshot() *ipvs.StatsSnapshot {
+	return &ipvs.StatsSnapshot{
+		Time: time.Unix(1577836800, 0),
+		Services: []*ipvs.ServiceDestinations{{
+			Service: &ipvs.Service{
+				Protocol:  6,
+				Address:   net.ParseIP("10.0.0.1"),
+				Port:      80,
+				SchedName: ipvs.RoundRobin,
+				Stats:     ipvs.SvcStats{Connections: 3, BytesIn: math.MaxUint64},
+			},
+			Destinations: []*ipvs.Destination{{
+				Address:           net.ParseIP("10.1.0.1"),
+				Port:              8080,
+				Weight:            1,
+				ActiveConnections: 2,
+				Stats:             ipvs.DstStats{Connections: 3},
+			}},
+		}},
+	}
+}
+
+func TestEncode(t *testing.T) {
+	s := &Sink{
+		Tags: map[string]string{"host": "lb 1"},
+		ServiceTags: func(svc *ipvs.Service) map[string]string {
+			return map[string]string{"app": "web,front"}
+		},
+	}
+
+	lines := s.Encode(testSnapshot())
+	assert.DeepEqual(t, lines, []string{
+		`ipvs_service,address=10.0.0.1,app=web\,front,host=lb\ 1,port=80,protocol=tcp,scheduler=rr ` +
+			`connections=3u,packets_in=0u,packets_out=0u,bytes_in=18446744073709551615u,bytes_out=0u,cps=0u,pps_in=0u,pps_out=0u,bps_in=0u,bps_out=0u ` +
+			`1577836800000000000`,
+		`ipvs_destination,address=10.0.0.1,app=web\,front,destination=10.1.0.1,destination_port=8080,host=lb\ 1,port=80,protocol=tcp,scheduler=rr ` +
+			`connections=3u,packets_in=0u,packets_out=0u,bytes_in=0u,bytes_out=0u,cps=0u,pps_in=0u,pps_out=0u,bps_in=0u,bps_out=0u,` +
+			`active_connections=2i,inactive_connections=0i,persistent_connections=0i,weight=1i ` +
+			`1577836800000000000`,
+	})
+}
+
+func TestWriteHTTP(t *testing.T) {
+	var bodies []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NilError(t, err)
+		assert.Equal(t, r.URL.Query().Get("db"), "ipvs")
+		bodies = append(bodies, string(body))
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer srv.Close()
+
+	s := &Sink{URL: srv.URL + "/write?db=ipvs", BatchSize: 1}
+	assert.NilError(t, s.Write(context.Background(), testSnapshot()))
+	assert.Equal(t, len(bodies), 2)
+	assert.Assert(t, strings.HasPrefix(bodies[0], "ipvs_service,"))
+	assert.Assert(t, strings.HasPrefix(bodies[1], "ipvs_destination,"))
+}
+
+func TestWriteUDP(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer conn.Close()
+
+	s := &Sink{URL: "udp://" + conn.LocalAddr().String()}
+	assert.NilError(t, s.Write(context.Background(), testSnapshot()))
+
+	buf := make([]byte, 4096)
+	assert.NilError(t, conn.SetReadDeadline(time.Now().Add(5*time.Second)))
+	n, _, err := conn.ReadFrom(buf)
+	assert.NilError(t, err)
+	assert.Equal(t, strings.Count(string(buf[:n]), "\n"), 2)
+}
@@ -3,14 +3,16 @@
 package ipvs
 
 import (
+	"errors"
 	"fmt"
-	"net"
+	"sync"
+	"syscall"
 	"time"
 
+	"github.com/kwanhur/ipvs/netlink"
 	"github.com/vishvananda/netlink/nl"
 	"github.com/vishvananda/netns"
 	"golang.org/x/sys/unix"
-	"syscall"
 )
 
 const (
@@ -18,170 +20,120 @@ const (
 	netlinkSendSocketTimeout  = 30 * time.Second
 )
 
-// IPProto specifies the protocol encapsulated within an IP datagram
-type IPProto uint16
-
-// String return name of the protocol
-func (p IPProto) String() string {
-	switch p {
-	case syscall.IPPROTO_TCP:
-		return "TCP"
-	case syscall.IPPROTO_UDP:
-		return "UDP"
-	}
+// Handle provides a namespace specific ipvs handle to program ipvs
+// rules.
+type Handle struct {
+	seq  uint32
+	opts *options
 
-	return fmt.Sprintf("IP(%d)", p)
-}
-
-// Value return number of the protocol
-func (p IPProto) Value() uint16 {
-	return uint16(p)
-}
-
-// Service defines an IPVS service in its entirety.
-type Service struct {
-	// Virtual service address.
-	Address  net.IP
-	Protocol IPProto
-	Port     uint16
-	FWMark   uint32 // Firewall mark of the service.
-
-	// Virtual service options.
-	SchedName     string
-	Flags         uint32
-	Timeout       uint32
-	Netmask       uint32
-	AddressFamily uint16
-	PEName        string
-	Stats         SvcStats
-}
-
-// String returns a string representation of a service
-func (svc Service) String() string {
-	switch {
-	case svc.FWMark > 0:
-		return fmt.Sprintf("FMW %d (%s)", svc.FWMark, svc.SchedName)
-	case svc.Address.To4() == nil:
-		return fmt.Sprintf("%v [%v]:%d (%s)", svc.Protocol, svc.Address, svc.Port, svc.SchedName)
-	default:
-		return fmt.Sprintf("%v %v:%d (%s)", svc.Protocol, svc.Address, svc.Port, svc.SchedName)
-	}
-}
+	// reqMu serializes the requests on the socket, whose answers would
+	// otherwise be read by the wrong request.
+	reqMu sync.Mutex
 
-// SvcStats defines an IPVS service statistics
-type SvcStats struct {
-	Connections uint32
-	PacketsIn   uint32
-	PacketsOut  uint32
-	BytesIn     uint64
-	BytesOut    uint64
-	CPS         uint32
-	BPSOut      uint32
-	PPSIn       uint32
-	PPSOut      uint32
-	BPSIn       uint32
-}
+	// batchMu serializes the batches of changes holding the host lock,
+	// see WithHostLock.
+	batchMu sync.Mutex
 
-// Destination defines an IPVS destination (real server) in its
-// entirety.
-type Destination struct {
-	Address               net.IP
-	Port                  uint16
-	Weight                int
-	ConnectionFlags       uint32
-	AddressFamily         uint16
-	UpperThreshold        uint32
-	LowerThreshold        uint32
-	ActiveConnections     int
-	InactiveConnections   int
-	PersistentConnections int
-	Stats                 DstStats
+	mu           sync.RWMutex
+	sock         *nl.NetlinkSocket
+	closed       bool
+	checkHooks   []CheckHook
+	beforeHooks  []BeforeHook
+	afterHooks   []AfterHook
+	bus          *EventBus
+	quota        Quota
+	reachability ReachabilityCheck
+	plan         []Event
+	baselines    map[string]DstStats
 }
 
-// DstStats defines IPVS destination (real server) statistics
-type DstStats SvcStats
-
-// LocalAddress defines in IPVS laddr in its entirety
-type LocalAddress struct {
-	Address     net.IP
-	Conflicts   uint64
-	Connections uint32
+// New provides a new ipvs handle in the namespace pointed to by the
+// passed path. It will return a valid handle or an error in case an
+// error occurred while creating the handle.
+func New(path string) (*Handle, error) {
+	return NewWithOptions(WithNetNSPath(path))
 }
 
-// Config defines IPVS timeout configuration
-type Config struct {
-	TimeoutTCP    time.Duration
-	TimeoutTCPFin time.Duration
-	TimeoutUDP    time.Duration
-}
+// NewWithOptions provides a new ipvs handle configured by opts, in the
+// namespace of the calling process unless WithNetNSPath or WithNetNSFd is
+// given.
+func NewWithOptions(opts ...Option) (*Handle, error) {
+	netlink.Setup()
 
-// Info defines IPVS info
-type Info struct {
-	Version       *Version
-	ConnTableSize uint32
-}
+	o := defaultOptions()
+	for _, opt := range opts {
+		opt(o)
+	}
 
-// Version defines IPVS version
-type Version struct {
-	Major uint
-	Minor uint
-	Patch uint
-}
+	sock, err := openSocket(o)
+	if err != nil {
+		return nil, err
+	}
 
-// String returns a string of IPVS version
-func (v *Version) String() string {
-	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
-}
+	h := &Handle{sock: sock, opts: o}
+	trackHandle(h)
 
-type Daemon struct {
-	State    uint32
-	SyncId   uint32
-	McastIfn string
+	return h, nil
 }
 
-// Handle provides a namespace specific ipvs handle to program ipvs
-// rules.
-type Handle struct {
-	seq  uint32
-	sock *nl.NetlinkSocket
-}
-
-// New provides a new ipvs handle in the namespace pointed to by the
-// passed path. It will return a valid handle or an error in case an
-// error occurred while creating the handle.
-func New(path string) (*Handle, error) {
-	setup()
-
-	n := netns.None()
-	if path != "" {
+// openSocket opens a generic netlink socket configured by o.
+func openSocket(o *options) (*nl.NetlinkSocket, error) {
+	n := netns.NsHandle(o.nsFd)
+	if o.nsPath != "" {
 		var err error
-		n, err = netns.GetFromPath(path)
+		n, err = netns.GetFromPath(o.nsPath)
 		if err != nil {
 			return nil, err
 		}
+		defer n.Close()
 	}
-	defer n.Close()
 
 	sock, err := nl.GetNetlinkSocketAt(n, netns.None(), unix.NETLINK_GENERIC)
 	if err != nil {
 		return nil, err
 	}
+	if err := setupSocket(sock, o); err != nil {
+		sock.Close()
+		return nil, err
+	}
+	return sock, nil
+}
+
+func setupSocket(sock *nl.NetlinkSocket, o *options) error {
 	// Add operation timeout to avoid deadlocks
-	tv := unix.NsecToTimeval(netlinkSendSocketTimeout.Nanoseconds())
+	tv := unix.NsecToTimeval(o.sendTimeout.Nanoseconds())
 	if err := sock.SetSendTimeout(&tv); err != nil {
-		return nil, err
+		return err
 	}
-	tv = unix.NsecToTimeval(netlinkRecvSocketsTimeout.Nanoseconds())
+	tv = unix.NsecToTimeval(o.recvTimeout.Nanoseconds())
 	if err := sock.SetReceiveTimeout(&tv); err != nil {
-		return nil, err
+		return err
+	}
+	if o.rcvBuf > 0 {
+		opt := unix.SO_RCVBUF
+		if o.rcvBufForce {
+			opt = unix.SO_RCVBUFFORCE
+		}
+		return unix.SetsockoptInt(sock.GetFd(), unix.SOL_SOCKET, opt, o.rcvBuf)
 	}
+	return nil
+}
 
-	return &Handle{sock: sock}, nil
+// LoadScheduler loads the kernel module of the scheduler name, e.g.
+// WeightedRoundRobin. The kernel loads schedulers on demand when a service
+// uses them; loading them ahead of time surfaces a missing module early.
+// Loads racing with other processes are retried, see netlink.LoadModule.
+func LoadScheduler(name string) error {
+	return netlink.LoadModule("ip_vs_" + name)
 }
 
 // Close closes the ipvs handle. The handle is invalid after Close
 // returns.
 func (i *Handle) Close() {
+	untrackHandle(i)
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.closed = true
 	if i.sock != nil {
 		i.sock.Close()
 	}
@@ -189,84 +141,194 @@ func (i *Handle) Close() {
 
 // NewService creates a new ipvs service in the passed handle.
 func (i *Handle) NewService(s *Service) error {
-	return i.doCmd(s, nil, ipvsCmdNewService)
+	if err := i.checkServiceQuota(); err != nil {
+		return err
+	}
+	return i.doCmd(s, nil, netlink.CmdNewService)
 }
 
 // IsServicePresent queries for the ipvs service in the passed handle.
 func (i *Handle) IsServicePresent(s *Service) bool {
-	return nil == i.doCmd(s, nil, ipvsCmdGetService)
+	return nil == i.doCmd(s, nil, netlink.CmdGetService)
 }
 
 // UpdateService updates an already existing service in the passed
 // handle.
 func (i *Handle) UpdateService(s *Service) error {
-	return i.doCmd(s, nil, ipvsCmdSetService)
+	return i.doCmd(s, nil, netlink.CmdSetService)
 }
 
 // DelService deletes an already existing service in the passed
 // handle.
 func (i *Handle) DelService(s *Service) error {
-	return i.doCmd(s, nil, ipvsCmdDelService)
+	err := i.doCmd(s, nil, netlink.CmdDelService)
+	if err == nil {
+		i.dropBaselines(s, nil)
+	}
+	return err
 }
 
 // Flush deletes all existing services in the passed
 // handle.
 func (i *Handle) Flush() error {
-	_, err := i.doCmdWithoutAttr(ipvsCmdFlush)
+	_, err := i.doCmdWithoutAttr(netlink.CmdFlush)
+	if err == nil {
+		i.dropBaselines(nil, nil)
+	}
 	return err
 }
 
+// FlushWhere deletes the services, along with their destinations, for which
+// match returns true, and returns the number of services deleted. Unlike
+// Flush it leaves alone the services managed by other components.
+func (i *Handle) FlushWhere(match func(s *Service) bool) (n int, err error) {
+	err = i.batch(func() error {
+		n, err = i.flushWhere(match)
+		return err
+	})
+	return n, err
+}
+
+func (i *Handle) flushWhere(match func(s *Service) bool) (int, error) {
+	svcs, err := i.GetServices()
+	if err != nil {
+		return 0, err
+	}
+
+	n := 0
+	for _, s := range svcs {
+		if !match(s) {
+			continue
+		}
+		if err := i.DelService(s); err != nil {
+			return n, err
+		}
+		n++
+	}
+	return n, nil
+}
+
 // ZeroService zero the packet, byte and rate counters of a service in the passed
 // handle.
 func (i *Handle) ZeroService(s *Service) error {
-	return i.doCmd(s, nil, ipvsCmdZero)
+	err := i.doCmd(s, nil, netlink.CmdZero)
+	if err == nil {
+		i.dropBaselines(s, nil)
+	}
+	return err
 }
 
 // Zero zero the packet, byte and rate counters of services in the passed
 // handle.
 func (i *Handle) Zero() error {
-	_, err := i.doCmdWithoutAttr(ipvsCmdZero)
+	_, err := i.doCmdWithoutAttr(netlink.CmdZero)
+	if err == nil {
+		i.dropBaselines(nil, nil)
+	}
 	return err
 }
 
 // NewDestination creates a new real server in the passed ipvs
 // service which should already be existing in the passed handle.
+// The destination is checked first if a reachability check is set, see
+// SetReachabilityCheck, unless the handle is a dry run one.
 func (i *Handle) NewDestination(s *Service, d *Destination) error {
-	return i.doCmd(s, d, ipvsCmdNewDest)
+	if err := i.checkDestinationQuota(s); err != nil {
+		return err
+	}
+	if !i.DryRun() {
+		if err := i.checkReachability(s, d); err != nil {
+			return err
+		}
+	}
+	return i.doCmd(s, d, netlink.CmdNewDest)
 }
 
 // UpdateDestination updates an already existing real server in the
 // passed ipvs service in the passed handle.
 func (i *Handle) UpdateDestination(s *Service, d *Destination) error {
-	return i.doCmd(s, d, ipvsCmdSetDest)
+	return i.doCmd(s, d, netlink.CmdSetDest)
 }
 
 // DelDestination deletes an already existing real server in the
 // passed ipvs service in the passed handle.
 func (i *Handle) DelDestination(s *Service, d *Destination) error {
-	return i.doCmd(s, d, ipvsCmdDelDest)
+	err := i.doCmd(s, d, netlink.CmdDelDest)
+	if err == nil {
+		i.dropBaselines(s, d)
+	}
+	return err
 }
 
 // NewLocalAddress creates a new local address in the passed ipvs
 // service which should already be existing in the passed handle.
 func (i *Handle) NewLocalAddress(s *Service, d *LocalAddress) error {
-	return i.doCmd2(s, d, ipvsCmdNewLaddr)
+	if err := i.checkLocalAddressQuota(s); err != nil {
+		return err
+	}
+	return i.doCmd2(s, d, netlink.CmdNewLaddr)
 }
 
 // DelLocalAddress deletes an already existing local address in the
 // passed ipvs service in the passed handle.
 func (i *Handle) DelLocalAddress(s *Service, d *LocalAddress) error {
-	return i.doCmd2(s, d, ipvsCmdDelLaddr)
+	return i.doCmd2(s, d, netlink.CmdDelLaddr)
 }
 
-// GetServices returns an array of services configured on the Node
+// GetServices returns an array of services configured on the Node. A dump
+// which could not be read entirely, e.g. with a *BufferOverrunError or
+// netlink.ErrTruncatedAnswer, returns an error rather than part of the
+// services.
 func (i *Handle) GetServices() ([]*Service, error) {
 	return i.doGetServicesCmd(nil)
 }
 
-// GetDestinations returns an array of Destinations configured for this Service
+// GetDestinations returns an array of Destinations configured for this
+// Service, or an error if the dump could not be read entirely, see
+// GetServices.
 func (i *Handle) GetDestinations(s *Service) ([]*Destination, error) {
-	return i.doGetDestinationsCmd(s, nil)
+	dsts, err := i.doGetDestinationsCmd(s, nil)
+	if err != nil {
+		return nil, err
+	}
+	i.applyBaselines(s, dsts)
+	return dsts, nil
+}
+
+// GetDestination returns the destination of s with the address and port of
+// d, as reported by the kernel, or an error wrapping syscall.ENOENT if s has
+// none. The kernel only dumps destinations, so the ones of s are scanned.
+func (i *Handle) GetDestination(s *Service, d *Destination) (*Destination, error) {
+	dst, err := i.getDestination(s, d)
+	if err != nil {
+		return nil, err
+	}
+	i.applyBaselines(s, []*Destination{dst})
+	return dst, nil
+}
+
+// getDestination returns the destination of s with the address and port of
+// d, with the counters of the kernel.
+func (i *Handle) getDestination(s *Service, d *Destination) (*Destination, error) {
+	dsts, err := i.doGetDestinationsCmd(s, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	key := destinationKey(d)
+	for _, dst := range dsts {
+		if destinationKey(dst) == key {
+			return dst, nil
+		}
+	}
+	return nil, fmt.Errorf("destination %s not found: %w", destinationAddr(d, d.Port), syscall.ENOENT)
+}
+
+// IsDestinationPresent queries for the destination d of s in the passed
+// handle.
+func (i *Handle) IsDestinationPresent(s *Service, d *Destination) bool {
+	_, err := i.GetDestination(s, d)
+	return err == nil
 }
 
 // GetLocalAddresses returns an array of LocalAddress configured for this Service
@@ -274,6 +336,35 @@ func (i *Handle) GetLocalAddresses(s *Service) ([]*LocalAddress, error) {
 	return i.doGetLocalAddressesCmd(s, nil)
 }
 
+// GetServicesWithDestinations returns every service together with its
+// destinations, and its local addresses if withLocalAddresses is set, in a
+// single pass: one dump of the services followed by one dump per service.
+// The services deleted while the pass runs are left out rather than
+// failing it.
+func (i *Handle) GetServicesWithDestinations(withLocalAddresses bool) ([]*ServiceSpec, error) {
+	svcs, err := i.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]*ServiceSpec, 0, len(svcs))
+	for _, svc := range svcs {
+		spec := &ServiceSpec{Service: svc}
+		spec.Destinations, err = i.GetDestinations(svc)
+		if err == nil && withLocalAddresses {
+			spec.LocalAddresses, err = i.GetLocalAddresses(svc)
+		}
+		if errors.Is(err, syscall.ESRCH) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
 // GetService gets details of a specific IPVS services, useful in updating statisics etc.,
 func (i *Handle) GetService(s *Service) (*Service, error) {
 
@@ -302,33 +393,20 @@ func (i *Handle) SetConfig(c *Config) error {
 
 // GetInfo returns info details from IPVS
 func (i *Handle) GetInfo() (*Info, error) {
-	res, err := i.doGetInfoCmd()
-	if err != nil {
-		return nil, err
-	}
-
-	ver := uint(res.version)
-	return &Info{
-		Version: &Version{
-			Major: (ver >> 16) & 0xff,
-			Minor: (ver >> 8) & 0xff,
-			Patch: ver & 0xff,
-		},
-		ConnTableSize: res.connTableSize,
-	}, nil
+	return i.doGetInfoCmd()
 }
 
 // GetDaemons return the current daemon information
-func (i *Handle) GetDaemons()([]*Daemon, error)  {
+func (i *Handle) GetDaemons() ([]*Daemon, error) {
 	return i.doGetDaemonCmd(nil)
 }
 
 // NewDaemon create a new daemon in the passed handle
-func (i *Handle) NewDaemon(d *Daemon) error  {
+func (i *Handle) NewDaemon(d *Daemon) error {
 	return i.doNewDaemonCmd(d)
 }
 
 // DelDaemon delete a already existing daemon in the passed handle
-func (i *Handle) DelDaemon(d *Daemon) error  {
+func (i *Handle) DelDaemon(d *Daemon) error {
 	return i.doDelDaemonCmd(d)
 }
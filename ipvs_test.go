@@ -3,12 +3,15 @@
 package ipvs
 
 import (
+	"context"
+	"errors"
 	"net"
 	"runtime"
 	"syscall"
 	"testing"
 	"time"
 
+	ipvsnl "github.com/kwanhur/ipvs/netlink"
 	"github.com/moby/ipvs/ns"
 	"github.com/vishvananda/netlink"
 	"github.com/vishvananda/netlink/nl"
@@ -30,10 +33,11 @@ var (
 	protocols = []string{
 		"TCP",
 		"UDP",
+		"SCTP",
 		"FWM",
 	}
 
-	fwdMethods = []uint32{
+	fwdMethods = []ConnectionFlags{
 		ConnectionFlagMasq,
 		ConnectionFlagTunnel,
 		ConnectionFlagDirectRoute,
@@ -46,7 +50,7 @@ var (
 	}
 )
 
-func lookupFwMethod(fwMethod uint32) string {
+func lookupFwMethod(fwMethod ConnectionFlags) string {
 
 	switch fwMethod {
 	case ConnectionFlagMasq:
@@ -118,7 +122,7 @@ func checkService(t *testing.T, i *Handle, s *Service, checkPresent bool) {
 }
 
 func TestGetFamily(t *testing.T) {
-	id, err := getIPVSFamily()
+	id, err := ipvsnl.GetIPVSFamily()
 	assert.NilError(t, err)
 	assert.Check(t, 0 != id)
 }
@@ -166,6 +170,11 @@ func TestService(t *testing.T) {
 					s.Port = 53
 					s.Address = net.ParseIP(td.IP)
 					s.Netmask = td.Netmask
+				case "SCTP":
+					s.Protocol = unix.IPPROTO_SCTP
+					s.Port = 3868
+					s.Address = net.ParseIP(td.IP)
+					s.Netmask = td.Netmask
 				}
 
 				err := i.NewService(&s)
@@ -301,6 +310,11 @@ func TestDestination(t *testing.T) {
 				s.Port = 53
 				s.Address = net.ParseIP(td.IP)
 				s.Netmask = td.Netmask
+			case "SCTP":
+				s.Protocol = unix.IPPROTO_SCTP
+				s.Port = 3868
+				s.Address = net.ParseIP(td.IP)
+				s.Netmask = td.Netmask
 			}
 
 			err := i.NewService(&s)
@@ -355,7 +369,7 @@ func TestTimeouts(t *testing.T) {
 	_, err = i.GetConfig()
 	assert.NilError(t, err)
 
-	cfg := Config{66 * time.Second, 66 * time.Second, 66 * time.Second}
+	cfg := Config{TimeoutTCP: 66 * time.Second, TimeoutTCPFin: 66 * time.Second, TimeoutUDP: 66 * time.Second}
 	err = i.SetConfig(&cfg)
 	assert.NilError(t, err)
 
@@ -364,13 +378,13 @@ func TestTimeouts(t *testing.T) {
 	assert.DeepEqual(t, cfg, *c2)
 
 	//  A timeout value 0 means that the current timeout value of the corresponding entry is preserved
-	cfg = Config{77 * time.Second, 0 * time.Second, 77 * time.Second}
+	cfg = Config{TimeoutTCP: 77 * time.Second, TimeoutTCPFin: 0 * time.Second, TimeoutUDP: 77 * time.Second}
 	err = i.SetConfig(&cfg)
 	assert.NilError(t, err)
 
 	c3, err := i.GetConfig()
 	assert.NilError(t, err)
-	assert.DeepEqual(t, *c3, Config{77 * time.Second, 66 * time.Second, 77 * time.Second})
+	assert.DeepEqual(t, *c3, Config{TimeoutTCP: 77 * time.Second, TimeoutTCPFin: 66 * time.Second, TimeoutUDP: 77 * time.Second})
 }
 
 func TestInfo(t *testing.T) {
@@ -386,6 +400,73 @@ func TestInfo(t *testing.T) {
 	assert.Assert(t, info.ConnTableSize > 0)
 }
 
+func TestHooks(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	var before, after []Command
+	i.OnBefore(func(cmd Command, obj interface{}) {
+		before = append(before, cmd)
+	})
+	i.OnAfter(func(cmd Command, obj interface{}, err error) {
+		assert.Check(t, err)
+		after = append(after, cmd)
+	})
+
+	s := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	assert.NilError(t, i.NewService(&s))
+	assert.NilError(t, i.DelService(&s))
+
+	expected := []Command{CmdNewService, CmdDelService}
+	assert.DeepEqual(t, before, expected)
+	assert.DeepEqual(t, after, expected)
+}
+
+func TestQuota(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	i.SetQuota(Quota{MaxServices: 1, MaxDestinationsPerService: 1})
+
+	s1 := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	s2 := s1
+	s2.Port = 443
+
+	assert.NilError(t, i.NewService(&s1))
+	err = i.NewService(&s2)
+	quotaErr, ok := err.(*QuotaExceededError)
+	assert.Assert(t, ok, "unexpected error %v", err)
+	assert.Equal(t, quotaErr.Resource, "services")
+
+	d := Destination{AddressFamily: nl.FAMILY_V4, Address: net.ParseIP("10.1.1.2"), Port: 80, Weight: 1}
+	assert.NilError(t, i.NewDestination(&s1, &d))
+	d.Address = net.ParseIP("10.1.1.3")
+	err = i.NewDestination(&s1, &d)
+	quotaErr, ok = err.(*QuotaExceededError)
+	assert.Assert(t, ok, "unexpected error %v", err)
+	assert.Equal(t, quotaErr.Resource, "destinations")
+
+	assert.NilError(t, i.Flush())
+}
+
 // setupTestOSContext joins a new network namespace, and returns its associated
 // teardown function.
 //
@@ -418,3 +499,178 @@ func setupTestOSContext(t *testing.T) func() {
 		runtime.UnlockOSThread()
 	}
 }
+
+func TestEnsure(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	s := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	changed, err := i.EnsureService(&s)
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	changed, err = i.EnsureService(&s)
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+	s.SchedName = WeightedRoundRobin
+	changed, err = i.EnsureService(&s)
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	d := Destination{AddressFamily: nl.FAMILY_V4, Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 1}
+	changed, err = i.EnsureDestination(&s, &d)
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+	changed, err = i.EnsureDestination(&s, &d)
+	assert.NilError(t, err)
+	assert.Assert(t, !changed)
+	d.Weight = 2
+	changed, err = i.EnsureDestination(&s, &d)
+	assert.NilError(t, err)
+	assert.Assert(t, changed)
+
+	assert.NilError(t, i.DelService(&s))
+}
+
+func TestFlushWhere(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	for _, port := range []uint16{80, 443, 8080} {
+		s := Service{
+			AddressFamily: nl.FAMILY_V4,
+			SchedName:     RoundRobin,
+			Protocol:      unix.IPPROTO_TCP,
+			Port:          port,
+			Address:       net.ParseIP("10.20.30.40"),
+			Netmask:       0xFFFFFFFF,
+		}
+		assert.NilError(t, i.NewService(&s))
+	}
+
+	n, err := i.FlushWhere(func(s *Service) bool { return s.Port != 443 })
+	assert.NilError(t, err)
+	assert.Equal(t, n, 2)
+
+	svcs, err := i.GetServices()
+	assert.NilError(t, err)
+	assert.Equal(t, len(svcs), 1)
+	assert.Equal(t, svcs[0].Port, uint16(443))
+	assert.NilError(t, i.Flush())
+}
+
+func TestGetServicesWithDestinations(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	s := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	assert.NilError(t, i.NewService(&s))
+	for _, ip := range []string{"10.1.0.1", "10.1.0.2"} {
+		d := Destination{AddressFamily: nl.FAMILY_V4, Address: net.ParseIP(ip), Port: 80, Weight: 1}
+		assert.NilError(t, i.NewDestination(&s, &d))
+	}
+
+	specs, err := i.GetServicesWithDestinations(false)
+	assert.NilError(t, err)
+	assert.Equal(t, len(specs), 1)
+	assert.Equal(t, specs[0].Service.Port, uint16(80))
+	assert.Equal(t, len(specs[0].Destinations), 2)
+
+	d, err := i.GetDestination(&s, &Destination{Address: net.ParseIP("10.1.0.2"), Port: 80})
+	assert.NilError(t, err)
+	assert.Equal(t, d.Weight, 1)
+	missing := &Destination{Address: net.ParseIP("10.1.0.3"), Port: 80}
+	_, err = i.GetDestination(&s, missing)
+	assert.Assert(t, errors.Is(err, syscall.ENOENT))
+	assert.Assert(t, !i.IsDestinationPresent(&s, missing))
+	assert.Assert(t, i.IsDestinationPresent(&s, d))
+
+	assert.NilError(t, i.DelService(&s))
+}
+
+func TestDrainDestination(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	s := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	assert.NilError(t, i.NewService(&s))
+	d := Destination{AddressFamily: nl.FAMILY_V4, Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 5}
+	assert.NilError(t, i.NewDestination(&s, &d))
+
+	opts := DrainOptions{Timeout: time.Second, Interval: 10 * time.Millisecond}
+	assert.NilError(t, i.DrainDestination(context.Background(), &s, &d, opts))
+	assert.Assert(t, !i.IsDestinationPresent(&s, &d))
+
+	assert.NilError(t, i.DelService(&s))
+}
+
+func TestZeroDestination(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	s := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	assert.NilError(t, i.NewService(&s))
+	d := Destination{AddressFamily: nl.FAMILY_V4, Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 1}
+	assert.NilError(t, i.NewDestination(&s, &d))
+
+	assert.NilError(t, i.ZeroDestination(&s, &d))
+	dst, err := i.GetDestination(&s, &d)
+	assert.NilError(t, err)
+	assert.Equal(t, dst.Stats.Connections, uint64(0))
+	err = i.ZeroDestination(&s, &Destination{Address: net.ParseIP("10.1.0.2"), Port: 80})
+	assert.Assert(t, errors.Is(err, syscall.ENOENT))
+
+	assert.NilError(t, i.DelService(&s))
+}
+
+func TestSysctlKernel(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	prev, err := i.GetSysctl(SysctlExpireNodestConn)
+	assert.NilError(t, err)
+	assert.NilError(t, i.SetSysctl(SysctlExpireNodestConn, 1))
+	v, err := i.GetSysctl(SysctlExpireNodestConn)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 1)
+	assert.NilError(t, i.SetSysctl(SysctlExpireNodestConn, prev))
+}
@@ -0,0 +1,313 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// WriteIPVSAdm writes the services of snap, with their destinations, as the
+// rules printed by ipvsadm-save -n, which ipvsadm-restore programs back.
+// Local addresses and fullnat destinations use the -P and -b options of the
+// ipvsadm supporting fullnat. Timeouts and sync daemons are not part of the
+// format.
+func WriteIPVSAdm(w io.Writer, snap *Snapshot) error {
+	bw := bufio.NewWriter(w)
+	for _, spec := range snap.Services {
+		svc := serviceRule(spec.Service)
+		fmt.Fprintf(bw, "-A %s%s\n", svc, serviceOptions(spec.Service))
+		for _, l := range spec.LocalAddresses {
+			fmt.Fprintf(bw, "-P %s -z %s\n", svc, l.Address)
+		}
+		for _, d := range spec.Destinations {
+			fmt.Fprintf(bw, "-a %s -r %s%s\n", svc, destinationAddr(d, d.Port), destinationOptions(d))
+		}
+	}
+	return bw.Flush()
+}
+
+// serviceRule returns the options identifying s.
+func serviceRule(s *Service) string {
+	if s.FWMark > 0 {
+		rule := fmt.Sprintf("-f %d", s.FWMark)
+		if s.AddressFamily == syscall.AF_INET6 {
+			rule += " -6"
+		}
+		return rule
+	}
+
+	var flag string
+	switch s.Protocol {
+	case ProtocolUDP:
+		flag = "-u"
+	case ProtocolSCTP:
+		flag = "--sctp-service"
+	default:
+		flag = "-t"
+	}
+	return flag + " " + net.JoinHostPort(s.Address.String(), strconv.Itoa(int(s.Port)))
+}
+
+// serviceOptions returns the options configuring s.
+func serviceOptions(s *Service) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, " -s %s", s.SchedName)
+
+	if flags := schedulerFlagNames(s); len(flags) > 0 {
+		fmt.Fprintf(&b, " -b %s", strings.Join(flags, ","))
+	}
+	if s.Flags.Has(SvcFlagPersistent) {
+		fmt.Fprintf(&b, " -p %d", s.Timeout)
+		if s.Netmask != 0 && s.Netmask != fullNetmask(s.AddressFamily) {
+			if s.AddressFamily == syscall.AF_INET6 {
+				fmt.Fprintf(&b, " -M %d", s.Netmask)
+			} else {
+				m := s.Netmask
+				fmt.Fprintf(&b, " -M %d.%d.%d.%d", byte(m>>24), byte(m>>16), byte(m>>8), byte(m))
+			}
+		}
+	}
+	if s.PEName != "" {
+		fmt.Fprintf(&b, " --pe %s", s.PEName)
+	}
+	if s.Flags.Has(SvcFlagOnePacket) {
+		b.WriteString(" -o")
+	}
+	return b.String()
+}
+
+// schedulerFlagNames returns the ipvsadm names of the scheduler flags of s.
+func schedulerFlagNames(s *Service) []string {
+	prefix := ""
+	switch s.SchedName {
+	case SourceHashing:
+		prefix = "sh-"
+	case MaglevHashing:
+		prefix = "mh-"
+	}
+
+	var names []string
+	for n, flag := range []ServiceFlags{SvcFlagSched1, SvcFlagSched2, SvcFlagSched3} {
+		if !s.Flags.Has(flag) {
+			continue
+		}
+		switch {
+		case prefix != "" && n == 0:
+			names = append(names, prefix+"fallback")
+		case prefix != "" && n == 1:
+			names = append(names, prefix+"port")
+		default:
+			names = append(names, fmt.Sprintf("flag-%d", n+1))
+		}
+	}
+	return names
+}
+
+var tunnelTypeNames = map[uint8]string{
+	TunnelTypeIPIP: "ipip",
+	TunnelTypeGUE:  "gue",
+	TunnelTypeGRE:  "gre",
+}
+
+// destinationOptions returns the options configuring d.
+func destinationOptions(d *Destination) string {
+	var b strings.Builder
+
+	switch d.ConnectionFlags & ConnectionFlagFwdMask {
+	case ConnectionFlagMasq:
+		b.WriteString(" -m")
+	case ConnectionFlagTunnel:
+		b.WriteString(" -i")
+		if d.TunnelType != TunnelTypeIPIP {
+			fmt.Fprintf(&b, " --tun-type %s", tunnelTypeNames[d.TunnelType])
+		}
+		if d.TunnelType == TunnelTypeGUE {
+			fmt.Fprintf(&b, " --tun-port %d", d.TunnelPort)
+		}
+		switch {
+		case d.TunnelFlags&TunnelFlagRemoteChecksum != 0:
+			b.WriteString(" --tun-remcsum")
+		case d.TunnelFlags&TunnelFlagChecksum != 0:
+			b.WriteString(" --tun-csum")
+		case d.TunnelType != TunnelTypeIPIP:
+			b.WriteString(" --tun-nocsum")
+		}
+	case ConnectionFlagFullNat:
+		b.WriteString(" -b")
+	default:
+		// Local node destinations are direct routing ones too for ipvsadm.
+		b.WriteString(" -g")
+	}
+
+	fmt.Fprintf(&b, " -w %d", d.Weight)
+	if d.UpperThreshold > 0 {
+		fmt.Fprintf(&b, " -x %d", d.UpperThreshold)
+	}
+	if d.LowerThreshold > 0 {
+		fmt.Fprintf(&b, " -y %d", d.LowerThreshold)
+	}
+	return b.String()
+}
+
+// ListFormat selects the columns of the listing of WriteIPVSAdmList.
+type ListFormat int
+
+const (
+	// ListConnections lists the configuration and the connection counts,
+	// like ipvsadm -Ln.
+	ListConnections ListFormat = iota
+
+	// ListStats lists the counters, like ipvsadm -Ln --stats.
+	ListStats
+
+	// ListRate lists the rates, like ipvsadm -Ln --rate.
+	ListRate
+)
+
+// ListOptions configures WriteIPVSAdmList.
+type ListOptions struct {
+	Format ListFormat
+
+	// Exact prints the counters and rates in full instead of scaling them
+	// with K, M, G and T suffixes, like ipvsadm --exact.
+	Exact bool
+
+	// Info, if not nil, is printed as the version banner.
+	Info *Info
+}
+
+// WriteIPVSAdmList writes specs as the listing printed by ipvsadm -Ln, in
+// the order given.
+func WriteIPVSAdmList(w io.Writer, specs []*ServiceSpec, opts ListOptions) error {
+	bw := bufio.NewWriter(w)
+	if opts.Info != nil && opts.Info.Version != nil {
+		fmt.Fprintf(bw, "IP Virtual Server version %s (size=%d)\n", opts.Info.Version, opts.Info.ConnTableSize)
+	}
+
+	switch opts.Format {
+	case ListStats:
+		fmt.Fprintf(bw, "%-33s%9s%9s%9s%9s%9s\n  -> RemoteAddress:Port\n", "Prot LocalAddress:Port", "Conns", "InPkts", "OutPkts", "InBytes", "OutBytes")
+	case ListRate:
+		fmt.Fprintf(bw, "%-33s%9s%9s%9s%9s%9s\n  -> RemoteAddress:Port\n", "Prot LocalAddress:Port", "CPS", "InPPS", "OutPPS", "InBPS", "OutBPS")
+	default:
+		fmt.Fprintf(bw, "Prot LocalAddress:Port Scheduler Flags\n  -> RemoteAddress:Port           Forward Weight ActiveConn InActConn\n")
+	}
+
+	for _, spec := range specs {
+		s := spec.Service
+		switch opts.Format {
+		case ListStats, ListRate:
+			fmt.Fprintf(bw, "%-33s%s\n", serviceListName(s), listCounters(&s.Stats, opts))
+		default:
+			fmt.Fprintf(bw, "%s %s%s\n", serviceListName(s), s.SchedName, serviceListFlags(s))
+		}
+
+		for _, d := range spec.Destinations {
+			name := destinationAddr(d, d.Port)
+			switch opts.Format {
+			case ListStats, ListRate:
+				st := SvcStats(d.Stats)
+				fmt.Fprintf(bw, "  -> %-28s%s\n", name, listCounters(&st, opts))
+			default:
+				fmt.Fprintf(bw, "  -> %-28s %-7s %-6d %-10d %-10d\n", name, forwardingListName(d), d.Weight, d.ActiveConnections, d.InactiveConnections)
+			}
+		}
+	}
+	return bw.Flush()
+}
+
+// serviceListName returns the protocol and address, or firewall mark, of s
+// as listed by ipvsadm.
+func serviceListName(s *Service) string {
+	if s.FWMark > 0 {
+		name := fmt.Sprintf("FWM  %d", s.FWMark)
+		if s.AddressFamily == syscall.AF_INET6 {
+			name += " IPv6"
+		}
+		return name
+	}
+	return fmt.Sprintf("%v  %s", s.Protocol, net.JoinHostPort(s.Address.String(), strconv.Itoa(int(s.Port))))
+}
+
+// serviceListFlags returns the scheduler flags, persistence and one-packet
+// scheduling of s as listed by ipvsadm.
+func serviceListFlags(s *Service) string {
+	var b strings.Builder
+	if flags := schedulerFlagNames(s); len(flags) > 0 {
+		fmt.Fprintf(&b, " (%s)", strings.Join(flags, ","))
+	}
+	if s.Flags.Has(SvcFlagPersistent) {
+		fmt.Fprintf(&b, " persistent %d", s.Timeout)
+		if s.Netmask != 0 && s.Netmask != fullNetmask(s.AddressFamily) {
+			if s.AddressFamily == syscall.AF_INET6 {
+				fmt.Fprintf(&b, " mask %d", s.Netmask)
+			} else {
+				m := s.Netmask
+				fmt.Fprintf(&b, " mask %d.%d.%d.%d", byte(m>>24), byte(m>>16), byte(m>>8), byte(m))
+			}
+		}
+		if s.PEName != "" {
+			fmt.Fprintf(&b, " pe %s", s.PEName)
+		}
+	}
+	if s.Flags.Has(SvcFlagOnePacket) {
+		b.WriteString(" ops")
+	}
+	return b.String()
+}
+
+// forwardingListName returns the name of the forwarding method of d as
+// listed by ipvsadm.
+func forwardingListName(d *Destination) string {
+	switch d.ConnectionFlags & ConnectionFlagFwdMask {
+	case ConnectionFlagMasq:
+		return "Masq"
+	case ConnectionFlagLocalNode:
+		return "Local"
+	case ConnectionFlagTunnel:
+		return "Tunnel"
+	case ConnectionFlagDirectRoute:
+		return "Route"
+	case ConnectionFlagFullNat:
+		return "FullNat"
+	}
+	return "Unknown"
+}
+
+// listCounters returns the counters, or rates, of st in the columns of
+// ipvsadm --stats, or --rate.
+func listCounters(st *SvcStats, opts ListOptions) string {
+	values := []uint64{st.Connections, st.PacketsIn, st.PacketsOut, st.BytesIn, st.BytesOut}
+	if opts.Format == ListRate {
+		values = []uint64{st.CPS, st.PPSIn, st.PPSOut, st.BPSIn, st.BPSOut}
+	}
+
+	var b strings.Builder
+	for _, v := range values {
+		b.WriteString(" ")
+		b.WriteString(largeNumber(v, opts.Exact))
+	}
+	return b.String()
+}
+
+// largeNumber returns n right aligned on 8 columns, scaled with a K, M, G or
+// T suffix unless exact if it does not fit.
+func largeNumber(n uint64, exact bool) string {
+	s := strconv.FormatUint(n, 10)
+	if exact || len(s) <= 8 {
+		return fmt.Sprintf("%8s", s)
+	}
+	for _, suffix := range "KMGT" {
+		n /= 1000
+		if s = strconv.FormatUint(n, 10); len(s) <= 7 {
+			return fmt.Sprintf("%7s%c", s, suffix)
+		}
+	}
+	return fmt.Sprintf("%7dT", n)
+}
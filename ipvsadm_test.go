@@ -0,0 +1,118 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bytes"
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestWriteIPVSAdm(t *testing.T) {
+	web := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      ProtocolTCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     WeightedRoundRobin,
+		Flags:         SvcFlagPersistent | SvcFlagHashed,
+		Timeout:       300,
+		Netmask:       0xFFFFFF00,
+	}
+	dns := &Service{
+		AddressFamily: syscall.AF_INET6,
+		Protocol:      ProtocolUDP,
+		Address:       net.ParseIP("2001:db8::1"),
+		Port:          53,
+		SchedName:     SourceHashing,
+		Flags:         SvcFlagOnePacket | SvcFlagSHPort,
+	}
+	fwmark := &Service{AddressFamily: syscall.AF_INET, FWMark: 7, SchedName: RoundRobin}
+
+	snap := &Snapshot{Services: []*ServiceSpec{
+		{Service: web, Destinations: []*Destination{
+			{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 100, ConnectionFlags: ConnectionFlagMasq},
+			{Address: net.ParseIP("10.1.0.2"), Port: 8080, Weight: 50, ConnectionFlags: ConnectionFlagMasq, UpperThreshold: 1000},
+		}},
+		{Service: dns, Destinations: []*Destination{
+			{Address: net.ParseIP("2001:db8::10"), Port: 53, Weight: 1, ConnectionFlags: ConnectionFlagTunnel,
+				TunnelType: TunnelTypeGUE, TunnelPort: 6080, TunnelFlags: TunnelFlagChecksum},
+		}},
+		{Service: fwmark, Destinations: []*Destination{
+			{Address: net.ParseIP("10.1.0.3"), Weight: 1, ConnectionFlags: ConnectionFlagDirectRoute},
+		}},
+	}}
+
+	var b bytes.Buffer
+	assert.NilError(t, WriteIPVSAdm(&b, snap))
+	assert.Equal(t, b.String(), `-A -t 10.0.0.1:80 -s wrr -p 300 -M 255.255.255.0
+-a -t 10.0.0.1:80 -r 10.1.0.1:8080 -m -w 100
+-a -t 10.0.0.1:80 -r 10.1.0.2:8080 -m -w 50 -x 1000
+-A -u [2001:db8::1]:53 -s sh -b sh-port -o
+-a -u [2001:db8::1]:53 -r [2001:db8::10]:53 -i --tun-type gue --tun-port 6080 --tun-csum -w 1
+-A -f 7 -s rr
+-a -f 7 -r 10.1.0.3:0 -g -w 1
+`)
+}
+
+func TestWriteIPVSAdmList(t *testing.T) {
+	web := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      ProtocolTCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     WeightedRoundRobin,
+		Flags:         SvcFlagPersistent,
+		Timeout:       300,
+		Netmask:       0xFFFFFF00,
+		Stats:         SvcStats{Connections: 12, PacketsIn: 345, BytesIn: 123456789, CPS: 2},
+	}
+	dns := &Service{
+		AddressFamily: syscall.AF_INET6,
+		FWMark:        7,
+		SchedName:     SourceHashing,
+		Flags:         SvcFlagOnePacket | SvcFlagSHPort,
+	}
+	specs := []*ServiceSpec{
+		{Service: web, Destinations: []*Destination{
+			{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 100, ConnectionFlags: ConnectionFlagMasq,
+				ActiveConnections: 3, InactiveConnections: 4, Stats: DstStats{Connections: 12}},
+		}},
+		{Service: dns, Destinations: []*Destination{
+			{Address: net.ParseIP("2001:db8::10"), Port: 53, Weight: 1, ConnectionFlags: ConnectionFlagDirectRoute},
+		}},
+	}
+
+	var b bytes.Buffer
+	info := &Info{Version: &Version{Major: 1, Minor: 2, Patch: 1}, ConnTableSize: 4096}
+	assert.NilError(t, WriteIPVSAdmList(&b, specs, ListOptions{Info: info}))
+	assert.Equal(t, b.String(), `IP Virtual Server version 1.2.1 (size=4096)
+Prot LocalAddress:Port Scheduler Flags
+  -> RemoteAddress:Port           Forward Weight ActiveConn InActConn
+TCP  10.0.0.1:80 wrr persistent 300 mask 255.255.255.0
+  -> 10.1.0.1:8080                Masq    100    3          4         
+FWM  7 IPv6 sh (sh-port) ops
+  -> [2001:db8::10]:53            Route   1      0          0         
+`)
+
+	b.Reset()
+	assert.NilError(t, WriteIPVSAdmList(&b, specs[:1], ListOptions{Format: ListStats}))
+	assert.Equal(t, b.String(), `Prot LocalAddress:Port               Conns   InPkts  OutPkts  InBytes OutBytes
+  -> RemoteAddress:Port
+TCP  10.0.0.1:80                        12      345        0  123456K        0
+  -> 10.1.0.1:8080                      12        0        0        0        0
+`)
+
+	b.Reset()
+	assert.NilError(t, WriteIPVSAdmList(&b, specs[:1], ListOptions{Format: ListStats, Exact: true}))
+	assert.Assert(t, strings.Contains(b.String(), " 123456789 "))
+
+	b.Reset()
+	assert.NilError(t, WriteIPVSAdmList(&b, specs[:1], ListOptions{Format: ListRate}))
+	assert.Assert(t, strings.HasPrefix(b.String(), "Prot LocalAddress:Port                 CPS    InPPS   OutPPS    InBPS   OutBPS\n"))
+	assert.Assert(t, strings.Contains(b.String(), "TCP  10.0.0.1:80                         2        0"))
+}
@@ -0,0 +1,210 @@
+// +build linux
+
+// Package ipvspb holds the protocol buffer messages of the IPVS objects of
+// package ipvs, defined in ipvs.proto, and the conversions between both.
+package ipvspb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative ipvs.proto
+
+import (
+	"net"
+
+	"github.com/kwanhur/ipvs"
+	"google.golang.org/protobuf/types/known/timestamppb"
+)
+
+// FromStats returns the message of st.
+func FromStats(st ipvs.SvcStats) *Stats {
+	return &Stats{
+		Connections: st.Connections,
+		PacketsIn:   st.PacketsIn,
+		PacketsOut:  st.PacketsOut,
+		BytesIn:     st.BytesIn,
+		BytesOut:    st.BytesOut,
+		Cps:         st.CPS,
+		BpsOut:      st.BPSOut,
+		PpsIn:       st.PPSIn,
+		PpsOut:      st.PPSOut,
+		BpsIn:       st.BPSIn,
+	}
+}
+
+// ToStats returns the statistics of m, zero if m is nil.
+func ToStats(m *Stats) ipvs.SvcStats {
+	return ipvs.SvcStats{
+		Connections: m.GetConnections(),
+		PacketsIn:   m.GetPacketsIn(),
+		PacketsOut:  m.GetPacketsOut(),
+		BytesIn:     m.GetBytesIn(),
+		BytesOut:    m.GetBytesOut(),
+		CPS:         m.GetCps(),
+		BPSOut:      m.GetBpsOut(),
+		PPSIn:       m.GetPpsIn(),
+		PPSOut:      m.GetPpsOut(),
+		BPSIn:       m.GetBpsIn(),
+	}
+}
+
+// FromService returns the message of s.
+func FromService(s *ipvs.Service) *Service {
+	return &Service{
+		Address:       fromIP(s.Address),
+		Protocol:      uint32(s.Protocol),
+		Port:          uint32(s.Port),
+		Fwmark:        s.FWMark,
+		Zone:          s.Zone,
+		SchedName:     s.SchedName,
+		Flags:         uint32(s.Flags),
+		Timeout:       s.Timeout,
+		Netmask:       s.Netmask,
+		AddressFamily: uint32(s.AddressFamily),
+		PeName:        s.PEName,
+		Stats:         FromStats(s.Stats),
+	}
+}
+
+// ToService returns the service of m.
+func ToService(m *Service) *ipvs.Service {
+	return &ipvs.Service{
+		Address:       toIP(m.GetAddress()),
+		Protocol:      ipvs.IPProto(m.GetProtocol()),
+		Port:          uint16(m.GetPort()),
+		FWMark:        m.GetFwmark(),
+		Zone:          m.GetZone(),
+		SchedName:     m.GetSchedName(),
+		Flags:         ipvs.ServiceFlags(m.GetFlags()),
+		Timeout:       m.GetTimeout(),
+		Netmask:       m.GetNetmask(),
+		AddressFamily: uint16(m.GetAddressFamily()),
+		PEName:        m.GetPeName(),
+		Stats:         ToStats(m.GetStats()),
+	}
+}
+
+// FromDestination returns the message of d.
+func FromDestination(d *ipvs.Destination) *Destination {
+	return &Destination{
+		Address:               fromIP(d.Address),
+		Port:                  uint32(d.Port),
+		Weight:                int32(d.Weight),
+		ConnectionFlags:       uint32(d.ConnectionFlags),
+		AddressFamily:         uint32(d.AddressFamily),
+		UpperThreshold:        d.UpperThreshold,
+		LowerThreshold:        d.LowerThreshold,
+		ActiveConnections:     int32(d.ActiveConnections),
+		InactiveConnections:   int32(d.InactiveConnections),
+		PersistentConnections: int32(d.PersistentConnections),
+		Stats:                 FromStats(ipvs.SvcStats(d.Stats)),
+		TunnelType:            uint32(d.TunnelType),
+		TunnelPort:            uint32(d.TunnelPort),
+		TunnelFlags:           uint32(d.TunnelFlags),
+		Zone:                  d.Zone,
+	}
+}
+
+// ToDestination returns the destination of m.
+func ToDestination(m *Destination) *ipvs.Destination {
+	return &ipvs.Destination{
+		Address:               toIP(m.GetAddress()),
+		Port:                  uint16(m.GetPort()),
+		Weight:                int(m.GetWeight()),
+		ConnectionFlags:       ipvs.ConnectionFlags(m.GetConnectionFlags()),
+		AddressFamily:         uint16(m.GetAddressFamily()),
+		UpperThreshold:        m.GetUpperThreshold(),
+		LowerThreshold:        m.GetLowerThreshold(),
+		ActiveConnections:     int(m.GetActiveConnections()),
+		InactiveConnections:   int(m.GetInactiveConnections()),
+		PersistentConnections: int(m.GetPersistentConnections()),
+		Stats:                 ipvs.DstStats(ToStats(m.GetStats())),
+		TunnelType:            uint8(m.GetTunnelType()),
+		TunnelPort:            uint16(m.GetTunnelPort()),
+		TunnelFlags:           uint16(m.GetTunnelFlags()),
+		Zone:                  m.GetZone(),
+	}
+}
+
+// FromLocalAddress returns the message of l.
+func FromLocalAddress(l *ipvs.LocalAddress) *LocalAddress {
+	return &LocalAddress{
+		Address:     fromIP(l.Address),
+		Conflicts:   l.Conflicts,
+		Connections: l.Connections,
+	}
+}
+
+// ToLocalAddress returns the local address of m.
+func ToLocalAddress(m *LocalAddress) *ipvs.LocalAddress {
+	return &ipvs.LocalAddress{
+		Address:     toIP(m.GetAddress()),
+		Conflicts:   m.GetConflicts(),
+		Connections: m.GetConnections(),
+	}
+}
+
+// FromServiceSpec returns the message of spec.
+func FromServiceSpec(spec *ipvs.ServiceSpec) *ServiceSpec {
+	m := &ServiceSpec{Service: FromService(spec.Service)}
+	for _, d := range spec.Destinations {
+		m.Destinations = append(m.Destinations, FromDestination(d))
+	}
+	for _, l := range spec.LocalAddresses {
+		m.LocalAddresses = append(m.LocalAddresses, FromLocalAddress(l))
+	}
+	return m
+}
+
+// ToServiceSpec returns the service spec of m.
+func ToServiceSpec(m *ServiceSpec) *ipvs.ServiceSpec {
+	spec := &ipvs.ServiceSpec{Service: ToService(m.GetService())}
+	for _, d := range m.GetDestinations() {
+		spec.Destinations = append(spec.Destinations, ToDestination(d))
+	}
+	for _, l := range m.GetLocalAddresses() {
+		spec.LocalAddresses = append(spec.LocalAddresses, ToLocalAddress(l))
+	}
+	return spec
+}
+
+// FromStatsSnapshot returns the message of snap.
+func FromStatsSnapshot(snap *ipvs.StatsSnapshot) *StatsSnapshot {
+	m := &StatsSnapshot{Time: timestamppb.New(snap.Time)}
+	for _, sd := range snap.Services {
+		spec := &ServiceSpec{Service: FromService(sd.Service)}
+		for _, d := range sd.Destinations {
+			spec.Destinations = append(spec.Destinations, FromDestination(d))
+		}
+		m.Services = append(m.Services, spec)
+	}
+	return m
+}
+
+// ToStatsSnapshot returns the statistics snapshot of m.
+func ToStatsSnapshot(m *StatsSnapshot) *ipvs.StatsSnapshot {
+	snap := &ipvs.StatsSnapshot{}
+	if m.GetTime() != nil {
+		snap.Time = m.GetTime().AsTime()
+	}
+	for _, spec := range m.GetServices() {
+		sd := &ipvs.ServiceDestinations{Service: ToService(spec.GetService())}
+		for _, d := range spec.GetDestinations() {
+			sd.Destinations = append(sd.Destinations, ToDestination(d))
+		}
+		snap.Services = append(snap.Services, sd)
+	}
+	return snap
+}
+
+// fromIP returns ip in its shortest form, 4 bytes for IPv4.
+func fromIP(ip net.IP) []byte {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+func toIP(b []byte) net.IP {
+	if len(b) == 0 {
+		return nil
+	}
+	return append(net.IP(nil), b...)
+}
@@ -0,0 +1,73 @@
+// +build linux
+
+package ipvspb
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"google.golang.org/protobuf/proto"
+	"gotest.tools/v3/assert"
+)
+
+func TestRoundTrip(t *testing.T) {
+	spec := &ipvs.ServiceSpec{
+		Service: &ipvs.Service{
+			Address:       net.ParseIP("fe80::1"),
+			Zone:          "eth0",
+			Protocol:      ipvs.ProtocolTCP,
+			Port:          443,
+			SchedName:     ipvs.WeightedRoundRobin,
+			Flags:         ipvs.SvcFlagPersistent,
+			Timeout:       300,
+			Netmask:       64,
+			AddressFamily: syscall.AF_INET6,
+			Stats:         ipvs.SvcStats{Connections: 1, BPSIn: 10},
+		},
+		Destinations: []*ipvs.Destination{{
+			Address:           net.ParseIP("10.1.0.1").To4(),
+			Port:              8443,
+			Weight:            2,
+			ConnectionFlags:   ipvs.ConnectionFlagTunnel,
+			AddressFamily:     syscall.AF_INET,
+			ActiveConnections: 3,
+			Stats:             ipvs.DstStats{PacketsOut: 4},
+			TunnelType:        ipvs.TunnelTypeGUE,
+			TunnelPort:        6080,
+			TunnelFlags:       ipvs.TunnelFlagChecksum,
+		}},
+		LocalAddresses: []*ipvs.LocalAddress{{Address: net.ParseIP("10.2.0.1").To4(), Conflicts: 5}},
+	}
+
+	b, err := proto.Marshal(FromServiceSpec(spec))
+	assert.NilError(t, err)
+	var m ServiceSpec
+	assert.NilError(t, proto.Unmarshal(b, &m))
+	assert.Equal(t, len(m.GetService().GetAddress()), 16)
+	assert.Equal(t, len(m.GetDestinations()[0].GetAddress()), 4)
+	assert.DeepEqual(t, ToServiceSpec(&m), spec)
+}
+
+func TestStatsSnapshotRoundTrip(t *testing.T) {
+	snap := &ipvs.StatsSnapshot{
+		Time: time.Unix(1577836800, 5).UTC(),
+		Services: []*ipvs.ServiceDestinations{{
+			Service:      &ipvs.Service{FWMark: 7, Stats: ipvs.SvcStats{Connections: 2}},
+			Destinations: []*ipvs.Destination{{Address: net.ParseIP("10.1.0.1").To4(), Port: 80, Stats: ipvs.DstStats{BytesIn: 3}}},
+		}},
+	}
+
+	b, err := proto.Marshal(FromStatsSnapshot(snap))
+	assert.NilError(t, err)
+	var m StatsSnapshot
+	assert.NilError(t, proto.Unmarshal(b, &m))
+	assert.DeepEqual(t, ToStatsSnapshot(&m), snap)
+}
+
+func TestToNil(t *testing.T) {
+	assert.DeepEqual(t, ToService(nil), &ipvs.Service{})
+	assert.DeepEqual(t, ToServiceSpec(nil), &ipvs.ServiceSpec{Service: &ipvs.Service{}})
+}
@@ -0,0 +1,67 @@
+//go:build linux && go1.23
+// +build linux,go1.23
+
+package ipvs
+
+import (
+	"iter"
+
+	"github.com/kwanhur/ipvs/netlink"
+)
+
+// Services returns an iterator over the ipvs services, decoded as the dump
+// is received from the kernel. An error ends the iteration, after being
+// yielded with a nil service. The handle is busy until the iteration ends:
+// the loop body must not make requests on it, which would deadlock, but may
+// use another handle.
+//
+//	for svc, err := range h.Services() {
+//		if err != nil {
+//			return err
+//		}
+//		...
+//	}
+func (i *Handle) Services() iter.Seq2[*Service, error] {
+	return func(yield func(*Service, error) bool) {
+		dumpSeq(i, nil, netlink.CmdGetService, netlink.ParseService, yield)
+	}
+}
+
+// Destinations returns an iterator over the destinations of the ipvs
+// service s, decoded as the dump is received from the kernel. An error ends
+// the iteration, after being yielded with a nil destination. The handle is
+// busy until the iteration ends, see Services.
+func (i *Handle) Destinations(s *Service) iter.Seq2[*Destination, error] {
+	return func(yield func(*Destination, error) bool) {
+		dumpSeq(i, s, netlink.CmdGetDest, func(msg []byte) (*Destination, error) {
+			d, err := netlink.ParseDestination(msg)
+			if err == nil {
+				i.applyBaselines(s, []*Destination{d})
+			}
+			return d, err
+		}, yield)
+	}
+}
+
+// dumpSeq runs the dump cmd, yielding every answer decoded with parse until
+// yield returns false.
+func dumpSeq[T any](i *Handle, s *Service, cmd uint8, parse func([]byte) (T, error), yield func(T, error) bool) {
+	var zero T
+	stopped := false
+	err := i.doDumpCmd(s, cmd, func(msg []byte) bool {
+		v, err := parse(msg)
+		if err != nil {
+			stopped = true
+			yield(zero, err)
+			return false
+		}
+		if !yield(v, nil) {
+			stopped = true
+			return false
+		}
+		return true
+	})
+	if err != nil && !stopped {
+		yield(zero, err)
+	}
+}
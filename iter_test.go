@@ -0,0 +1,59 @@
+//go:build linux && go1.23
+// +build linux,go1.23
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+
+	"github.com/vishvananda/netlink/nl"
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestIterators(t *testing.T) {
+	defer setupTestOSContext(t)()
+
+	i, err := New("")
+	assert.NilError(t, err)
+
+	s := Service{
+		AddressFamily: nl.FAMILY_V4,
+		SchedName:     RoundRobin,
+		Protocol:      unix.IPPROTO_TCP,
+		Port:          80,
+		Address:       net.ParseIP("10.20.30.40"),
+		Netmask:       0xFFFFFFFF,
+	}
+	assert.NilError(t, i.NewService(&s))
+	for _, ip := range []string{"10.1.0.1", "10.1.0.2", "10.1.0.3"} {
+		d := Destination{AddressFamily: nl.FAMILY_V4, Address: net.ParseIP(ip), Port: 80, Weight: 1}
+		assert.NilError(t, i.NewDestination(&s, &d))
+	}
+
+	var svcs []*Service
+	for svc, err := range i.Services() {
+		assert.NilError(t, err)
+		svcs = append(svcs, svc)
+	}
+	assert.Equal(t, len(svcs), 1)
+	assert.Equal(t, svcs[0].Port, uint16(80))
+
+	n := 0
+	for _, err := range i.Destinations(&s) {
+		assert.NilError(t, err)
+		n++
+		if n == 2 {
+			break
+		}
+	}
+	assert.Equal(t, n, 2)
+
+	// The socket is still usable after an early termination.
+	dsts, err := i.GetDestinations(&s)
+	assert.NilError(t, err)
+	assert.Equal(t, len(dsts), 3)
+
+	assert.NilError(t, i.DelService(&s))
+}
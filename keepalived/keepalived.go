@@ -0,0 +1,563 @@
+// +build linux
+
+// Package keepalived converts the virtual_server blocks of keepalived
+// configurations into services and destinations, to migrate the load
+// balancers configured by keepalived to controllers built on package ipvs.
+//
+// Only the static IPVS configuration is converted: health checkers, sorry
+// servers, VRRP instances and the other keepalived settings are ignored.
+package keepalived
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/kwanhur/ipvs/types"
+)
+
+// defaultPersistenceTimeout is the persistence timeout of keepalived, in
+// seconds, when persistence_timeout has no value.
+const defaultPersistenceTimeout = 360
+
+// node is a statement of a configuration, with the statements of its block.
+type node struct {
+	line     int
+	name     string
+	args     []string
+	children []*node
+}
+
+func (n *node) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("line %d: %s: %s", n.line, n.name, fmt.Sprintf(format, args...))
+}
+
+// Parse returns the services and destinations of the virtual_server blocks
+// of the keepalived configuration read from r. Include directives are not
+// supported, see ParseFile.
+func Parse(r io.Reader) ([]*ipvs.ServiceSpec, error) {
+	root, err := parse(r, "")
+	if err != nil {
+		return nil, err
+	}
+	return convert(root)
+}
+
+// ParseFile is like Parse for the configuration file path, following its
+// include directives.
+func ParseFile(path string) ([]*ipvs.ServiceSpec, error) {
+	root, err := parseFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return convert(root)
+}
+
+func parseFile(path string) (*node, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	root, err := parse(f, filepath.Dir(path))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return root, nil
+}
+
+// parse returns the statements of the configuration read from r. Included
+// files are looked up relative to dir, and not supported if dir is empty.
+func parse(r io.Reader, dir string) (*node, error) {
+	root := &node{}
+	stack := []*node{root}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		top := stack[len(stack)-1]
+		var cur *node
+		for _, tok := range tokenize(scanner.Text()) {
+			switch tok {
+			case "{":
+				if cur == nil {
+					// The block opens on the line following its statement.
+					if len(top.children) == 0 {
+						return nil, fmt.Errorf("line %d: unexpected {", line)
+					}
+					cur = top.children[len(top.children)-1]
+				}
+				stack = append(stack, cur)
+				top, cur = cur, nil
+			case "}":
+				if len(stack) == 1 {
+					return nil, fmt.Errorf("line %d: unexpected }", line)
+				}
+				stack = stack[:len(stack)-1]
+				top, cur = stack[len(stack)-1], nil
+			default:
+				if cur != nil {
+					cur.args = append(cur.args, tok)
+					continue
+				}
+				cur = &node{line: line, name: tok}
+				top.children = append(top.children, cur)
+			}
+		}
+
+		if cur != nil && cur.name == "include" {
+			top.children = top.children[:len(top.children)-1]
+			included, err := include(cur, dir)
+			if err != nil {
+				return nil, err
+			}
+			top.children = append(top.children, included...)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(stack) > 1 {
+		return nil, stack[len(stack)-1].errorf("unclosed block")
+	}
+	return root, nil
+}
+
+// include returns the statements of the files matched by the include
+// directive n.
+func include(n *node, dir string) ([]*node, error) {
+	if dir == "" {
+		return nil, n.errorf("not supported, use ParseFile")
+	}
+	if len(n.args) != 1 {
+		return nil, n.errorf("expected a file pattern")
+	}
+
+	pattern := n.args[0]
+	if !filepath.IsAbs(pattern) {
+		pattern = filepath.Join(dir, pattern)
+	}
+	paths, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, n.errorf("%v", err)
+	}
+
+	var res []*node
+	for _, path := range paths {
+		root, err := parseFile(path)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, root.children...)
+	}
+	return res, nil
+}
+
+// tokenize splits line into words, quoted strings and braces, up to its
+// comment.
+func tokenize(line string) []string {
+	var toks []string
+	for n := 0; n < len(line); {
+		c := line[n]
+		switch {
+		case c == '#' || c == '!':
+			return toks
+		case c == ' ' || c == '\t' || c == '\r':
+			n++
+		case c == '{' || c == '}':
+			toks = append(toks, line[n:n+1])
+			n++
+		case c == '"':
+			end := strings.IndexByte(line[n+1:], '"')
+			if end < 0 {
+				end = len(line) - n - 1
+			}
+			toks = append(toks, line[n+1:n+1+end])
+			n += end + 2
+		default:
+			end := strings.IndexAny(line[n:], " \t\r{}")
+			if end < 0 {
+				end = len(line) - n
+			}
+			toks = append(toks, line[n:n+end])
+			n += end
+		}
+	}
+	return toks
+}
+
+// convert returns the services of the virtual_server statements of root.
+func convert(root *node) ([]*ipvs.ServiceSpec, error) {
+	groups := make(map[string]*node)
+	for _, n := range root.children {
+		if n.name == "virtual_server_group" {
+			if len(n.args) != 1 {
+				return nil, n.errorf("expected a group name")
+			}
+			groups[n.args[0]] = n
+		}
+	}
+
+	var specs []*ipvs.ServiceSpec
+	for _, n := range root.children {
+		if n.name != "virtual_server" {
+			continue
+		}
+		s, err := virtualServer(n, groups)
+		if err != nil {
+			return nil, err
+		}
+		specs = append(specs, s...)
+	}
+	return specs, nil
+}
+
+// virtualServer returns the services of the virtual_server statement n, one
+// per address of its group if it refers to one.
+func virtualServer(n *node, groups map[string]*node) ([]*ipvs.ServiceSpec, error) {
+	var addrs []*ipvs.Service
+	switch {
+	case len(n.args) == 2 && n.args[0] == "group":
+		g, ok := groups[n.args[1]]
+		if !ok {
+			return nil, n.errorf("unknown group %s", n.args[1])
+		}
+		for _, entry := range g.children {
+			s, err := groupEntry(entry)
+			if err != nil {
+				return nil, err
+			}
+			addrs = append(addrs, s...)
+		}
+	default:
+		s, err := virtualAddress(n, n.args)
+		if err != nil {
+			return nil, err
+		}
+		addrs = append(addrs, s)
+	}
+
+	tmpl := &ipvs.Service{Protocol: ipvs.ProtocolTCP, SchedName: ipvs.WeightedLeastConnection}
+	method := &forwarding{method: ipvs.ForwardMasq}
+	var family uint16
+	var granularity string
+	var reals []*node
+	for _, c := range n.children {
+		var err error
+		switch c.name {
+		case "lb_algo", "lvs_sched":
+			if len(c.args) != 1 {
+				return nil, c.errorf("expected a scheduler")
+			}
+			tmpl.SchedName = c.args[0]
+		case "lb_kind", "lvs_method":
+			method, err = parseForwarding(c)
+		case "protocol":
+			if len(c.args) != 1 {
+				return nil, c.errorf("expected a protocol")
+			}
+			tmpl.Protocol, err = types.ParseIPProto(c.args[0])
+		case "persistence_timeout":
+			tmpl.Flags.Set(ipvs.SvcFlagPersistent)
+			tmpl.Timeout = defaultPersistenceTimeout
+			if len(c.args) > 0 {
+				tmpl.Timeout, err = parseUint32(c)
+			}
+		case "persistence_granularity":
+			if len(c.args) != 1 {
+				return nil, c.errorf("expected a netmask or prefix length")
+			}
+			granularity = c.args[0]
+		case "persistence_engine":
+			if len(c.args) != 1 {
+				return nil, c.errorf("expected a persistence engine")
+			}
+			tmpl.PEName = c.args[0]
+		case "ops":
+			tmpl.Flags.Set(ipvs.SvcFlagOnePacket)
+		case "sh-fallback", "mh-fallback", "flag-1":
+			tmpl.Flags.Set(ipvs.SvcFlagSched1)
+		case "sh-port", "mh-port", "flag-2":
+			tmpl.Flags.Set(ipvs.SvcFlagSched2)
+		case "flag-3":
+			tmpl.Flags.Set(ipvs.SvcFlagSched3)
+		case "ip_family":
+			if len(c.args) != 1 || (c.args[0] != "inet" && c.args[0] != "inet6") {
+				return nil, c.errorf("expected inet or inet6")
+			}
+			family = syscall.AF_INET
+			if c.args[0] == "inet6" {
+				family = syscall.AF_INET6
+			}
+		case "real_server":
+			reals = append(reals, c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	specs := make([]*ipvs.ServiceSpec, 0, len(addrs))
+	for _, addr := range addrs {
+		s := *tmpl
+		s.Address, s.Port, s.FWMark = addr.Address, addr.Port, addr.FWMark
+		s.AddressFamily = addressFamily(s.Address)
+		if s.FWMark > 0 && family != 0 {
+			s.AddressFamily = family
+		}
+		s.Netmask = fullNetmask(s.AddressFamily)
+		if granularity != "" {
+			if err := setGranularity(&s, granularity); err != nil {
+				return nil, n.errorf("%v", err)
+			}
+		}
+
+		spec := &ipvs.ServiceSpec{Service: &s}
+		for _, r := range reals {
+			d, err := realServer(r, &s, method)
+			if err != nil {
+				return nil, err
+			}
+			spec.Destinations = append(spec.Destinations, d)
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// virtualAddress returns the service identified by args, either an address
+// and a port or a firewall mark.
+func virtualAddress(n *node, args []string) (*ipvs.Service, error) {
+	if len(args) == 2 && args[0] == "fwmark" {
+		mark, err := strconv.ParseUint(args[1], 10, 32)
+		if err != nil || mark == 0 {
+			return nil, n.errorf("invalid firewall mark %s", args[1])
+		}
+		return &ipvs.Service{FWMark: uint32(mark)}, nil
+	}
+	if len(args) != 2 {
+		return nil, n.errorf("expected an address and a port, a firewall mark or a group")
+	}
+
+	ip := parseIP(args[0])
+	if ip == nil {
+		return nil, n.errorf("invalid address %s", args[0])
+	}
+	port, err := strconv.ParseUint(args[1], 10, 16)
+	if err != nil {
+		return nil, n.errorf("invalid port %s", args[1])
+	}
+	return &ipvs.Service{Address: ip, Port: uint16(port)}, nil
+}
+
+// groupEntry returns the services of an entry of a virtual_server_group: an
+// address and a port, an IPv4 range whose last byte is given as a range,
+// e.g. "10.0.0.1-4 80", or a firewall mark.
+func groupEntry(n *node) ([]*ipvs.Service, error) {
+	args := append([]string{n.name}, n.args...)
+	if n.name == "fwmark" || !strings.Contains(n.name, "-") {
+		s, err := virtualAddress(n, args)
+		if err != nil {
+			return nil, err
+		}
+		return []*ipvs.Service{s}, nil
+	}
+
+	dash := strings.LastIndexByte(n.name, '-')
+	first := parseIP(n.name[:dash]).To4()
+	last, err := strconv.ParseUint(n.name[dash+1:], 10, 8)
+	if first == nil || err != nil || byte(last) < first[3] {
+		return nil, n.errorf("invalid address range %s", n.name)
+	}
+
+	var res []*ipvs.Service
+	for b := int(first[3]); b <= int(last); b++ {
+		ip := net.IPv4(first[0], first[1], first[2], byte(b)).To4()
+		s, err := virtualAddress(n, append([]string{ip.String()}, n.args...))
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, s)
+	}
+	return res, nil
+}
+
+// realServer returns the destination of s described by the real_server
+// statement n, forwarded with method unless it sets its own.
+func realServer(n *node, s *ipvs.Service, method *forwarding) (*ipvs.Destination, error) {
+	if len(n.args) < 1 || len(n.args) > 2 {
+		return nil, n.errorf("expected an address and a port")
+	}
+	ip := parseIP(n.args[0])
+	if ip == nil {
+		return nil, n.errorf("invalid address %s", n.args[0])
+	}
+	d := &ipvs.Destination{
+		Address:       ip,
+		Port:          s.Port,
+		Weight:        1,
+		AddressFamily: addressFamily(ip),
+	}
+	if len(n.args) == 2 {
+		port, err := strconv.ParseUint(n.args[1], 10, 16)
+		if err != nil {
+			return nil, n.errorf("invalid port %s", n.args[1])
+		}
+		d.Port = uint16(port)
+	}
+
+	for _, c := range n.children {
+		var err error
+		switch c.name {
+		case "weight":
+			var w uint32
+			w, err = parseUint32(c)
+			d.Weight = int(w)
+		case "uthreshold":
+			d.UpperThreshold, err = parseUint32(c)
+		case "lthreshold":
+			d.LowerThreshold, err = parseUint32(c)
+		case "lb_kind", "lvs_method":
+			method, err = parseForwarding(c)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	d.SetForwardingMethod(method.method)
+	d.TunnelType, d.TunnelPort, d.TunnelFlags = method.tunnelType, method.tunnelPort, method.tunnelFlags
+	return d, nil
+}
+
+// forwarding is the forwarding method of real servers, with their tunnel
+// encapsulation.
+type forwarding struct {
+	method      ipvs.ForwardingMethod
+	tunnelType  uint8
+	tunnelPort  uint16
+	tunnelFlags uint16
+}
+
+var forwardingMethods = map[string]ipvs.ForwardingMethod{
+	"NAT": ipvs.ForwardMasq,
+	"DR":  ipvs.ForwardDirectRoute,
+	"TUN": ipvs.ForwardTunnel,
+}
+
+// parseForwarding parses the forwarding method statement n, of the form:
+//
+//	lvs_method NAT|DR|TUN [type ipip|gue port PORT|gre] [nocsum|csum|remcsum]
+func parseForwarding(n *node) (*forwarding, error) {
+	if len(n.args) == 0 {
+		return nil, n.errorf("expected NAT, DR or TUN")
+	}
+	m, ok := forwardingMethods[strings.ToUpper(n.args[0])]
+	if !ok {
+		return nil, n.errorf("unknown forwarding method %s", n.args[0])
+	}
+	f := &forwarding{method: m}
+	if m != ipvs.ForwardTunnel && len(n.args) > 1 {
+		return nil, n.errorf("unexpected %s", n.args[1])
+	}
+
+	for args := n.args[1:]; len(args) > 0; args = args[1:] {
+		switch args[0] {
+		case "type":
+			if len(args) < 2 {
+				return nil, n.errorf("expected a tunnel type")
+			}
+			args = args[1:]
+			switch args[0] {
+			case "ipip":
+				f.tunnelType = ipvs.TunnelTypeIPIP
+			case "gre":
+				f.tunnelType = ipvs.TunnelTypeGRE
+			case "gue":
+				if len(args) < 3 || args[1] != "port" {
+					return nil, n.errorf("expected the port of the gue tunnel")
+				}
+				port, err := strconv.ParseUint(args[2], 10, 16)
+				if err != nil {
+					return nil, n.errorf("invalid tunnel port %s", args[2])
+				}
+				f.tunnelType, f.tunnelPort = ipvs.TunnelTypeGUE, uint16(port)
+				args = args[2:]
+			default:
+				return nil, n.errorf("unknown tunnel type %s", args[0])
+			}
+		case "nocsum":
+			f.tunnelFlags = ipvs.TunnelFlagNoChecksum
+		case "csum":
+			f.tunnelFlags = ipvs.TunnelFlagChecksum
+		case "remcsum":
+			f.tunnelFlags = ipvs.TunnelFlagRemoteChecksum
+		default:
+			return nil, n.errorf("unexpected %s", args[0])
+		}
+	}
+	return f, nil
+}
+
+// setGranularity sets the persistence netmask of s to granularity, a
+// netmask for IPv4 and a prefix length for IPv6.
+func setGranularity(s *ipvs.Service, granularity string) error {
+	if s.AddressFamily == syscall.AF_INET6 {
+		plen, err := strconv.Atoi(strings.TrimPrefix(granularity, "/"))
+		if err != nil {
+			return fmt.Errorf("invalid persistence granularity %s", granularity)
+		}
+		return s.SetPersistencePrefix(plen)
+	}
+
+	mask := net.ParseIP(granularity).To4()
+	if mask == nil {
+		return fmt.Errorf("invalid persistence granularity %s", granularity)
+	}
+	s.Netmask = uint32(mask[0])<<24 | uint32(mask[1])<<16 | uint32(mask[2])<<8 | uint32(mask[3])
+	return nil
+}
+
+func parseUint32(n *node) (uint32, error) {
+	if len(n.args) != 1 {
+		return 0, n.errorf("expected a number")
+	}
+	v, err := strconv.ParseUint(n.args[0], 10, 32)
+	if err != nil {
+		return 0, n.errorf("invalid number %s", n.args[0])
+	}
+	return uint32(v), nil
+}
+
+// parseIP parses ip, returning IPv4 addresses in their 4 bytes form.
+func parseIP(s string) net.IP {
+	ip := net.ParseIP(s)
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4
+	}
+	return ip
+}
+
+// addressFamily returns the address family of ip, IPv4 if not set.
+func addressFamily(ip net.IP) uint16 {
+	if ip != nil && ip.To4() == nil {
+		return syscall.AF_INET6
+	}
+	return syscall.AF_INET
+}
+
+// fullNetmask returns the netmask of a service of family which does not
+// group clients.
+func fullNetmask(family uint16) uint32 {
+	if family == syscall.AF_INET6 {
+		return 128
+	}
+	return 0xFFFFFFFF
+}
@@ -0,0 +1,137 @@
+// +build linux
+
+package keepalived
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+	is "gotest.tools/v3/assert/cmp"
+)
+
+const testConfig = `
+global_defs {
+    router_id LVS_1
+}
+
+! Web frontends.
+virtual_server 10.0.0.1 80 {
+    delay_loop 6
+    lb_algo wrr
+    lb_kind DR
+    persistence_timeout 300
+    persistence_granularity 255.255.255.0
+    protocol TCP
+
+    real_server 10.1.0.1 8080 {
+        weight 2
+        uthreshold 100
+        TCP_CHECK {
+            connect_timeout 3
+        }
+    }
+    real_server 10.1.0.2 8080 {
+        lvs_method TUN type gue port 6080 csum
+    }
+}
+
+virtual_server_group dns {
+    10.0.0.10-11 53
+    fwmark 5
+}
+
+virtual_server group dns
+{
+    lvs_sched sh
+    sh-port
+    ops
+    protocol UDP
+    real_server 2001:db8::1 { weight 0 }
+}
+`
+
+func TestParse(t *testing.T) {
+	specs, err := Parse(strings.NewReader(testConfig))
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(specs, 4))
+
+	web := specs[0]
+	assert.DeepEqual(t, *web.Service, ipvs.Service{
+		Address:       net.ParseIP("10.0.0.1").To4(),
+		Protocol:      ipvs.ProtocolTCP,
+		Port:          80,
+		SchedName:     ipvs.WeightedRoundRobin,
+		Flags:         ipvs.SvcFlagPersistent,
+		Timeout:       300,
+		Netmask:       0xFFFFFF00,
+		AddressFamily: syscall.AF_INET,
+	})
+	assert.Assert(t, is.Len(web.Destinations, 2))
+	assert.DeepEqual(t, *web.Destinations[0], ipvs.Destination{
+		Address:         net.ParseIP("10.1.0.1").To4(),
+		Port:            8080,
+		Weight:          2,
+		ConnectionFlags: ipvs.ConnectionFlagDirectRoute,
+		AddressFamily:   syscall.AF_INET,
+		UpperThreshold:  100,
+	})
+	tun := web.Destinations[1]
+	assert.Equal(t, tun.ForwardingMethod(), ipvs.ForwardTunnel)
+	assert.Equal(t, tun.TunnelType, uint8(ipvs.TunnelTypeGUE))
+	assert.Equal(t, tun.TunnelPort, uint16(6080))
+	assert.Equal(t, tun.TunnelFlags, uint16(ipvs.TunnelFlagChecksum))
+	assert.Equal(t, tun.Weight, 1)
+
+	var names []string
+	for _, spec := range specs[1:] {
+		names = append(names, spec.Service.String())
+		assert.Equal(t, spec.Service.Flags, ipvs.ServiceFlags(ipvs.SvcFlagSHPort|ipvs.SvcFlagOnePacket))
+		assert.Assert(t, is.Len(spec.Destinations, 1))
+		assert.Equal(t, spec.Destinations[0].Weight, 0)
+		assert.Equal(t, spec.Destinations[0].Port, spec.Service.Port)
+		assert.Equal(t, spec.Destinations[0].ForwardingMethod(), ipvs.ForwardMasq)
+	}
+	assert.DeepEqual(t, names, []string{"UDP 10.0.0.10:53 (sh)", "UDP 10.0.0.11:53 (sh)", "FMW 5 (sh)"})
+}
+
+func TestParseErrors(t *testing.T) {
+	testcases := []struct {
+		conf string
+		err  string
+	}{
+		{"virtual_server 10.0.0.1 80 {\n", "line 1: virtual_server: unclosed block"},
+		{"}\n", "line 1: unexpected }"},
+		{"virtual_server 10.0.0.300 80 {}\n", "invalid address 10.0.0.300"},
+		{"virtual_server group web {}\n", "unknown group web"},
+		{"virtual_server fwmark 1 {\n lb_kind FULLNAT\n}\n", "line 2: lb_kind: unknown forwarding method FULLNAT"},
+		{"virtual_server fwmark 1 {\n real_server 10.1.0.1 80 {\n  weight -1\n }\n}\n", "line 3: weight: invalid number -1"},
+		{"include /etc/keepalived/*.conf\n", "include: not supported"},
+	}
+
+	for _, tc := range testcases {
+		_, err := Parse(strings.NewReader(tc.conf))
+		assert.ErrorContains(t, err, tc.err, tc.conf)
+	}
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "keepalived")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "conf.d"), 0755))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "keepalived.conf"), []byte("include conf.d/*.conf\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "conf.d", "web.conf"), []byte("virtual_server fwmark 1 {\n}\n"), 0644))
+
+	specs, err := ParseFile(filepath.Join(dir, "keepalived.conf"))
+	assert.NilError(t, err)
+	assert.Assert(t, is.Len(specs, 1))
+	assert.Equal(t, specs[0].Service.FWMark, uint32(1))
+}
@@ -0,0 +1,47 @@
+// +build linux
+
+package ipvs
+
+import (
+	"runtime"
+	"runtime/debug"
+	"sync/atomic"
+
+	"github.com/sirupsen/logrus"
+)
+
+var leakDetection int32
+
+// SetLeakDetection enables or disables the detection of leaked handles. When
+// enabled, the handles created afterwards record the stack of their creation
+// and, if one gets garbage collected without having been closed, that stack
+// is logged and its socket closed. Recording stacks and setting finalizers
+// has a cost, so this is meant for debugging.
+func SetLeakDetection(enable bool) {
+	var v int32
+	if enable {
+		v = 1
+	}
+	atomic.StoreInt32(&leakDetection, v)
+}
+
+// trackHandle sets a finalizer reporting h as leaked if leak detection is
+// enabled.
+func trackHandle(h *Handle) {
+	if atomic.LoadInt32(&leakDetection) == 0 {
+		return
+	}
+
+	stack := debug.Stack()
+	runtime.SetFinalizer(h, func(h *Handle) {
+		logrus.Warnf("ipvs handle garbage collected without being closed, created at:\n%s", stack)
+		if h.sock != nil {
+			h.sock.Close()
+		}
+	})
+}
+
+// untrackHandle removes the finalizer set by trackHandle, if any.
+func untrackHandle(h *Handle) {
+	runtime.SetFinalizer(h, nil)
+}
@@ -0,0 +1,50 @@
+// +build linux
+
+package ipvs
+
+import (
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/sirupsen/logrus/hooks/test"
+	"gotest.tools/v3/assert"
+)
+
+func TestLeakDetection(t *testing.T) {
+	hook := test.NewGlobal()
+	defer logrus.StandardLogger().ReplaceHooks(make(logrus.LevelHooks))
+
+	SetLeakDetection(true)
+	defer SetLeakDetection(false)
+
+	closed, err := New("")
+	assert.NilError(t, err)
+	closed.Close()
+
+	_, err = New("")
+	assert.NilError(t, err)
+
+	leaks := func() []*logrus.Entry {
+		var res []*logrus.Entry
+		for _, e := range hook.AllEntries() {
+			if strings.Contains(e.Message, "without being closed") {
+				res = append(res, e)
+			}
+		}
+		return res
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for len(leaks()) == 0 && time.Now().Before(deadline) {
+		runtime.GC()
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	entries := leaks()
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Level, logrus.WarnLevel)
+	assert.Assert(t, strings.Contains(entries[0].Message, "TestLeakDetection"))
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"sort"
+)
+
+// LoadMetric selects how the load of a destination is measured.
+type LoadMetric int
+
+const (
+	// ByActiveConnections measures the load with the active connections.
+	ByActiveConnections LoadMetric = iota + 1
+
+	// ByConnections measures the load with both the active and inactive
+	// connections, weighing inactive ones like the lc scheduler does.
+	ByConnections
+
+	// ByRate measures the load with the rate of new connections.
+	ByRate
+
+	// ByBandwidth measures the load with the incoming and outgoing byte
+	// rates.
+	ByBandwidth
+)
+
+var loadMetricNames = map[LoadMetric]string{
+	ByActiveConnections: "ActiveConnections",
+	ByConnections:       "Connections",
+	ByRate:              "Rate",
+	ByBandwidth:         "Bandwidth",
+}
+
+// String returns the name of the metric
+func (m LoadMetric) String() string {
+	if name, ok := loadMetricNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("LoadMetric(%d)", int(m))
+}
+
+// Load returns the load of d measured with m, relative to its weight so that
+// destinations of different capacities compare fairly. A destination with a
+// null weight gets no new connections and has no load.
+func (m LoadMetric) Load(d *Destination) float64 {
+	if d.Weight <= 0 {
+		return 0
+	}
+
+	var v float64
+	switch m {
+	case ByActiveConnections:
+		v = float64(d.ActiveConnections)
+	case ByConnections:
+		// Same overhead as the kernel lc and wlc schedulers.
+		v = float64(d.ActiveConnections)*256 + float64(d.InactiveConnections)
+	case ByRate:
+		v = float64(d.Stats.CPS)
+	case ByBandwidth:
+		v = float64(d.Stats.BPSIn) + float64(d.Stats.BPSOut)
+	}
+	return v / float64(d.Weight)
+}
+
+// SortDestinations sorts dsts from the least to the most loaded according to
+// m. Destinations with a null weight, which cannot take new connections,
+// come last. The order of destinations with the same load is preserved.
+func SortDestinations(dsts []*Destination, m LoadMetric) {
+	sort.SliceStable(dsts, func(a, b int) bool {
+		da, db := dsts[a], dsts[b]
+		if (da.Weight <= 0) != (db.Weight <= 0) {
+			return db.Weight <= 0
+		}
+		return m.Load(da) < m.Load(db)
+	})
+}
+
+// SortDestinationsByLoad returns the destinations of s sorted from the least
+// to the most loaded according to m, see SortDestinations.
+func (i *Handle) SortDestinationsByLoad(s *Service, m LoadMetric) ([]*Destination, error) {
+	dsts, err := i.GetDestinations(s)
+	if err != nil {
+		return nil, err
+	}
+	SortDestinations(dsts, m)
+	return dsts, nil
+}
+
+// LeastLoadedDestination returns the destination of s with the most headroom
+// according to m, or nil if s has no destination with a positive weight.
+func (i *Handle) LeastLoadedDestination(s *Service, m LoadMetric) (*Destination, error) {
+	dsts, err := i.SortDestinationsByLoad(s, m)
+	if err != nil {
+		return nil, err
+	}
+	if len(dsts) == 0 || dsts[0].Weight <= 0 {
+		return nil, nil
+	}
+	return dsts[0], nil
+}
@@ -0,0 +1,44 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSortDestinations(t *testing.T) {
+	dsts := []*Destination{
+		{Address: net.ParseIP("10.1.0.1"), Weight: 1, ActiveConnections: 10, InactiveConnections: 0, Stats: DstStats{CPS: 5, BPSIn: 100, BPSOut: 900}},
+		{Address: net.ParseIP("10.1.0.2"), Weight: 4, ActiveConnections: 20, InactiveConnections: 50, Stats: DstStats{CPS: 8, BPSIn: 1000, BPSOut: 1000}},
+		{Address: net.ParseIP("10.1.0.3"), Weight: 0, ActiveConnections: 0, InactiveConnections: 0},
+		{Address: net.ParseIP("10.1.0.4"), Weight: 2, ActiveConnections: 4, InactiveConnections: 600, Stats: DstStats{CPS: 12, BPSIn: 100, BPSOut: 100}},
+	}
+
+	testcases := []struct {
+		metric   LoadMetric
+		expected []string
+	}{
+		{ByActiveConnections, []string{"10.1.0.4", "10.1.0.2", "10.1.0.1", "10.1.0.3"}},
+		{ByConnections, []string{"10.1.0.4", "10.1.0.2", "10.1.0.1", "10.1.0.3"}},
+		{ByRate, []string{"10.1.0.2", "10.1.0.1", "10.1.0.4", "10.1.0.3"}},
+		{ByBandwidth, []string{"10.1.0.4", "10.1.0.2", "10.1.0.1", "10.1.0.3"}},
+	}
+
+	for _, tc := range testcases {
+		sorted := append([]*Destination(nil), dsts...)
+		SortDestinations(sorted, tc.metric)
+
+		var got []string
+		for _, d := range sorted {
+			got = append(got, d.Address.String())
+		}
+		for n := range got {
+			if got[n] != tc.expected[n] {
+				t.Logf("sorted by %s: %v", tc.metric, got)
+				t.Errorf("expected %v", tc.expected)
+				break
+			}
+		}
+	}
+}
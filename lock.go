@@ -0,0 +1,216 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/sys/unix"
+)
+
+// DefaultLockPath is the lock file used by the writers of the host IPVS
+// configuration agreeing on a HostLock.
+const DefaultLockPath = "/run/ipvs.lock"
+
+// DefaultLockTimeout bounds the wait of a batch for the host lock, see
+// WithHostLock.
+const DefaultLockTimeout = 30 * time.Second
+
+// lockPollInterval is the interval at which a busy lock is tried again.
+const lockPollInterval = 50 * time.Millisecond
+
+// LockBusyError is returned when the lock could not be taken before the
+// context was done, the lock being held by another process or handle.
+type LockBusyError struct {
+	Path string
+	// PID is the PID of the holder, zero if it did not record it.
+	PID int
+	// Err is the error of the context.
+	Err error
+}
+
+func (e *LockBusyError) Error() string {
+	if e.PID == 0 {
+		return fmt.Sprintf("lock %s busy: %v", e.Path, e.Err)
+	}
+	return fmt.Sprintf("lock %s held by PID %d: %v", e.Path, e.PID, e.Err)
+}
+
+// Unwrap returns the error of the context, so that errors.Is(err,
+// context.DeadlineExceeded) reports whether the wait timed out.
+func (e *LockBusyError) Unwrap() error {
+	return e.Err
+}
+
+// HostLock is an advisory lock, a flock on a well known file, serializing
+// the batches of changes of the processes programming IPVS on a host, so
+// that no writer observes or builds on the half applied batch of another.
+// Being advisory, it only protects from the writers taking it too, e.g. a
+// keepalived notify script wrapped with flock(1) on the same file.
+//
+// The PID of the holder is written to the file, see LockHolder.
+type HostLock struct {
+	path string
+
+	mu sync.Mutex
+	f  *os.File
+}
+
+// NewHostLock returns the lock on the file path, DefaultLockPath if empty.
+// The file is created when the lock is first taken.
+func NewHostLock(path string) *HostLock {
+	if path == "" {
+		path = DefaultLockPath
+	}
+	return &HostLock{path: path}
+}
+
+// Path returns the path of the lock file.
+func (l *HostLock) Path() string {
+	return l.path
+}
+
+// Lock takes the lock, waiting for the other holder to release it until ctx
+// is done, in which case a *LockBusyError is returned.
+func (l *HostLock) Lock(ctx context.Context) error {
+	ticker := time.NewTicker(lockPollInterval)
+	defer ticker.Stop()
+
+	for {
+		ok, err := l.TryLock()
+		if err != nil || ok {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			pid, _, _ := LockHolder(l.path)
+			return &LockBusyError{Path: l.path, PID: pid, Err: ctx.Err()}
+		case <-ticker.C:
+		}
+	}
+}
+
+// TryLock takes the lock if it is free and reports whether it did.
+func (l *HostLock) TryLock() (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f != nil {
+		return false, fmt.Errorf("lock %s already held by this process", l.path)
+	}
+
+	f, err := os.OpenFile(l.path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return false, err
+	}
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_EX|unix.LOCK_NB); err != nil {
+		f.Close()
+		if err == unix.EWOULDBLOCK {
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to lock %s: %v", l.path, err)
+	}
+
+	// The PID is informational, failing to record it does not matter.
+	if err := f.Truncate(0); err == nil {
+		f.WriteAt([]byte(strconv.Itoa(os.Getpid())+"\n"), 0)
+	}
+	l.f = f
+	return true, nil
+}
+
+// Unlock releases the lock.
+func (l *HostLock) Unlock() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.f == nil {
+		return fmt.Errorf("lock %s not held", l.path)
+	}
+	f := l.f
+	l.f = nil
+
+	f.Truncate(0)
+	// Closing the file releases the flock.
+	return f.Close()
+}
+
+// Do runs fn, typically a batch of changes made through a Handle, holding
+// the lock.
+func (l *HostLock) Do(ctx context.Context, fn func() error) error {
+	if err := l.Lock(ctx); err != nil {
+		return err
+	}
+	defer l.Unlock()
+	return fn()
+}
+
+// WithHostLock makes the handle hold the HostLock on the file path,
+// DefaultLockPath if empty, around its batches of changes: Reconcile,
+// ReconcileParallel, Restore, FlushWhere, and PrepareService with the Enable
+// and Abort of its Warmup. A batch waits for the other holders to release
+// the lock for timeout, DefaultLockTimeout if zero, and then fails with a
+// *LockBusyError. Batches of the handle are run one at a time.
+func WithHostLock(path string, timeout time.Duration) Option {
+	return func(o *options) {
+		o.hostLock = NewHostLock(path)
+		o.hostLockTimeout = timeout
+	}
+}
+
+// batch runs fn holding the host lock of the handle, if it has one.
+func (i *Handle) batch(fn func() error) error {
+	if i.opts == nil || i.opts.hostLock == nil {
+		return fn()
+	}
+	timeout := i.opts.hostLockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	i.batchMu.Lock()
+	defer i.batchMu.Unlock()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return i.opts.hostLock.Do(ctx, fn)
+}
+
+// LockHolder reports whether the lock file path is held by a process,
+// including this one, and the PID of the holder if it recorded it.
+func LockHolder(path string) (pid int, locked bool, err error) {
+	if path == "" {
+		path = DefaultLockPath
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	defer f.Close()
+
+	// flock locks belong to the open file, so probing from another one
+	// detects the locks of this process too.
+	if err := unix.Flock(int(f.Fd()), unix.LOCK_SH|unix.LOCK_NB); err == nil {
+		unix.Flock(int(f.Fd()), unix.LOCK_UN)
+		return 0, false, nil
+	} else if err != unix.EWOULDBLOCK {
+		return 0, false, fmt.Errorf("failed to probe lock %s: %v", path, err)
+	}
+
+	b, err := ioutil.ReadAll(f)
+	if err != nil {
+		return 0, true, nil
+	}
+	pid, _ = strconv.Atoi(strings.TrimSpace(string(b)))
+	return pid, true, nil
+}
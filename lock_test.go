@@ -0,0 +1,113 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestHostLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ipvs.lock")
+
+	_, locked, err := LockHolder(path)
+	assert.NilError(t, err)
+	assert.Assert(t, !locked)
+
+	l := NewHostLock(path)
+	assert.NilError(t, l.Lock(context.Background()))
+
+	pid, locked, err := LockHolder(path)
+	assert.NilError(t, err)
+	assert.Assert(t, locked)
+	assert.Equal(t, pid, os.Getpid())
+
+	other := NewHostLock(path)
+	ok, err := other.TryLock()
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*lockPollInterval)
+	defer cancel()
+	err = other.Lock(ctx)
+	assert.Assert(t, errors.Is(err, context.DeadlineExceeded))
+	busy, ok := err.(*LockBusyError)
+	assert.Assert(t, ok)
+	assert.Equal(t, busy.PID, os.Getpid())
+
+	go func() {
+		time.Sleep(lockPollInterval)
+		l.Unlock()
+	}()
+	ran := false
+	assert.NilError(t, other.Do(context.Background(), func() error {
+		ran = true
+		return nil
+	}))
+	assert.Assert(t, ran)
+
+	_, locked, err = LockHolder(path)
+	assert.NilError(t, err)
+	assert.Assert(t, !locked)
+	assert.ErrorContains(t, l.Unlock(), "not held")
+}
+
+func TestWithHostLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "lock")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "ipvs.lock")
+
+	o := defaultOptions()
+	WithHostLock(path, 3*lockPollInterval)(o)
+	i := &Handle{opts: o}
+
+	other := NewHostLock(path)
+	assert.NilError(t, other.Lock(context.Background()))
+	err = i.batch(func() error {
+		t.Error("batch run holding the lock")
+		return nil
+	})
+	assert.ErrorContains(t, err, "held by PID")
+
+	released := make(chan struct{})
+	go func() {
+		time.Sleep(lockPollInterval)
+		close(released)
+		other.Unlock()
+	}()
+
+	assert.NilError(t, i.batch(func() error {
+		select {
+		case <-released:
+		default:
+			t.Error("batch run before the lock was released")
+		}
+		pid, locked, err := LockHolder(path)
+		assert.NilError(t, err)
+		assert.Assert(t, locked)
+		assert.Equal(t, pid, os.Getpid())
+		return nil
+	}))
+
+	h := &warmupHandler{}
+	w, err := prepareService(h, &Service{Port: 80}, []*Destination{{Port: 8080, Weight: 1}})
+	assert.NilError(t, err)
+	w.batch = i.batch
+	assert.NilError(t, w.Enable())
+	assert.Equal(t, h.weights[8080], 1)
+
+	_, locked, err := LockHolder(path)
+	assert.NilError(t, err)
+	assert.Assert(t, !locked)
+}
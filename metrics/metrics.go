@@ -0,0 +1,168 @@
+// +build linux
+
+// Package metrics renders IPVS statistics in the Prometheus text exposition
+// format and in the OpenMetrics text format.
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/kwanhur/ipvs"
+)
+
+// Metric types of the exposition format.
+const (
+	counter = "counter"
+	gauge   = "gauge"
+)
+
+// family describes a metric and how to read its value.
+type family struct {
+	name  string
+	help  string
+	kind  string
+	value func(st *ipvs.SvcStats, d *ipvs.Destination) float64
+}
+
+var statsFamilies = []family{
+	{"connections_total", "Total number of connections.", counter,
+		func(st *ipvs.SvcStats, _ *ipvs.Destination) float64 { return float64(st.Connections) }},
+	{"incoming_packets_total", "Total number of incoming packets.", counter,
+		func(st *ipvs.SvcStats, _ *ipvs.Destination) float64 { return float64(st.PacketsIn) }},
+	{"outgoing_packets_total", "Total number of outgoing packets.", counter,
+		func(st *ipvs.SvcStats, _ *ipvs.Destination) float64 { return float64(st.PacketsOut) }},
+	{"incoming_bytes_total", "Total number of incoming bytes.", counter,
+		func(st *ipvs.SvcStats, _ *ipvs.Destination) float64 { return float64(st.BytesIn) }},
+	{"outgoing_bytes_total", "Total number of outgoing bytes.", counter,
+		func(st *ipvs.SvcStats, _ *ipvs.Destination) float64 { return float64(st.BytesOut) }},
+	{"connections_per_second", "Rate of new connections, as estimated by the kernel.", gauge,
+		func(st *ipvs.SvcStats, _ *ipvs.Destination) float64 { return float64(st.CPS) }},
+}
+
+var destinationFamilies = []family{
+	{"active_connections", "Number of active connections.", gauge,
+		func(_ *ipvs.SvcStats, d *ipvs.Destination) float64 { return float64(d.ActiveConnections) }},
+	{"inactive_connections", "Number of inactive connections.", gauge,
+		func(_ *ipvs.SvcStats, d *ipvs.Destination) float64 { return float64(d.InactiveConnections) }},
+	{"persistent_connections", "Number of persistent connection templates.", gauge,
+		func(_ *ipvs.SvcStats, d *ipvs.Destination) float64 { return float64(d.PersistentConnections) }},
+	{"weight", "Weight of the destination.", gauge,
+		func(_ *ipvs.SvcStats, d *ipvs.Destination) float64 { return float64(d.Weight) }},
+}
+
+// Namespace prefixes the name of every metric.
+const Namespace = "ipvs"
+
+// OpenMetricsContentType is the content type of the output of
+// WriteOpenMetrics.
+const OpenMetricsContentType = "application/openmetrics-text; version=1.0.0; charset=utf-8"
+
+// WriteText writes the statistics of snap to w in the Prometheus text
+// exposition format. Services are labelled with protocol, address, port and
+// fwmark, destinations additionally with destination and destination_port.
+func WriteText(w io.Writer, snap *ipvs.StatsSnapshot) error {
+	return write(w, snap, false)
+}
+
+// WriteOpenMetrics writes the statistics of snap to w in the OpenMetrics
+// text format, with the metrics and labels of WriteText.
+func WriteOpenMetrics(w io.Writer, snap *ipvs.StatsSnapshot) error {
+	return write(w, snap, true)
+}
+
+func write(w io.Writer, snap *ipvs.StatsSnapshot, openMetrics bool) error {
+	bw := bufio.NewWriter(w)
+
+	for _, f := range statsFamilies {
+		writeHeader(bw, "service", f, openMetrics)
+		for _, sd := range snap.Services {
+			st := sd.Service.Stats
+			writeSample(bw, "service", f, serviceLabels(sd.Service), f.value(&st, nil))
+		}
+	}
+
+	for _, f := range append(statsFamilies[:len(statsFamilies):len(statsFamilies)], destinationFamilies...) {
+		writeHeader(bw, "destination", f, openMetrics)
+		for _, sd := range snap.Services {
+			labels := serviceLabels(sd.Service)
+			for _, d := range sd.Destinations {
+				st := ipvs.SvcStats(d.Stats)
+				writeSample(bw, "destination", f, destinationLabels(labels, d), f.value(&st, d))
+			}
+		}
+	}
+
+	if openMetrics {
+		bw.WriteString("# EOF\n")
+	}
+	return bw.Flush()
+}
+
+// writeHeader writes the metadata of the family f. OpenMetrics names
+// counter families without their _total suffix and declares their unit.
+func writeHeader(w *bufio.Writer, subsystem string, f family, openMetrics bool) {
+	name := metricName(subsystem, f.name)
+	if openMetrics {
+		name = strings.TrimSuffix(name, "_total")
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n", name, f.help)
+	fmt.Fprintf(w, "# TYPE %s %s\n", name, f.kind)
+	if openMetrics && strings.HasSuffix(name, "_bytes") {
+		fmt.Fprintf(w, "# UNIT %s bytes\n", name)
+	}
+}
+
+func writeSample(w *bufio.Writer, subsystem string, f family, labels []label, v float64) {
+	w.WriteString(metricName(subsystem, f.name))
+	w.WriteByte('{')
+	for n, l := range labels {
+		if n > 0 {
+			w.WriteByte(',')
+		}
+		w.WriteString(l.name)
+		w.WriteString(`="`)
+		w.WriteString(labelEscaper.Replace(l.value))
+		w.WriteByte('"')
+	}
+	w.WriteString("} ")
+	w.WriteString(strconv.FormatFloat(v, 'g', -1, 64))
+	w.WriteByte('\n')
+}
+
+func metricName(subsystem, name string) string {
+	return Namespace + "_" + subsystem + "_" + name
+}
+
+type label struct {
+	name, value string
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+
+func serviceLabels(s *ipvs.Service) []label {
+	labels := []label{
+		{"protocol", ""},
+		{"address", ""},
+		{"port", ""},
+		{"fwmark", ""},
+	}
+	if s.FWMark > 0 {
+		labels[3].value = strconv.FormatUint(uint64(s.FWMark), 10)
+	} else {
+		labels[0].value = strings.ToLower(s.Protocol.String())
+		labels[1].value = s.Address.String()
+		labels[2].value = strconv.Itoa(int(s.Port))
+	}
+	return labels
+}
+
+func destinationLabels(service []label, d *ipvs.Destination) []label {
+	return append(service[:len(service):len(service)],
+		label{"destination", d.Address.String()},
+		label{"destination_port", strconv.Itoa(int(d.Port))},
+	)
+}
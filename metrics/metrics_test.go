@@ -0,0 +1,102 @@
+// +build linux
+
+package metrics
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func testSnapshot() *ipvs.StatsSnapshot {
+	return &ipvs.StatsSnapshot{
+		Time: time.Unix(1577836800, 0),
+		Services: []*ipvs.ServiceDestinations{
+			{
+				Service: &ipvs.Service{
+					Protocol: 6,
+					Address:  net.ParseIP("10.0.0.1"),
+					Port:     80,
+					Stats:    ipvs.SvcStats{Connections: 3, BytesIn: 1e10},
+				},
+				Destinations: []*ipvs.Destination{{
+					Address:           net.ParseIP("10.1.0.1"),
+					Port:              8080,
+					Weight:            2,
+					ActiveConnections: 1,
+					Stats:             ipvs.DstStats{Connections: 3},
+				}},
+			},
+			{
+				Service: &ipvs.Service{FWMark: 7},
+			},
+		},
+	}
+}
+
+func TestWriteText(t *testing.T) {
+	var b bytes.Buffer
+	assert.NilError(t, WriteText(&b, testSnapshot()))
+	out := b.String()
+
+	for _, expected := range []string{
+		"# HELP ipvs_service_connections_total Total number of connections.\n" +
+			"# TYPE ipvs_service_connections_total counter\n" +
+			`ipvs_service_connections_total{protocol="tcp",address="10.0.0.1",port="80",fwmark=""} 3` + "\n" +
+			`ipvs_service_connections_total{protocol="",address="",port="",fwmark="7"} 0` + "\n",
+		`ipvs_service_incoming_bytes_total{protocol="tcp",address="10.0.0.1",port="80",fwmark=""} 1e+10` + "\n",
+		"# TYPE ipvs_destination_weight gauge\n" +
+			`ipvs_destination_weight{protocol="tcp",address="10.0.0.1",port="80",fwmark="",destination="10.1.0.1",destination_port="8080"} 2` + "\n",
+	} {
+		assert.Assert(t, strings.Contains(out, expected), "missing %q in:\n%s", expected, out)
+	}
+}
+
+func TestWriteTextfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "textfile")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "ipvs.prom")
+	assert.NilError(t, WriteTextfile(path, testSnapshot()))
+
+	var b bytes.Buffer
+	assert.NilError(t, WriteText(&b, testSnapshot()))
+	content, err := ioutil.ReadFile(path)
+	assert.NilError(t, err)
+	assert.Equal(t, string(content), b.String())
+
+	entries, err := ioutil.ReadDir(dir)
+	assert.NilError(t, err)
+	assert.Equal(t, len(entries), 1)
+	assert.Equal(t, entries[0].Mode().Perm(), os.FileMode(0644))
+}
+
+func TestWriteOpenMetrics(t *testing.T) {
+	var b bytes.Buffer
+	assert.NilError(t, WriteOpenMetrics(&b, testSnapshot()))
+	out := b.String()
+
+	for _, expected := range []string{
+		"# HELP ipvs_service_connections Total number of connections.\n" +
+			"# TYPE ipvs_service_connections counter\n" +
+			`ipvs_service_connections_total{protocol="tcp",address="10.0.0.1",port="80",fwmark=""} 3` + "\n",
+		"# TYPE ipvs_service_incoming_bytes counter\n" +
+			"# UNIT ipvs_service_incoming_bytes bytes\n" +
+			`ipvs_service_incoming_bytes_total{protocol="tcp",address="10.0.0.1",port="80",fwmark=""} 1e+10` + "\n",
+		"# TYPE ipvs_destination_active_connections gauge\n" +
+			`ipvs_destination_active_connections{protocol="tcp",address="10.0.0.1",port="80",fwmark="",destination="10.1.0.1",destination_port="8080"} 1` + "\n",
+	} {
+		assert.Assert(t, strings.Contains(out, expected), "missing %q in:\n%s", expected, out)
+	}
+	assert.Assert(t, strings.HasSuffix(out, "\n# EOF\n"))
+	assert.Assert(t, !strings.Contains(out, "# UNIT ipvs_service_connections"))
+}
@@ -0,0 +1,81 @@
+// +build linux
+
+package metrics
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/sirupsen/logrus"
+)
+
+// TextfileWriter periodically renders the statistics of a handle into a
+// file read by the textfile collector of node_exporter, for hosts where
+// running another listening exporter is not allowed.
+type TextfileWriter struct {
+	Handle *ipvs.Handle
+
+	// Path is the file written, it must end with ".prom" and be in the
+	// directory given to node_exporter with
+	// --collector.textfile.directory.
+	Path string
+
+	// Interval is the delay between two writes.
+	Interval time.Duration
+}
+
+// Run writes the file every Interval until ctx is done. Failures are
+// logged.
+func (tw *TextfileWriter) Run(ctx context.Context) error {
+	ticker := time.NewTicker(tw.Interval)
+	defer ticker.Stop()
+
+	for {
+		if err := tw.WriteOnce(); err != nil {
+			logrus.Warnf("Writing ipvs metrics to %s failed: %v", tw.Path, err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// WriteOnce takes a stats snapshot and writes it to Path.
+func (tw *TextfileWriter) WriteOnce() error {
+	snap, err := tw.Handle.GetStatsSnapshot()
+	if err != nil {
+		return err
+	}
+	return WriteTextfile(tw.Path, snap)
+}
+
+// WriteTextfile writes the statistics of snap to path atomically: they are
+// written to a temporary file of the same directory which is then renamed,
+// so that node_exporter never reads a partial file.
+func WriteTextfile(path string, snap *ipvs.StatsSnapshot) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "."+filepath.Base(path)+".")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	if err := WriteText(f, snap); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
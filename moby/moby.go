@@ -0,0 +1,375 @@
+// +build linux
+
+// Package moby exposes the API of github.com/moby/ipvs backed by package
+// ipvs, so that its users can switch by only changing the import path:
+//
+//	import ipvs "github.com/kwanhur/ipvs/moby"
+//
+// The features missing from moby/ipvs, like local addresses and sync
+// daemons, are available through Handle.Ext.
+package moby
+
+import (
+	"net"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+)
+
+const (
+	// ConnectionFlagFwdMask indicates the mask in the connection
+	// flags which is used by forwarding method bits.
+	ConnectionFlagFwdMask = ipvs.ConnectionFlagFwdMask
+
+	// ConnectionFlagMasq is used for masquerade forwarding method.
+	ConnectionFlagMasq = ipvs.ConnectionFlagMasq
+
+	// ConnectionFlagLocalNode is used for local node forwarding
+	// method.
+	ConnectionFlagLocalNode = ipvs.ConnectionFlagLocalNode
+
+	// ConnectionFlagTunnel is used for tunnel mode forwarding
+	// method.
+	ConnectionFlagTunnel = ipvs.ConnectionFlagTunnel
+
+	// ConnectionFlagDirectRoute is used for direct routing
+	// forwarding method.
+	ConnectionFlagDirectRoute = ipvs.ConnectionFlagDirectRoute
+)
+
+const (
+	// RoundRobin distributes jobs equally amongst the available
+	// real servers.
+	RoundRobin = ipvs.RoundRobin
+
+	// LeastConnection assigns more jobs to real servers with
+	// fewer active jobs.
+	LeastConnection = ipvs.LeastConnection
+
+	// DestinationHashing assigns jobs to servers through looking
+	// up a statically assigned hash table by their destination IP
+	// addresses.
+	DestinationHashing = ipvs.DestinationHashing
+
+	// SourceHashing assigns jobs to servers through looking up
+	// a statically assigned hash table by their source IP
+	// addresses.
+	SourceHashing = ipvs.SourceHashing
+
+	// WeightedRoundRobin assigns jobs to real servers proportionally
+	// to there real servers' weight. Servers with higher weights
+	// receive new jobs first and get more jobs than servers
+	// with lower weights. Servers with equal weights get
+	// an equal distribution of new jobs
+	WeightedRoundRobin = ipvs.WeightedRoundRobin
+
+	// WeightedLeastConnection assigns more jobs to servers
+	// with fewer jobs and relative to the real servers' weight
+	WeightedLeastConnection = ipvs.WeightedLeastConnection
+)
+
+const (
+	// ConnFwdMask is a mask for the fwd methods
+	ConnFwdMask = ipvs.ConnFwdMask
+
+	// ConnFwdMasq denotes forwarding via masquerading/NAT
+	ConnFwdMasq = ipvs.ConnFwdMasq
+
+	// ConnFwdLocalNode denotes forwarding to a local node
+	ConnFwdLocalNode = ipvs.ConnFwdLocalNode
+
+	// ConnFwdTunnel denotes forwarding via a tunnel
+	ConnFwdTunnel = ipvs.ConnFwdTunnel
+
+	// ConnFwdDirectRoute denotes forwarding via direct routing
+	ConnFwdDirectRoute = ipvs.ConnFwdDirectRoute
+
+	// ConnFwdBypass denotes forwarding while bypassing the cache
+	ConnFwdBypass = ipvs.ConnFwdBypass
+)
+
+// Service defines an IPVS service in its entirety.
+type Service struct {
+	// Virtual service address.
+	Address  net.IP
+	Protocol uint16
+	Port     uint16
+	FWMark   uint32 // Firewall mark of the service.
+
+	// Virtual service options.
+	SchedName     string
+	Flags         uint32
+	Timeout       uint32
+	Netmask       uint32
+	AddressFamily uint16
+	PEName        string
+	Stats         SvcStats
+}
+
+// SvcStats defines an IPVS service statistics
+type SvcStats struct {
+	Connections uint32
+	PacketsIn   uint32
+	PacketsOut  uint32
+	BytesIn     uint64
+	BytesOut    uint64
+	CPS         uint32
+	BPSOut      uint32
+	PPSIn       uint32
+	PPSOut      uint32
+	BPSIn       uint32
+}
+
+// Destination defines an IPVS destination (real server) in its
+// entirety.
+type Destination struct {
+	Address             net.IP
+	Port                uint16
+	Weight              int
+	ConnectionFlags     uint32
+	AddressFamily       uint16
+	UpperThreshold      uint32
+	LowerThreshold      uint32
+	ActiveConnections   int
+	InactiveConnections int
+	Stats               DstStats
+}
+
+// DstStats defines IPVS destination (real server) statistics
+type DstStats SvcStats
+
+// Config defines IPVS timeout configuration
+type Config struct {
+	TimeoutTCP    time.Duration
+	TimeoutTCPFin time.Duration
+	TimeoutUDP    time.Duration
+}
+
+// Handle provides a namespace specific ipvs handle to program ipvs
+// rules.
+type Handle struct {
+	h *ipvs.Handle
+}
+
+// New provides a new ipvs handle in the namespace pointed to by the
+// passed path. It will return a valid handle or an error in case an
+// error occurred while creating the handle.
+func New(path string) (*Handle, error) {
+	h, err := ipvs.New(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Handle{h: h}, nil
+}
+
+// Ext returns the underlying handle, giving access to the features moby/ipvs
+// does not have.
+func (i *Handle) Ext() *ipvs.Handle {
+	return i.h
+}
+
+// Close closes the ipvs handle. The handle is invalid after Close
+// returns.
+func (i *Handle) Close() {
+	i.h.Close()
+}
+
+// NewService creates a new ipvs service in the passed handle.
+func (i *Handle) NewService(s *Service) error {
+	return bareErrno(i.h.NewService(toService(s)))
+}
+
+// IsServicePresent queries for the ipvs service in the passed handle.
+func (i *Handle) IsServicePresent(s *Service) bool {
+	return i.h.IsServicePresent(toService(s))
+}
+
+// UpdateService updates an already existing service in the passed
+// handle.
+func (i *Handle) UpdateService(s *Service) error {
+	return bareErrno(i.h.UpdateService(toService(s)))
+}
+
+// DelService deletes an already existing service in the passed
+// handle.
+func (i *Handle) DelService(s *Service) error {
+	return bareErrno(i.h.DelService(toService(s)))
+}
+
+// Flush deletes all existing services in the passed
+// handle.
+func (i *Handle) Flush() error {
+	return bareErrno(i.h.Flush())
+}
+
+// NewDestination creates a new real server in the passed ipvs
+// service which should already be existing in the passed handle.
+func (i *Handle) NewDestination(s *Service, d *Destination) error {
+	return bareErrno(i.h.NewDestination(toService(s), toDestination(d)))
+}
+
+// UpdateDestination updates an already existing real server in the
+// passed ipvs service in the passed handle.
+func (i *Handle) UpdateDestination(s *Service, d *Destination) error {
+	return bareErrno(i.h.UpdateDestination(toService(s), toDestination(d)))
+}
+
+// DelDestination deletes an already existing real server in the
+// passed ipvs service in the passed handle.
+func (i *Handle) DelDestination(s *Service, d *Destination) error {
+	return bareErrno(i.h.DelDestination(toService(s), toDestination(d)))
+}
+
+// GetServices returns an array of services configured on the Node
+func (i *Handle) GetServices() ([]*Service, error) {
+	svcs, err := i.h.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Service, len(svcs))
+	for n, s := range svcs {
+		res[n] = fromService(s)
+	}
+	return res, nil
+}
+
+// GetDestinations returns an array of Destinations configured for this Service
+func (i *Handle) GetDestinations(s *Service) ([]*Destination, error) {
+	dsts, err := i.h.GetDestinations(toService(s))
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Destination, len(dsts))
+	for n, d := range dsts {
+		res[n] = fromDestination(d)
+	}
+	return res, nil
+}
+
+// GetService gets details of a specific IPVS services, useful in updating statisics etc.,
+func (i *Handle) GetService(s *Service) (*Service, error) {
+	svc, err := i.h.GetService(toService(s))
+	if err != nil {
+		return nil, err
+	}
+	return fromService(svc), nil
+}
+
+// GetConfig returns the current timeout configuration
+func (i *Handle) GetConfig() (*Config, error) {
+	c, err := i.h.GetConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &Config{TimeoutTCP: c.TimeoutTCP, TimeoutTCPFin: c.TimeoutTCPFin, TimeoutUDP: c.TimeoutUDP}, nil
+}
+
+// SetConfig set the current timeout configuration. 0: no change
+func (i *Handle) SetConfig(c *Config) error {
+	return bareErrno(i.h.SetConfig(&ipvs.Config{TimeoutTCP: c.TimeoutTCP, TimeoutTCPFin: c.TimeoutTCPFin, TimeoutUDP: c.TimeoutUDP}))
+}
+
+// bareErrno returns the errno of an *ipvs.CommandError, as moby/ipvs did and
+// as its callers compare errors with, e.g. syscall.EEXIST.
+func bareErrno(err error) error {
+	if cerr, ok := err.(*ipvs.CommandError); ok {
+		return cerr.Err
+	}
+	return err
+}
+
+func toService(s *Service) *ipvs.Service {
+	return &ipvs.Service{
+		Address:       s.Address,
+		Protocol:      ipvs.IPProto(s.Protocol),
+		Port:          s.Port,
+		FWMark:        s.FWMark,
+		SchedName:     s.SchedName,
+		Flags:         ipvs.ServiceFlags(s.Flags),
+		Timeout:       s.Timeout,
+		Netmask:       s.Netmask,
+		AddressFamily: s.AddressFamily,
+		PEName:        s.PEName,
+		Stats:         toStats(s.Stats),
+	}
+}
+
+func fromService(s *ipvs.Service) *Service {
+	return &Service{
+		Address:       s.Address,
+		Protocol:      uint16(s.Protocol),
+		Port:          s.Port,
+		FWMark:        s.FWMark,
+		SchedName:     s.SchedName,
+		Flags:         uint32(s.Flags),
+		Timeout:       s.Timeout,
+		Netmask:       s.Netmask,
+		AddressFamily: s.AddressFamily,
+		PEName:        s.PEName,
+		Stats:         fromStats(s.Stats),
+	}
+}
+
+func toDestination(d *Destination) *ipvs.Destination {
+	return &ipvs.Destination{
+		Address:             d.Address,
+		Port:                d.Port,
+		Weight:              d.Weight,
+		ConnectionFlags:     ipvs.ConnectionFlags(d.ConnectionFlags),
+		AddressFamily:       d.AddressFamily,
+		UpperThreshold:      d.UpperThreshold,
+		LowerThreshold:      d.LowerThreshold,
+		ActiveConnections:   d.ActiveConnections,
+		InactiveConnections: d.InactiveConnections,
+		Stats:               ipvs.DstStats(toStats(SvcStats(d.Stats))),
+	}
+}
+
+func fromDestination(d *ipvs.Destination) *Destination {
+	return &Destination{
+		Address:             d.Address,
+		Port:                d.Port,
+		Weight:              d.Weight,
+		ConnectionFlags:     uint32(d.ConnectionFlags),
+		AddressFamily:       d.AddressFamily,
+		UpperThreshold:      d.UpperThreshold,
+		LowerThreshold:      d.LowerThreshold,
+		ActiveConnections:   d.ActiveConnections,
+		InactiveConnections: d.InactiveConnections,
+		Stats:               DstStats(fromStats(ipvs.SvcStats(d.Stats))),
+	}
+}
+
+func toStats(st SvcStats) ipvs.SvcStats {
+	return ipvs.SvcStats{
+		Connections: uint64(st.Connections),
+		PacketsIn:   uint64(st.PacketsIn),
+		PacketsOut:  uint64(st.PacketsOut),
+		BytesIn:     st.BytesIn,
+		BytesOut:    st.BytesOut,
+		CPS:         uint64(st.CPS),
+		BPSOut:      uint64(st.BPSOut),
+		PPSIn:       uint64(st.PPSIn),
+		PPSOut:      uint64(st.PPSOut),
+		BPSIn:       uint64(st.BPSIn),
+	}
+}
+
+// fromStats converts st, truncating the counters moby/ipvs has 32 bits
+// wide.
+func fromStats(st ipvs.SvcStats) SvcStats {
+	return SvcStats{
+		Connections: uint32(st.Connections),
+		PacketsIn:   uint32(st.PacketsIn),
+		PacketsOut:  uint32(st.PacketsOut),
+		BytesIn:     st.BytesIn,
+		BytesOut:    st.BytesOut,
+		CPS:         uint32(st.CPS),
+		BPSOut:      uint32(st.BPSOut),
+		PPSIn:       uint32(st.PPSIn),
+		PPSOut:      uint32(st.PPSOut),
+		BPSIn:       uint32(st.BPSIn),
+	}
+}
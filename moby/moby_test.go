@@ -0,0 +1,51 @@
+// +build linux
+
+package moby
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func TestConversions(t *testing.T) {
+	s := &Service{
+		Address:       net.ParseIP("10.0.0.1"),
+		Protocol:      syscall.IPPROTO_TCP,
+		Port:          80,
+		SchedName:     RoundRobin,
+		Flags:         1,
+		Timeout:       300,
+		Netmask:       0xFFFFFFFF,
+		AddressFamily: syscall.AF_INET,
+		Stats:         SvcStats{Connections: 1, BytesIn: 2},
+	}
+	assert.DeepEqual(t, fromService(toService(s)), s)
+
+	d := &Destination{
+		Address:           net.ParseIP("10.1.0.1"),
+		Port:              8080,
+		Weight:            3,
+		ConnectionFlags:   ConnectionFlagTunnel,
+		AddressFamily:     syscall.AF_INET,
+		UpperThreshold:    100,
+		ActiveConnections: 4,
+		Stats:             DstStats{PacketsOut: 5},
+	}
+	assert.DeepEqual(t, fromDestination(toDestination(d)), d)
+}
+
+func TestFromStats(t *testing.T) {
+	st := fromStats(ipvs.SvcStats{Connections: 1<<32 + 1, BytesIn: 1 << 40, PPSIn: 7})
+	assert.Equal(t, st, SvcStats{Connections: 1, BytesIn: 1 << 40, PPSIn: 7})
+}
+
+func TestBareErrno(t *testing.T) {
+	err := &ipvs.CommandError{Command: ipvs.CmdNewService, Err: syscall.EEXIST}
+	assert.Equal(t, bareErrno(err), syscall.EEXIST)
+	assert.Equal(t, bareErrno(syscall.ESRCH), syscall.ESRCH)
+	assert.NilError(t, bareErrno(nil))
+}
@@ -0,0 +1,119 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/kwanhur/ipvs/netlink"
+	"golang.org/x/sys/unix"
+)
+
+var (
+	sysModule  = "/sys/module"
+	libModules = "/lib/modules"
+
+	ipvsFamily     = netlink.GetIPVSFamily
+	waitIPVSFamily = netlink.WaitIPVSFamily
+	loadModule     = netlink.LoadModule
+)
+
+// ErrModuleNotLoaded is wrapped by the ModuleError of the modules missing
+// when EnsureModules is not allowed to load them.
+var ErrModuleNotLoaded = errors.New("module not loaded")
+
+// ModuleError reports a kernel module IPVS needs which is unavailable.
+type ModuleError struct {
+	Module string
+	Err    error
+}
+
+func (e *ModuleError) Error() string {
+	return fmt.Sprintf("kernel module %s unavailable: %v", e.Module, e.Err)
+}
+
+// Unwrap returns the reason the module is unavailable.
+func (e *ModuleError) Unwrap() error {
+	return e.Err
+}
+
+// ModuleOptions configures EnsureModules.
+type ModuleOptions struct {
+	// Load loads the missing modules with modprobe, see
+	// netlink.LoadModule. Modules are only checked for otherwise.
+	Load bool
+
+	// Schedulers are the schedulers whose module is needed too, e.g.
+	// WeightedRoundRobin, SourceHashing or MaglevHashing.
+	Schedulers []string
+}
+
+// EnsureModules checks that the kernel has IPVS, i.e. that the IPVS generic
+// netlink family is registered, and the modules of the schedulers of opts,
+// loading the missing ones if opts.Load is set. Without IPVS, handles get
+// created but all their requests fail, so EnsureModules is best called
+// before New. It returns a *ModuleError for the first module unavailable.
+func EnsureModules(opts ModuleOptions) error {
+	_, err := ipvsFamily()
+	if errors.Is(err, syscall.ENOENT) {
+		if !opts.Load {
+			return &ModuleError{Module: "ip_vs", Err: ErrModuleNotLoaded}
+		}
+		if err = loadModule("ip_vs"); err == nil {
+			_, err = waitIPVSFamily()
+		}
+	}
+	if err != nil {
+		return &ModuleError{Module: "ip_vs", Err: err}
+	}
+
+	for _, sched := range opts.Schedulers {
+		name := "ip_vs_" + sched
+		if moduleAvailable(name) {
+			continue
+		}
+		if !opts.Load {
+			return &ModuleError{Module: name, Err: ErrModuleNotLoaded}
+		}
+		if err := loadModule(name); err != nil {
+			return &ModuleError{Module: name, Err: err}
+		}
+	}
+	return nil
+}
+
+// moduleAvailable reports whether the module name is loaded, or built into
+// the running kernel.
+func moduleAvailable(name string) bool {
+	if _, err := os.Stat(filepath.Join(sysModule, name)); err == nil {
+		return true
+	}
+
+	var uts unix.Utsname
+	if err := unix.Uname(&uts); err != nil {
+		return false
+	}
+	release := string(uts.Release[:])
+	if n := strings.IndexByte(release, 0); n >= 0 {
+		release = release[:n]
+	}
+	f, err := os.Open(filepath.Join(libModules, release, "modules.builtin"))
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if strings.TrimSuffix(filepath.Base(scanner.Text()), ".ko") == name {
+			return true
+		}
+	}
+	return false
+}
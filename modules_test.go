@@ -0,0 +1,58 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestEnsureModules(t *testing.T) {
+	dir, err := ioutil.TempDir("", "modules")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	defer func(sys, lib string, family, wait func() (int, error), load func(string) error) {
+		sysModule, libModules, ipvsFamily, waitIPVSFamily, loadModule = sys, lib, family, wait, load
+	}(sysModule, libModules, ipvsFamily, waitIPVSFamily, loadModule)
+	sysModule, libModules = dir, dir
+	assert.NilError(t, os.Mkdir(filepath.Join(dir, "ip_vs_wrr"), 0755))
+
+	registered := false
+	ipvsFamily = func() (int, error) {
+		if !registered {
+			return 0, syscall.ENOENT
+		}
+		return 42, nil
+	}
+	waitIPVSFamily = ipvsFamily
+	var loaded []string
+	loadModule = func(name string) error {
+		if name == "ip_vs_mh" {
+			return errors.New("modprobe ip_vs_mh failed")
+		}
+		loaded = append(loaded, name)
+		registered = registered || name == "ip_vs"
+		return nil
+	}
+
+	err = EnsureModules(ModuleOptions{})
+	var merr *ModuleError
+	assert.Assert(t, errors.As(err, &merr))
+	assert.Equal(t, merr.Module, "ip_vs")
+	assert.Assert(t, errors.Is(err, ErrModuleNotLoaded))
+
+	assert.NilError(t, EnsureModules(ModuleOptions{Load: true, Schedulers: []string{WeightedRoundRobin, SourceHashing}}))
+	assert.DeepEqual(t, loaded, []string{"ip_vs", "ip_vs_sh"})
+
+	err = EnsureModules(ModuleOptions{Schedulers: []string{MaglevHashing}})
+	assert.Assert(t, errors.Is(err, ErrModuleNotLoaded))
+	err = EnsureModules(ModuleOptions{Load: true, Schedulers: []string{MaglevHashing}})
+	assert.ErrorContains(t, err, "kernel module ip_vs_mh unavailable: modprobe ip_vs_mh failed")
+}
@@ -0,0 +1,145 @@
+// +build linux
+
+package netlink
+
+// GenlCtrlID is the id of the generic netlink controller family
+const (
+	GenlCtrlID = 0x10
+)
+
+// GENL control commands
+const (
+	GenlCtrlCmdUnspec uint8 = iota
+	GenlCtrlCmdNewFamily
+	GenlCtrlCmdDelFamily
+	GenlCtrlCmdGetFamily
+)
+
+// GENL family attributes
+const (
+	GenlCtrlAttrUnspec int = iota
+	GenlCtrlAttrFamilyID
+	GenlCtrlAttrFamilyName
+)
+
+// IPVS genl commands
+const (
+	CmdUnspec uint8 = iota
+	CmdNewService
+	CmdSetService
+	CmdDelService
+	CmdGetService
+	CmdNewDest
+	CmdSetDest
+	CmdDelDest
+	CmdGetDest
+	CmdNewDaemon
+	CmdDelDaemon
+	CmdGetDaemon
+	CmdSetConfig
+	CmdGetConfig
+	CmdSetInfo
+	CmdGetInfo
+	CmdZero
+	CmdFlush
+	CmdNewLaddr
+	CmdDelLaddr
+	CmdGetLaddr
+)
+
+// Attributes used in the first level of commands
+const (
+	CmdAttrUnspec int = iota
+	CmdAttrService
+	CmdAttrDest
+	CmdAttrDaemon
+	CmdAttrTimeoutTCP
+	CmdAttrTimeoutTCPFin
+	CmdAttrTimeoutUDP
+	CmdAttrLaddr
+)
+
+// Attributes used to describe an info
+const (
+	CmdAttrInfoUnspec int = iota
+	CmdAttrInfoVersion
+	CmdAttrInfoConnTableSize
+)
+
+// Attributes used to describe a service. Used inside nested attribute
+// CmdAttrService
+const (
+	SvcAttrUnspec int = iota
+	SvcAttrAddressFamily
+	SvcAttrProtocol
+	SvcAttrAddress
+	SvcAttrPort
+	SvcAttrFWMark
+	SvcAttrSchedName
+	SvcAttrFlags
+	SvcAttrTimeout
+	SvcAttrNetmask
+	SvcAttrStats
+	SvcAttrPEName
+	SvcAttrStats64
+)
+
+// Attributes used to describe a destination (real server). Used
+// inside nested attribute CmdAttrDest.
+const (
+	DestAttrUnspec int = iota
+	DestAttrAddress
+	DestAttrPort
+	DestAttrForwardingMethod
+	DestAttrWeight
+	DestAttrUpperThreshold
+	DestAttrLowerThreshold
+	DestAttrActiveConnections
+	DestAttrInactiveConnections
+	DestAttrPersistentConnections
+	DestAttrStats
+	DestAttrAddressFamily
+	DestAttrStats64
+	DestAttrTunType
+	DestAttrTunPort
+	DestAttrTunFlags
+)
+
+// Attributes used to describe a local address. Used
+// inside nested attribute CmdAttrLaddr
+const (
+	LaddrAttrUnspec int = iota
+	LaddrAttrAddress
+	LaddrAttrPortConflict
+	LaddrAttrConnections
+)
+
+// Attributes used to describe statistics. Used inside nested attributes
+// SvcAttrStats and DestAttrStats.
+const (
+	StatsUnspec int = iota
+	StatsConns
+	StatsPktsIn
+	StatsPktsOut
+	StatsBytesIn
+	StatsBytesOut
+	StatsCPS
+	StatsPPSIn
+	StatsPPSOut
+	StatsBPSIn
+	StatsBPSOut
+)
+
+// Attributes used to describe a sync daemon. Used inside nested attribute
+// CmdAttrDaemon.
+const (
+	DaemonAttrUnspec int = iota
+	DaemonAttrState
+	DaemonAttrMcastIfn
+	DaemonAttrSyncID
+	DaemonAttrSyncMaxLen
+	DaemonAttrMcastGroup
+	DaemonAttrMcastGroup6
+	DaemonAttrMcastPort
+	DaemonAttrMcastTTL
+)
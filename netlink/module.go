@@ -0,0 +1,89 @@
+// +build linux
+
+package netlink
+
+import (
+	"fmt"
+	"math/rand"
+	"os/exec"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const moduleLoadAttempts = 5
+
+var (
+	// moduleLoadBackoff is the delay before the first retry of a module
+	// load, doubled on every subsequent one.
+	moduleLoadBackoff = 100 * time.Millisecond
+
+	modprobe = func(name string) ([]byte, error) {
+		return exec.Command("modprobe", "-va", name).CombinedOutput()
+	}
+)
+
+// LoadModule loads the kernel module name with modprobe. When several
+// processes load the same module concurrently, the loads racing with the
+// one in progress fail with EBUSY, and with EEXIST once it is done: the
+// former are retried with a jittered exponential backoff, the latter are a
+// success.
+func LoadModule(name string) error {
+	backoff := moduleLoadBackoff
+
+	var err error
+	for attempt := 0; attempt < moduleLoadAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(jitter(backoff))
+			backoff *= 2
+		}
+
+		var out []byte
+		out, err = modprobe(name)
+		if err == nil {
+			return nil
+		}
+		msg := strings.TrimSpace(string(out))
+		err = fmt.Errorf("modprobe %s failed with message: `%s`, error: %v", name, msg, err)
+
+		// modprobe reports errors with strerror, capitalized.
+		lower := strings.ToLower(msg)
+		switch {
+		case strings.Contains(lower, syscall.EEXIST.Error()):
+			return nil
+		case strings.Contains(lower, syscall.EBUSY.Error()):
+			continue
+		default:
+			return err
+		}
+	}
+	return err
+}
+
+// WaitIPVSFamily looks up the IPVS generic netlink family, retrying
+// while it is not registered yet, as happens right after the module got
+// loaded by another process.
+func WaitIPVSFamily() (int, error) {
+	backoff := moduleLoadBackoff
+
+	var err error
+	for attempt := 0; attempt < moduleLoadAttempts; attempt++ {
+		if attempt > 0 {
+			time.Sleep(jitter(backoff))
+			backoff *= 2
+		}
+
+		var family int
+		family, err = GetIPVSFamily()
+		if err != syscall.ENOENT {
+			return family, err
+		}
+	}
+	return 0, err
+}
+
+// jitter returns a random duration between d/2 and d, so that processes
+// started together do not retry in lockstep.
+func jitter(d time.Duration) time.Duration {
+	return d/2 + time.Duration(rand.Int63n(int64(d/2)+1))
+}
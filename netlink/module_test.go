@@ -0,0 +1,73 @@
+// +build linux
+
+package netlink
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestLoadModule(t *testing.T) {
+	defer func(f func(string) ([]byte, error), backoff time.Duration) {
+		modprobe, moduleLoadBackoff = f, backoff
+	}(modprobe, moduleLoadBackoff)
+	moduleLoadBackoff = time.Millisecond
+
+	failure := errors.New("exit status 1")
+	testcases := []struct {
+		name        string
+		outputs     []string
+		expectedErr bool
+		calls       int
+	}{
+		{
+			name:    "loaded",
+			outputs: []string{""},
+			calls:   1,
+		},
+		{
+			name:    "busy then loaded",
+			outputs: []string{"modprobe: ERROR: could not insert 'ip_vs': Device or resource busy", ""},
+			calls:   2,
+		},
+		{
+			name:    "loaded concurrently",
+			outputs: []string{"modprobe: ERROR: could not insert 'ip_vs': File exists"},
+			calls:   1,
+		},
+		{
+			name:        "missing",
+			outputs:     []string{"modprobe: FATAL: Module ip_vs not found"},
+			expectedErr: true,
+			calls:       1,
+		},
+		{
+			name: "always busy",
+			outputs: []string{
+				"device or resource busy", "device or resource busy", "device or resource busy",
+				"device or resource busy", "device or resource busy",
+			},
+			expectedErr: true,
+			calls:       moduleLoadAttempts,
+		},
+	}
+
+	for _, tc := range testcases {
+		calls := 0
+		modprobe = func(name string) ([]byte, error) {
+			out := tc.outputs[calls]
+			calls++
+			if out == "" {
+				return nil, nil
+			}
+			return []byte(out), failure
+		}
+
+		err := LoadModule("ip_vs")
+		if (err != nil) != tc.expectedErr || calls != tc.calls {
+			t.Logf("case: %s", tc.name)
+			t.Errorf("expected error %v after %d calls, got %v after %d calls", tc.expectedErr, tc.calls, err, calls)
+		}
+	}
+}
@@ -0,0 +1,952 @@
+// +build linux
+
+// Package netlink implements the encoding and decoding of IPVS generic
+// netlink messages and their transport over a netlink socket. It is the
+// codec the ipvs package is built on and can be used directly to issue
+// requests the high level API does not cover.
+package netlink
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+	"unsafe"
+
+	"github.com/kwanhur/ipvs/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+// For Quick Reference IPVS related netlink message is described at the end of this file.
+var (
+	native     = nl.NativeEndian()
+	ipvsFamily int
+	ipvsOnce   sync.Once
+)
+
+type genlMsgHdr struct {
+	cmd      uint8
+	version  uint8
+	reserved uint16
+}
+
+type ipvsFlags struct {
+	flags uint32
+	mask  uint32
+}
+
+func deserializeGenlMsg(b []byte) (hdr *genlMsgHdr) {
+	return (*genlMsgHdr)(unsafe.Pointer(&b[0:unsafe.Sizeof(*hdr)][0]))
+}
+
+func (hdr *genlMsgHdr) Serialize() []byte {
+	return (*(*[unsafe.Sizeof(*hdr)]byte)(unsafe.Pointer(hdr)))[:]
+}
+
+func (hdr *genlMsgHdr) Len() int {
+	return int(unsafe.Sizeof(*hdr))
+}
+
+func (f *ipvsFlags) Serialize() []byte {
+	return (*(*[unsafe.Sizeof(*f)]byte)(unsafe.Pointer(f)))[:]
+}
+
+func (f *ipvsFlags) Len() int {
+	return int(unsafe.Sizeof(*f))
+}
+
+// Setup loads the ip_vs kernel module and looks up the IPVS generic netlink
+// family. It only does so once per process.
+func Setup() {
+	ipvsOnce.Do(func() {
+		var err error
+		if err := LoadModule("ip_vs"); err != nil {
+			logrus.Warnf("Running %v", err)
+		}
+
+		ipvsFamily, err = WaitIPVSFamily()
+		if err != nil {
+			logrus.Error("Could not get ipvs family information from the kernel. It is possible that ipvs is not enabled in your kernel. Native loadbalancing will not work until this is fixed.")
+		}
+	})
+}
+
+// EncodeService encodes s as a CmdAttrService attribute.
+func EncodeService(s *types.Service) nl.NetlinkRequestData {
+	cmdAttr := nl.NewRtAttr(CmdAttrService, nil)
+	nl.NewRtAttrChild(cmdAttr, SvcAttrAddressFamily, nl.Uint16Attr(s.AddressFamily))
+	if s.FWMark != 0 {
+		nl.NewRtAttrChild(cmdAttr, SvcAttrFWMark, nl.Uint32Attr(s.FWMark))
+	} else {
+		nl.NewRtAttrChild(cmdAttr, SvcAttrProtocol, nl.Uint16Attr(uint16(s.Protocol)))
+		nl.NewRtAttrChild(cmdAttr, SvcAttrAddress, rawIPData(s.Address))
+
+		// Port needs to be in network byte order.
+		portBuf := new(bytes.Buffer)
+		binary.Write(portBuf, binary.BigEndian, s.Port)
+		nl.NewRtAttrChild(cmdAttr, SvcAttrPort, portBuf.Bytes())
+	}
+
+	nl.NewRtAttrChild(cmdAttr, SvcAttrSchedName, nl.ZeroTerminated(s.SchedName))
+	if s.PEName != "" {
+		nl.NewRtAttrChild(cmdAttr, SvcAttrPEName, nl.ZeroTerminated(s.PEName))
+	}
+	f := &ipvsFlags{
+		flags: uint32(s.Flags),
+		mask:  0xFFFFFFFF,
+	}
+	nl.NewRtAttrChild(cmdAttr, SvcAttrFlags, f.Serialize())
+	nl.NewRtAttrChild(cmdAttr, SvcAttrTimeout, nl.Uint32Attr(s.Timeout))
+	nl.NewRtAttrChild(cmdAttr, SvcAttrNetmask, encodeNetmask(s))
+	return cmdAttr
+}
+
+// encodeNetmask encodes the persistence netmask of s: a mask in network
+// byte order for IPv4, a prefix length for IPv6.
+//
+// The IPv4 mask used to be sent in host byte order, so that on little
+// endian hosts 0xffffff00 reached the kernel as 0.255.255.255. Callers who
+// byte swapped their masks to compensate must now pass them unswapped,
+// e.g. 0xffffff00 for a /24; ipvs.ValidateService rejects the swapped,
+// non contiguous masks.
+func encodeNetmask(s *types.Service) []byte {
+	if s.AddressFamily == syscall.AF_INET6 {
+		return nl.Uint32Attr(s.Netmask)
+	}
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, s.Netmask)
+	return b
+}
+
+func decodeNetmask(b []byte, family uint16) uint32 {
+	if family == syscall.AF_INET6 {
+		return native.Uint32(b)
+	}
+	return binary.BigEndian.Uint32(b)
+}
+
+// EncodeDestination encodes d as a CmdAttrDest attribute.
+func EncodeDestination(d *types.Destination) nl.NetlinkRequestData {
+	cmdAttr := nl.NewRtAttr(CmdAttrDest, nil)
+
+	nl.NewRtAttrChild(cmdAttr, DestAttrAddress, rawIPData(d.Address))
+	// Port needs to be in network byte order.
+	portBuf := new(bytes.Buffer)
+	binary.Write(portBuf, binary.BigEndian, d.Port)
+	nl.NewRtAttrChild(cmdAttr, DestAttrPort, portBuf.Bytes())
+
+	nl.NewRtAttrChild(cmdAttr, DestAttrForwardingMethod, nl.Uint32Attr(uint32(d.ConnectionFlags&types.ConnectionFlagFwdMask)))
+	nl.NewRtAttrChild(cmdAttr, DestAttrWeight, nl.Uint32Attr(uint32(d.Weight)))
+	nl.NewRtAttrChild(cmdAttr, DestAttrUpperThreshold, nl.Uint32Attr(d.UpperThreshold))
+	nl.NewRtAttrChild(cmdAttr, DestAttrLowerThreshold, nl.Uint32Attr(d.LowerThreshold))
+
+	// Kernels without tunnel encapsulation support ignore these.
+	if d.ConnectionFlags&types.ConnectionFlagFwdMask == types.ConnectionFlagTunnel {
+		nl.NewRtAttrChild(cmdAttr, DestAttrTunType, nl.Uint8Attr(d.TunnelType))
+		tunPortBuf := new(bytes.Buffer)
+		binary.Write(tunPortBuf, binary.BigEndian, d.TunnelPort)
+		nl.NewRtAttrChild(cmdAttr, DestAttrTunPort, tunPortBuf.Bytes())
+		nl.NewRtAttrChild(cmdAttr, DestAttrTunFlags, nl.Uint16Attr(d.TunnelFlags))
+	}
+
+	return cmdAttr
+}
+
+// EncodeLocalAddress encodes l as a CmdAttrLaddr attribute.
+func EncodeLocalAddress(d *types.LocalAddress) nl.NetlinkRequestData {
+	cmdAttr := nl.NewRtAttr(CmdAttrLaddr, nil)
+
+	nl.NewRtAttrChild(cmdAttr, LaddrAttrAddress, rawIPData(d.Address))
+
+	return cmdAttr
+}
+
+// EncodeDaemon encodes d as a CmdAttrDaemon attribute.
+func EncodeDaemon(d *types.Daemon) nl.NetlinkRequestData {
+	cmdAttr := nl.NewRtAttr(CmdAttrDaemon, nil)
+
+	nl.NewRtAttrChild(cmdAttr, DaemonAttrState, nl.Uint32Attr(d.State))
+	nl.NewRtAttrChild(cmdAttr, DaemonAttrSyncID, nl.Uint32Attr(d.SyncId))
+	nl.NewRtAttrChild(cmdAttr, DaemonAttrMcastIfn, nl.ZeroTerminated(d.McastIfn))
+
+	// Optional, older kernels ignore them.
+	if d.SyncMaxLen != 0 {
+		nl.NewRtAttrChild(cmdAttr, DaemonAttrSyncMaxLen, nl.Uint16Attr(d.SyncMaxLen))
+	}
+	if ip := d.McastGroup.To4(); ip != nil {
+		nl.NewRtAttrChild(cmdAttr, DaemonAttrMcastGroup, []byte(ip))
+	}
+	if d.McastGroup6 != nil && d.McastGroup6.To4() == nil {
+		nl.NewRtAttrChild(cmdAttr, DaemonAttrMcastGroup6, []byte(d.McastGroup6.To16()))
+	}
+	if d.McastPort != 0 {
+		// Unlike the ports of services and destinations, the kernel reads
+		// it in host byte order.
+		nl.NewRtAttrChild(cmdAttr, DaemonAttrMcastPort, nl.Uint16Attr(d.McastPort))
+	}
+	if d.McastTTL != 0 {
+		nl.NewRtAttrChild(cmdAttr, DaemonAttrMcastTTL, nl.Uint8Attr(d.McastTTL))
+	}
+
+	return cmdAttr
+}
+
+// EncodeConfig encodes the timeouts of c as first level attributes.
+func EncodeConfig(c *types.Config) []nl.NetlinkRequestData {
+	return []nl.NetlinkRequestData{
+		nl.NewRtAttr(CmdAttrTimeoutTCP, nl.Uint32Attr(uint32(c.TimeoutTCP.Seconds()))),
+		nl.NewRtAttr(CmdAttrTimeoutTCPFin, nl.Uint32Attr(uint32(c.TimeoutTCPFin.Seconds()))),
+		nl.NewRtAttr(CmdAttrTimeoutUDP, nl.Uint32Attr(uint32(c.TimeoutUDP.Seconds()))),
+	}
+}
+
+// GetIPVSFamily asks the generic netlink controller for the id of the IPVS
+// family.
+func GetIPVSFamily() (int, error) {
+	sock, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), syscall.NETLINK_GENERIC)
+	if err != nil {
+		return 0, err
+	}
+	defer sock.Close()
+
+	req := NewGenlRequest(GenlCtrlID, GenlCtrlCmdGetFamily)
+	req.AddData(nl.NewRtAttr(GenlCtrlAttrFamilyName, nl.ZeroTerminated("IPVS")))
+
+	msgs, err := Execute(sock, req, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, m := range msgs {
+		hdr := deserializeGenlMsg(m)
+		attrs, err := nl.ParseRouteAttr(m[hdr.Len():])
+		if err != nil {
+			return 0, err
+		}
+
+		for _, attr := range attrs {
+			switch int(attr.Attr.Type) {
+			case GenlCtrlAttrFamilyID:
+				return int(native.Uint16(attr.Value[0:2])), nil
+			}
+		}
+	}
+
+	return 0, fmt.Errorf("no family id in the netlink response")
+}
+
+func rawIPData(ip net.IP) []byte {
+	family := nl.GetIPFamily(ip)
+	if family == nl.FAMILY_V4 {
+		return ip.To4()
+	}
+	return ip
+}
+
+// NewRequest returns a request for the IPVS command cmd. Setup must have
+// been called before.
+func NewRequest(cmd uint8) *nl.NetlinkRequest {
+	return NewGenlRequest(ipvsFamily, cmd)
+}
+
+// NewGenlRequest returns a generic netlink request for the command cmd of
+// the family familyID, asking for an acknowledgment.
+func NewGenlRequest(familyID int, cmd uint8) *nl.NetlinkRequest {
+	req := nl.NewNetlinkRequest(familyID, syscall.NLM_F_ACK)
+	req.AddData(&genlMsgHdr{cmd: cmd, version: 1})
+	return req
+}
+
+// receiveBufferSize is the size of the buffer answers are read into. The
+// kernel sizes the messages of dumps after the buffers they are read with,
+// up to 32KiB.
+const receiveBufferSize = 65536
+
+var (
+	// ErrTruncatedAnswer is returned when an answer did not fit in the
+	// receive buffer and was truncated.
+	ErrTruncatedAnswer = errors.New("netlink answer truncated")
+
+	// ErrDumpInterrupted is returned for a dump the kernel flagged as
+	// interrupted by a concurrent change of the table, which may have
+	// missed or repeated entries. The dump should be done again.
+	ErrDumpInterrupted = errors.New("netlink dump interrupted by a concurrent change")
+)
+
+// ReplyError is returned for an answer which belongs to another request
+// sent on the same socket, i.e. when requests are sent concurrently.
+type ReplyError struct {
+	Seq, Pid                 uint32
+	ExpectedSeq, ExpectedPid uint32
+}
+
+func (e *ReplyError) Error() string {
+	return fmt.Sprintf("unexpected answer seq %d pid %d, expected seq %d pid %d", e.Seq, e.Pid, e.ExpectedSeq, e.ExpectedPid)
+}
+
+// Execute sends req on s and returns the payload of the answers. Answers of
+// another type than resType are skipped, unless resType is 0.
+func Execute(s *nl.NetlinkSocket, req *nl.NetlinkRequest, resType uint16) ([][]byte, error) {
+	var res [][]byte
+	err := ExecuteFunc(s, req, resType, func(msg []byte) bool {
+		res = append(res, msg)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// ExecuteFunc sends req on s and calls fn with the payload of every answer
+// as it is received, until fn returns false. The remaining answers are still
+// read off the socket, without being decoded, so that it is ready for the
+// next request. Answers of another type than resType are skipped, unless
+// resType is 0.
+//
+// Answers to earlier requests, left on the socket by requests which timed
+// out, are dropped. Answers to later requests or to another port return a
+// *ReplyError: requests must not be sent concurrently on s.
+func ExecuteFunc(s *nl.NetlinkSocket, req *nl.NetlinkRequest, resType uint16, fn func(msg []byte) bool) error {
+	if err := s.Send(req); err != nil {
+		return err
+	}
+
+	pid, err := s.GetPid()
+	if err != nil {
+		return err
+	}
+
+	stopped := false
+	interrupted := false
+	buf := make([]byte, receiveBufferSize)
+
+done:
+	for {
+		msgs, err := receive(s, buf)
+		if err != nil {
+			if s.GetFd() == -1 {
+				return fmt.Errorf("Socket got closed on receive")
+			}
+			if err == syscall.EAGAIN {
+				// timeout fired
+				continue
+			}
+			return err
+		}
+		for _, m := range msgs {
+			if m.Header.Seq != req.Seq {
+				// Sequence numbers wrap around.
+				if int32(m.Header.Seq-req.Seq) < 0 {
+					continue
+				}
+				return &ReplyError{Seq: m.Header.Seq, Pid: m.Header.Pid, ExpectedSeq: req.Seq, ExpectedPid: pid}
+			}
+			if m.Header.Pid != pid {
+				return &ReplyError{Seq: m.Header.Seq, Pid: m.Header.Pid, ExpectedSeq: req.Seq, ExpectedPid: pid}
+			}
+			if m.Header.Flags&unix.NLM_F_DUMP_INTR != 0 {
+				interrupted = true
+			}
+			if m.Header.Type == syscall.NLMSG_DONE {
+				break done
+			}
+			if m.Header.Type == syscall.NLMSG_ERROR {
+				error := int32(native.Uint32(m.Data[0:4]))
+				if error == 0 {
+					break done
+				}
+				return syscall.Errno(-error)
+			}
+			if resType != 0 && m.Header.Type != resType {
+				continue
+			}
+			if !stopped {
+				stopped = !fn(m.Data)
+			}
+			if m.Header.Flags&syscall.NLM_F_MULTI == 0 {
+				break done
+			}
+		}
+	}
+	if interrupted {
+		return ErrDumpInterrupted
+	}
+	return nil
+}
+
+// receive reads the next datagram of s into buf and returns its messages,
+// which do not share buf. Datagrams larger than buf are reported with
+// ErrTruncatedAnswer rather than partly decoded.
+func receive(s *nl.NetlinkSocket, buf []byte) ([]syscall.NetlinkMessage, error) {
+	fd := s.GetFd()
+	if fd < 0 {
+		return nil, syscall.EBADF
+	}
+	// With MSG_TRUNC the real size of the datagram is returned.
+	n, _, err := unix.Recvfrom(fd, buf, unix.MSG_TRUNC)
+	if err != nil {
+		return nil, err
+	}
+	if n > len(buf) {
+		return nil, fmt.Errorf("%w: %d bytes received in a %d bytes buffer", ErrTruncatedAnswer, n, len(buf))
+	}
+	if n < unix.NLMSG_HDRLEN {
+		return nil, fmt.Errorf("%w: %d bytes received", ErrTruncatedAnswer, n)
+	}
+
+	b := make([]byte, n)
+	copy(b, buf[:n])
+	msgs, err := syscall.ParseNetlinkMessage(b)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrTruncatedAnswer, err)
+	}
+	return msgs, nil
+}
+
+func parseIP(ip []byte, family uint16) (net.IP, error) {
+
+	var resIP net.IP
+
+	switch family {
+	case syscall.AF_INET:
+		resIP = (net.IP)(ip[:4])
+	case syscall.AF_INET6:
+		resIP = (net.IP)(ip[:16])
+	default:
+		return nil, fmt.Errorf("parseIP Error ip=%v", ip)
+
+	}
+	return resIP, nil
+}
+
+// AssembleStats assembles statistics back from a chain of netlink
+// attributes of SvcAttrStats or DestAttrStats, whose counters and rates are
+// 32 bits wide except for the byte counters.
+func AssembleStats(msg []byte) (types.SvcStats, error) {
+	return assembleStats(msg, func(b []byte) uint64 {
+		return uint64(native.Uint32(b))
+	})
+}
+
+// AssembleStats64 assembles statistics back from a chain of netlink
+// attributes of SvcAttrStats64 or DestAttrStats64, whose values are all 64
+// bits wide.
+func AssembleStats64(msg []byte) (types.SvcStats, error) {
+	return assembleStats(msg, native.Uint64)
+}
+
+func assembleStats(msg []byte, value func([]byte) uint64) (types.SvcStats, error) {
+
+	var s types.SvcStats
+
+	attrs, err := nl.ParseRouteAttr(msg)
+	if err != nil {
+		return s, err
+	}
+
+	for _, attr := range attrs {
+		attrType := int(attr.Attr.Type)
+		switch attrType {
+		case StatsConns:
+			s.Connections = value(attr.Value)
+		case StatsPktsIn:
+			s.PacketsIn = value(attr.Value)
+		case StatsPktsOut:
+			s.PacketsOut = value(attr.Value)
+		case StatsBytesIn:
+			s.BytesIn = native.Uint64(attr.Value)
+		case StatsBytesOut:
+			s.BytesOut = native.Uint64(attr.Value)
+		case StatsCPS:
+			s.CPS = value(attr.Value)
+		case StatsPPSIn:
+			s.PPSIn = value(attr.Value)
+		case StatsPPSOut:
+			s.PPSOut = value(attr.Value)
+		case StatsBPSIn:
+			s.BPSIn = value(attr.Value)
+		case StatsBPSOut:
+			s.BPSOut = value(attr.Value)
+		}
+	}
+	return s, nil
+}
+
+// AssembleService assembles a service back from a chain of netlink attributes
+func AssembleService(attrs []syscall.NetlinkRouteAttr) (*types.Service, error) {
+
+	var s types.Service
+	var addressBytes, netmaskBytes []byte
+	var stats64 bool
+
+	for _, attr := range attrs {
+
+		attrType := int(attr.Attr.Type)
+
+		switch attrType {
+
+		case SvcAttrAddressFamily:
+			s.AddressFamily = native.Uint16(attr.Value)
+		case SvcAttrProtocol:
+			s.Protocol = types.IPProto(native.Uint16(attr.Value))
+		case SvcAttrAddress:
+			addressBytes = attr.Value
+		case SvcAttrPort:
+			s.Port = binary.BigEndian.Uint16(attr.Value)
+		case SvcAttrFWMark:
+			s.FWMark = native.Uint32(attr.Value)
+		case SvcAttrSchedName:
+			s.SchedName = nl.BytesToString(attr.Value)
+		case SvcAttrFlags:
+			s.Flags = types.ServiceFlags(native.Uint32(attr.Value))
+		case SvcAttrTimeout:
+			s.Timeout = native.Uint32(attr.Value)
+		case SvcAttrNetmask:
+			netmaskBytes = attr.Value
+		case SvcAttrStats:
+			if stats64 {
+				continue
+			}
+			stats, err := AssembleStats(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			s.Stats = stats
+		case SvcAttrStats64:
+			stats, err := AssembleStats64(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			s.Stats = stats
+			stats64 = true
+		}
+
+	}
+
+	// parse Address after parse AddressFamily incase of parseIP error
+	if addressBytes != nil {
+		ip, err := parseIP(addressBytes, s.AddressFamily)
+		if err != nil {
+			return nil, err
+		}
+		s.Address = ip
+	}
+
+	if netmaskBytes != nil {
+		s.Netmask = decodeNetmask(netmaskBytes, s.AddressFamily)
+	}
+
+	return &s, nil
+}
+
+// ParseService given a ipvs netlink response this function will respond with a valid service entry, an error otherwise
+func ParseService(msg []byte) (*types.Service, error) {
+
+	var s *types.Service
+
+	//Remove General header for this message and parse the NetLink message
+	hdr := deserializeGenlMsg(msg)
+	NetLinkAttrs, err := nl.ParseRouteAttr(msg[hdr.Len():])
+	if err != nil {
+		return nil, err
+	}
+	if len(NetLinkAttrs) == 0 {
+		return nil, fmt.Errorf("error no valid netlink message found while parsing service record")
+	}
+
+	//Now Parse and get IPVS related attributes messages packed in this message.
+	ipvsAttrs, err := nl.ParseRouteAttr(NetLinkAttrs[0].Value)
+	if err != nil {
+		return nil, err
+	}
+
+	//Assemble all the IPVS related attribute messages and create a service record
+	s, err = AssembleService(ipvsAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// AssembleDestination assembles a destination back from a chain of netlink attributes
+func AssembleDestination(attrs []syscall.NetlinkRouteAttr) (*types.Destination, error) {
+
+	var d types.Destination
+	var addressBytes []byte
+	var stats64 bool
+
+	for _, attr := range attrs {
+
+		attrType := int(attr.Attr.Type)
+
+		switch attrType {
+
+		case DestAttrAddressFamily:
+			d.AddressFamily = native.Uint16(attr.Value)
+		case DestAttrAddress:
+			addressBytes = attr.Value
+		case DestAttrPort:
+			d.Port = binary.BigEndian.Uint16(attr.Value)
+		case DestAttrForwardingMethod:
+			d.ConnectionFlags = types.ConnectionFlags(native.Uint32(attr.Value))
+		case DestAttrWeight:
+			d.Weight = int(native.Uint16(attr.Value))
+		case DestAttrUpperThreshold:
+			d.UpperThreshold = native.Uint32(attr.Value)
+		case DestAttrLowerThreshold:
+			d.LowerThreshold = native.Uint32(attr.Value)
+		case DestAttrActiveConnections:
+			d.ActiveConnections = int(native.Uint16(attr.Value))
+		case DestAttrInactiveConnections:
+			d.InactiveConnections = int(native.Uint16(attr.Value))
+		case DestAttrPersistentConnections:
+			d.PersistentConnections = int(native.Uint16(attr.Value))
+		case DestAttrTunType:
+			d.TunnelType = attr.Value[0]
+		case DestAttrTunPort:
+			d.TunnelPort = binary.BigEndian.Uint16(attr.Value)
+		case DestAttrTunFlags:
+			d.TunnelFlags = native.Uint16(attr.Value)
+		case DestAttrStats:
+			if stats64 {
+				continue
+			}
+			stats, err := AssembleStats(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			d.Stats = types.DstStats(stats)
+		case DestAttrStats64:
+			stats, err := AssembleStats64(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			d.Stats = types.DstStats(stats)
+			stats64 = true
+		}
+	}
+
+	// in older kernels (< 3.18), the destination address family attribute doesn't exist so we must
+	// assume it based on the destination address provided.
+	if d.AddressFamily == 0 {
+		// we can't check the address family using net stdlib because netlink returns
+		// IPv4 addresses as the first 4 bytes in a []byte of length 16 where as
+		// stdlib expects it as the last 4 bytes.
+		addressFamily, err := getIPFamily(addressBytes)
+		if err != nil {
+			return nil, err
+		}
+		d.AddressFamily = addressFamily
+	}
+
+	// parse Address after parse AddressFamily incase of parseIP error
+	if addressBytes != nil {
+		ip, err := parseIP(addressBytes, d.AddressFamily)
+		if err != nil {
+			return nil, err
+		}
+		d.Address = ip
+	}
+
+	return &d, nil
+}
+
+// getIPFamily parses the IP family based on raw data from netlink.
+// For AF_INET, netlink will set the first 4 bytes with trailing zeros
+//
+//	10.0.0.1 -> [10 0 0 1 0 0 0 0 0 0 0 0 0 0 0 0]
+//
+// For AF_INET6, the full 16 byte array is used:
+//
+//	2001:db8:3c4d:15::1a00 -> [32 1 13 184 60 77 0 21 0 0 0 0 0 0 26 0]
+func getIPFamily(address []byte) (uint16, error) {
+	if len(address) == 4 {
+		return syscall.AF_INET, nil
+	}
+
+	if isZeros(address) {
+		return 0, errors.New("could not parse IP family from address data")
+	}
+
+	// assume IPv4 if first 4 bytes are non-zero but rest of the data is trailing zeros
+	if !isZeros(address[:4]) && isZeros(address[4:]) {
+		return syscall.AF_INET, nil
+	}
+
+	return syscall.AF_INET6, nil
+}
+
+func isZeros(b []byte) bool {
+	for i := 0; i < len(b); i++ {
+		if b[i] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseDestination given a ipvs netlink response this function will respond with a valid destination entry, an error otherwise
+func ParseDestination(msg []byte) (*types.Destination, error) {
+	var dst *types.Destination
+
+	//Remove General header for this message
+	hdr := deserializeGenlMsg(msg)
+	NetLinkAttrs, err := nl.ParseRouteAttr(msg[hdr.Len():])
+	if err != nil {
+		return nil, err
+	}
+	if len(NetLinkAttrs) == 0 {
+		return nil, fmt.Errorf("error no valid netlink message found while parsing destination record")
+	}
+
+	//Now Parse and get IPVS related attributes messages packed in this message.
+	ipvsAttrs, err := nl.ParseRouteAttr(NetLinkAttrs[0].Value)
+	if err != nil {
+		return nil, err
+	}
+
+	//Assemble netlink attributes and create a Destination record
+	dst, err = AssembleDestination(ipvsAttrs)
+	if err != nil {
+		return nil, err
+	}
+
+	return dst, nil
+}
+
+// AssembleLocalAddress assembles a local address back from a chain of netlink attributes
+func AssembleLocalAddress(attrs []syscall.NetlinkRouteAttr, addressFamily uint16) (*types.LocalAddress, error) {
+	var addr types.LocalAddress
+	var addrBytes []byte
+
+	for _, attr := range attrs {
+		attrType := int(attr.Attr.Type)
+		switch attrType {
+		case LaddrAttrAddress:
+			addrBytes = attr.Value
+		case LaddrAttrPortConflict:
+			addr.Conflicts = native.Uint64(attr.Value)
+		case LaddrAttrConnections:
+			addr.Connections = native.Uint32(attr.Value)
+		}
+	}
+
+	if addrBytes != nil {
+		ip, err := parseIP(addrBytes, addressFamily)
+		if err != nil {
+			return nil, err
+		}
+		addr.Address = ip
+	}
+
+	return &addr, nil
+}
+
+// ParseLocalAddress given a ipvs netlink response this function will respond with a valid local address entry,
+// an error otherwise
+func ParseLocalAddress(msg []byte, addressFamily uint16) (*types.LocalAddress, error) {
+	var addr *types.LocalAddress
+
+	// Remove General header for this message
+	hdr := deserializeGenlMsg(msg)
+	NetLinkAttrs, err := nl.ParseRouteAttr(msg[hdr.Len():])
+	if err != nil {
+		return nil, err
+	}
+	if len(NetLinkAttrs) == 0 {
+		return nil, fmt.Errorf("error no valid netlink message found while parsing local address record")
+	}
+
+	//Now Parse and get IPVS related attributes messages packed in this message.
+	ipvsAttrs, err := nl.ParseRouteAttr(NetLinkAttrs[0].Value)
+	if err != nil {
+		return nil, err
+	}
+
+	//Assemble netlink attributes and create a LocalAddress record
+	addr, err = AssembleLocalAddress(ipvsAttrs, addressFamily)
+	if err != nil {
+		return nil, err
+	}
+
+	return addr, nil
+}
+
+// ParseConfig given a ipvs netlink response this function will respond with a valid config entry, an error otherwise
+func ParseConfig(msg []byte) (*types.Config, error) {
+	var c types.Config
+
+	//Remove General header for this message
+	hdr := deserializeGenlMsg(msg)
+	attrs, err := nl.ParseRouteAttr(msg[hdr.Len():])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attr := range attrs {
+		attrType := int(attr.Attr.Type)
+		switch attrType {
+		case CmdAttrTimeoutTCP:
+			c.TimeoutTCP = time.Duration(native.Uint32(attr.Value)) * time.Second
+		case CmdAttrTimeoutTCPFin:
+			c.TimeoutTCPFin = time.Duration(native.Uint32(attr.Value)) * time.Second
+		case CmdAttrTimeoutUDP:
+			c.TimeoutUDP = time.Duration(native.Uint32(attr.Value)) * time.Second
+		}
+	}
+
+	return &c, nil
+}
+
+// ParseInfo given a ipvs netlink response this function will respond with a valid info entry, an error otherwise
+func ParseInfo(msg []byte) (*types.Info, error) {
+	var version uint32
+	var info types.Info
+
+	hdr := deserializeGenlMsg(msg)
+	attrs, err := nl.ParseRouteAttr(msg[hdr.Len():])
+	if err != nil {
+		return nil, err
+	}
+
+	for _, attr := range attrs {
+		attrType := int(attr.Attr.Type)
+		switch attrType {
+		case CmdAttrInfoVersion:
+			version = native.Uint32(attr.Value)
+		case CmdAttrInfoConnTableSize:
+			info.ConnTableSize = native.Uint32(attr.Value)
+		}
+	}
+
+	ver := uint(version)
+	info.Version = &types.Version{
+		Major: (ver >> 16) & 0xff,
+		Minor: (ver >> 8) & 0xff,
+		Patch: ver & 0xff,
+	}
+
+	return &info, nil
+}
+
+// ParseDaemon given a ipvs netlink response this function will respond with a valid daemon entry, an error otherwise
+func ParseDaemon(msg []byte) (*types.Daemon, error) {
+	hdr := deserializeGenlMsg(msg)
+	attrs, err := nl.ParseRouteAttr(msg[hdr.Len():])
+	if err != nil {
+		return nil, err
+	}
+
+	// The kernel nests the daemon attributes in a CmdAttrDaemon.
+	for _, attr := range attrs {
+		if int(attr.Attr.Type) == CmdAttrDaemon {
+			daemonAttrs, err := nl.ParseRouteAttr(attr.Value)
+			if err != nil {
+				return nil, err
+			}
+			return AssembleDaemon(daemonAttrs), nil
+		}
+	}
+	return AssembleDaemon(attrs), nil
+}
+
+// AssembleDaemon assembles a sync daemon back from a chain of netlink
+// attributes
+func AssembleDaemon(attrs []syscall.NetlinkRouteAttr) *types.Daemon {
+	var d types.Daemon
+
+	for _, attr := range attrs {
+		attrType := int(attr.Attr.Type)
+		switch attrType {
+		case DaemonAttrState:
+			d.State = native.Uint32(attr.Value)
+		case DaemonAttrSyncID:
+			d.SyncId = native.Uint32(attr.Value)
+		case DaemonAttrMcastIfn:
+			d.McastIfn = nl.BytesToString(attr.Value)
+		case DaemonAttrSyncMaxLen:
+			d.SyncMaxLen = native.Uint16(attr.Value)
+		case DaemonAttrMcastGroup:
+			d.McastGroup = net.IP(append([]byte(nil), attr.Value[:4]...))
+		case DaemonAttrMcastGroup6:
+			d.McastGroup6 = net.IP(append([]byte(nil), attr.Value[:16]...))
+		case DaemonAttrMcastPort:
+			d.McastPort = native.Uint16(attr.Value)
+		case DaemonAttrMcastTTL:
+			d.McastTTL = attr.Value[0]
+		}
+	}
+
+	return &d
+}
+
+// IPVS related netlink message format explained
+
+/* EACH NETLINK MSG is of the below format, this is what we will receive from execute() api.
+   If we have multiple netlink objects to process like GetServices() etc., execute() will
+   supply an array of this below object
+
+            NETLINK MSG
+|-----------------------------------|
+    0        1        2        3
+|--------|--------|--------|--------| -
+| CMD ID |  VER   |    RESERVED     | |==> General Message Header represented by genlMsgHdr
+|-----------------------------------| -
+|    ATTR LEN     |   ATTR TYPE     | |
+|-----------------------------------| |
+|                                   | |
+|              VALUE                | |
+|     []byte Array of IPVS MSG      | |==> Attribute Message represented by syscall.NetlinkRouteAttr
+|        PADDED BY 4 BYTES          | |
+|                                   | |
+|-----------------------------------| -
+
+
+ Once We strip genlMsgHdr from above NETLINK MSG, we should parse the VALUE.
+ VALUE will have an array of netlink attributes (syscall.NetlinkRouteAttr) such that each attribute will
+ represent a "Service" or "Destination" object's field.  If we assemble these attributes we can construct
+ Service or Destination.
+
+            IPVS MSG
+|-----------------------------------|
+     0        1        2        3
+|--------|--------|--------|--------|
+|    ATTR LEN     |    ATTR TYPE    |
+|-----------------------------------|
+|                                   |
+|                                   |
+| []byte IPVS ATTRIBUTE  BY 4 BYTES |
+|                                   |
+|                                   |
+|-----------------------------------|
+           NEXT ATTRIBUTE
+|-----------------------------------|
+|    ATTR LEN     |    ATTR TYPE    |
+|-----------------------------------|
+|                                   |
+|                                   |
+| []byte IPVS ATTRIBUTE  BY 4 BYTES |
+|                                   |
+|                                   |
+|-----------------------------------|
+           NEXT ATTRIBUTE
+|-----------------------------------|
+|    ATTR LEN     |    ATTR TYPE    |
+|-----------------------------------|
+|                                   |
+|                                   |
+| []byte IPVS ATTRIBUTE  BY 4 BYTES |
+|                                   |
+|                                   |
+|-----------------------------------|
+
+*/
@@ -0,0 +1,286 @@
+// +build linux
+
+package netlink
+
+import (
+	"errors"
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+
+	"github.com/kwanhur/ipvs/types"
+	"github.com/vishvananda/netlink/nl"
+	"github.com/vishvananda/netns"
+	"golang.org/x/sys/unix"
+)
+
+func Test_getIPFamily(t *testing.T) {
+	testcases := []struct {
+		name           string
+		address        []byte
+		expectedFamily uint16
+		expectedErr    error
+	}{
+		{
+			name:           "16 byte IPv4 10.0.0.1",
+			address:        []byte{10, 0, 0, 1, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			expectedFamily: syscall.AF_INET,
+			expectedErr:    nil,
+		},
+		{
+			name:           "16 byte IPv6 2001:db8:3c4d:15::1a00",
+			address:        []byte{32, 1, 13, 184, 60, 77, 0, 21, 0, 0, 0, 0, 0, 0, 26, 0},
+			expectedFamily: syscall.AF_INET6,
+			expectedErr:    nil,
+		},
+		{
+			name:           "zero address",
+			address:        []byte{0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			expectedFamily: 0,
+			expectedErr:    errors.New("could not parse IP family from address data"),
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			family, err := getIPFamily(testcase.address)
+			if !reflect.DeepEqual(err, testcase.expectedErr) {
+				t.Logf("got err: %v", err)
+				t.Logf("expected err: %v", testcase.expectedErr)
+				t.Errorf("unexpected error")
+			}
+
+			if family != testcase.expectedFamily {
+				t.Logf("got IP family: %v", family)
+				t.Logf("expected IP family: %v", testcase.expectedFamily)
+				t.Errorf("unexpected IP family")
+			}
+		})
+	}
+}
+
+func TestDestinationTunnel(t *testing.T) {
+	d := &types.Destination{
+		Address:         net.ParseIP("10.1.0.1"),
+		Port:            80,
+		Weight:          1,
+		ConnectionFlags: types.ConnectionFlagTunnel,
+		TunnelType:      types.TunnelTypeGUE,
+		TunnelPort:      6080,
+		TunnelFlags:     types.TunnelFlagChecksum,
+	}
+
+	// Skip the header of the nested attribute.
+	attrs, err := nl.ParseRouteAttr(EncodeDestination(d).Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := AssembleDestination(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.TunnelType != d.TunnelType || res.TunnelPort != d.TunnelPort || res.TunnelFlags != d.TunnelFlags {
+		t.Errorf("expected tunnel %d/%d/%d, got %d/%d/%d",
+			d.TunnelType, d.TunnelPort, d.TunnelFlags, res.TunnelType, res.TunnelPort, res.TunnelFlags)
+	}
+
+	d.ConnectionFlags = types.ConnectionFlagMasq
+	attrs, err = nl.ParseRouteAttr(EncodeDestination(d).Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, attr := range attrs {
+		if int(attr.Attr.Type) == DestAttrTunType {
+			t.Errorf("tunnel attributes encoded for a masquerade destination")
+		}
+	}
+}
+
+func TestServiceStats64(t *testing.T) {
+	stats := nl.NewRtAttr(SvcAttrStats, nil)
+	nl.NewRtAttrChild(stats, StatsConns, nl.Uint32Attr(1))
+	nl.NewRtAttrChild(stats, StatsBytesIn, nl.Uint64Attr(2))
+	stats64 := nl.NewRtAttr(SvcAttrStats64, nil)
+	nl.NewRtAttrChild(stats64, StatsConns, nl.Uint64Attr(1<<40))
+	nl.NewRtAttrChild(stats64, StatsBytesIn, nl.Uint64Attr(2<<40))
+	nl.NewRtAttrChild(stats64, StatsCPS, nl.Uint64Attr(3<<40))
+
+	for _, order := range [][]*nl.RtAttr{{stats, stats64}, {stats64, stats}} {
+		var b []byte
+		for _, attr := range order {
+			b = append(b, attr.Serialize()...)
+		}
+		attrs, err := nl.ParseRouteAttr(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+		s, err := AssembleService(attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Stats.Connections != 1<<40 || s.Stats.BytesIn != 2<<40 || s.Stats.CPS != 3<<40 {
+			t.Errorf("expected the 64 bit stats, got %+v", s.Stats)
+		}
+	}
+
+	attrs, err := nl.ParseRouteAttr(stats.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := AssembleService(attrs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Stats.Connections != 1 || s.Stats.BytesIn != 2 {
+		t.Errorf("expected the 32 bit stats, got %+v", s.Stats)
+	}
+}
+
+func TestDaemonRoundTrip(t *testing.T) {
+	d := &types.Daemon{
+		State:      types.DaemonStateMaster,
+		SyncId:     7,
+		McastIfn:   "eth0",
+		McastGroup: net.ParseIP("239.1.1.1").To4(),
+		McastPort:  8849,
+		McastTTL:   4,
+		SyncMaxLen: 1400,
+	}
+
+	// Genl header followed by the nested daemon attribute, as dumped.
+	msg := append([]byte{CmdNewDaemon, 1, 0, 0}, EncodeDaemon(d).Serialize()...)
+	res, err := ParseDaemon(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, d) {
+		t.Errorf("expected %+v, got %+v", d, res)
+	}
+
+	d.McastGroup = nil
+	d.McastGroup6 = net.ParseIP("ff02::81")
+	msg = append([]byte{CmdNewDaemon, 1, 0, 0}, EncodeDaemon(d).Serialize()...)
+	res, err = ParseDaemon(msg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(res, d) {
+		t.Errorf("expected %+v, got %+v", d, res)
+	}
+}
+
+func TestDaemonMcastPort(t *testing.T) {
+	d := &types.Daemon{State: types.DaemonStateBackup, McastIfn: "eth0", McastPort: 8849}
+	attrs, err := nl.ParseRouteAttr(EncodeDaemon(d).Serialize()[syscall.SizeofRtAttr:])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A host byte order NLA_U16, converted with htons by the kernel.
+	expected := nl.Uint16Attr(8849)
+	found := false
+	for _, attr := range attrs {
+		if int(attr.Attr.Type) == DaemonAttrMcastPort {
+			found = true
+			if !reflect.DeepEqual(attr.Value, expected) {
+				t.Errorf("expected mcast port %v, got %v", expected, attr.Value)
+			}
+		}
+	}
+	if !found {
+		t.Error("no mcast port attribute")
+	}
+}
+
+func TestServiceNetmask(t *testing.T) {
+	testcases := []struct {
+		family  uint16
+		netmask uint32
+		encoded []byte
+	}{
+		{syscall.AF_INET, 0xFFFFFF00, []byte{0xFF, 0xFF, 0xFF, 0x00}},
+		{syscall.AF_INET6, 64, nl.Uint32Attr(64)},
+	}
+
+	for _, tc := range testcases {
+		s := &types.Service{AddressFamily: tc.family, FWMark: 1, Netmask: tc.netmask}
+		attrs, err := nl.ParseRouteAttr(EncodeService(s).Serialize()[syscall.SizeofRtAttr:])
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, attr := range attrs {
+			if int(attr.Attr.Type) == SvcAttrNetmask && !reflect.DeepEqual(attr.Value, tc.encoded) {
+				t.Errorf("family %d: expected netmask %v, got %v", tc.family, tc.encoded, attr.Value)
+			}
+		}
+
+		res, err := AssembleService(attrs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if res.Netmask != tc.netmask {
+			t.Errorf("family %d: expected netmask %#x, got %#x", tc.family, tc.netmask, res.Netmask)
+		}
+	}
+}
+
+func TestExecuteReplyValidation(t *testing.T) {
+	s, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	// Gets the loopback interface.
+	getLink := func(seq uint32) *nl.NetlinkRequest {
+		req := nl.NewNetlinkRequest(unix.RTM_GETLINK, unix.NLM_F_ACK)
+		msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+		msg.Index = 1
+		req.AddData(msg)
+		req.Seq = seq
+		return req
+	}
+
+	// The answers of an earlier request are dropped.
+	if err := s.Send(getLink(3)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Execute(s, getLink(4), 0); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+
+	// The answers of a later one are reported.
+	if err := s.Send(getLink(6)); err != nil {
+		t.Fatal(err)
+	}
+	_, err = Execute(s, getLink(5), 0)
+	var replyErr *ReplyError
+	if !errors.As(err, &replyErr) {
+		t.Fatalf("expected a ReplyError, got %v", err)
+	}
+	if replyErr.Seq != 6 || replyErr.ExpectedSeq != 5 {
+		t.Errorf("unexpected error %v", replyErr)
+	}
+}
+
+func TestReceiveTruncated(t *testing.T) {
+	s, err := nl.GetNetlinkSocketAt(netns.None(), netns.None(), unix.NETLINK_ROUTE)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	req := nl.NewNetlinkRequest(unix.RTM_GETLINK, 0)
+	msg := nl.NewIfInfomsg(unix.AF_UNSPEC)
+	msg.Index = 1
+	req.AddData(msg)
+	if err := s.Send(req); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = receive(s, make([]byte, 64))
+	if !errors.Is(err, ErrTruncatedAnswer) {
+		t.Fatalf("expected a truncated answer, got %v", err)
+	}
+}
@@ -0,0 +1,85 @@
+// +build linux
+
+package ipvs
+
+import (
+	"time"
+
+	"github.com/vishvananda/netns"
+)
+
+// Option configures a handle created by NewWithOptions.
+type Option func(*options)
+
+type options struct {
+	nsPath          string
+	nsFd            int
+	sendTimeout     time.Duration
+	recvTimeout     time.Duration
+	rcvBuf          int
+	rcvBufForce     bool
+	reconnect       ReconnectPolicy
+	retry           RetryPolicy
+	dryRun          bool
+	hostLock        *HostLock
+	hostLockTimeout time.Duration
+}
+
+func defaultOptions() *options {
+	return &options{
+		nsFd:        int(netns.None()),
+		sendTimeout: netlinkSendSocketTimeout,
+		recvTimeout: netlinkRecvSocketsTimeout,
+	}
+}
+
+// WithNetNSPath creates the handle in the network namespace pointed to by
+// path, e.g. /var/run/netns/blue.
+func WithNetNSPath(path string) Option {
+	return func(o *options) {
+		o.nsPath = path
+	}
+}
+
+// WithNetNSFd creates the handle in the network namespace referred to by
+// fd, which is not closed. It is ignored if WithNetNSPath is also given.
+func WithNetNSFd(fd int) Option {
+	return func(o *options) {
+		o.nsFd = fd
+	}
+}
+
+// WithSendTimeout sets the send timeout of the handle's socket, 30 seconds
+// by default. A zero timeout disables it.
+func WithSendTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.sendTimeout = timeout
+	}
+}
+
+// WithRecvTimeout sets the receive timeout of the handle's socket, 3
+// seconds by default. A zero timeout disables it.
+func WithRecvTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.recvTimeout = timeout
+	}
+}
+
+// WithRcvBuf sets the size of the handle's socket receive buffer, see
+// SetReceiveBufferSize.
+func WithRcvBuf(size int) Option {
+	return func(o *options) {
+		o.rcvBuf = size
+		o.rcvBufForce = false
+	}
+}
+
+// WithRcvBufForce sets the size of the handle's socket receive buffer
+// beyond net.core.rmem_max, which requires CAP_NET_ADMIN, see
+// SetReceiveBufferSize.
+func WithRcvBufForce(size int) Option {
+	return func(o *options) {
+		o.rcvBuf = size
+		o.rcvBufForce = true
+	}
+}
@@ -0,0 +1,35 @@
+// +build linux
+
+package ipvs
+
+import (
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestNewWithOptions(t *testing.T) {
+	i, err := NewWithOptions(
+		WithSendTimeout(5*time.Second),
+		WithRecvTimeout(time.Second),
+		WithRcvBuf(1<<16),
+	)
+	assert.NilError(t, err)
+	defer i.Close()
+
+	fd := i.sock.GetFd()
+	tv, err := unix.GetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_SNDTIMEO)
+	assert.NilError(t, err)
+	assert.Equal(t, tv.Sec, int64(5))
+	tv, err = unix.GetsockoptTimeval(fd, unix.SOL_SOCKET, unix.SO_RCVTIMEO)
+	assert.NilError(t, err)
+	assert.Equal(t, tv.Sec, int64(1))
+	v, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	assert.NilError(t, err)
+	assert.Assert(t, v >= 1<<16)
+
+	_, err = NewWithOptions(WithNetNSPath("/nonexistent/netns"))
+	assert.Assert(t, err != nil)
+}
@@ -0,0 +1,296 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+
+	"github.com/kwanhur/ipvs/types"
+)
+
+// defaultPersistenceTimeout is the persistence timeout of ipvsadm, in
+// seconds, used when the persistent option of ParseService has no value.
+const defaultPersistenceTimeout = 300
+
+var schedulerFlagsByName = map[string]ServiceFlags{
+	"flag-1":      SvcFlagSched1,
+	"flag-2":      SvcFlagSched2,
+	"flag-3":      SvcFlagSched3,
+	"sh-fallback": SvcFlagSHFallback,
+	"sh-port":     SvcFlagSHPort,
+	"mh-fallback": SvcFlagMHFallback,
+	"mh-port":     SvcFlagMHPort,
+}
+
+// ParseService parses a service from a URI like string naming its protocol,
+// address and port, e.g. "tcp://10.0.0.1:80" or "udp://[2001:db8::1]:53",
+// or its firewall mark, e.g. "fwmark://7", followed by options:
+//
+//   - sched: the scheduler, wlc like ipvsadm if not set;
+//   - persistent: the persistence timeout in seconds, 300 if empty;
+//   - netmask: the persistence netmask, e.g. 255.255.255.0 for IPv4 or a
+//     prefix length, e.g. 64, for IPv6;
+//   - pe: the persistence engine;
+//   - flags: comma separated scheduler flags, e.g. sh-port,sh-fallback;
+//   - ops: one-packet scheduling;
+//   - af: the address family of firewall mark services, inet or inet6.
+//
+// For example "tcp://10.0.0.1:80?sched=wrr&persistent=300".
+func ParseService(s string) (*Service, error) {
+	u, opts, err := parseURI(s)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := &Service{SchedName: WeightedLeastConnection, AddressFamily: syscall.AF_INET}
+	switch u.Scheme {
+	case "fwmark", "fwm":
+		mark, err := strconv.ParseUint(u.Host, 10, 32)
+		if err != nil || mark == 0 {
+			return nil, fmt.Errorf("service %q: invalid firewall mark %q", s, u.Host)
+		}
+		svc.FWMark = uint32(mark)
+	default:
+		if svc.Protocol, err = types.ParseIPProto(u.Scheme); err != nil {
+			return nil, fmt.Errorf("service %q: %v", s, err)
+		}
+		if svc.Address, svc.Zone, svc.Port, err = parseHostPort(u.Host, true); err != nil {
+			return nil, fmt.Errorf("service %q: %v", s, err)
+		}
+		svc.AddressFamily = addressFamily(svc.Address)
+	}
+
+	netmask := ""
+	for key, value := range opts {
+		switch key {
+		case "sched":
+			svc.SchedName = value
+		case "persistent":
+			svc.Flags.Set(SvcFlagPersistent)
+			svc.Timeout = defaultPersistenceTimeout
+			if value != "" {
+				t, err := strconv.ParseUint(value, 10, 32)
+				if err != nil {
+					return nil, fmt.Errorf("service %q: invalid persistence timeout %q", s, value)
+				}
+				svc.Timeout = uint32(t)
+			}
+		case "netmask":
+			netmask = value
+		case "pe":
+			svc.PEName = value
+		case "flags":
+			for _, name := range strings.Split(value, ",") {
+				flag, ok := schedulerFlagsByName[name]
+				if !ok {
+					return nil, fmt.Errorf("service %q: unknown scheduler flag %q", s, name)
+				}
+				svc.Flags.Set(flag)
+			}
+		case "ops":
+			svc.Flags.Set(SvcFlagOnePacket)
+		case "af":
+			if svc.FWMark == 0 {
+				return nil, fmt.Errorf("service %q: the address family is only set on firewall mark services", s)
+			}
+			switch value {
+			case "inet":
+				svc.AddressFamily = syscall.AF_INET
+			case "inet6":
+				svc.AddressFamily = syscall.AF_INET6
+			default:
+				return nil, fmt.Errorf("service %q: unknown address family %q", s, value)
+			}
+		default:
+			return nil, fmt.Errorf("service %q: unknown option %q", s, key)
+		}
+	}
+
+	svc.Netmask = fullNetmask(svc.AddressFamily)
+	if netmask != "" {
+		if err := parsePersistenceNetmask(svc, netmask); err != nil {
+			return nil, fmt.Errorf("service %q: %v", s, err)
+		}
+	}
+	return svc, nil
+}
+
+var forwardingMethodsByName = map[string]ForwardingMethod{
+	"masq":        ForwardMasq,
+	"masquerade":  ForwardMasq,
+	"nat":         ForwardMasq,
+	"route":       ForwardDirectRoute,
+	"dr":          ForwardDirectRoute,
+	"gate":        ForwardDirectRoute,
+	"directroute": ForwardDirectRoute,
+	"tunnel":      ForwardTunnel,
+	"tun":         ForwardTunnel,
+	"ipip":        ForwardTunnel,
+	"local":       ForwardLocalNode,
+	"localnode":   ForwardLocalNode,
+	"fullnat":     ForwardFullNat,
+}
+
+var tunnelTypesByName = map[string]uint8{
+	"ipip": TunnelTypeIPIP,
+	"gue":  TunnelTypeGUE,
+	"gre":  TunnelTypeGRE,
+}
+
+var tunnelChecksumsByName = map[string]uint16{
+	"nocsum":  TunnelFlagNoChecksum,
+	"csum":    TunnelFlagChecksum,
+	"remcsum": TunnelFlagRemoteChecksum,
+}
+
+// ParseDestination parses a destination from a URI like string made of its
+// address and port, e.g. "192.168.1.10:8080" or "[2001:db8::10]:8080", or
+// its address only for destinations of firewall mark services, followed by
+// options:
+//
+//   - fwd: the forwarding method, masq, route, tunnel, local or fullnat,
+//     masq if not set;
+//   - weight: the weight, 1 if not set;
+//   - upper and lower: the connection thresholds;
+//   - tun-type, tun-port and tun-csum: the tunnel encapsulation, ipip, gue
+//     or gre, its UDP port for gue, and its checksum, nocsum, csum or
+//     remcsum.
+//
+// For example "192.168.1.10:8080?fwd=masq&weight=50".
+func ParseDestination(s string) (*Destination, error) {
+	u, opts, err := parseURI("dst://" + s)
+	if err != nil {
+		return nil, err
+	}
+
+	d := &Destination{Weight: 1}
+	if d.Address, d.Zone, d.Port, err = parseHostPort(u.Host, false); err != nil {
+		return nil, fmt.Errorf("destination %q: %v", s, err)
+	}
+	d.AddressFamily = addressFamily(d.Address)
+
+	for key, value := range opts {
+		var err error
+		switch key {
+		case "fwd":
+			m, ok := forwardingMethodsByName[strings.ToLower(value)]
+			if !ok {
+				return nil, fmt.Errorf("destination %q: unknown forwarding method %q", s, value)
+			}
+			d.SetForwardingMethod(m)
+		case "weight":
+			var w uint64
+			w, err = strconv.ParseUint(value, 10, 31)
+			d.Weight = int(w)
+		case "upper":
+			d.UpperThreshold, err = parseUint32(value)
+		case "lower":
+			d.LowerThreshold, err = parseUint32(value)
+		case "tun-type":
+			t, ok := tunnelTypesByName[value]
+			if !ok {
+				return nil, fmt.Errorf("destination %q: unknown tunnel type %q", s, value)
+			}
+			d.TunnelType = t
+		case "tun-port":
+			var port uint64
+			port, err = strconv.ParseUint(value, 10, 16)
+			d.TunnelPort = uint16(port)
+		case "tun-csum":
+			flags, ok := tunnelChecksumsByName[value]
+			if !ok {
+				return nil, fmt.Errorf("destination %q: unknown tunnel checksum %q", s, value)
+			}
+			d.TunnelFlags = flags
+		default:
+			return nil, fmt.Errorf("destination %q: unknown option %q", s, key)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("destination %q: invalid %s %q", s, key, value)
+		}
+	}
+	return d, nil
+}
+
+// parseURI parses the URI s and its options, which may only be given once.
+func parseURI(s string) (*url.URL, map[string]string, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, nil, err
+	}
+	if u.Host == "" || (u.Path != "" && u.Path != "/") || u.User != nil || u.Fragment != "" {
+		return nil, nil, fmt.Errorf("invalid URI %q", s)
+	}
+
+	query, err := url.ParseQuery(u.RawQuery)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid options %q: %v", u.RawQuery, err)
+	}
+	opts := make(map[string]string, len(query))
+	for key, values := range query {
+		if len(values) > 1 {
+			return nil, nil, fmt.Errorf("%q: option %q given %d times", s, key, len(values))
+		}
+		opts[key] = values[0]
+	}
+	return u, opts, nil
+}
+
+// parseHostPort parses the address, with its IPv6 zone, and the port of
+// host. The port may be omitted unless needPort.
+func parseHostPort(host string, needPort bool) (net.IP, string, uint16, error) {
+	addr, port := strings.TrimSuffix(strings.TrimPrefix(host, "["), "]"), ""
+	if h, p, err := net.SplitHostPort(host); err == nil {
+		addr, port = h, p
+	} else if needPort {
+		return nil, "", 0, err
+	}
+
+	ip, zone, err := types.ParseAddress(addr)
+	if err != nil {
+		return nil, "", 0, err
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	if port == "" {
+		return ip, zone, 0, nil
+	}
+	p, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return nil, "", 0, fmt.Errorf("invalid port %q", port)
+	}
+	return ip, zone, uint16(p), nil
+}
+
+// parsePersistenceNetmask sets the persistence netmask of s to mask, a
+// dotted netmask for IPv4 and a prefix length for both families.
+func parsePersistenceNetmask(s *Service, mask string) error {
+	if plen, err := strconv.Atoi(mask); err == nil {
+		return s.SetPersistencePrefix(plen)
+	}
+	ip := net.ParseIP(mask).To4()
+	if ip == nil || s.AddressFamily == syscall.AF_INET6 {
+		return fmt.Errorf("invalid netmask %q", mask)
+	}
+	s.Netmask = uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+	return nil
+}
+
+func parseUint32(s string) (uint32, error) {
+	v, err := strconv.ParseUint(s, 10, 32)
+	return uint32(v), err
+}
+
+// addressFamily returns the address family of ip.
+func addressFamily(ip net.IP) uint16 {
+	if ip.To4() == nil {
+		return syscall.AF_INET6
+	}
+	return syscall.AF_INET
+}
@@ -0,0 +1,92 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestParseService(t *testing.T) {
+	testcases := []struct {
+		uri  string
+		want Service
+	}{
+		{"tcp://10.0.0.1:80?sched=wrr&persistent=600&netmask=255.255.255.0", Service{
+			Address: net.ParseIP("10.0.0.1").To4(), Protocol: ProtocolTCP, Port: 80, AddressFamily: syscall.AF_INET,
+			SchedName: WeightedRoundRobin, Flags: SvcFlagPersistent, Timeout: 600, Netmask: 0xFFFFFF00,
+		}},
+		{"udp://[2001:db8::1]:53?sched=sh&flags=sh-port,sh-fallback&ops", Service{
+			Address: net.ParseIP("2001:db8::1"), Protocol: ProtocolUDP, Port: 53, AddressFamily: syscall.AF_INET6,
+			SchedName: SourceHashing, Flags: SvcFlagSHPort | SvcFlagSHFallback | SvcFlagOnePacket, Netmask: 128,
+		}},
+		{"SCTP://[fe80::1%25eth0]:3868?persistent&netmask=64&pe=sip", Service{
+			Address: net.ParseIP("fe80::1"), Zone: "eth0", Protocol: ProtocolSCTP, Port: 3868, AddressFamily: syscall.AF_INET6,
+			SchedName: WeightedLeastConnection, Flags: SvcFlagPersistent, Timeout: 300, Netmask: 64, PEName: "sip",
+		}},
+		{"fwmark://7?af=inet6", Service{FWMark: 7, AddressFamily: syscall.AF_INET6, SchedName: WeightedLeastConnection, Netmask: 128}},
+	}
+
+	for _, tc := range testcases {
+		svc, err := ParseService(tc.uri)
+		assert.NilError(t, err, tc.uri)
+		assert.DeepEqual(t, *svc, tc.want)
+	}
+
+	for _, uri := range []string{
+		"10.0.0.1:80",
+		"icmp://10.0.0.1:80",
+		"tcp://10.0.0.1",
+		"tcp://10.0.0.1:80/path",
+		"tcp://10.0.0.1:80?timeout=5",
+		"tcp://10.0.0.1:80?sched=rr&sched=wrr",
+		"tcp://10.0.0.1:80?flags=sh-ports",
+		"tcp://10.0.0.1:80?af=inet6",
+		"tcp://[2001:db8::1]:80?netmask=255.255.255.0",
+		"fwmark://0",
+	} {
+		_, err := ParseService(uri)
+		assert.Assert(t, err != nil, uri)
+	}
+}
+
+func TestParseDestination(t *testing.T) {
+	testcases := []struct {
+		uri  string
+		want Destination
+	}{
+		{"192.168.1.10:8080?fwd=masq&weight=50", Destination{
+			Address: net.ParseIP("192.168.1.10").To4(), Port: 8080, AddressFamily: syscall.AF_INET,
+			Weight: 50, ConnectionFlags: ConnectionFlagMasq,
+		}},
+		{"192.168.1.11?fwd=DR&upper=100&lower=10", Destination{
+			Address: net.ParseIP("192.168.1.11").To4(), AddressFamily: syscall.AF_INET,
+			Weight: 1, ConnectionFlags: ConnectionFlagDirectRoute, UpperThreshold: 100, LowerThreshold: 10,
+		}},
+		{"[2001:db8::10]:80?fwd=tunnel&tun-type=gue&tun-port=6080&tun-csum=remcsum&weight=0", Destination{
+			Address: net.ParseIP("2001:db8::10"), Port: 80, AddressFamily: syscall.AF_INET6, ConnectionFlags: ConnectionFlagTunnel,
+			TunnelType: TunnelTypeGUE, TunnelPort: 6080, TunnelFlags: TunnelFlagRemoteChecksum,
+		}},
+		{"2001:db8::11", Destination{Address: net.ParseIP("2001:db8::11"), AddressFamily: syscall.AF_INET6, Weight: 1}},
+	}
+
+	for _, tc := range testcases {
+		d, err := ParseDestination(tc.uri)
+		assert.NilError(t, err, tc.uri)
+		assert.DeepEqual(t, *d, tc.want)
+	}
+
+	for _, uri := range []string{
+		"192.168.1.10:http",
+		"192.168.1.10:8080?fwd=bridge",
+		"192.168.1.10:8080?weight=-1",
+		"192.168.1.10:8080?tun-type=vxlan",
+		"192.168.1.10:8080?mark=1",
+	} {
+		_, err := ParseDestination(uri)
+		assert.Assert(t, err != nil, uri)
+	}
+}
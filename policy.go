@@ -0,0 +1,90 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"fmt"
+	"net"
+)
+
+// ErrNotPermitted is wrapped by the errors of the commands a Policy denies.
+var ErrNotPermitted = errors.New("not permitted by policy")
+
+// PortRange is an inclusive range of ports.
+type PortRange struct {
+	First, Last uint16
+}
+
+// FWMarkRange is an inclusive range of firewall marks.
+type FWMarkRange struct {
+	First, Last uint32
+}
+
+// Policy restricts the services which may be changed to ranges of virtual
+// addresses, ports and firewall marks, e.g. the ones assigned to a tenant or
+// to a component sharing the host with others. It is enforced on a handle
+// by registering its Check with OnCheck: the commands changing other
+// services, their destinations or local addresses fail with an error
+// wrapping ErrNotPermitted, without reaching the kernel.
+type Policy struct {
+	// Name identifies the policy in errors, e.g. the tenant name.
+	Name string
+
+	// Networks are the networks of the virtual addresses of the services,
+	// and Ports their port ranges, any port if empty.
+	Networks []*net.IPNet
+	Ports    []PortRange
+	// FWMarks are the firewall mark ranges of the firewall mark services.
+	FWMarks []FWMarkRange
+
+	// Global permits the commands applying to every service or to the
+	// host: Flush, Zero, SetConfig and the sync daemon commands.
+	Global bool
+}
+
+// Allows reports whether s is within the policy.
+func (p *Policy) Allows(s *Service) bool {
+	if s.FWMark > 0 {
+		for _, r := range p.FWMarks {
+			if s.FWMark >= r.First && s.FWMark <= r.Last {
+				return true
+			}
+		}
+		return false
+	}
+
+	network := false
+	for _, n := range p.Networks {
+		if n.Contains(s.Address) {
+			network = true
+			break
+		}
+	}
+	if !network {
+		return false
+	}
+	if len(p.Ports) == 0 {
+		return true
+	}
+	for _, r := range p.Ports {
+		if s.Port >= r.First && s.Port <= r.Last {
+			return true
+		}
+	}
+	return false
+}
+
+// Check is the CheckHook enforcing the policy.
+func (p *Policy) Check(cmd Command, s *Service, obj interface{}) error {
+	if s == nil {
+		if p.Global {
+			return nil
+		}
+		return fmt.Errorf("policy %s: %v: %w", p.Name, cmd, ErrNotPermitted)
+	}
+	if !p.Allows(s) {
+		return fmt.Errorf("policy %s: %v of service %v: %w", p.Name, cmd, s, ErrNotPermitted)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPolicy(t *testing.T) {
+	_, tenant, _ := net.ParseCIDR("10.0.0.0/24")
+	p := &Policy{
+		Name:     "tenant",
+		Networks: []*net.IPNet{tenant},
+		Ports:    []PortRange{{80, 80}, {8000, 8999}},
+		FWMarks:  []FWMarkRange{{100, 199}},
+	}
+
+	for _, tc := range []struct {
+		s    *Service
+		want bool
+	}{
+		{&Service{Address: net.ParseIP("10.0.0.1"), Port: 80}, true},
+		{&Service{Address: net.ParseIP("10.0.0.1"), Port: 8080}, true},
+		{&Service{Address: net.ParseIP("10.0.0.1"), Port: 443}, false},
+		{&Service{Address: net.ParseIP("10.0.1.1"), Port: 80}, false},
+		{&Service{FWMark: 150}, true},
+		{&Service{FWMark: 200}, false},
+	} {
+		assert.Equal(t, p.Allows(tc.s), tc.want, "%v", tc.s)
+	}
+
+	err := p.Check(Command(0), nil, nil)
+	assert.Assert(t, errors.Is(err, ErrNotPermitted))
+	p.Global = true
+	assert.NilError(t, p.Check(Command(0), nil, nil))
+}
+
+func TestCheckHook(t *testing.T) {
+	i, err := NewWithOptions(WithDryRun())
+	assert.NilError(t, err)
+	defer i.Close()
+
+	_, tenant, _ := net.ParseCIDR("10.0.0.0/24")
+	p := &Policy{Name: "tenant", Networks: []*net.IPNet{tenant}}
+	i.OnCheck(p.Check)
+	var hooked int
+	i.OnBefore(func(cmd Command, obj interface{}) { hooked++ })
+
+	s := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      syscall.IPPROTO_TCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     RoundRobin,
+	}
+	assert.NilError(t, i.NewService(s))
+
+	other := *s
+	other.Address = net.ParseIP("10.0.1.1")
+	err = i.NewService(&other)
+	assert.Assert(t, errors.Is(err, ErrNotPermitted))
+	assert.ErrorContains(t, err, "policy tenant")
+
+	err = i.Flush()
+	assert.Assert(t, errors.Is(err, ErrNotPermitted))
+
+	assert.Equal(t, len(i.Plan()), 1)
+	assert.Equal(t, hooked, 0)
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Poller collects the statistics of every service and destination of a
+// handler every Interval and hands the samples to OnSample and to Samples,
+// whichever are set, in that order.
+//
+// Failed polls are passed to OnError, or logged if not set, and skipped.
+// If the handler is a Handle whose socket failed, the socket is reopened
+// before the next poll.
+type Poller struct {
+	Handler  Handler
+	Interval time.Duration
+
+	// OnSample, if set, is called with every sample.
+	OnSample func(snap *StatsSnapshot)
+
+	// Samples, if set, receives every sample. Sends block until the sample
+	// is received or the poller stops.
+	Samples chan<- *StatsSnapshot
+
+	// OnError, if set, is called with the error of every failed poll.
+	OnError func(err error)
+}
+
+// Run polls until ctx is done, starting immediately.
+func (p *Poller) Run(ctx context.Context) error {
+	ticker := time.NewTicker(p.Interval)
+	defer ticker.Stop()
+
+	for {
+		snap, err := pollStats(p.Handler)
+		if err != nil {
+			p.fail(err)
+		} else {
+			if p.OnSample != nil {
+				p.OnSample(snap)
+			}
+			if p.Samples != nil {
+				select {
+				case p.Samples <- snap:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// fail reports the error of a poll and reconnects the handle if its socket
+// failed.
+func (p *Poller) fail(err error) {
+	if p.OnError != nil {
+		p.OnError(err)
+	} else {
+		logrus.Warnf("Failed to poll ipvs stats: %v", err)
+	}
+
+	if i, ok := p.Handler.(*Handle); ok && isSocketError(err) {
+		if rerr := i.Reconnect(); rerr != nil && rerr != ErrHandleClosed {
+			logrus.Warnf("Failed to reconnect ipvs handle: %v", rerr)
+		}
+	}
+}
+
+// pollStats returns the current statistics of the services of h, skipping
+// the services removed while reading their destinations.
+func pollStats(h Handler) (*StatsSnapshot, error) {
+	svcs, err := h.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &StatsSnapshot{Time: time.Now()}
+	for _, svc := range svcs {
+		dsts, err := h.GetDestinations(svc)
+		if errors.Is(err, syscall.ESRCH) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		snap.Services = append(snap.Services, &ServiceDestinations{Service: svc, Destinations: dsts})
+	}
+	return snap, nil
+}
@@ -0,0 +1,64 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+// failingHandler fails its first dumps of services.
+type failingHandler struct {
+	fakeHandler
+	failures int
+}
+
+func (f *failingHandler) GetServices() ([]*Service, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, errors.New("dump failed")
+	}
+	return f.fakeHandler.GetServices()
+}
+
+func TestPoller(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80, Stats: SvcStats{Connections: 3}}
+	h := &failingHandler{
+		fakeHandler: fakeHandler{
+			services:     []*Service{svc},
+			destinations: []*Destination{{Address: net.ParseIP("10.1.0.1"), Port: 8080}},
+		},
+		failures: 1,
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	samples := make(chan *StatsSnapshot)
+	var errs, calls int
+	p := &Poller{
+		Handler:  h,
+		Interval: time.Millisecond,
+		OnSample: func(*StatsSnapshot) { calls++ },
+		Samples:  samples,
+		OnError:  func(error) { errs++ },
+	}
+	done := make(chan error)
+	go func() { done <- p.Run(ctx) }()
+
+	for n := 0; n < 2; n++ {
+		snap := <-samples
+		assert.Equal(t, len(snap.Services), 1)
+		assert.Equal(t, snap.Services[0].Service.Stats.Connections, uint64(3))
+		assert.Equal(t, len(snap.Services[0].Destinations), 1)
+	}
+	cancel()
+	assert.Equal(t, <-done, context.Canceled)
+	assert.Equal(t, errs, 1)
+	assert.Assert(t, calls >= 2)
+}
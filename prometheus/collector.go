@@ -0,0 +1,202 @@
+// +build linux
+
+// Package prometheus exposes IPVS statistics to Prometheus with a collector
+// reading the services and destinations of an ipvs.Handler on every scrape.
+//
+// It is a separate module so that the ipvs package does not depend on the
+// Prometheus client library.
+package prometheus
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	prom "github.com/prometheus/client_golang/prometheus"
+)
+
+// Namespace prefixes the name of every metric, like in package metrics.
+const Namespace = "ipvs"
+
+var (
+	serviceLabelNames     = []string{"protocol", "address", "port", "fwmark"}
+	destinationLabelNames = append(serviceLabelNames[:len(serviceLabelNames):len(serviceLabelNames)], "destination", "destination_port")
+)
+
+// stat describes a metric read from the statistics of a service or a
+// destination.
+type stat struct {
+	name  string
+	help  string
+	kind  prom.ValueType
+	value func(st *ipvs.SvcStats) uint64
+}
+
+var stats = []stat{
+	{"connections_total", "Total number of connections.", prom.CounterValue,
+		func(st *ipvs.SvcStats) uint64 { return st.Connections }},
+	{"incoming_packets_total", "Total number of incoming packets.", prom.CounterValue,
+		func(st *ipvs.SvcStats) uint64 { return st.PacketsIn }},
+	{"outgoing_packets_total", "Total number of outgoing packets.", prom.CounterValue,
+		func(st *ipvs.SvcStats) uint64 { return st.PacketsOut }},
+	{"incoming_bytes_total", "Total number of incoming bytes.", prom.CounterValue,
+		func(st *ipvs.SvcStats) uint64 { return st.BytesIn }},
+	{"outgoing_bytes_total", "Total number of outgoing bytes.", prom.CounterValue,
+		func(st *ipvs.SvcStats) uint64 { return st.BytesOut }},
+	{"connections_per_second", "Rate of new connections, as estimated by the kernel.", prom.GaugeValue,
+		func(st *ipvs.SvcStats) uint64 { return st.CPS }},
+	{"incoming_packets_per_second", "Rate of incoming packets, as estimated by the kernel.", prom.GaugeValue,
+		func(st *ipvs.SvcStats) uint64 { return st.PPSIn }},
+	{"outgoing_packets_per_second", "Rate of outgoing packets, as estimated by the kernel.", prom.GaugeValue,
+		func(st *ipvs.SvcStats) uint64 { return st.PPSOut }},
+	{"incoming_bytes_per_second", "Rate of incoming bytes, as estimated by the kernel.", prom.GaugeValue,
+		func(st *ipvs.SvcStats) uint64 { return st.BPSIn }},
+	{"outgoing_bytes_per_second", "Rate of outgoing bytes, as estimated by the kernel.", prom.GaugeValue,
+		func(st *ipvs.SvcStats) uint64 { return st.BPSOut }},
+}
+
+// Collector is a prom.Collector reading the services and destinations of
+// an ipvs.Handler on every collection.
+type Collector struct {
+	h ipvs.Handler
+
+	mu     sync.Mutex
+	scorer *ipvs.Scorer
+	prev   *ipvs.StatsSnapshot
+
+	serviceStats     []*prom.Desc
+	destinationStats []*prom.Desc
+	active           *prom.Desc
+	inactive         *prom.Desc
+	persistent       *prom.Desc
+	weight           *prom.Desc
+	availability     *prom.Desc
+}
+
+var _ prom.Collector = (*Collector)(nil)
+
+// NewCollector returns a collector of the statistics of the services and
+// destinations of h. Services are labelled with protocol, address, port and
+// fwmark, destinations additionally with destination and destination_port.
+func NewCollector(h ipvs.Handler) *Collector {
+	c := &Collector{
+		h:          h,
+		active:     destinationDesc("active_connections", "Number of active connections."),
+		inactive:   destinationDesc("inactive_connections", "Number of inactive connections."),
+		persistent: destinationDesc("persistent_connections", "Number of persistent connection templates."),
+		weight:     destinationDesc("weight", "Weight of the destination."),
+		availability: destinationDesc("availability_score",
+			"Availability score of the destination, from 0 (unavailable) to 100 (fully available)."),
+	}
+	for _, s := range stats {
+		c.serviceStats = append(c.serviceStats,
+			prom.NewDesc(prom.BuildFQName(Namespace, "service", s.name), s.help, serviceLabelNames, nil))
+		c.destinationStats = append(c.destinationStats, destinationDesc(s.name, s.help))
+	}
+	return c
+}
+
+// SetScorer makes c export the availability score of every destination as
+// computed by sc, comparing each collection with the previous one, as the
+// ipvs_destination_availability_score gauge. Scores are not exported if sc
+// is nil, the default.
+func (c *Collector) SetScorer(sc *ipvs.Scorer) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.scorer, c.prev = sc, nil
+}
+
+func destinationDesc(name, help string) *prom.Desc {
+	return prom.NewDesc(prom.BuildFQName(Namespace, "destination", name), help, destinationLabelNames, nil)
+}
+
+// Describe implements prom.Collector.
+func (c *Collector) Describe(ch chan<- *prom.Desc) {
+	for _, d := range c.serviceStats {
+		ch <- d
+	}
+	for _, d := range c.destinationStats {
+		ch <- d
+	}
+	ch <- c.active
+	ch <- c.inactive
+	ch <- c.persistent
+	ch <- c.weight
+	ch <- c.availability
+}
+
+// Collect implements prom.Collector. Services deleted while collecting are
+// skipped, other errors are reported as invalid metrics failing the scrape.
+func (c *Collector) Collect(ch chan<- prom.Metric) {
+	svcs, err := c.h.GetServices()
+	if err != nil {
+		ch <- prom.NewInvalidMetric(c.serviceStats[0], err)
+		return
+	}
+
+	snap := &ipvs.StatsSnapshot{Time: time.Now()}
+	for _, s := range svcs {
+		dsts, err := c.h.GetDestinations(s)
+		if errors.Is(err, syscall.ESRCH) {
+			continue
+		}
+		if err != nil {
+			ch <- prom.NewInvalidMetric(c.destinationStats[0], err)
+			return
+		}
+		snap.Services = append(snap.Services, &ipvs.ServiceDestinations{Service: s, Destinations: dsts})
+	}
+
+	for _, sd := range snap.Services {
+		s, dsts := sd.Service, sd.Destinations
+		labels := serviceLabels(s)
+		for n, st := range stats {
+			ch <- prom.MustNewConstMetric(c.serviceStats[n], st.kind, float64(st.value(&s.Stats)), labels...)
+		}
+
+		for _, d := range dsts {
+			labels := append(labels[:len(labels):len(labels)], d.Address.String(), strconv.Itoa(int(d.Port)))
+			dst := ipvs.SvcStats(d.Stats)
+			for n, st := range stats {
+				ch <- prom.MustNewConstMetric(c.destinationStats[n], st.kind, float64(st.value(&dst)), labels...)
+			}
+			ch <- prom.MustNewConstMetric(c.active, prom.GaugeValue, float64(d.ActiveConnections), labels...)
+			ch <- prom.MustNewConstMetric(c.inactive, prom.GaugeValue, float64(d.InactiveConnections), labels...)
+			ch <- prom.MustNewConstMetric(c.persistent, prom.GaugeValue, float64(d.PersistentConnections), labels...)
+			ch <- prom.MustNewConstMetric(c.weight, prom.GaugeValue, float64(d.Weight), labels...)
+		}
+	}
+
+	c.collectScores(ch, snap)
+}
+
+// collectScores sends the availability scores of the destinations of snap,
+// if a scorer is set.
+func (c *Collector) collectScores(ch chan<- prom.Metric, snap *ipvs.StatsSnapshot) {
+	c.mu.Lock()
+	sc, prev := c.scorer, c.prev
+	if sc != nil {
+		c.prev = snap
+	}
+	c.mu.Unlock()
+	if sc == nil {
+		return
+	}
+
+	for _, score := range sc.Score(prev, snap) {
+		labels := append(serviceLabels(score.Service), score.Destination.Address.String(), strconv.Itoa(int(score.Destination.Port)))
+		ch <- prom.MustNewConstMetric(c.availability, prom.GaugeValue, float64(score.Score), labels...)
+	}
+}
+
+// serviceLabels returns the values of serviceLabelNames for s.
+func serviceLabels(s *ipvs.Service) []string {
+	if s.FWMark > 0 {
+		return []string{"", "", "", strconv.FormatUint(uint64(s.FWMark), 10)}
+	}
+	return []string{strings.ToLower(s.Protocol.String()), s.Address.String(), strconv.Itoa(int(s.Port)), ""}
+}
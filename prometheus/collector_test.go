@@ -0,0 +1,99 @@
+// +build linux
+
+package prometheus
+
+import (
+	"net"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"gotest.tools/v3/assert"
+)
+
+type fakeHandler struct {
+	ipvs.Handler
+
+	services     []*ipvs.Service
+	destinations map[uint32][]*ipvs.Destination
+}
+
+func (h *fakeHandler) GetServices() ([]*ipvs.Service, error) {
+	return h.services, nil
+}
+
+func (h *fakeHandler) GetDestinations(s *ipvs.Service) ([]*ipvs.Destination, error) {
+	dsts, ok := h.destinations[s.FWMark]
+	if !ok {
+		return nil, syscall.ESRCH
+	}
+	return dsts, nil
+}
+
+func TestCollector(t *testing.T) {
+	h := &fakeHandler{
+		services: []*ipvs.Service{
+			{Address: net.ParseIP("10.0.0.1"), Protocol: ipvs.ProtocolTCP, Port: 80, Stats: ipvs.SvcStats{Connections: 3, CPS: 1}},
+			{FWMark: 7},
+		},
+		destinations: map[uint32][]*ipvs.Destination{
+			0: {{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 2, ActiveConnections: 1, Stats: ipvs.DstStats{Connections: 3}}},
+		},
+	}
+
+	expected := `
+# HELP ipvs_service_connections_total Total number of connections.
+# TYPE ipvs_service_connections_total counter
+ipvs_service_connections_total{address="10.0.0.1",fwmark="",port="80",protocol="tcp"} 3
+# HELP ipvs_service_connections_per_second Rate of new connections, as estimated by the kernel.
+# TYPE ipvs_service_connections_per_second gauge
+ipvs_service_connections_per_second{address="10.0.0.1",fwmark="",port="80",protocol="tcp"} 1
+# HELP ipvs_destination_connections_total Total number of connections.
+# TYPE ipvs_destination_connections_total counter
+ipvs_destination_connections_total{address="10.0.0.1",destination="10.1.0.1",destination_port="8080",fwmark="",port="80",protocol="tcp"} 3
+# HELP ipvs_destination_active_connections Number of active connections.
+# TYPE ipvs_destination_active_connections gauge
+ipvs_destination_active_connections{address="10.0.0.1",destination="10.1.0.1",destination_port="8080",fwmark="",port="80",protocol="tcp"} 1
+# HELP ipvs_destination_weight Weight of the destination.
+# TYPE ipvs_destination_weight gauge
+ipvs_destination_weight{address="10.0.0.1",destination="10.1.0.1",destination_port="8080",fwmark="",port="80",protocol="tcp"} 2
+`
+	c := NewCollector(h)
+	assert.NilError(t, testutil.CollectAndCompare(c, strings.NewReader(expected),
+		"ipvs_service_connections_total",
+		"ipvs_service_connections_per_second",
+		"ipvs_destination_connections_total",
+		"ipvs_destination_active_connections",
+		"ipvs_destination_weight",
+	))
+	// The firewall mark service vanished before its destinations were read.
+	assert.Equal(t, testutil.CollectAndCount(c, "ipvs_service_connections_total"), 1)
+}
+
+func TestCollectorScores(t *testing.T) {
+	h := &fakeHandler{
+		services: []*ipvs.Service{
+			{Address: net.ParseIP("10.0.0.1"), Protocol: ipvs.ProtocolTCP, Port: 80},
+		},
+		destinations: map[uint32][]*ipvs.Destination{
+			0: {
+				{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 1, ActiveConnections: 1, InactiveConnections: 1},
+				{Address: net.ParseIP("10.1.0.2"), Port: 8080},
+			},
+		},
+	}
+
+	c := NewCollector(h)
+	assert.Equal(t, testutil.CollectAndCount(c, "ipvs_destination_availability_score"), 0)
+
+	c.SetScorer(&ipvs.Scorer{})
+	expected := `
+# HELP ipvs_destination_availability_score Availability score of the destination, from 0 (unavailable) to 100 (fully available).
+# TYPE ipvs_destination_availability_score gauge
+ipvs_destination_availability_score{address="10.0.0.1",destination="10.1.0.1",destination_port="8080",fwmark="",port="80",protocol="tcp"} 80
+ipvs_destination_availability_score{address="10.0.0.1",destination="10.1.0.2",destination_port="8080",fwmark="",port="80",protocol="tcp"} 0
+`
+	assert.NilError(t, testutil.CollectAndCompare(c, strings.NewReader(expected), "ipvs_destination_availability_score"))
+}
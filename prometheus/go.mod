@@ -0,0 +1,16 @@
+module github.com/kwanhur/ipvs/prometheus
+
+go 1.13
+
+require (
+	github.com/kwanhur/ipvs v0.0.0-20261016122243-b171d12773aa
+	github.com/prometheus/client_golang v1.12.2
+	github.com/sirupsen/logrus v1.8.1 // indirect
+	golang.org/x/sys v0.7.0 // indirect
+	gotest.tools/v3 v3.0.3
+)
+
+// Builds within the repository use the ipvs package next to this module;
+// the replace directive is ignored when this module is a dependency, which
+// gets the version required above.
+replace github.com/kwanhur/ipvs => ../
@@ -0,0 +1,94 @@
+// +build linux
+
+package ipvs
+
+import "fmt"
+
+// Quota limits the number of objects which can be created through a
+// handle, protecting hosts shared by several controllers. A zero limit means
+// unlimited. Limits are checked against the kernel state of the handle's
+// namespace before each creation.
+type Quota struct {
+	MaxServices                 int
+	MaxDestinationsPerService   int
+	MaxLocalAddressesPerService int
+}
+
+// QuotaExceededError is returned when a creation would exceed a quota.
+type QuotaExceededError struct {
+	// Resource is the kind of object which could not be created:
+	// "services", "destinations" or "local addresses".
+	Resource string
+	Limit    int
+	// Service is the service the object was created in, nil for
+	// services.
+	Service *Service
+}
+
+func (e *QuotaExceededError) Error() string {
+	if e.Service == nil {
+		return fmt.Sprintf("quota exceeded: at most %d %s allowed", e.Limit, e.Resource)
+	}
+	return fmt.Sprintf("quota exceeded: at most %d %s allowed for service %v", e.Limit, e.Resource, e.Service)
+}
+
+// SetQuota sets the quota enforced by the handle.
+func (i *Handle) SetQuota(q Quota) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.quota = q
+}
+
+func (i *Handle) getQuota() Quota {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.quota
+}
+
+func (i *Handle) checkServiceQuota() error {
+	limit := i.getQuota().MaxServices
+	if limit <= 0 {
+		return nil
+	}
+
+	svcs, err := i.GetServices()
+	if err != nil {
+		return err
+	}
+	if len(svcs) >= limit {
+		return &QuotaExceededError{Resource: "services", Limit: limit}
+	}
+	return nil
+}
+
+func (i *Handle) checkDestinationQuota(s *Service) error {
+	limit := i.getQuota().MaxDestinationsPerService
+	if limit <= 0 {
+		return nil
+	}
+
+	dsts, err := i.GetDestinations(s)
+	if err != nil {
+		return err
+	}
+	if len(dsts) >= limit {
+		return &QuotaExceededError{Resource: "destinations", Limit: limit, Service: s}
+	}
+	return nil
+}
+
+func (i *Handle) checkLocalAddressQuota(s *Service) error {
+	limit := i.getQuota().MaxLocalAddressesPerService
+	if limit <= 0 {
+		return nil
+	}
+
+	laddrs, err := i.GetLocalAddresses(s)
+	if err != nil {
+		return err
+	}
+	if len(laddrs) >= limit {
+		return &QuotaExceededError{Resource: "local addresses", Limit: limit, Service: s}
+	}
+	return nil
+}
@@ -0,0 +1,242 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/kwanhur/ipvs/types"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink"
+	"golang.org/x/sys/unix"
+)
+
+// ReachabilityMode selects what NewDestination does with a destination
+// failing its reachability check.
+type ReachabilityMode int
+
+const (
+	// ReachabilityOff disables the check, the default.
+	ReachabilityOff ReachabilityMode = iota
+
+	// ReachabilityWarn logs unreachable destinations and adds them anyway.
+	ReachabilityWarn
+
+	// ReachabilityEnforce refuses to add unreachable destinations and
+	// returns an *UnreachableError.
+	ReachabilityEnforce
+)
+
+// defaultReachabilityTimeout bounds a check whose Timeout is not set.
+const defaultReachabilityTimeout = time.Second
+
+// neighbourPollInterval is the interval at which a neighbour being resolved
+// is looked up again.
+const neighbourPollInterval = 20 * time.Millisecond
+
+// ReachabilityCheck configures the reachability check run by NewDestination
+// before adding a destination, catching typos and dead backends before they
+// take traffic.
+type ReachabilityCheck struct {
+	Mode ReachabilityMode
+	// Timeout bounds the check, one second if zero.
+	Timeout time.Duration
+}
+
+// UnreachableError is returned for a destination failing its reachability
+// check.
+type UnreachableError struct {
+	Service     *Service
+	Destination *Destination
+	Reason      string
+}
+
+func (e *UnreachableError) Error() string {
+	return fmt.Sprintf("service %s: destination %s is unreachable: %s", e.Service, destinationAddr(e.Destination, e.Destination.Port), e.Reason)
+}
+
+// SetReachabilityCheck sets the reachability check run by NewDestination.
+func (i *Handle) SetReachabilityCheck(c ReachabilityCheck) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	i.reachability = c
+}
+
+func (i *Handle) getReachabilityCheck() ReachabilityCheck {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.reachability
+}
+
+func (i *Handle) checkReachability(s *Service, d *Destination) error {
+	c := i.getReachabilityCheck()
+	if c.Mode == ReachabilityOff {
+		return nil
+	}
+
+	err := CheckReachability(s, d, c.Timeout)
+	if err == nil {
+		return nil
+	}
+	if c.Mode == ReachabilityEnforce {
+		return err
+	}
+	logrus.Warnf("Adding ipvs destination anyway: %v", err)
+	return nil
+}
+
+// CheckReachability checks that d, a destination of s, can be reached with
+// its forwarding method within timeout:
+//
+//   - direct routing destinations must be on link and their neighbour entry
+//     must resolve, which is triggered if needed;
+//   - tunnel destinations must be routable;
+//   - masquerade and fullnat destinations of TCP services must accept a TCP
+//     connection, other ones must be routable.
+//
+// Local node destinations are always reachable. The Zone of link-local
+// destinations selects their link instead of a route lookup. Routes and
+// neighbours are looked up in the network namespace of the calling thread,
+// which is not necessarily the one of the handle adding d.
+func CheckReachability(s *Service, d *Destination, timeout time.Duration) error {
+	if timeout <= 0 {
+		timeout = defaultReachabilityTimeout
+	}
+
+	var reason string
+	switch d.ConnectionFlags & ConnectionFlagFwdMask {
+	case ConnectionFlagLocalNode:
+		return nil
+	case ConnectionFlagDirectRoute:
+		reason = checkOnLink(d.Address, d.Zone, timeout)
+	case ConnectionFlagTunnel:
+		_, reason = lookupRoute(d.Address, d.Zone)
+	default:
+		reason = checkConnect(s, d, timeout)
+	}
+
+	if reason != "" {
+		return &UnreachableError{Service: s, Destination: d, Reason: reason}
+	}
+	return nil
+}
+
+// lookupRoute returns the route to ip, or the reason why there is none. A
+// link-local ip with a zone is routed on the link named by zone.
+func lookupRoute(ip net.IP, zone string) (*netlink.Route, string) {
+	if zone != "" {
+		link, err := netlink.LinkByName(zone)
+		if err != nil {
+			return nil, fmt.Sprintf("zone %s: %v", zone, err)
+		}
+		return &netlink.Route{LinkIndex: link.Attrs().Index}, ""
+	}
+
+	routes, err := netlink.RouteGet(ip)
+	if err != nil {
+		return nil, fmt.Sprintf("no route: %v", err)
+	}
+	if len(routes) == 0 {
+		return nil, "no route"
+	}
+	return &routes[0], ""
+}
+
+// checkOnLink checks that ip is directly connected and that its link layer
+// address resolves within timeout.
+func checkOnLink(ip net.IP, zone string, timeout time.Duration) string {
+	route, reason := lookupRoute(ip, zone)
+	if reason != "" {
+		return reason
+	}
+	if route.Type == unix.RTN_LOCAL {
+		return ""
+	}
+	if route.Gw != nil {
+		return fmt.Sprintf("not on link, routed through %s", route.Gw)
+	}
+
+	family := netlink.FAMILY_V4
+	if ip.To4() == nil {
+		family = netlink.FAMILY_V6
+	}
+
+	deadline := time.Now().Add(timeout)
+	probed := false
+	for {
+		state, err := neighbourState(route.LinkIndex, family, ip)
+		if err != nil {
+			return fmt.Sprintf("neighbour lookup: %v", err)
+		}
+
+		switch {
+		case state&(netlink.NUD_REACHABLE|netlink.NUD_STALE|netlink.NUD_DELAY|netlink.NUD_PROBE|netlink.NUD_PERMANENT|netlink.NUD_NOARP) != 0:
+			return ""
+		case state == netlink.NUD_FAILED && probed:
+			return "neighbour resolution failed"
+		case !probed:
+			// Any packet makes the kernel resolve the neighbour.
+			probeNeighbour(ip, zone)
+			probed = true
+		}
+
+		if time.Now().After(deadline) {
+			return "neighbour resolution timed out"
+		}
+		time.Sleep(neighbourPollInterval)
+	}
+}
+
+// neighbourState returns the state of the neighbour entry of ip on link,
+// netlink.NUD_NONE if there is none.
+func neighbourState(link, family int, ip net.IP) (int, error) {
+	neighs, err := netlink.NeighList(link, family)
+	if err != nil {
+		return 0, err
+	}
+	for _, n := range neighs {
+		if n.IP.Equal(ip) {
+			return n.State, nil
+		}
+	}
+	return netlink.NUD_NONE, nil
+}
+
+// probeNeighbour sends a datagram to the discard port of ip.
+func probeNeighbour(ip net.IP, zone string) {
+	conn, err := net.Dial("udp", net.JoinHostPort(types.ZonedAddress(ip, zone), "9"))
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+	conn.Write([]byte{0})
+}
+
+// checkConnect checks that a TCP connection to d can be established within
+// timeout, or that d is routable for the other protocols.
+func checkConnect(s *Service, d *Destination, timeout time.Duration) string {
+	port := d.Port
+	if port == 0 {
+		port = s.Port
+	}
+	if s.Protocol != syscall.IPPROTO_TCP || port == 0 {
+		_, reason := lookupRoute(d.Address, d.Zone)
+		return reason
+	}
+
+	conn, err := net.DialTimeout("tcp", destinationAddr(d, port), timeout)
+	if err != nil {
+		return fmt.Sprintf("connect: %v", err)
+	}
+	conn.Close()
+	return ""
+}
+
+// destinationAddr returns the host:port address of d with port.
+func destinationAddr(d *Destination, port uint16) string {
+	return net.JoinHostPort(types.ZonedAddress(d.Address, d.Zone), strconv.Itoa(int(port)))
+}
@@ -0,0 +1,64 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestCheckReachability(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	defer l.Close()
+	port := uint16(l.Addr().(*net.TCPAddr).Port)
+
+	// Take a free port to get a refused connection.
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NilError(t, err)
+	closedPort := uint16(closed.Addr().(*net.TCPAddr).Port)
+	closed.Close()
+
+	s := &Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      syscall.IPPROTO_TCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+	}
+	loopback := net.ParseIP("127.0.0.1")
+
+	tests := []struct {
+		name        string
+		d           *Destination
+		unreachable bool
+	}{
+		{"masquerade listening", &Destination{Address: loopback, Port: port, ConnectionFlags: ConnectionFlagMasq}, false},
+		{"masquerade refused", &Destination{Address: loopback, Port: closedPort, ConnectionFlags: ConnectionFlagMasq}, true},
+		{"fullnat listening", &Destination{Address: loopback, Port: port, ConnectionFlags: ConnectionFlagFullNat}, false},
+		{"local node", &Destination{Address: loopback, Port: closedPort, ConnectionFlags: ConnectionFlagLocalNode}, false},
+		{"direct routing local", &Destination{Address: loopback, ConnectionFlags: ConnectionFlagDirectRoute}, false},
+	}
+
+	for _, tt := range tests {
+		err := CheckReachability(s, tt.d, time.Second)
+		if tt.unreachable {
+			_, ok := err.(*UnreachableError)
+			assert.Assert(t, ok, "%s: got %v", tt.name, err)
+		} else {
+			assert.NilError(t, err, tt.name)
+		}
+	}
+
+	h := &Handle{}
+	refused := &Destination{Address: loopback, Port: closedPort}
+	assert.NilError(t, h.checkReachability(s, refused))
+	h.SetReachabilityCheck(ReachabilityCheck{Mode: ReachabilityWarn})
+	assert.NilError(t, h.checkReachability(s, refused))
+	h.SetReachabilityCheck(ReachabilityCheck{Mode: ReachabilityEnforce})
+	_, ok := h.checkReachability(s, refused).(*UnreachableError)
+	assert.Assert(t, ok)
+}
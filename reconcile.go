@@ -0,0 +1,402 @@
+// +build linux
+
+package ipvs
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// ReconcileReport lists the changes made by Reconcile, in order, as the
+// events of the mutations performed.
+type ReconcileReport struct {
+	Changes []Event
+}
+
+// Reconcile converges the services, destinations and local addresses of the
+// handle to desired with the fewest mutations: missing objects are added,
+// objects whose configuration differs are updated and the other ones are
+// deleted. Additions and updates are made before deletions so that traffic
+// keeps being served while converging.
+//
+// Services are matched on their address family, protocol, address and port,
+// or firewall mark, and destinations on their address and port, so desired
+// objects must set them like the kernel reports them, see Fingerprint.
+// Local addresses are only read for the services having some desired or a
+// fullnat destination, as kernels without fullnat support do not know them.
+//
+// Reconcile stops at the first failed mutation and returns its error along
+// with the report of the changes made until then. On a dry run handle, see
+// WithDryRun, the report lists the changes which would be made.
+func (i *Handle) Reconcile(desired []*ServiceSpec) (report *ReconcileReport, err error) {
+	err = i.batch(func() error {
+		report, err = i.reconcile(desired)
+		return err
+	})
+	return report, err
+}
+
+func (i *Handle) reconcile(desired []*ServiceSpec) (*ReconcileReport, error) {
+	current, err := i.currentSpecs(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &ReconcileReport{}
+	for _, change := range planReconcile(current, desired) {
+		if err := i.applyChange(change); err != nil {
+			return report, err
+		}
+		change.Time = time.Now()
+		report.Changes = append(report.Changes, change)
+	}
+	return report, nil
+}
+
+// ReconcileParallel is Reconcile making the changes of different services
+// concurrently, on up to workers sockets opened in the namespace of the
+// handle, to converge faster on hosts with many services. The changes of a
+// service are made in order, by a single worker, and services are deleted
+// once every other change is made. The hooks, quota and event bus of the
+// handle apply to every socket, so hooks must be safe for concurrent use,
+// and concurrent creations may exceed a quota.
+//
+// On the first failed mutation, the workers stop before their next change,
+// and the error is returned with the report of the changes made, in the order
+// they were made. Dry run handles and a single worker reconcile like
+// Reconcile.
+func (i *Handle) ReconcileParallel(desired []*ServiceSpec, workers int) (report *ReconcileReport, err error) {
+	err = i.batch(func() error {
+		if workers <= 1 || i.opts != nil && i.opts.dryRun {
+			report, err = i.reconcile(desired)
+		} else {
+			report, err = i.reconcileParallel(desired, workers)
+		}
+		return err
+	})
+	return report, err
+}
+
+func (i *Handle) reconcileParallel(desired []*ServiceSpec, workers int) (*ReconcileReport, error) {
+	current, err := i.currentSpecs(desired)
+	if err != nil {
+		return nil, err
+	}
+
+	phases := groupChanges(planReconcile(current, desired))
+	n := len(phases[0])
+	if len(phases[1]) > n {
+		n = len(phases[1])
+	}
+	if n > workers {
+		n = workers
+	}
+	apply := []func(Event) error{i.applyChange}
+	for len(apply) < n {
+		h, err := i.worker()
+		if err != nil {
+			return nil, err
+		}
+		defer h.Close()
+		apply = append(apply, h.applyChange)
+	}
+
+	report := &ReconcileReport{}
+	for _, groups := range phases {
+		if err := applyGroups(groups, apply, report); err != nil {
+			return report, err
+		}
+	}
+	return report, nil
+}
+
+// worker returns a handle with the hooks, quota, reachability check and
+// event bus of i, on a socket of its own.
+func (i *Handle) worker() (*Handle, error) {
+	o := i.opts
+	if o == nil {
+		o = defaultOptions()
+	}
+	sock, err := openSocket(o)
+	if err != nil {
+		return nil, err
+	}
+
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return &Handle{
+		sock:         sock,
+		opts:         o,
+		checkHooks:   i.checkHooks,
+		beforeHooks:  i.beforeHooks,
+		afterHooks:   i.afterHooks,
+		bus:          i.bus,
+		quota:        i.quota,
+		reachability: i.reachability,
+	}, nil
+}
+
+// groupChanges splits the changes planned by planReconcile per service,
+// keeping their order, in two phases: the deletions of services come after
+// every other change.
+func groupChanges(changes []Event) [2][][]Event {
+	var phases [2][][]Event
+	index := make(map[string]int)
+	for _, e := range changes {
+		if e.Type == EventServiceDeleted {
+			phases[1] = append(phases[1], []Event{e})
+			continue
+		}
+		key := serviceKey(e.Service)
+		n, ok := index[key]
+		if !ok {
+			n = len(phases[0])
+			index[key] = n
+			phases[0] = append(phases[0], nil)
+		}
+		phases[0][n] = append(phases[0][n], e)
+	}
+	return phases
+}
+
+// applyGroups makes the changes of groups, each group in order by one of
+// the workers making changes with apply, and adds them to report. Workers
+// stop taking groups after the first error, which is returned.
+func applyGroups(groups [][]Event, apply []func(Event) error, report *ReconcileReport) error {
+	queue := make(chan []Event, len(groups))
+	for _, g := range groups {
+		queue <- g
+	}
+	close(queue)
+
+	var (
+		mu       sync.Mutex
+		firstErr error
+		wg       sync.WaitGroup
+	)
+	failed := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return firstErr != nil
+	}
+	for _, fn := range apply {
+		wg.Add(1)
+		go func(fn func(Event) error) {
+			defer wg.Done()
+			for g := range queue {
+				for _, change := range g {
+					if failed() {
+						return
+					}
+					err := fn(change)
+					mu.Lock()
+					if err != nil {
+						if firstErr == nil {
+							firstErr = err
+						}
+					} else {
+						change.Time = time.Now()
+						report.Changes = append(report.Changes, change)
+					}
+					mu.Unlock()
+					if err != nil {
+						return
+					}
+				}
+			}
+		}(fn)
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// currentSpecs returns the configuration of the services of the handle.
+func (i *Handle) currentSpecs(desired []*ServiceSpec) ([]*ServiceSpec, error) {
+	return currentSpecs(i, desired)
+}
+
+func currentSpecs(h Handler, desired []*ServiceSpec) ([]*ServiceSpec, error) {
+	wantLaddrs := make(map[string]bool)
+	for _, spec := range desired {
+		if len(spec.LocalAddresses) > 0 {
+			wantLaddrs[serviceKey(spec.Service)] = true
+		}
+	}
+
+	svcs, err := h.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	specs := make([]*ServiceSpec, 0, len(svcs))
+	for _, svc := range svcs {
+		spec := &ServiceSpec{Service: svc}
+		if spec.Destinations, err = h.GetDestinations(svc); err != nil {
+			return nil, err
+		}
+		if wantLaddrs[serviceKey(svc)] || hasFullNat(spec.Destinations) {
+			if spec.LocalAddresses, err = h.GetLocalAddresses(svc); err != nil {
+				return nil, err
+			}
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+func hasFullNat(dsts []*Destination) bool {
+	for _, d := range dsts {
+		if d.ConnectionFlags&ConnectionFlagFwdMask == ConnectionFlagFullNat {
+			return true
+		}
+	}
+	return false
+}
+
+// planReconcile returns the mutations converging current to desired, as
+// events, in the order they must be made.
+func planReconcile(current, desired []*ServiceSpec) []Event {
+	cur := make(map[string]*ServiceSpec, len(current))
+	for _, spec := range current {
+		cur[serviceKey(spec.Service)] = spec
+	}
+
+	sorted := make([]*ServiceSpec, len(desired))
+	copy(sorted, desired)
+	sort.Slice(sorted, func(a, b int) bool {
+		return serviceKey(sorted[a].Service) < serviceKey(sorted[b].Service)
+	})
+
+	var changes []Event
+	wanted := make(map[string]bool, len(desired))
+	for _, want := range sorted {
+		key := serviceKey(want.Service)
+		wanted[key] = true
+		have, ok := cur[key]
+		if !ok {
+			have = &ServiceSpec{}
+			changes = append(changes, Event{Type: EventServiceAdded, Service: want.Service})
+		} else if serviceChanged(have.Service, want.Service) {
+			changes = append(changes, Event{Type: EventServiceUpdated, Service: want.Service})
+		}
+		changes = append(changes, planServiceSpec(have, want)...)
+	}
+
+	var deleted []*Service
+	for key, spec := range cur {
+		if !wanted[key] {
+			deleted = append(deleted, spec.Service)
+		}
+	}
+	sort.Slice(deleted, func(a, b int) bool {
+		return serviceKey(deleted[a]) < serviceKey(deleted[b])
+	})
+	for _, svc := range deleted {
+		changes = append(changes, Event{Type: EventServiceDeleted, Service: svc})
+	}
+	return changes
+}
+
+// planServiceSpec returns the mutations converging the destinations and
+// local addresses of have to the ones of want. Local addresses are added
+// first, as fullnat destinations need them, and deleted last.
+func planServiceSpec(have, want *ServiceSpec) []Event {
+	var changes []Event
+	svc := want.Service
+
+	haveLaddrs := make(map[string]bool, len(have.LocalAddresses))
+	for _, l := range have.LocalAddresses {
+		haveLaddrs[l.Address.String()] = true
+	}
+	wantLaddrs := make(map[string]bool, len(want.LocalAddresses))
+	for _, l := range want.LocalAddresses {
+		wantLaddrs[l.Address.String()] = true
+		if !haveLaddrs[l.Address.String()] {
+			changes = append(changes, Event{Type: EventLocalAddressAdded, Service: svc, LocalAddress: l})
+		}
+	}
+
+	haveDsts := make(map[string]*Destination, len(have.Destinations))
+	for _, d := range have.Destinations {
+		haveDsts[destinationKey(d)] = d
+	}
+	wantDsts := make(map[string]bool, len(want.Destinations))
+	for _, d := range want.Destinations {
+		key := destinationKey(d)
+		wantDsts[key] = true
+		cur, ok := haveDsts[key]
+		if !ok {
+			changes = append(changes, Event{Type: EventDestinationAdded, Service: svc, Destination: d})
+		} else if destinationChanged(cur, d) {
+			changes = append(changes, Event{Type: EventDestinationUpdated, Service: svc, Destination: d})
+		}
+	}
+
+	for _, d := range have.Destinations {
+		if !wantDsts[destinationKey(d)] {
+			changes = append(changes, Event{Type: EventDestinationDeleted, Service: svc, Destination: d})
+		}
+	}
+	for _, l := range have.LocalAddresses {
+		if !wantLaddrs[l.Address.String()] {
+			changes = append(changes, Event{Type: EventLocalAddressDeleted, Service: svc, LocalAddress: l})
+		}
+	}
+	return changes
+}
+
+// serviceChanged reports whether the configuration of want differs from
+// the one of cur, ignoring the flags maintained by the kernel. An unset
+// netmask is the one of a service which does not group clients.
+func serviceChanged(cur, want *Service) bool {
+	netmask := func(s *Service) uint32 {
+		if s.Netmask == 0 {
+			return fullNetmask(s.AddressFamily)
+		}
+		return s.Netmask
+	}
+	return cur.SchedName != want.SchedName ||
+		cur.Flags&^SvcFlagHashed != want.Flags&^SvcFlagHashed ||
+		cur.Timeout != want.Timeout ||
+		netmask(cur) != netmask(want) ||
+		cur.PEName != want.PEName
+}
+
+// destinationChanged reports whether the configuration of want differs from
+// the one of cur. The kernel only reports the forwarding method of the
+// connection flags.
+func destinationChanged(cur, want *Destination) bool {
+	fwd := want.ConnectionFlags & ConnectionFlagFwdMask
+	if cur.Weight != want.Weight ||
+		cur.ConnectionFlags&ConnectionFlagFwdMask != fwd ||
+		cur.UpperThreshold != want.UpperThreshold ||
+		cur.LowerThreshold != want.LowerThreshold {
+		return true
+	}
+	return fwd == ConnectionFlagTunnel &&
+		(cur.TunnelType != want.TunnelType || cur.TunnelPort != want.TunnelPort || cur.TunnelFlags != want.TunnelFlags)
+}
+
+// applyChange performs the mutation described by e.
+func (i *Handle) applyChange(e Event) error {
+	switch e.Type {
+	case EventServiceAdded:
+		return i.NewService(e.Service)
+	case EventServiceUpdated:
+		return i.UpdateService(e.Service)
+	case EventServiceDeleted:
+		return i.DelService(e.Service)
+	case EventDestinationAdded:
+		return i.NewDestination(e.Service, e.Destination)
+	case EventDestinationUpdated:
+		return i.UpdateDestination(e.Service, e.Destination)
+	case EventDestinationDeleted:
+		return i.DelDestination(e.Service, e.Destination)
+	case EventLocalAddressAdded:
+		return i.NewLocalAddress(e.Service, e.LocalAddress)
+	case EventLocalAddressDeleted:
+		return i.DelLocalAddress(e.Service, e.LocalAddress)
+	}
+	return nil
+}
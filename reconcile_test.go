@@ -0,0 +1,124 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"net"
+	"sync"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestPlanReconcile(t *testing.T) {
+	spec := func(port uint16, weights ...int) *ServiceSpec {
+		s := &ServiceSpec{Service: &Service{
+			AddressFamily: syscall.AF_INET,
+			Protocol:      syscall.IPPROTO_TCP,
+			Address:       net.ParseIP("10.0.0.1"),
+			Port:          port,
+			SchedName:     RoundRobin,
+		}}
+		for n, w := range weights {
+			s.Destinations = append(s.Destinations, &Destination{
+				Address: net.IPv4(10, 1, 0, byte(n+1)),
+				Port:    80,
+				Weight:  w,
+			})
+		}
+		return s
+	}
+	types := func(changes []Event) []EventType {
+		res := make([]EventType, len(changes))
+		for n, e := range changes {
+			res[n] = e.Type
+		}
+		return res
+	}
+
+	// Converged, kernel flags and netmask left to their default.
+	cur := spec(80, 1, 2)
+	cur.Service.Flags = SvcFlagHashed
+	cur.Service.Netmask = 0xFFFFFFFF
+	cur.Destinations[0].ActiveConnections = 5
+	assert.Equal(t, len(planReconcile([]*ServiceSpec{cur}, []*ServiceSpec{spec(80, 1, 2)})), 0)
+
+	// A weight changed, a destination added and another removed.
+	changes := planReconcile([]*ServiceSpec{spec(80, 1, 2)}, []*ServiceSpec{spec(80, 3)})
+	assert.DeepEqual(t, types(changes), []EventType{EventDestinationUpdated, EventDestinationDeleted})
+	assert.Equal(t, changes[0].Destination.Weight, 3)
+	assert.Equal(t, changes[1].Destination.Address.String(), "10.1.0.2")
+
+	// A service replaced by another one, added first.
+	laddrs := spec(443, 1)
+	laddrs.Service.SchedName = WeightedRoundRobin
+	laddrs.LocalAddresses = []*LocalAddress{{Address: net.ParseIP("10.2.0.1")}}
+	changes = planReconcile([]*ServiceSpec{spec(80, 1)}, []*ServiceSpec{laddrs})
+	assert.DeepEqual(t, types(changes), []EventType{
+		EventServiceAdded, EventLocalAddressAdded, EventDestinationAdded, EventServiceDeleted,
+	})
+	assert.Equal(t, changes[3].Service.Port, uint16(80))
+
+	// Updated service options.
+	changes = planReconcile([]*ServiceSpec{spec(443, 1)}, []*ServiceSpec{laddrs})
+	assert.DeepEqual(t, types(changes), []EventType{EventServiceUpdated, EventLocalAddressAdded})
+}
+
+func TestApplyGroups(t *testing.T) {
+	svc := func(port uint16) *Service {
+		return &Service{AddressFamily: syscall.AF_INET, Protocol: syscall.IPPROTO_TCP, Address: net.ParseIP("10.0.0.1"), Port: port}
+	}
+	dst := &Destination{Address: net.ParseIP("10.1.0.1"), Port: 80}
+	changes := []Event{
+		{Type: EventServiceAdded, Service: svc(80)},
+		{Type: EventDestinationAdded, Service: svc(80), Destination: dst},
+		{Type: EventServiceUpdated, Service: svc(443)},
+		{Type: EventDestinationUpdated, Service: svc(80), Destination: dst},
+		{Type: EventServiceDeleted, Service: svc(8080)},
+	}
+
+	phases := groupChanges(changes)
+	assert.Equal(t, len(phases[0]), 2)
+	assert.Equal(t, len(phases[0][0]), 3)
+	assert.Equal(t, phases[0][0][2].Type, EventDestinationUpdated)
+	assert.Equal(t, len(phases[1]), 1)
+
+	// Every worker makes changes, the ones of a service in order.
+	var mu sync.Mutex
+	var made []Event
+	apply := make([]func(Event) error, 3)
+	for n := range apply {
+		apply[n] = func(e Event) error {
+			mu.Lock()
+			defer mu.Unlock()
+			made = append(made, e)
+			return nil
+		}
+	}
+	report := &ReconcileReport{}
+	for _, groups := range phases {
+		assert.NilError(t, applyGroups(groups, apply, report))
+	}
+	assert.Equal(t, len(report.Changes), len(changes))
+	var ports []EventType
+	for _, e := range made {
+		if e.Service.Port == 80 {
+			ports = append(ports, e.Type)
+		}
+	}
+	assert.DeepEqual(t, ports, []EventType{EventServiceAdded, EventDestinationAdded, EventDestinationUpdated})
+	assert.Equal(t, made[len(made)-1].Type, EventServiceDeleted)
+
+	// The first error stops the workers.
+	failing := []func(Event) error{func(e Event) error {
+		if e.Type == EventServiceAdded {
+			return errors.New("new service failed")
+		}
+		return nil
+	}}
+	report = &ReconcileReport{}
+	assert.ErrorContains(t, applyGroups(phases[0], failing, report), "new service failed")
+	assert.Equal(t, len(report.Changes), 0)
+}
@@ -0,0 +1,125 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"syscall"
+	"time"
+
+	"github.com/kwanhur/ipvs/netlink"
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// ErrHandleClosed is returned when reconnecting a closed handle.
+var ErrHandleClosed = errors.New("ipvs handle is closed")
+
+// ReconnectPolicy configures how a handle recovers from the failures of its
+// netlink socket, e.g. a receive buffer overrun leaving it out of sync.
+type ReconnectPolicy struct {
+	// MaxAttempts is the number of attempts made to open a new socket
+	// after a failure. Reconnection is disabled if zero.
+	MaxAttempts int
+	// Backoff is the wait before the second attempt, doubled before each
+	// following one.
+	Backoff time.Duration
+}
+
+// WithReconnect makes the handle open a new socket when its socket fails,
+// following p. The failed request is sent again on the new socket if it
+// only reads the configuration, or if the retry policy allows it, see
+// WithRetry; other requests, which may have been applied, and dumps return
+// their error, and the handle keeps working for the next requests.
+//
+// The socket options set after the handle's creation, e.g. with
+// SetStrictCheck, are not restored on the new socket.
+func WithReconnect(p ReconnectPolicy) Option {
+	return func(o *options) {
+		o.reconnect = p
+	}
+}
+
+// socket returns the current socket of the handle.
+func (i *Handle) socket() *nl.NetlinkSocket {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	return i.sock
+}
+
+// Reconnect replaces the socket of the handle with a new one, opened in the
+// same namespace with the same options. Requests in flight on the previous
+// socket fail.
+func (i *Handle) Reconnect() error {
+	o := i.opts
+	if o == nil {
+		o = defaultOptions()
+	}
+	sock, err := openSocket(o)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	if i.closed {
+		i.mu.Unlock()
+		sock.Close()
+		return ErrHandleClosed
+	}
+	prev := i.sock
+	i.sock = sock
+	i.mu.Unlock()
+
+	if prev != nil {
+		prev.Close()
+	}
+	return nil
+}
+
+// reconnectOnError reconnects the handle if err is a failure of its socket
+// and reconnection is enabled, and reports whether it did.
+func (i *Handle) reconnectOnError(err error) bool {
+	if i.opts == nil || i.opts.reconnect.MaxAttempts <= 0 || !isSocketError(err) {
+		return false
+	}
+
+	p := i.opts.reconnect
+	backoff := p.Backoff
+	for n := 0; n < p.MaxAttempts; n++ {
+		if n > 0 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		rerr := i.Reconnect()
+		if rerr == nil {
+			logrus.Infof("Reconnected ipvs handle after socket failure: %v", err)
+			return true
+		}
+		if rerr == ErrHandleClosed {
+			return false
+		}
+		logrus.Warnf("Failed to reconnect ipvs handle: %v", rerr)
+	}
+	return false
+}
+
+// isSocketError reports whether err leaves the socket unusable, as opposed
+// to an error answered by the kernel.
+func isSocketError(err error) bool {
+	for _, errno := range []syscall.Errno{syscall.ENOBUFS, syscall.EBADF, syscall.ENOTSOCK, syscall.EPIPE, syscall.ECONNRESET} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
+
+// isReadCommand reports whether cmd only reads the configuration, and can be
+// sent again safely.
+func isReadCommand(cmd uint8) bool {
+	switch cmd {
+	case netlink.CmdGetService, netlink.CmdGetDest, netlink.CmdGetDaemon, netlink.CmdGetConfig, netlink.CmdGetInfo, netlink.CmdGetLaddr:
+		return true
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestReconnect(t *testing.T) {
+	i, err := NewWithOptions(WithRecvTimeout(time.Second), WithReconnect(ReconnectPolicy{MaxAttempts: 1}))
+	assert.NilError(t, err)
+
+	prev := i.socket()
+	assert.NilError(t, i.Reconnect())
+	assert.Assert(t, i.socket() != prev)
+	assert.Equal(t, prev.GetFd(), -1)
+
+	// The options are applied to the new socket.
+	tv, err := unix.GetsockoptTimeval(i.socket().GetFd(), unix.SOL_SOCKET, unix.SO_RCVTIMEO)
+	assert.NilError(t, err)
+	assert.Equal(t, tv.Sec, int64(1))
+
+	prev = i.socket()
+	assert.Assert(t, i.reconnectOnError(fmt.Errorf("dump: %w", syscall.ENOBUFS)))
+	assert.Assert(t, i.socket() != prev)
+	assert.Assert(t, !i.reconnectOnError(syscall.EEXIST))
+
+	i.Close()
+	assert.Equal(t, i.Reconnect(), ErrHandleClosed)
+	assert.Assert(t, !i.reconnectOnError(syscall.ENOBUFS))
+}
@@ -0,0 +1,130 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// Peer is a host the services of a Replicator are replicated to, e.g. the
+// standby director of an active/standby pair. The gRPC client of package
+// github.com/kwanhur/ipvs/replication is one.
+type Peer interface {
+	// Replicate converges the services of the peer to specs, with
+	// Reconcile.
+	Replicate(ctx context.Context, specs []*ServiceSpec) error
+}
+
+// PeerFunc adapts a function to the Peer interface.
+type PeerFunc func(ctx context.Context, specs []*ServiceSpec) error
+
+// Replicate calls f(ctx, specs).
+func (f PeerFunc) Replicate(ctx context.Context, specs []*ServiceSpec) error {
+	return f(ctx, specs)
+}
+
+// Replicator keeps the services of peers in sync with the ones of a
+// handler: every change published on Bus, e.g. the event bus of the handle,
+// is followed by the replication of all the services, their destinations
+// and local addresses, as Snapshot reads them, to every peer. Changes made
+// within Delay of each other are replicated together.
+//
+// Sync daemons and timeouts are not replicated, the ones of the master and
+// of the backup differing. Events missed because the subscription buffer
+// was full, and replications which failed, are caught up by the periodic
+// replication every Interval.
+type Replicator struct {
+	Handler Handler
+	Bus     *EventBus
+	Peers   []Peer
+
+	// Delay is the time waited after a change for the next ones, 100ms
+	// if zero.
+	Delay time.Duration
+	// Interval is the interval of the periodic replications, disabled if
+	// zero.
+	Interval time.Duration
+
+	// OnError, if set, is called with the error of every failed
+	// replication, which are logged otherwise.
+	OnError func(p Peer, err error)
+}
+
+// defaultReplicationDelay is the default Replicator.Delay.
+const defaultReplicationDelay = 100 * time.Millisecond
+
+// Run replicates until ctx is done, starting with a replication.
+func (r *Replicator) Run(ctx context.Context) error {
+	events, cancel := r.Bus.Subscribe(64)
+	defer cancel()
+
+	var tick <-chan time.Time
+	if r.Interval > 0 {
+		ticker := time.NewTicker(r.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+	delay := r.Delay
+	if delay <= 0 {
+		delay = defaultReplicationDelay
+	}
+	debounce := time.NewTimer(delay)
+	debounce.Stop()
+	defer debounce.Stop()
+	var pending <-chan time.Time
+
+	r.replicate(ctx)
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case e := <-events:
+			if !replicated(e.Type) {
+				continue
+			}
+			if pending == nil {
+				debounce.Reset(delay)
+				pending = debounce.C
+			}
+		case <-pending:
+			pending = nil
+			r.replicate(ctx)
+		case <-tick:
+			r.replicate(ctx)
+		}
+	}
+}
+
+// replicated reports whether events of type t change the services.
+func replicated(t EventType) bool {
+	switch t {
+	case EventDaemonAdded, EventDaemonDeleted, EventConfigUpdated, EventZeroed, EventAnomaly, EventAlert:
+		return false
+	}
+	return true
+}
+
+// replicate sends the services of the handler to every peer.
+func (r *Replicator) replicate(ctx context.Context) {
+	specs, err := currentSpecs(r.Handler, nil)
+	if err != nil {
+		r.fail(nil, err)
+		return
+	}
+	for _, p := range r.Peers {
+		if err := p.Replicate(ctx, specs); err != nil && ctx.Err() == nil {
+			r.fail(p, err)
+		}
+	}
+}
+
+func (r *Replicator) fail(p Peer, err error) {
+	if r.OnError != nil {
+		r.OnError(p, err)
+	} else {
+		logrus.Warnf("Failed to replicate ipvs services: %v", err)
+	}
+}
@@ -0,0 +1,62 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestReplicator(t *testing.T) {
+	svc := &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	f := &fakeHandler{
+		services:     []*Service{svc},
+		destinations: []*Destination{{Address: net.ParseIP("10.1.0.1"), Port: 80}},
+	}
+	bus := NewEventBus()
+
+	replicas := make(chan []*ServiceSpec, 10)
+	failures := make(chan error, 10)
+	r := &Replicator{
+		Handler: f,
+		Bus:     bus,
+		Peers: []Peer{
+			PeerFunc(func(ctx context.Context, specs []*ServiceSpec) error {
+				replicas <- specs
+				return nil
+			}),
+			PeerFunc(func(ctx context.Context, specs []*ServiceSpec) error {
+				return errors.New("peer down")
+			}),
+		},
+		Delay:   time.Millisecond,
+		OnError: func(p Peer, err error) { failures <- err },
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- r.Run(ctx) }()
+
+	specs := <-replicas
+	assert.Equal(t, len(specs), 1)
+	assert.Equal(t, specs[0].Service, svc)
+	assert.Equal(t, len(specs[0].Destinations), 1)
+	assert.ErrorContains(t, <-failures, "peer down")
+
+	// Wait for the subscription.
+	for len(replicas) == 0 {
+		bus.Publish(Event{Type: EventAlert})
+		bus.Publish(Event{Type: EventDestinationDeleted, Service: svc})
+		time.Sleep(10 * time.Millisecond)
+	}
+	specs = <-replicas
+	assert.Equal(t, len(specs), 1)
+
+	cancel()
+	assert.Equal(t, <-done, context.Canceled)
+}
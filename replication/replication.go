@@ -0,0 +1,136 @@
+// +build linux
+
+// Package replication replicates the services of a director to its peers
+// over gRPC: a Peer is the client side of an ipvs.Replicator, a Server
+// programs the services it receives with Reconcile.
+//
+// The ipvs.v1.Replication service has a single client streaming method,
+// Replicate, streaming every ipvspb.ServiceSpec of the director and
+// answering google.protobuf.Empty once the peer converged.
+//
+// It is a separate module so that the ipvs package does not depend on
+// gRPC.
+package replication
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/kwanhur/ipvs/ipvspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+)
+
+// replicateMethod is the full name of the Replicate method.
+const replicateMethod = "/ipvs.v1.Replication/Replicate"
+
+// Reconciler converges the services of a host, like ipvs.Handle does.
+type Reconciler interface {
+	Reconcile(desired []*ipvs.ServiceSpec) (*ipvs.ReconcileReport, error)
+}
+
+// Server is the server of the ipvs.v1.Replication service.
+type Server struct {
+	r Reconciler
+
+	// OnReplicate, if set, is called with the changes made by every
+	// replication, and its error.
+	OnReplicate func(report *ipvs.ReconcileReport, err error)
+}
+
+// NewServer returns a server converging the services of r to the ones
+// replicated.
+func NewServer(r Reconciler) *Server {
+	return &Server{r: r}
+}
+
+// Register registers srv on s.
+func Register(s *grpc.Server, srv *Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// replicationServer is the interface of the implementations of the
+// service, checked by grpc.Server.RegisterService.
+type replicationServer interface {
+	replicate(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "ipvs.v1.Replication",
+	HandlerType: (*replicationServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Replicate",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(replicationServer).replicate(stream)
+		},
+		ClientStreams: true,
+	}},
+	Metadata: "ipvs.proto",
+}
+
+func (srv *Server) replicate(stream grpc.ServerStream) error {
+	var specs []*ipvs.ServiceSpec
+	for {
+		m := new(ipvspb.ServiceSpec)
+		err := stream.RecvMsg(m)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		specs = append(specs, ipvspb.ToServiceSpec(m))
+	}
+
+	report, err := srv.r.Reconcile(specs)
+	if srv.OnReplicate != nil {
+		srv.OnReplicate(report, err)
+	}
+	if errors.Is(err, ipvs.ErrNotPermitted) {
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	if err != nil {
+		return status.Error(codes.Internal, err.Error())
+	}
+	return stream.SendMsg(&emptypb.Empty{})
+}
+
+// Peer replicates services to the server of a connection.
+type Peer struct {
+	cc grpc.ClientConnInterface
+}
+
+var _ ipvs.Peer = (*Peer)(nil)
+
+// NewPeer returns the peer served on cc.
+func NewPeer(cc grpc.ClientConnInterface) *Peer {
+	return &Peer{cc: cc}
+}
+
+// Replicate implements ipvs.Peer.
+func (p *Peer) Replicate(ctx context.Context, specs []*ipvs.ServiceSpec) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	stream, err := p.cc.NewStream(ctx, &serviceDesc.Streams[0], replicateMethod)
+	if err != nil {
+		return err
+	}
+	for _, spec := range specs {
+		if err := stream.SendMsg(ipvspb.FromServiceSpec(spec)); err != nil {
+			// The error of the stream is the one of RecvMsg.
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+	return stream.RecvMsg(&emptypb.Empty{})
+}
@@ -0,0 +1,71 @@
+// +build linux
+
+package replication
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"gotest.tools/v3/assert"
+)
+
+type fakeReconciler struct {
+	desired []*ipvs.ServiceSpec
+	err     error
+}
+
+func (r *fakeReconciler) Reconcile(desired []*ipvs.ServiceSpec) (*ipvs.ReconcileReport, error) {
+	r.desired = desired
+	return &ipvs.ReconcileReport{}, r.err
+}
+
+func TestReplicate(t *testing.T) {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	r := &fakeReconciler{}
+	Register(s, NewServer(r))
+	go s.Serve(lis)
+	defer s.Stop()
+
+	cc, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	defer cc.Close()
+	p := NewPeer(cc)
+
+	specs := []*ipvs.ServiceSpec{
+		{
+			Service:      &ipvs.Service{Protocol: ipvs.ProtocolTCP, Address: net.ParseIP("10.0.0.1").To4(), Port: 80, SchedName: ipvs.RoundRobin},
+			Destinations: []*ipvs.Destination{{Address: net.ParseIP("10.1.0.1").To4(), Port: 8080, Weight: 1}},
+		},
+		{Service: &ipvs.Service{FWMark: 7, SchedName: ipvs.WeightedLeastConnection}},
+	}
+	assert.NilError(t, p.Replicate(context.Background(), specs))
+	assert.Equal(t, len(r.desired), 2)
+	assert.Equal(t, r.desired[0].Service.Port, uint16(80))
+	assert.Equal(t, r.desired[0].Destinations[0].Address.String(), "10.1.0.1")
+	assert.Equal(t, r.desired[1].Service.FWMark, uint32(7))
+
+	// Everything is replicated, services deleted included.
+	assert.NilError(t, p.Replicate(context.Background(), nil))
+	assert.Equal(t, len(r.desired), 0)
+
+	r.err = errors.New("reconcile failed")
+	err = p.Replicate(context.Background(), specs)
+	assert.Equal(t, status.Code(err), codes.Internal)
+	assert.ErrorContains(t, err, "reconcile failed")
+
+	r.err = fmt.Errorf("policy tenant: %w", ipvs.ErrNotPermitted)
+	err = p.Replicate(context.Background(), specs)
+	assert.Equal(t, status.Code(err), codes.PermissionDenied)
+}
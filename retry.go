@@ -0,0 +1,96 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"math/rand"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/kwanhur/ipvs/netlink"
+	"github.com/vishvananda/netlink/nl"
+)
+
+// RetryPolicy configures how the requests of a handle failing with a
+// transient error, EINTR, EAGAIN, ENOBUFS or an interrupted dump, are sent
+// again.
+type RetryPolicy struct {
+	// MaxAttempts is the number of times a request is sent at most,
+	// retries are disabled if it is lower than two.
+	MaxAttempts int
+	// Backoff is the wait before the first retry, doubled before each
+	// following one up to MaxBackoff if set.
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Jitter adds a random fraction, up to Jitter, of the wait to it so
+	// that handles failing together do not retry together.
+	Jitter float64
+}
+
+// delay returns the wait before the retry following attempt, counted from
+// one.
+func (p *RetryPolicy) delay(attempt int) time.Duration {
+	d := p.Backoff
+	for n := 1; n < attempt; n++ {
+		d *= 2
+		if p.MaxBackoff > 0 && d >= p.MaxBackoff {
+			d = p.MaxBackoff
+			break
+		}
+	}
+	if p.Jitter > 0 {
+		d += time.Duration(rand.Float64() * p.Jitter * float64(d))
+	}
+	return d
+}
+
+// WithRetry makes the handle send again the requests failing with a
+// transient error, following p. A mutation whose answer was lost, e.g. to
+// ENOBUFS, may have been applied and fail when sent again, with EEXIST for
+// instance. Dumps, e.g. GetServices, are sent again as a whole, including
+// the ones the kernel interrupted because the configuration changed. The dumps
+// of the Services and Destinations iterators are not retried, their answers
+// having been yielded already.
+func WithRetry(p RetryPolicy) Option {
+	return func(o *options) {
+		o.retry = p
+	}
+}
+
+// isTransientError reports whether err may not happen again if the request
+// is sent again.
+func isTransientError(err error) bool {
+	return errors.Is(err, syscall.EINTR) || errors.Is(err, syscall.EAGAIN) || errors.Is(err, syscall.ENOBUFS) ||
+		errors.Is(err, netlink.ErrDumpInterrupted)
+}
+
+// execute sends req on the handle's socket and returns its answers. Failed
+// requests are sent again as configured by the retry policy, or once after
+// the socket was reconnected for reads, see WithReconnect.
+func (i *Handle) execute(cmd uint8, req *nl.NetlinkRequest) ([][]byte, error) {
+	var retry RetryPolicy
+	if i.opts != nil {
+		retry = i.opts.retry
+	}
+
+	i.reqMu.Lock()
+	defer i.reqMu.Unlock()
+
+	res, err := netlink.Execute(i.socket(), req, 0)
+	for attempt := 1; err != nil; attempt++ {
+		reconnected := i.reconnectOnError(err)
+		transient := isTransientError(err) && attempt < retry.MaxAttempts
+		if !transient && !(reconnected && attempt == 1 && isReadCommand(cmd)) {
+			break
+		}
+		if transient {
+			time.Sleep(retry.delay(attempt))
+		}
+
+		req.Seq = atomic.AddUint32(&i.seq, 1)
+		res, err = netlink.Execute(i.socket(), req, 0)
+	}
+	return res, wrapCommandError(cmd, wrapBufferOverrun(cmd, err))
+}
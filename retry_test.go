@@ -0,0 +1,53 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs/netlink"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	p := RetryPolicy{Backoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond}
+	for attempt, expected := range map[int]time.Duration{
+		1: 10 * time.Millisecond,
+		2: 20 * time.Millisecond,
+		3: 40 * time.Millisecond,
+		4: 50 * time.Millisecond,
+		9: 50 * time.Millisecond,
+	} {
+		if d := p.delay(attempt); d != expected {
+			t.Errorf("attempt %d: expected %v, got %v", attempt, expected, d)
+		}
+	}
+
+	p.Jitter = 0.5
+	for n := 0; n < 100; n++ {
+		if d := p.delay(1); d < 10*time.Millisecond || d > 15*time.Millisecond {
+			t.Fatalf("jittered delay %v out of range", d)
+		}
+	}
+}
+
+func TestIsTransientError(t *testing.T) {
+	testcases := []struct {
+		err      error
+		expected bool
+	}{
+		{syscall.EINTR, true},
+		{syscall.EAGAIN, true},
+		{fmt.Errorf("receive: %w", syscall.ENOBUFS), true},
+		{netlink.ErrDumpInterrupted, true},
+		{syscall.EEXIST, false},
+		{fmt.Errorf("Socket got closed on receive"), false},
+	}
+	for _, tc := range testcases {
+		if got := isTransientError(tc.err); got != tc.expected {
+			t.Errorf("%v: expected %v, got %v", tc.err, tc.expected, got)
+		}
+	}
+}
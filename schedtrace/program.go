@@ -0,0 +1,207 @@
+// +build linux,ipvsbpf
+
+package schedtrace
+
+import (
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+)
+
+// The programs are assembled at run time, with the offsets of the fields of
+// struct ip_vs_service read from the BTF of the running kernel, so that
+// neither a BPF compiler nor objects built for every kernel are needed.
+//
+// The kprobe saves, by thread, the time ip_vs_schedule was called, the
+// pointer to its ignored argument and the key of the service in the starts
+// map, as a start. The kretprobe looks the start up and adds the latency
+// and the outcome of the call to the per CPU stats of the service.
+
+// key is the key of the stats map, filled from struct ip_vs_service.
+type key struct {
+	Family   uint16
+	Protocol uint16
+	Port     [2]byte // network byte order
+	_        uint16
+	FWMark   uint32
+	_        uint32
+	Address  [16]byte
+}
+
+// keySize is the size of a key.
+const keySize = 32
+
+// start is the value of the starts map.
+type start struct {
+	Time    uint64
+	Ignored uint64
+	Key     key
+}
+
+// startSize is the size of a start.
+const startSize = 16 + keySize
+
+// value is the value of the stats map, with the same fields as Stats.
+type value struct {
+	Latency       uint64
+	MaxLatency    uint64
+	Scheduled     uint64
+	NoDestination uint64
+	Ignored       uint64
+	Dropped       uint64
+}
+
+// Offsets of the fields of value.
+const (
+	valueSize          = 48
+	offLatency         = 0
+	offMaxLatency      = 8
+	offScheduled       = 16
+	offNoDestination   = 24
+	offIgnored         = 32
+	offDropped         = 40
+	bpfAny, bpfNoExist = 0, 1
+)
+
+// serviceOffsets are the offsets of the fields of struct ip_vs_service.
+type serviceOffsets struct {
+	family, protocol, address, port, fwmark int16
+}
+
+// regs are the offsets in struct pt_regs of the svc and ignored arguments
+// of ip_vs_schedule, and of its return value.
+type regs struct {
+	svc, ignored, ret int16
+}
+
+// entryProgram returns the kprobe saving the starts.
+func entryProgram(starts *ebpf.Map, svc serviceOffsets, r regs) asm.Instructions {
+	// The start is at fp-48 and the thread at fp-56.
+	insns := asm.Instructions{asm.Mov.Reg(asm.R6, asm.R1)}
+	for off := int16(-startSize); off < 0; off += 8 {
+		insns = append(insns, asm.StoreImm(asm.RFP, off, 0, asm.DWord))
+	}
+	insns = append(insns,
+		asm.FnKtimeGetNs.Call(),
+		asm.StoreMem(asm.RFP, -48, asm.R0, asm.DWord),
+		asm.LoadMem(asm.R1, asm.R6, r.ignored, asm.DWord),
+		asm.StoreMem(asm.RFP, -40, asm.R1, asm.DWord),
+		asm.LoadMem(asm.R7, asm.R6, r.svc, asm.DWord),
+	)
+	for _, f := range []struct{ dst, size, off int16 }{
+		{-32, 2, svc.family},
+		{-30, 2, svc.protocol},
+		{-28, 2, svc.port},
+		{-24, 4, svc.fwmark},
+		{-16, 16, svc.address},
+	} {
+		insns = append(insns,
+			asm.Mov.Reg(asm.R1, asm.RFP),
+			asm.Add.Imm(asm.R1, int32(f.dst)),
+			asm.Mov.Imm(asm.R2, int32(f.size)),
+			asm.Mov.Reg(asm.R3, asm.R7),
+			asm.Add.Imm(asm.R3, int32(f.off)),
+			asm.FnProbeReadKernel.Call(),
+		)
+	}
+	return append(insns,
+		asm.FnGetCurrentPidTgid.Call(),
+		asm.StoreMem(asm.RFP, -56, asm.R0, asm.DWord),
+		asm.LoadMapPtr(asm.R1, starts.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -56),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -48),
+		asm.Mov.Imm(asm.R4, bpfAny),
+		asm.FnMapUpdateElem.Call(),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	)
+}
+
+// returnProgram returns the kretprobe counting the calls.
+func returnProgram(starts, stats *ebpf.Map, r regs) asm.Instructions {
+	// The thread is at fp-8, the ignored argument at fp-16, the return
+	// value at fp-24 and a zero value at fp-72. r6 is the context, r7 the
+	// start, r8 the latency and r9 the ignored argument.
+	insns := asm.Instructions{
+		asm.Mov.Reg(asm.R6, asm.R1),
+		asm.FnGetCurrentPidTgid.Call(),
+		asm.StoreMem(asm.RFP, -8, asm.R0, asm.DWord),
+		asm.LoadMapPtr(asm.R1, starts.FD()),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "exit"),
+		asm.Mov.Reg(asm.R7, asm.R0),
+
+		asm.FnKtimeGetNs.Call(),
+		asm.Mov.Reg(asm.R8, asm.R0),
+		asm.LoadMem(asm.R1, asm.R7, 0, asm.DWord),
+		asm.Sub.Reg(asm.R8, asm.R1),
+
+		asm.StoreImm(asm.RFP, -16, 0, asm.DWord),
+		asm.Mov.Reg(asm.R1, asm.RFP),
+		asm.Add.Imm(asm.R1, -16),
+		asm.Mov.Imm(asm.R2, 4),
+		asm.LoadMem(asm.R3, asm.R7, 8, asm.DWord),
+		asm.FnProbeReadKernel.Call(),
+		asm.LoadMem(asm.R9, asm.RFP, -16, asm.Word),
+		asm.LoadMem(asm.R1, asm.R6, r.ret, asm.DWord),
+		asm.StoreMem(asm.RFP, -24, asm.R1, asm.DWord),
+
+		asm.LoadMapPtr(asm.R1, stats.FD()),
+		asm.Mov.Reg(asm.R2, asm.R7),
+		asm.Add.Imm(asm.R2, 16),
+		asm.FnMapLookupElem.Call(),
+		asm.JNE.Imm(asm.R0, 0, "update"),
+	}
+	for off := int16(-72); off < -24; off += 8 {
+		insns = append(insns, asm.StoreImm(asm.RFP, off, 0, asm.DWord))
+	}
+	return append(insns,
+		asm.LoadMapPtr(asm.R1, stats.FD()),
+		asm.Mov.Reg(asm.R2, asm.R7),
+		asm.Add.Imm(asm.R2, 16),
+		asm.Mov.Reg(asm.R3, asm.RFP),
+		asm.Add.Imm(asm.R3, -72),
+		asm.Mov.Imm(asm.R4, bpfNoExist),
+		asm.FnMapUpdateElem.Call(),
+		asm.LoadMapPtr(asm.R1, stats.FD()),
+		asm.Mov.Reg(asm.R2, asm.R7),
+		asm.Add.Imm(asm.R2, 16),
+		asm.FnMapLookupElem.Call(),
+		asm.JEq.Imm(asm.R0, 0, "delete"),
+
+		// The value is per CPU and the probes do not migrate: no atomic
+		// operations are needed.
+		asm.LoadMem(asm.R1, asm.R0, offLatency, asm.DWord).WithSymbol("update"),
+		asm.Add.Reg(asm.R1, asm.R8),
+		asm.StoreMem(asm.R0, offLatency, asm.R1, asm.DWord),
+		asm.LoadMem(asm.R1, asm.R0, offMaxLatency, asm.DWord),
+		asm.JGE.Reg(asm.R1, asm.R8, "outcome"),
+		asm.StoreMem(asm.R0, offMaxLatency, asm.R8, asm.DWord),
+
+		// A connection was returned, or ignored tells why not: 0 if no
+		// destination was found, 1 if the packet is left to the stack and
+		// -1 if it is dropped.
+		asm.LoadMem(asm.R1, asm.RFP, -24, asm.DWord).WithSymbol("outcome"),
+		asm.Mov.Imm(asm.R2, offScheduled),
+		asm.JNE.Imm(asm.R1, 0, "count"),
+		asm.Mov.Imm(asm.R2, offNoDestination),
+		asm.JEq.Imm(asm.R9, 0, "count"),
+		asm.Mov.Imm(asm.R2, offIgnored),
+		asm.JEq.Imm(asm.R9, 1, "count"),
+		asm.Mov.Imm(asm.R2, offDropped),
+		asm.Add.Reg(asm.R0, asm.R2).WithSymbol("count"),
+		asm.LoadMem(asm.R1, asm.R0, 0, asm.DWord),
+		asm.Add.Imm(asm.R1, 1),
+		asm.StoreMem(asm.R0, 0, asm.R1, asm.DWord),
+
+		asm.LoadMapPtr(asm.R1, starts.FD()).WithSymbol("delete"),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.FnMapDeleteElem.Call(),
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"),
+		asm.Return(),
+	)
+}
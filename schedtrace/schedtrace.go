@@ -0,0 +1,69 @@
+// +build linux
+
+// Package schedtrace measures how IPVS schedules new connections with eBPF,
+// which the counters of the kernel do not tell: a Tracer attaches a kprobe
+// and a kretprobe to ip_vs_schedule, and counts for every service the time
+// spent choosing a destination and why packets were not scheduled.
+//
+// Tracing requires the ipvsbpf build tag, Linux 5.11 or later, for the BTF
+// of the ip_vs module, and CAP_BPF and CAP_PERFMON, or CAP_SYS_ADMIN.
+// Without the build tag, New returns ErrNotSupported, so that programs can
+// build the package everywhere and trace where it is supported.
+//
+// It is a separate module so that the ipvs package does not depend on an
+// eBPF library.
+package schedtrace
+
+import (
+	"errors"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+)
+
+// ErrNotSupported is returned by New when the package was built without
+// the ipvsbpf build tag, or for an architecture it does not support.
+var ErrNotSupported = errors.New("ip_vs scheduling tracing not supported")
+
+// Stats are the scheduling statistics of a service since the tracer was
+// created.
+type Stats struct {
+	// Service identifies the service, only its address family, protocol,
+	// address, port and firewall mark being set.
+	Service *ipvs.Service
+
+	// Scheduled is the number of packets for which a connection was
+	// created.
+	Scheduled uint64
+	// NoDestination is the number of packets which were not scheduled
+	// because the scheduler found no available destination, which the
+	// kernel then answers with an ICMP error, or forwards unchanged if the
+	// cache_bypass sysctl is set.
+	NoDestination uint64
+	// Ignored is the number of packets which the kernel did not schedule
+	// and passed to the local stack, e.g. the replies of local
+	// destinations.
+	Ignored uint64
+	// Dropped is the number of packets which were dropped because the
+	// connection, or its persistence template, could not be allocated.
+	Dropped uint64
+
+	// Latency is the total time spent scheduling the packets, and
+	// MaxLatency the longest.
+	Latency    time.Duration
+	MaxLatency time.Duration
+}
+
+// Calls returns the number of packets the kernel tried to schedule.
+func (s *Stats) Calls() uint64 {
+	return s.Scheduled + s.NoDestination + s.Ignored + s.Dropped
+}
+
+// MeanLatency returns the mean time spent scheduling a packet.
+func (s *Stats) MeanLatency() time.Duration {
+	calls := s.Calls()
+	if calls == 0 {
+		return 0
+	}
+	return s.Latency / time.Duration(calls)
+}
@@ -0,0 +1,292 @@
+// +build linux,ipvsbpf
+
+package schedtrace
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/link"
+	"github.com/cilium/ebpf/rlimit"
+	"github.com/kwanhur/ipvs"
+)
+
+// MaxServices bounds the number of services traced, further services not
+// being counted.
+const MaxServices = 4096
+
+// maxThreads bounds the number of threads scheduling at the same time.
+const maxThreads = 16384
+
+// scheduleSymbol is the traced kernel function.
+const scheduleSymbol = "ip_vs_schedule"
+
+// archRegs are the pt_regs offsets of the supported architectures.
+var archRegs = map[string]regs{
+	// di, cx and ax.
+	"amd64": {svc: 112, ignored: 88, ret: 80},
+	// regs[0], regs[3] and regs[0].
+	"arm64": {svc: 0, ignored: 24, ret: 0},
+}
+
+// Capabilities, see capability.h.
+const (
+	capSysAdmin = 21
+	capPerfmon  = 38
+	capBPF      = 39
+)
+
+// Tracer traces the scheduling of the connections of every service.
+type Tracer struct {
+	starts, stats *ebpf.Map
+	entry, ret    *ebpf.Program
+	links         []link.Link
+}
+
+// New attaches a tracer to the kernel. The ip_vs module must be loaded.
+func New() (*Tracer, error) {
+	r, ok := archRegs[runtime.GOARCH]
+	if !ok {
+		return nil, fmt.Errorf("%w on %s", ErrNotSupported, runtime.GOARCH)
+	}
+	if err := checkCapabilities("/proc/self/status"); err != nil {
+		return nil, err
+	}
+	svc, err := loadServiceOffsets()
+	if err != nil {
+		return nil, err
+	}
+	if err := rlimit.RemoveMemlock(); err != nil {
+		return nil, err
+	}
+
+	t := new(Tracer)
+	if err := t.load(svc, r); err != nil {
+		t.Close()
+		return nil, err
+	}
+	entry, err := link.Kprobe(scheduleSymbol, t.entry, nil)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.links = append(t.links, entry)
+	ret, err := link.Kretprobe(scheduleSymbol, t.ret, nil)
+	if err != nil {
+		t.Close()
+		return nil, err
+	}
+	t.links = append(t.links, ret)
+	return t, nil
+}
+
+// load creates the maps and loads the programs.
+func (t *Tracer) load(svc serviceOffsets, r regs) error {
+	var err error
+	t.starts, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "ipvs_starts",
+		Type:       ebpf.Hash,
+		KeySize:    8,
+		ValueSize:  startSize,
+		MaxEntries: maxThreads,
+	})
+	if err != nil {
+		return err
+	}
+	t.stats, err = ebpf.NewMap(&ebpf.MapSpec{
+		Name:       "ipvs_sched",
+		Type:       ebpf.PerCPUHash,
+		KeySize:    keySize,
+		ValueSize:  valueSize,
+		MaxEntries: MaxServices,
+	})
+	if err != nil {
+		return err
+	}
+	t.entry, err = ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "ipvs_sched_in",
+		Type:         ebpf.Kprobe,
+		Instructions: entryProgram(t.starts, svc, r),
+		License:      "GPL",
+	})
+	if err != nil {
+		return err
+	}
+	t.ret, err = ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:         "ipvs_sched_out",
+		Type:         ebpf.Kprobe,
+		Instructions: returnProgram(t.starts, t.stats, r),
+		License:      "GPL",
+	})
+	return err
+}
+
+// Stats returns the statistics of the services scheduled since the tracer
+// was created.
+func (t *Tracer) Stats() ([]*Stats, error) {
+	var (
+		k      key
+		values []value
+		res    []*Stats
+	)
+	iter := t.stats.Iterate()
+	for iter.Next(&k, &values) {
+		res = append(res, newStats(k, values))
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// newStats sums the values of every CPU.
+func newStats(k key, values []value) *Stats {
+	st := &Stats{Service: k.service()}
+	for _, v := range values {
+		st.Scheduled += v.Scheduled
+		st.NoDestination += v.NoDestination
+		st.Ignored += v.Ignored
+		st.Dropped += v.Dropped
+		st.Latency += time.Duration(v.Latency)
+		if max := time.Duration(v.MaxLatency); max > st.MaxLatency {
+			st.MaxLatency = max
+		}
+	}
+	return st
+}
+
+// service returns the service identified by k.
+func (k *key) service() *ipvs.Service {
+	s := &ipvs.Service{
+		AddressFamily: k.Family,
+		Protocol:      ipvs.IPProto(k.Protocol),
+		Port:          binary.BigEndian.Uint16(k.Port[:]),
+		FWMark:        k.FWMark,
+	}
+	if s.FWMark > 0 {
+		return s
+	}
+	if k.Family == syscall.AF_INET {
+		s.Address = net.IP(append([]byte(nil), k.Address[:net.IPv4len]...))
+	} else {
+		s.Address = net.IP(append([]byte(nil), k.Address[:]...))
+	}
+	return s
+}
+
+// Close detaches the tracer.
+func (t *Tracer) Close() error {
+	var errs []string
+	for _, l := range t.links {
+		if err := l.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	// Close is a no-op on the nil programs and maps of a failed New.
+	for _, c := range []interface{ Close() error }{t.entry, t.ret, t.starts, t.stats} {
+		if err := c.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if len(errs) > 0 {
+		return errors.New(strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+// checkCapabilities checks that the effective capabilities listed in the
+// status file allow loading and attaching kprobes.
+func checkCapabilities(status string) error {
+	f, err := os.Open(status)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		v := strings.TrimPrefix(sc.Text(), "CapEff:")
+		if v == sc.Text() {
+			continue
+		}
+		caps, err := strconv.ParseUint(strings.TrimSpace(v), 16, 64)
+		if err != nil {
+			return fmt.Errorf("invalid effective capabilities %q: %v", v, err)
+		}
+		has := func(c uint) bool { return caps&(1<<c) != 0 }
+		if has(capSysAdmin) || has(capBPF) && has(capPerfmon) {
+			return nil
+		}
+		return fmt.Errorf("%w: CAP_BPF and CAP_PERFMON, or CAP_SYS_ADMIN, are required", os.ErrPermission)
+	}
+	if err := sc.Err(); err != nil {
+		return err
+	}
+	return fmt.Errorf("no effective capabilities in %s", status)
+}
+
+// loadServiceOffsets reads the offsets of the fields of struct
+// ip_vs_service from the BTF of the ip_vs module.
+func loadServiceOffsets() (serviceOffsets, error) {
+	base, err := btf.LoadKernelSpec()
+	if err != nil {
+		return serviceOffsets{}, err
+	}
+	f, err := os.Open("/sys/kernel/btf/ip_vs")
+	if err != nil {
+		return serviceOffsets{}, fmt.Errorf("%v (is the ip_vs module loaded?)", err)
+	}
+	defer f.Close()
+	spec, err := btf.LoadSplitSpecFromReader(f, base)
+	if err != nil {
+		return serviceOffsets{}, err
+	}
+	var svc *btf.Struct
+	if err := spec.TypeByName("ip_vs_service", &svc); err != nil {
+		return serviceOffsets{}, err
+	}
+	return serviceOffsetsOf(svc)
+}
+
+// serviceOffsetsOf returns the offsets of the fields of svc.
+func serviceOffsetsOf(svc *btf.Struct) (serviceOffsets, error) {
+	var o serviceOffsets
+	for _, f := range []struct {
+		name string
+		off  *int16
+	}{
+		{"af", &o.family},
+		{"protocol", &o.protocol},
+		{"addr", &o.address},
+		{"port", &o.port},
+		{"fwmark", &o.fwmark},
+	} {
+		found := false
+		for _, m := range svc.Members {
+			if m.Name != f.name {
+				continue
+			}
+			if m.BitfieldSize > 0 || m.Offset%8 != 0 {
+				return o, fmt.Errorf("ip_vs_service.%s is a bit field", f.name)
+			}
+			*f.off = int16(m.Offset / 8)
+			found = true
+			break
+		}
+		if !found {
+			return o, fmt.Errorf("ip_vs_service.%s not found", f.name)
+		}
+	}
+	return o, nil
+}
@@ -0,0 +1,22 @@
+// +build linux,!ipvsbpf
+
+package schedtrace
+
+// Tracer traces the scheduling of the connections of every service.
+type Tracer struct{}
+
+// New returns ErrNotSupported, the package being built without the ipvsbpf
+// build tag.
+func New() (*Tracer, error) {
+	return nil, ErrNotSupported
+}
+
+// Stats returns ErrNotSupported.
+func (t *Tracer) Stats() ([]*Stats, error) {
+	return nil, ErrNotSupported
+}
+
+// Close does nothing.
+func (t *Tracer) Close() error {
+	return nil
+}
@@ -0,0 +1,130 @@
+// +build linux,ipvsbpf
+
+package schedtrace
+
+import (
+	"encoding/binary"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/rlimit"
+	"gotest.tools/v3/assert"
+)
+
+func TestLayout(t *testing.T) {
+	assert.Equal(t, binary.Size(key{}), keySize)
+	assert.Equal(t, binary.Size(start{}), startSize)
+	assert.Equal(t, binary.Size(value{}), valueSize)
+}
+
+func TestServiceOffsets(t *testing.T) {
+	// The head of struct ip_vs_service.
+	svc := &btf.Struct{
+		Name: "ip_vs_service",
+		Members: []btf.Member{
+			{Name: "s_list", Offset: 0},
+			{Name: "f_list", Offset: 128},
+			{Name: "refcnt", Offset: 256},
+			{Name: "af", Offset: 288},
+			{Name: "protocol", Offset: 304},
+			{Name: "addr", Offset: 320},
+			{Name: "port", Offset: 448},
+			{Name: "fwmark", Offset: 480},
+		},
+	}
+	o, err := serviceOffsetsOf(svc)
+	assert.NilError(t, err)
+	assert.Equal(t, o, serviceOffsets{family: 36, protocol: 38, address: 40, port: 56, fwmark: 60})
+
+	svc.Members = svc.Members[:len(svc.Members)-1]
+	_, err = serviceOffsetsOf(svc)
+	assert.ErrorContains(t, err, "ip_vs_service.fwmark not found")
+}
+
+func TestKeyService(t *testing.T) {
+	k := key{Family: 2, Protocol: 6, Port: [2]byte{0x1f, 0x90}}
+	copy(k.Address[:], []byte{10, 0, 0, 1})
+	s := k.service()
+	assert.Equal(t, s.Address.String(), "10.0.0.1")
+	assert.Equal(t, s.Port, uint16(8080))
+
+	k = key{Family: 10, Protocol: 17, Port: [2]byte{0, 53}}
+	k.Address[15] = 1
+	s = k.service()
+	assert.Equal(t, s.Address.String(), "::1")
+	assert.Equal(t, s.Port, uint16(53))
+
+	k = key{Family: 2, FWMark: 7}
+	s = k.service()
+	assert.Equal(t, s.FWMark, uint32(7))
+	assert.Assert(t, s.Address == nil)
+}
+
+func TestNewStats(t *testing.T) {
+	st := newStats(key{Family: 2}, []value{
+		{Latency: 3000, MaxLatency: 2000, Scheduled: 2},
+		{Latency: 1000, MaxLatency: 1000, NoDestination: 1, Dropped: 1},
+	})
+	assert.Equal(t, st.Calls(), uint64(4))
+	assert.Equal(t, st.Latency, 4*time.Microsecond)
+	assert.Equal(t, st.MaxLatency, 2*time.Microsecond)
+	assert.Equal(t, st.MeanLatency(), time.Microsecond)
+}
+
+func TestCheckCapabilities(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schedtrace")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		caps string
+		err  string
+	}{
+		{"000001ffffffffff", ""},
+		{"0000000000200000", ""},
+		{"000000c000000000", ""},
+		{"0000004000000000", "permission denied"},
+		{"zz", "invalid effective capabilities"},
+	} {
+		status := filepath.Join(dir, "status")
+		assert.NilError(t, ioutil.WriteFile(status, []byte("Name:\ttest\nCapEff:\t"+tc.caps+"\n"), 0644))
+		err := checkCapabilities(status)
+		if tc.err == "" {
+			assert.NilError(t, err, tc.caps)
+		} else {
+			assert.ErrorContains(t, err, tc.err, tc.caps)
+		}
+	}
+}
+
+// TestLoad checks that the kernel verifier accepts the programs, which
+// requires the capabilities, but not the ip_vs module.
+func TestLoad(t *testing.T) {
+	r, ok := archRegs[runtime.GOARCH]
+	if !ok {
+		t.Skip("unsupported architecture")
+	}
+	if err := checkCapabilities("/proc/self/status"); err != nil {
+		t.Skip(err)
+	}
+	assert.NilError(t, rlimit.RemoveMemlock())
+
+	tr := new(Tracer)
+	defer tr.Close()
+	err := tr.load(serviceOffsets{family: 36, protocol: 38, address: 40, port: 56, fwmark: 60}, r)
+	if errors.Is(err, ebpf.ErrNotSupported) {
+		t.Skip(err)
+	}
+	assert.NilError(t, err)
+
+	st, err := tr.Stats()
+	assert.NilError(t, err)
+	assert.Equal(t, len(st), 0)
+}
@@ -0,0 +1,353 @@
+// +build linux
+
+// Package seesaw adapts package ipvs to the IPVS interface used by the ncc
+// component of Seesaw, so that deployments can use this library as their
+// IPVS backend. Types mirror the ones of github.com/google/seesaw/ipvs.
+package seesaw
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/kwanhur/ipvs"
+)
+
+// IPProto specifies the protocol encapsulated within an IP datagram.
+type IPProto uint16
+
+// String returns the name for the given protocol value.
+func (proto IPProto) String() string {
+	return ipvs.IPProto(proto).String()
+}
+
+// ServiceFlags specifies the flags for a IPVS service.
+type ServiceFlags uint32
+
+// Service flags.
+const (
+	SFPersistent ServiceFlags = ipvs.SvcFlagPersistent
+	SFHashed     ServiceFlags = ipvs.SvcFlagHashed
+	SFOnePacket  ServiceFlags = ipvs.SvcFlagOnePacket
+)
+
+// DestinationFlags specifies the flags for a connection to an IPVS
+// destination.
+type DestinationFlags uint32
+
+// Destination forwarding methods.
+const (
+	DFForwardMask   DestinationFlags = ipvs.ConnFwdMask
+	DFForwardMasq   DestinationFlags = ipvs.ConnFwdMasq
+	DFForwardLocal  DestinationFlags = ipvs.ConnFwdLocalNode
+	DFForwardTunnel DestinationFlags = ipvs.ConnFwdTunnel
+	DFForwardRoute  DestinationFlags = ipvs.ConnFwdDirectRoute
+	DFForwardBypass DestinationFlags = ipvs.ConnFwdBypass
+)
+
+// Version represents a IPVS version.
+type Version struct {
+	Major uint
+	Minor uint
+	Patch uint
+}
+
+// String returns a string representation of the IPVS version number.
+func (v Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Stats contains statistics for an IPVS service or destination.
+type Stats struct {
+	Connections uint32
+	PacketsIn   uint32
+	PacketsOut  uint32
+	BytesIn     uint64
+	BytesOut    uint64
+	CPS         uint32
+	PPSIn       uint32
+	PPSOut      uint32
+	BPSIn       uint32
+	BPSOut      uint32
+}
+
+// ServiceStats encapsulates statistics for an IPVS service.
+type ServiceStats struct {
+	Stats
+}
+
+// DestinationStats encapsulates statistics for an IPVS destination.
+type DestinationStats struct {
+	Stats
+	ActiveConns   uint32
+	InactiveConns uint32
+	PersistConns  uint32
+}
+
+// Service represents an IPVS service.
+type Service struct {
+	Address           net.IP
+	Protocol          IPProto
+	Port              uint16
+	FirewallMark      uint32
+	Scheduler         string
+	Flags             ServiceFlags
+	Timeout           uint32
+	PersistenceEngine string
+	Statistics        *ServiceStats
+	Destinations      []*Destination
+}
+
+// String returns a string representation of the service.
+func (svc Service) String() string {
+	return toService(svc).String()
+}
+
+// Destination represents an IPVS destination.
+type Destination struct {
+	Address        net.IP
+	Port           uint16
+	Weight         int32
+	Flags          DestinationFlags
+	LowerThreshold uint32
+	UpperThreshold uint32
+	Statistics     *DestinationStats
+}
+
+// IPVS is the interface ncc programs IPVS through.
+type IPVS interface {
+	Flush() error
+	Version() (*Version, error)
+	AddService(svc Service) error
+	UpdateService(svc Service) error
+	DeleteService(svc Service) error
+	GetService(svc *Service) (*Service, error)
+	GetServices() ([]*Service, error)
+	AddDestination(svc Service, dst Destination) error
+	UpdateDestination(svc Service, dst Destination) error
+	DeleteDestination(svc Service, dst Destination) error
+}
+
+// Engine implements IPVS on top of an ipvs handle.
+type Engine struct {
+	h *ipvs.Handle
+}
+
+var _ IPVS = (*Engine)(nil)
+
+// New returns an Engine programming IPVS in the namespace pointed to by
+// path, the current one if empty.
+func New(path string) (*Engine, error) {
+	h, err := ipvs.New(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Engine{h: h}, nil
+}
+
+// Ext returns the underlying handle, giving access to the features the
+// Seesaw interface does not have.
+func (e *Engine) Ext() *ipvs.Handle {
+	return e.h
+}
+
+// Close closes the engine's handle.
+func (e *Engine) Close() {
+	e.h.Close()
+}
+
+// Flush flushes all services and destinations from the IPVS table.
+func (e *Engine) Flush() error {
+	return e.h.Flush()
+}
+
+// Version returns the version of the kernel's IPVS implementation.
+func (e *Engine) Version() (*Version, error) {
+	info, err := e.h.GetInfo()
+	if err != nil {
+		return nil, err
+	}
+	return &Version{Major: info.Version.Major, Minor: info.Version.Minor, Patch: info.Version.Patch}, nil
+}
+
+// AddService adds the specified service to the IPVS table, together with
+// its destinations. The service is removed again if a destination cannot be
+// added.
+func (e *Engine) AddService(svc Service) error {
+	s := toService(svc)
+	if err := e.h.NewService(s); err != nil {
+		return err
+	}
+	for _, dst := range svc.Destinations {
+		if err := e.h.NewDestination(s, toDestination(s, *dst)); err != nil {
+			e.h.DelService(s)
+			return err
+		}
+	}
+	return nil
+}
+
+// UpdateService updates the specified service in the IPVS table.
+func (e *Engine) UpdateService(svc Service) error {
+	return e.h.UpdateService(toService(svc))
+}
+
+// DeleteService deletes the specified service from the IPVS table.
+func (e *Engine) DeleteService(svc Service) error {
+	return e.h.DelService(toService(svc))
+}
+
+// GetService returns the specified service from the IPVS table, with its
+// destinations.
+func (e *Engine) GetService(svc *Service) (*Service, error) {
+	s, err := e.h.GetService(toService(*svc))
+	if err != nil {
+		return nil, err
+	}
+	return e.fromService(s)
+}
+
+// GetServices returns all services in the IPVS table, with their
+// destinations.
+func (e *Engine) GetServices() ([]*Service, error) {
+	svcs, err := e.h.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Service, 0, len(svcs))
+	for _, s := range svcs {
+		svc, err := e.fromService(s)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, svc)
+	}
+	return res, nil
+}
+
+// AddDestination adds the specified destination to the specified service.
+func (e *Engine) AddDestination(svc Service, dst Destination) error {
+	s := toService(svc)
+	return e.h.NewDestination(s, toDestination(s, dst))
+}
+
+// UpdateDestination updates the specified destination of the specified
+// service.
+func (e *Engine) UpdateDestination(svc Service, dst Destination) error {
+	s := toService(svc)
+	return e.h.UpdateDestination(s, toDestination(s, dst))
+}
+
+// DeleteDestination deletes the specified destination from the specified
+// service.
+func (e *Engine) DeleteDestination(svc Service, dst Destination) error {
+	s := toService(svc)
+	return e.h.DelDestination(s, toDestination(s, dst))
+}
+
+func (e *Engine) fromService(s *ipvs.Service) (*Service, error) {
+	dsts, err := e.h.GetDestinations(s)
+	if err != nil {
+		return nil, err
+	}
+
+	svc := fromService(s)
+	for _, d := range dsts {
+		svc.Destinations = append(svc.Destinations, fromDestination(d))
+	}
+	return svc, nil
+}
+
+// addressFamily returns the family of ip, IPv4 when not set as for firewall
+// mark services.
+func addressFamily(ip net.IP) uint16 {
+	if ip == nil || ip.To4() != nil {
+		return syscall.AF_INET
+	}
+	return syscall.AF_INET6
+}
+
+func toService(svc Service) *ipvs.Service {
+	s := &ipvs.Service{
+		Address:       svc.Address,
+		Protocol:      ipvs.IPProto(svc.Protocol),
+		Port:          svc.Port,
+		FWMark:        svc.FirewallMark,
+		SchedName:     svc.Scheduler,
+		Flags:         ipvs.ServiceFlags(svc.Flags),
+		Timeout:       svc.Timeout,
+		AddressFamily: addressFamily(svc.Address),
+		PEName:        svc.PersistenceEngine,
+	}
+	if s.AddressFamily == syscall.AF_INET {
+		s.Netmask = 0xFFFFFFFF
+	} else {
+		s.Netmask = 128
+	}
+	return s
+}
+
+func fromService(s *ipvs.Service) *Service {
+	return &Service{
+		Address:           s.Address,
+		Protocol:          IPProto(s.Protocol),
+		Port:              s.Port,
+		FirewallMark:      s.FWMark,
+		Scheduler:         s.SchedName,
+		Flags:             ServiceFlags(s.Flags),
+		Timeout:           s.Timeout,
+		PersistenceEngine: s.PEName,
+		Statistics:        &ServiceStats{Stats: fromStats(s.Stats)},
+	}
+}
+
+func toDestination(s *ipvs.Service, dst Destination) *ipvs.Destination {
+	family := s.AddressFamily
+	if dst.Address != nil {
+		family = addressFamily(dst.Address)
+	}
+	return &ipvs.Destination{
+		Address:         dst.Address,
+		Port:            dst.Port,
+		Weight:          int(dst.Weight),
+		ConnectionFlags: ipvs.ConnectionFlags(dst.Flags),
+		AddressFamily:   family,
+		LowerThreshold:  dst.LowerThreshold,
+		UpperThreshold:  dst.UpperThreshold,
+	}
+}
+
+func fromDestination(d *ipvs.Destination) *Destination {
+	return &Destination{
+		Address:        d.Address,
+		Port:           d.Port,
+		Weight:         int32(d.Weight),
+		Flags:          DestinationFlags(d.ConnectionFlags),
+		LowerThreshold: d.LowerThreshold,
+		UpperThreshold: d.UpperThreshold,
+		Statistics: &DestinationStats{
+			Stats:         fromStats(ipvs.SvcStats(d.Stats)),
+			ActiveConns:   uint32(d.ActiveConnections),
+			InactiveConns: uint32(d.InactiveConnections),
+			PersistConns:  uint32(d.PersistentConnections),
+		},
+	}
+}
+
+// fromStats converts st, truncating the counters seesaw has 32 bits wide
+// like older kernels do.
+func fromStats(st ipvs.SvcStats) Stats {
+	return Stats{
+		Connections: uint32(st.Connections),
+		PacketsIn:   uint32(st.PacketsIn),
+		PacketsOut:  uint32(st.PacketsOut),
+		BytesIn:     st.BytesIn,
+		BytesOut:    st.BytesOut,
+		CPS:         uint32(st.CPS),
+		PPSIn:       uint32(st.PPSIn),
+		PPSOut:      uint32(st.PPSOut),
+		BPSIn:       uint32(st.BPSIn),
+		BPSOut:      uint32(st.BPSOut),
+	}
+}
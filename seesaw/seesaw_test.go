@@ -0,0 +1,46 @@
+// +build linux
+
+package seesaw
+
+import (
+	"net"
+	"syscall"
+	"testing"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func TestConversions(t *testing.T) {
+	svc := Service{
+		Address:   net.ParseIP("2001:db8::1"),
+		Protocol:  syscall.IPPROTO_TCP,
+		Port:      443,
+		Scheduler: ipvs.WeightedRoundRobin,
+		Flags:     SFPersistent,
+		Timeout:   300,
+	}
+	s := toService(svc)
+	assert.Equal(t, s.AddressFamily, uint16(syscall.AF_INET6))
+	assert.Equal(t, s.Netmask, uint32(128))
+	assert.Equal(t, s.Flags, ipvs.ServiceFlags(ipvs.SvcFlagPersistent))
+
+	back := fromService(s)
+	assert.Equal(t, back.String(), svc.String())
+	assert.DeepEqual(t, back.Statistics, &ServiceStats{})
+
+	fwm := toService(Service{FirewallMark: 7, Scheduler: ipvs.RoundRobin})
+	assert.Equal(t, fwm.AddressFamily, uint16(syscall.AF_INET))
+
+	dst := Destination{Address: net.ParseIP("10.1.0.1"), Port: 8443, Weight: 5, Flags: DFForwardRoute}
+	d := toDestination(s, dst)
+	assert.Equal(t, d.AddressFamily, uint16(syscall.AF_INET))
+	assert.Equal(t, d.ConnectionFlags, ipvs.ConnectionFlags(ipvs.ConnFwdDirectRoute))
+
+	d.ActiveConnections = 3
+	d.Stats.Connections = 10
+	got := fromDestination(d)
+	assert.Equal(t, got.Weight, int32(5))
+	assert.Equal(t, got.Statistics.ActiveConns, uint32(3))
+	assert.Equal(t, got.Statistics.Connections, uint32(10))
+}
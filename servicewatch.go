@@ -0,0 +1,169 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ServiceEventType is the type of a ServiceEvent.
+type ServiceEventType int
+
+const (
+	// ServiceAdded reports a service which appeared, followed by the
+	// DestinationAdded events of its destinations.
+	ServiceAdded ServiceEventType = iota + 1
+
+	// ServiceRemoved reports a service which disappeared, along with its
+	// destinations.
+	ServiceRemoved
+
+	// ServiceChanged reports a service whose options changed.
+	ServiceChanged
+
+	// DestinationAdded reports a destination which appeared.
+	DestinationAdded
+
+	// DestinationRemoved reports a destination which disappeared.
+	DestinationRemoved
+
+	// DestinationChanged reports a destination whose options other than
+	// its weight changed.
+	DestinationChanged
+
+	// WeightChanged reports a destination whose weight alone changed.
+	WeightChanged
+)
+
+var serviceEventTypeNames = map[ServiceEventType]string{
+	ServiceAdded:       "ServiceAdded",
+	ServiceRemoved:     "ServiceRemoved",
+	ServiceChanged:     "ServiceChanged",
+	DestinationAdded:   "DestinationAdded",
+	DestinationRemoved: "DestinationRemoved",
+	DestinationChanged: "DestinationChanged",
+	WeightChanged:      "WeightChanged",
+}
+
+// String returns the name of the event type
+func (t ServiceEventType) String() string {
+	if name, ok := serviceEventTypeNames[t]; ok {
+		return name
+	}
+	return "Unknown"
+}
+
+// ServiceEvent is a change of the services or destinations seen by a
+// ServiceWatcher.
+type ServiceEvent struct {
+	Type    ServiceEventType
+	Time    time.Time
+	Service *Service
+
+	// Previous is the service before a ServiceChanged event.
+	Previous *Service
+
+	// Destination and PreviousDestination are the destination after and
+	// before the change for destination events, Destination being nil for
+	// DestinationRemoved and PreviousDestination for DestinationAdded.
+	Destination         *Destination
+	PreviousDestination *Destination
+}
+
+// ServiceWatcher polls the services and destinations of a handler and
+// reports their changes, e.g. made out of band by ipvsadm or keepalived on
+// the same host. Changes undone between two polls go unnoticed, and
+// statistics and connection counts are not changes.
+type ServiceWatcher struct {
+	Handler  Handler
+	Interval time.Duration
+
+	prev *Snapshot
+}
+
+// Run polls the services every Interval and sends the changes on events
+// until ctx is done. The services present at the first poll are not
+// reported. Failed polls are logged and skipped.
+func (w *ServiceWatcher) Run(ctx context.Context, events chan<- ServiceEvent) error {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+
+	for {
+		changes, err := w.poll(time.Now())
+		if err != nil {
+			logrus.Warnf("Failed to read ipvs services: %v", err)
+		}
+		for _, e := range changes {
+			select {
+			case events <- e:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll reads the services and returns their changes since the previous
+// poll, none for the first one.
+func (w *ServiceWatcher) poll(now time.Time) ([]ServiceEvent, error) {
+	stats, err := pollStats(w.Handler)
+	if err != nil {
+		return nil, err
+	}
+	snap := &Snapshot{Time: now}
+	for _, sd := range stats.Services {
+		snap.Services = append(snap.Services, &ServiceSpec{Service: sd.Service, Destinations: sd.Destinations})
+	}
+
+	prev := w.prev
+	w.prev = snap
+	if prev == nil {
+		return nil, nil
+	}
+	return serviceEvents(Diff(prev, snap), now), nil
+}
+
+// serviceEvents returns the events of the changes of c.
+func serviceEvents(c *Changeset, now time.Time) []ServiceEvent {
+	var events []ServiceEvent
+	for _, spec := range c.ServicesAdded {
+		events = append(events, ServiceEvent{Type: ServiceAdded, Time: now, Service: spec.Service})
+		for _, d := range spec.Destinations {
+			events = append(events, ServiceEvent{Type: DestinationAdded, Time: now, Service: spec.Service, Destination: d})
+		}
+	}
+	for _, spec := range c.ServicesRemoved {
+		events = append(events, ServiceEvent{Type: ServiceRemoved, Time: now, Service: spec.Service})
+	}
+	for _, sd := range c.ServicesModified {
+		events = append(events, ServiceEvent{Type: ServiceChanged, Time: now, Service: sd.Service, Previous: sd.Previous})
+	}
+
+	for _, dd := range c.Destinations {
+		e := ServiceEvent{Time: now, Service: dd.Service, Destination: dd.Destination, PreviousDestination: dd.Previous}
+		switch {
+		case dd.Previous == nil:
+			e.Type = DestinationAdded
+		case dd.Destination == nil:
+			e.Type = DestinationRemoved
+		default:
+			e.Type = DestinationChanged
+			p := *dd.Previous
+			p.Weight = dd.Destination.Weight
+			if !destinationChanged(&p, dd.Destination) {
+				e.Type = WeightChanged
+			}
+		}
+		events = append(events, e)
+	}
+	return events
+}
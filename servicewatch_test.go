@@ -0,0 +1,68 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestServiceWatcher(t *testing.T) {
+	web := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80, SchedName: RoundRobin}
+	dns := &Service{Protocol: 17, Address: net.ParseIP("10.0.0.2"), Port: 53, SchedName: RoundRobin}
+	dst := func(ip string, weight int, fwd ConnectionFlags) *Destination {
+		return &Destination{Address: net.ParseIP(ip), Port: 8080, Weight: weight, ConnectionFlags: fwd}
+	}
+
+	f := &fakeHandler{
+		services:     []*Service{web},
+		destinations: []*Destination{dst("10.1.0.1", 1, ConnectionFlagMasq), dst("10.1.0.2", 1, ConnectionFlagMasq)},
+	}
+	w := &ServiceWatcher{Handler: f}
+	events, err := w.poll(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 0)
+
+	// Stats and connection counts are not changes.
+	changed := *web
+	changed.Stats.Connections = 10
+	f.services = []*Service{&changed}
+	f.destinations[0].ActiveConnections = 3
+	events, err = w.poll(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 0)
+
+	wrr := changed
+	wrr.SchedName = WeightedRoundRobin
+	f.services = []*Service{&wrr, dns}
+	f.destinations = []*Destination{dst("10.1.0.1", 5, ConnectionFlagMasq), dst("10.1.0.2", 1, ConnectionFlagDirectRoute), dst("10.1.0.3", 1, ConnectionFlagMasq)}
+	events, err = w.poll(time.Now())
+	assert.NilError(t, err)
+
+	var types []ServiceEventType
+	for _, e := range events {
+		types = append(types, e.Type)
+	}
+	assert.DeepEqual(t, types, []ServiceEventType{
+		ServiceAdded, DestinationAdded, DestinationAdded, DestinationAdded,
+		ServiceChanged,
+		WeightChanged, DestinationChanged, DestinationAdded,
+	})
+	assert.Equal(t, events[0].Service, dns)
+	assert.Equal(t, events[4].Previous.SchedName, RoundRobin)
+	assert.Equal(t, events[5].PreviousDestination.Weight, 1)
+	assert.Equal(t, events[5].Destination.Weight, 5)
+	assert.Equal(t, events[5].Type.String(), "WeightChanged")
+
+	f.services = []*Service{&wrr}
+	f.destinations = f.destinations[:2]
+	events, err = w.poll(time.Now())
+	assert.NilError(t, err)
+	assert.Equal(t, len(events), 2)
+	assert.Equal(t, events[0].Type, ServiceRemoved)
+	assert.Equal(t, events[1].Type, DestinationRemoved)
+	assert.Assert(t, events[1].Destination == nil)
+}
@@ -0,0 +1,134 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"time"
+)
+
+// Snapshot is the complete IPVS configuration of a handle's namespace, for
+// backups and migrations. It can be serialized, e.g. with encoding/json, and
+// programmed back with Restore.
+type Snapshot struct {
+	Time     time.Time
+	Services []*ServiceSpec
+	Daemons  []*Daemon
+	Config   *Config
+}
+
+// Snapshot returns the current configuration of the services, sync daemons
+// and timeouts. Local addresses are only read for the services with fullnat
+// destinations, see Reconcile.
+func (i *Handle) Snapshot() (*Snapshot, error) {
+	snap := &Snapshot{Time: time.Now()}
+
+	var err error
+	if snap.Services, err = i.currentSpecs(nil); err != nil {
+		return nil, err
+	}
+	if snap.Daemons, err = i.GetDaemons(); err != nil {
+		return nil, err
+	}
+	if snap.Config, err = i.GetConfig(); err != nil {
+		return nil, err
+	}
+	return snap, nil
+}
+
+// Restore programs the configuration of snap: the timeouts, then the
+// services as Reconcile does, deleting the services snap does not have,
+// then the sync daemons. It returns the changes made, and stops at the
+// first failed one, see Reconcile.
+func (i *Handle) Restore(snap *Snapshot) (report *ReconcileReport, err error) {
+	err = i.batch(func() error {
+		report, err = i.restore(snap)
+		return err
+	})
+	return report, err
+}
+
+func (i *Handle) restore(snap *Snapshot) (*ReconcileReport, error) {
+	report := &ReconcileReport{}
+
+	if snap.Config != nil {
+		cur, err := i.GetConfig()
+		if err != nil {
+			return report, err
+		}
+		if *cur != *snap.Config {
+			if err := i.SetConfig(snap.Config); err != nil {
+				return report, err
+			}
+			report.Changes = append(report.Changes, Event{Type: EventConfigUpdated, Time: time.Now(), Config: snap.Config})
+		}
+	}
+
+	svcReport, err := i.reconcile(snap.Services)
+	if svcReport != nil {
+		report.Changes = append(report.Changes, svcReport.Changes...)
+	}
+	if err != nil {
+		return report, err
+	}
+
+	daemons, err := i.GetDaemons()
+	if err != nil {
+		return report, err
+	}
+	for _, change := range planDaemons(daemons, snap.Daemons) {
+		if err := i.applyDaemonChange(change); err != nil {
+			return report, err
+		}
+		change.Time = time.Now()
+		report.Changes = append(report.Changes, change)
+	}
+	return report, nil
+}
+
+// planDaemons returns the changes converging the sync daemons cur to want.
+// There is at most one daemon per state, master or backup, and a daemon is
+// replaced when its configuration changed.
+func planDaemons(cur, want []*Daemon) []Event {
+	have := make(map[uint32]*Daemon, len(cur))
+	for _, d := range cur {
+		have[d.State] = d
+	}
+	wanted := make(map[uint32]bool, len(want))
+
+	var deletions, additions []Event
+	for _, d := range want {
+		wanted[d.State] = true
+		h, ok := have[d.State]
+		if ok && daemonEqual(h, d) {
+			continue
+		}
+		if ok {
+			deletions = append(deletions, Event{Type: EventDaemonDeleted, Daemon: h})
+		}
+		additions = append(additions, Event{Type: EventDaemonAdded, Daemon: d})
+	}
+	for _, d := range cur {
+		if !wanted[d.State] {
+			deletions = append(deletions, Event{Type: EventDaemonDeleted, Daemon: d})
+		}
+	}
+	return append(deletions, additions...)
+}
+
+// daemonEqual reports whether a and b have the same configuration.
+func daemonEqual(a, b *Daemon) bool {
+	ipEqual := func(x, y net.IP) bool {
+		return (len(x) == 0 && len(y) == 0) || x.Equal(y)
+	}
+	return a.State == b.State && a.SyncId == b.SyncId && a.McastIfn == b.McastIfn &&
+		ipEqual(a.McastGroup, b.McastGroup) && ipEqual(a.McastGroup6, b.McastGroup6) &&
+		a.McastPort == b.McastPort && a.McastTTL == b.McastTTL && a.SyncMaxLen == b.SyncMaxLen
+}
+
+func (i *Handle) applyDaemonChange(e Event) error {
+	if e.Type == EventDaemonDeleted {
+		return i.DelDaemon(e.Daemon)
+	}
+	return i.NewDaemon(e.Daemon)
+}
@@ -0,0 +1,58 @@
+// +build linux
+
+package ipvs
+
+import (
+	"encoding/json"
+	"net"
+	"syscall"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSnapshotJSON(t *testing.T) {
+	snap := &Snapshot{
+		Services: []*ServiceSpec{{
+			Service: &Service{
+				AddressFamily: syscall.AF_INET,
+				Protocol:      syscall.IPPROTO_TCP,
+				Address:       net.ParseIP("10.0.0.1").To4(),
+				Port:          80,
+				SchedName:     RoundRobin,
+				Netmask:       0xFFFFFFFF,
+			},
+			Destinations: []*Destination{{Address: net.ParseIP("10.1.0.1").To4(), Port: 80, Weight: 1}},
+		}},
+		Daemons: []*Daemon{{State: DaemonStateMaster, SyncId: 1, McastIfn: "eth0"}},
+		Config:  &Config{TimeoutTCP: 900},
+	}
+
+	b, err := json.Marshal(snap)
+	assert.NilError(t, err)
+	var res Snapshot
+	assert.NilError(t, json.Unmarshal(b, &res))
+	assert.Equal(t, Fingerprint(res.Services), Fingerprint(snap.Services))
+	assert.Assert(t, daemonEqual(res.Daemons[0], snap.Daemons[0]))
+	assert.Equal(t, *res.Config, *snap.Config)
+}
+
+func TestPlanDaemons(t *testing.T) {
+	master := &Daemon{State: DaemonStateMaster, SyncId: 1, McastIfn: "eth0"}
+	backup := &Daemon{State: DaemonStateBackup, SyncId: 1, McastIfn: "eth0"}
+
+	assert.Equal(t, len(planDaemons([]*Daemon{master}, []*Daemon{master})), 0)
+
+	changed := *master
+	changed.SyncId = 2
+	changes := planDaemons([]*Daemon{master}, []*Daemon{&changed, backup})
+	assert.Equal(t, len(changes), 3)
+	assert.Equal(t, changes[0].Type, EventDaemonDeleted)
+	assert.Equal(t, changes[0].Daemon, master)
+	assert.Equal(t, changes[1].Daemon, &changed)
+	assert.Equal(t, changes[2].Daemon, backup)
+
+	changes = planDaemons([]*Daemon{master, backup}, nil)
+	assert.Equal(t, len(changes), 2)
+	assert.Equal(t, changes[1].Type, EventDaemonDeleted)
+}
@@ -0,0 +1,85 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"fmt"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// BufferOverrunError is returned for a request whose answers overflowed the
+// receive buffer of the handle's socket, ENOBUFS, and were partly dropped.
+// Dumps of large tables need a larger buffer, see SetReceiveBufferSize and
+// WithRcvBuf.
+type BufferOverrunError struct {
+	Command Command
+	Err     error
+}
+
+func (e *BufferOverrunError) Error() string {
+	return fmt.Sprintf("%v: netlink receive buffer overrun, answers were dropped, increase the receive buffer size: %v", e.Command, e.Err)
+}
+
+// Unwrap returns the underlying ENOBUFS error.
+func (e *BufferOverrunError) Unwrap() error {
+	return e.Err
+}
+
+// wrapBufferOverrun returns err as a *BufferOverrunError if it is ENOBUFS.
+func wrapBufferOverrun(cmd uint8, err error) error {
+	if err != nil && errors.Is(err, syscall.ENOBUFS) {
+		return &BufferOverrunError{Command: Command(cmd), Err: err}
+	}
+	return err
+}
+
+// SetStrictCheck enables or disables strict checking of the requests sent
+// on the handle's socket (NETLINK_GET_STRICT_CHK). With strict checking the
+// kernel rejects malformed requests with an error instead of silently
+// ignoring the unexpected bits, which helps catching mistakes during
+// development. Kernels older than 4.20 do not support the option and return
+// ENOPROTOOPT.
+func (i *Handle) SetStrictCheck(enable bool) error {
+	return i.setSockoptBool(unix.SOL_NETLINK, unix.NETLINK_GET_STRICT_CHK, enable)
+}
+
+// SetReceiveBufferSize sets the size of the handle's socket receive buffer
+// (SO_RCVBUF). Dumps of very large tables may not fit in the default size.
+// The kernel caps the size to net.core.rmem_max unless force is set, which
+// uses SO_RCVBUFFORCE and requires CAP_NET_ADMIN.
+func (i *Handle) SetReceiveBufferSize(size int, force bool) error {
+	opt := unix.SO_RCVBUF
+	if force {
+		opt = unix.SO_RCVBUFFORCE
+	}
+	return unix.SetsockoptInt(i.socket().GetFd(), unix.SOL_SOCKET, opt, size)
+}
+
+// SetSendBufferSize sets the size of the handle's socket send buffer
+// (SO_SNDBUF). The kernel caps the size to net.core.wmem_max unless force is
+// set, which uses SO_SNDBUFFORCE and requires CAP_NET_ADMIN.
+func (i *Handle) SetSendBufferSize(size int, force bool) error {
+	opt := unix.SO_SNDBUF
+	if force {
+		opt = unix.SO_SNDBUFFORCE
+	}
+	return unix.SetsockoptInt(i.socket().GetFd(), unix.SOL_SOCKET, opt, size)
+}
+
+// SetNoENOBUFS enables or disables NETLINK_NO_ENOBUFS on the handle's
+// socket, asking the kernel not to report receive buffer overruns with
+// ENOBUFS.
+func (i *Handle) SetNoENOBUFS(enable bool) error {
+	return i.setSockoptBool(unix.SOL_NETLINK, unix.NETLINK_NO_ENOBUFS, enable)
+}
+
+func (i *Handle) setSockoptBool(level, opt int, enable bool) error {
+	v := 0
+	if enable {
+		v = 1
+	}
+	return unix.SetsockoptInt(i.socket().GetFd(), level, opt, v)
+}
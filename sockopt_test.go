@@ -0,0 +1,63 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"golang.org/x/sys/unix"
+	"gotest.tools/v3/assert"
+)
+
+func TestSetStrictCheck(t *testing.T) {
+	i, err := New("")
+	assert.NilError(t, err)
+	defer i.Close()
+
+	assert.NilError(t, i.SetStrictCheck(true))
+	v, err := unix.GetsockoptInt(i.sock.GetFd(), unix.SOL_NETLINK, unix.NETLINK_GET_STRICT_CHK)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 1)
+
+	assert.NilError(t, i.SetStrictCheck(false))
+	v, err = unix.GetsockoptInt(i.sock.GetFd(), unix.SOL_NETLINK, unix.NETLINK_GET_STRICT_CHK)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 0)
+}
+
+func TestSetBufferSizes(t *testing.T) {
+	i, err := New("")
+	assert.NilError(t, err)
+	defer i.Close()
+
+	const size = 4 << 20
+	fd := i.sock.GetFd()
+
+	assert.NilError(t, i.SetReceiveBufferSize(size, true))
+	v, err := unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_RCVBUF)
+	assert.NilError(t, err)
+	assert.Assert(t, v >= size)
+
+	assert.NilError(t, i.SetSendBufferSize(size, true))
+	v, err = unix.GetsockoptInt(fd, unix.SOL_SOCKET, unix.SO_SNDBUF)
+	assert.NilError(t, err)
+	assert.Assert(t, v >= size)
+
+	assert.NilError(t, i.SetNoENOBUFS(true))
+	v, err = unix.GetsockoptInt(fd, unix.SOL_NETLINK, unix.NETLINK_NO_ENOBUFS)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 1)
+}
+
+func TestBufferOverrunError(t *testing.T) {
+	err := wrapBufferOverrun(uint8(CmdGetDest), syscall.ENOBUFS)
+	var overrun *BufferOverrunError
+	assert.Assert(t, errors.As(err, &overrun))
+	assert.Equal(t, overrun.Command, CmdGetDest)
+	assert.Assert(t, errors.Is(err, syscall.ENOBUFS))
+
+	assert.Equal(t, wrapBufferOverrun(uint8(CmdGetDest), syscall.EEXIST), syscall.EEXIST)
+	assert.NilError(t, wrapBufferOverrun(uint8(CmdGetDest), nil))
+}
@@ -0,0 +1,132 @@
+// +build linux
+
+// Package sse streams IPVS change events, and optionally statistics
+// snapshots, to HTTP clients as server-sent events, so that web UIs can
+// follow a host live with an EventSource.
+package sse
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/kwanhur/ipvs/webhook"
+)
+
+// StatsEvent is the name of the events carrying statistics snapshots, the
+// change events being named after their ipvs.EventType.
+const StatsEvent = "stats"
+
+// Default settings of a Handler.
+const (
+	DefaultBuffer        = 64
+	DefaultStatsInterval = 10 * time.Second
+)
+
+// Snapshotter takes statistics snapshots, like ipvs.Handle does.
+type Snapshotter interface {
+	GetStatsSnapshot() (*ipvs.StatsSnapshot, error)
+}
+
+// Handler streams the events published on Bus to every GET request, as
+// server-sent events whose data is the webhook.Payload of the event. Events
+// published while the buffer of a client is full are not sent to it, see
+// ipvs.EventBus.
+type Handler struct {
+	Bus *ipvs.EventBus
+
+	// Buffer is the number of events buffered for every client,
+	// DefaultBuffer if zero.
+	Buffer int
+
+	// Stats, if set, is sampled every StatsInterval, DefaultStatsInterval
+	// if zero, for the clients asking for it with the stats query
+	// parameter, e.g. "/events?stats". The snapshots are sent as StatsEvent
+	// events, starting with one when the client connects.
+	Stats         Snapshotter
+	StatsInterval time.Duration
+}
+
+// ServeHTTP streams the events until the client goes away.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", http.MethodGet)
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	size := h.Buffer
+	if size <= 0 {
+		size = DefaultBuffer
+	}
+	events, cancel := h.Bus.Subscribe(size)
+	defer cancel()
+
+	var tick <-chan time.Time
+	_, stats := r.URL.Query()["stats"]
+	stats = stats && h.Stats != nil
+	if stats {
+		interval := h.StatsInterval
+		if interval <= 0 {
+			interval = DefaultStatsInterval
+		}
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	if stats && h.sendStats(w) != nil {
+		return
+	}
+	flusher.Flush()
+	for {
+		var err error
+		select {
+		case <-r.Context().Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			err = write(w, e.Type.String(), webhook.NewPayload(e))
+		case <-tick:
+			err = h.sendStats(w)
+		}
+		if err != nil {
+			return
+		}
+		flusher.Flush()
+	}
+}
+
+// sendStats writes a StatsEvent, or a comment telling why the snapshot
+// failed.
+func (h *Handler) sendStats(w io.Writer) error {
+	snap, err := h.Stats.GetStatsSnapshot()
+	if err != nil {
+		_, err = fmt.Fprintf(w, ": failed to take a stats snapshot: %v\n\n", err)
+		return err
+	}
+	return write(w, StatsEvent, snap)
+}
+
+// write writes the event name with the JSON encoding of v as data.
+func write(w io.Writer, name string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", name, data)
+	return err
+}
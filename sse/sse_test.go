@@ -0,0 +1,84 @@
+// +build linux
+
+package sse
+
+import (
+	"bufio"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+type fakeSnapshotter struct {
+	err error
+}
+
+func (s *fakeSnapshotter) GetStatsSnapshot() (*ipvs.StatsSnapshot, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return &ipvs.StatsSnapshot{Time: time.Unix(1577836800, 0).UTC()}, nil
+}
+
+// readEvent returns the next event, or comment, of r.
+func readEvent(t *testing.T, r *bufio.Reader) string {
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		assert.NilError(t, err)
+		if line == "\n" {
+			return strings.Join(lines, "\n")
+		}
+		lines = append(lines, strings.TrimSuffix(line, "\n"))
+	}
+}
+
+func TestHandler(t *testing.T) {
+	bus := ipvs.NewEventBus()
+	h := &Handler{Bus: bus, Stats: &fakeSnapshotter{}, StatsInterval: time.Hour}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?stats")
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, resp.Header.Get("Content-Type"), "text/event-stream")
+	r := bufio.NewReader(resp.Body)
+	assert.Equal(t, readEvent(t, r), `event: stats`+"\n"+`data: {"Time":"2020-01-01T00:00:00Z","Services":null}`)
+
+	bus.Publish(ipvs.Event{
+		Type:    ipvs.EventServiceAdded,
+		Time:    time.Unix(1577836800, 0).UTC(),
+		Service: &ipvs.Service{FWMark: 7},
+	})
+	event := readEvent(t, r)
+	assert.Assert(t, strings.HasPrefix(event, "event: ServiceAdded\ndata: {"), event)
+	assert.Assert(t, strings.Contains(event, `"type":"ServiceAdded"`), event)
+}
+
+func TestHandlerStatsFailure(t *testing.T) {
+	h := &Handler{Bus: ipvs.NewEventBus(), Stats: &fakeSnapshotter{err: errors.New("dump failed")}}
+	srv := httptest.NewServer(h)
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "?stats")
+	assert.NilError(t, err)
+	defer resp.Body.Close()
+	assert.Equal(t, readEvent(t, bufio.NewReader(resp.Body)), ": failed to take a stats snapshot: dump failed")
+}
+
+func TestHandlerMethod(t *testing.T) {
+	srv := httptest.NewServer(&Handler{Bus: ipvs.NewEventBus()})
+	defer srv.Close()
+
+	resp, err := http.Post(srv.URL, "text/plain", nil)
+	assert.NilError(t, err)
+	resp.Body.Close()
+	assert.Equal(t, resp.StatusCode, http.StatusMethodNotAllowed)
+}
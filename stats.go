@@ -0,0 +1,93 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"time"
+)
+
+// ServiceDestinations pairs a service with the destinations configured for
+// it.
+type ServiceDestinations struct {
+	Service      *Service
+	Destinations []*Destination
+}
+
+// StatsSnapshot is a point in time capture of the statistics of every
+// service and destination.
+type StatsSnapshot struct {
+	Time     time.Time
+	Services []*ServiceDestinations
+}
+
+// GetStatsSnapshot returns the current statistics of every service together
+// with their destinations.
+func (i *Handle) GetStatsSnapshot() (*StatsSnapshot, error) {
+	svcs, err := i.GetServices()
+	if err != nil {
+		return nil, err
+	}
+
+	snap := &StatsSnapshot{Time: time.Now()}
+	for _, svc := range svcs {
+		dsts, err := i.GetDestinations(svc)
+		if err != nil {
+			return nil, err
+		}
+		snap.Services = append(snap.Services, &ServiceDestinations{Service: svc, Destinations: dsts})
+	}
+
+	return snap, nil
+}
+
+// service returns the entry of the snapshot matching s, or nil.
+func (snap *StatsSnapshot) service(s *Service) *ServiceDestinations {
+	if snap == nil {
+		return nil
+	}
+	key := serviceKey(s)
+	for _, sd := range snap.Services {
+		if serviceKey(sd.Service) == key {
+			return sd
+		}
+	}
+	return nil
+}
+
+// destination returns the destination of sd matching d, or nil.
+func (sd *ServiceDestinations) destination(d *Destination) *Destination {
+	if sd == nil {
+		return nil
+	}
+	key := destinationKey(d)
+	for _, dst := range sd.Destinations {
+		if destinationKey(dst) == key {
+			return dst
+		}
+	}
+	return nil
+}
+
+// serviceKey returns a string identifying s the way the kernel does.
+func serviceKey(s *Service) string {
+	if s.FWMark > 0 {
+		return fmt.Sprintf("%d/fwm/%d", s.AddressFamily, s.FWMark)
+	}
+	return fmt.Sprintf("%d/%d/%s/%d", s.AddressFamily, s.Protocol, s.Address, s.Port)
+}
+
+// destinationKey returns a string identifying d within its service.
+func destinationKey(d *Destination) string {
+	return fmt.Sprintf("%s/%d", d.Address, d.Port)
+}
+
+// counterDelta returns the increase of a counter between two samples. A
+// counter going backwards has been zeroed in between, so its current value
+// is the increase.
+func counterDelta(prev, cur uint64) uint64 {
+	if cur < prev {
+		return cur
+	}
+	return cur - prev
+}
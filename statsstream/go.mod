@@ -0,0 +1,27 @@
+module github.com/kwanhur/ipvs/statsstream
+
+go 1.19
+
+require (
+	github.com/kwanhur/ipvs v0.0.0-20261016122243-b171d12773aa
+	google.golang.org/grpc v1.64.1
+	google.golang.org/protobuf v1.33.0
+	gotest.tools/v3 v3.0.3
+)
+
+require (
+	github.com/google/go-cmp v0.6.0 // indirect
+	github.com/pkg/errors v0.9.1 // indirect
+	github.com/sirupsen/logrus v1.4.2 // indirect
+	github.com/vishvananda/netlink v1.1.0 // indirect
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df // indirect
+	golang.org/x/net v0.26.0 // indirect
+	golang.org/x/sys v0.21.0 // indirect
+	golang.org/x/text v0.16.0 // indirect
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20240318140521-94a12d6c2237 // indirect
+)
+
+// Builds within the repository use the ipvs package next to this module;
+// the replace directive is ignored when this module is a dependency, which
+// gets the version required above.
+replace github.com/kwanhur/ipvs => ../
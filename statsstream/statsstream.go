@@ -0,0 +1,198 @@
+// +build linux
+
+// Package statsstream streams the statistics of the services of a host to
+// their subscribers over gRPC, so that remote dashboards do not need to
+// poll: a Server sends the snapshots of a host, a Subscription receives
+// them.
+//
+// The ipvs.v1.Statistics service has a single server streaming method,
+// Stats, answering an ipvspb.StatsRequest with an ipvspb.StatsSnapshot
+// every interval of the request.
+//
+// It is a separate module so that the ipvs package does not depend on
+// gRPC.
+package statsstream
+
+import (
+	"context"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/kwanhur/ipvs/ipvspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// statsMethod is the full name of the Stats method.
+const statsMethod = "/ipvs.v1.Statistics/Stats"
+
+// Default intervals of a Server.
+const (
+	DefaultInterval    = 10 * time.Second
+	DefaultMinInterval = time.Second
+)
+
+// Snapshotter takes statistics snapshots, like ipvs.Handle does.
+type Snapshotter interface {
+	GetStatsSnapshot() (*ipvs.StatsSnapshot, error)
+}
+
+// Server is the server of the ipvs.v1.Statistics service. Every
+// subscription takes snapshots of its own.
+type Server struct {
+	s Snapshotter
+
+	// Interval is the interval of the subscriptions which do not request
+	// one, DefaultInterval if zero.
+	Interval time.Duration
+	// MinInterval is the shortest interval granted to a subscription,
+	// bounding the dumps made for it, DefaultMinInterval if zero.
+	MinInterval time.Duration
+}
+
+// NewServer returns a server streaming the snapshots of s.
+func NewServer(s Snapshotter) *Server {
+	return &Server{s: s}
+}
+
+// Register registers srv on s.
+func Register(s *grpc.Server, srv *Server) {
+	s.RegisterService(&serviceDesc, srv)
+}
+
+// statisticsServer is the interface of the implementations of the service,
+// checked by grpc.Server.RegisterService.
+type statisticsServer interface {
+	stats(stream grpc.ServerStream) error
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "ipvs.v1.Statistics",
+	HandlerType: (*statisticsServer)(nil),
+	Streams: []grpc.StreamDesc{{
+		StreamName: "Stats",
+		Handler: func(srv interface{}, stream grpc.ServerStream) error {
+			return srv.(statisticsServer).stats(stream)
+		},
+		ServerStreams: true,
+	}},
+	Metadata: "ipvs.proto",
+}
+
+func (srv *Server) stats(stream grpc.ServerStream) error {
+	req := new(ipvspb.StatsRequest)
+	if err := stream.RecvMsg(req); err != nil {
+		return err
+	}
+	if d := req.GetInterval(); d != nil {
+		if err := d.CheckValid(); err != nil {
+			return status.Error(codes.InvalidArgument, err.Error())
+		}
+	}
+	interval := srv.interval(req.GetInterval().AsDuration())
+	var services []*ipvs.Service
+	for _, s := range req.GetServices() {
+		services = append(services, ipvspb.ToService(s))
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		snap, err := srv.s.GetStatsSnapshot()
+		if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		if err := stream.SendMsg(ipvspb.FromStatsSnapshot(filter(snap, services, req.GetNoDestinations()))); err != nil {
+			return err
+		}
+
+		select {
+		case <-stream.Context().Done():
+			return stream.Context().Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// interval returns the interval granted for the requested one.
+func (srv *Server) interval(requested time.Duration) time.Duration {
+	if requested <= 0 {
+		requested = srv.Interval
+		if requested <= 0 {
+			requested = DefaultInterval
+		}
+	}
+	min := srv.MinInterval
+	if min <= 0 {
+		min = DefaultMinInterval
+	}
+	if requested < min {
+		return min
+	}
+	return requested
+}
+
+// filter returns the snapshot of the services of snap matching services,
+// all if empty, without their destinations if noDestinations is set.
+func filter(snap *ipvs.StatsSnapshot, services []*ipvs.Service, noDestinations bool) *ipvs.StatsSnapshot {
+	res := &ipvs.StatsSnapshot{Time: snap.Time}
+	for _, sd := range snap.Services {
+		if len(services) > 0 && !matchAny(services, sd.Service) {
+			continue
+		}
+		if noDestinations {
+			sd = &ipvs.ServiceDestinations{Service: sd.Service}
+		}
+		res.Services = append(res.Services, sd)
+	}
+	return res
+}
+
+func matchAny(services []*ipvs.Service, s *ipvs.Service) bool {
+	for _, want := range services {
+		if want.AddressFamily != 0 && want.AddressFamily != s.AddressFamily {
+			continue
+		}
+		if want.FWMark > 0 || s.FWMark > 0 {
+			if want.FWMark == s.FWMark {
+				return true
+			}
+			continue
+		}
+		if want.Protocol == s.Protocol && want.Port == s.Port && want.Address.Equal(s.Address) {
+			return true
+		}
+	}
+	return false
+}
+
+// Subscription receives the statistics snapshots served on a connection.
+type Subscription struct {
+	stream grpc.ClientStream
+}
+
+// Subscribe subscribes to the snapshots served on cc, as requested by req,
+// until ctx is done.
+func Subscribe(ctx context.Context, cc grpc.ClientConnInterface, req *ipvspb.StatsRequest) (*Subscription, error) {
+	stream, err := cc.NewStream(ctx, &serviceDesc.Streams[0], statsMethod)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(req); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &Subscription{stream: stream}, nil
+}
+
+// Recv returns the next snapshot.
+func (s *Subscription) Recv() (*ipvs.StatsSnapshot, error) {
+	m := new(ipvspb.StatsSnapshot)
+	if err := s.stream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return ipvspb.ToStatsSnapshot(m), nil
+}
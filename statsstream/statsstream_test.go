@@ -0,0 +1,122 @@
+// +build linux
+
+package statsstream
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/kwanhur/ipvs/ipvspb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/durationpb"
+	"gotest.tools/v3/assert"
+)
+
+type fakeSnapshotter struct {
+	snaps chan *ipvs.StatsSnapshot
+	err   error
+}
+
+func (s *fakeSnapshotter) GetStatsSnapshot() (*ipvs.StatsSnapshot, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	return <-s.snaps, nil
+}
+
+func testSnapshot(conns uint64) *ipvs.StatsSnapshot {
+	return &ipvs.StatsSnapshot{
+		Time: time.Unix(1577836800, 0).UTC(),
+		Services: []*ipvs.ServiceDestinations{
+			{
+				Service:      &ipvs.Service{AddressFamily: 2, Protocol: ipvs.ProtocolTCP, Address: net.ParseIP("10.0.0.1").To4(), Port: 80, Stats: ipvs.SvcStats{Connections: conns}},
+				Destinations: []*ipvs.Destination{{Address: net.ParseIP("10.1.0.1").To4(), Port: 8080}},
+			},
+			{Service: &ipvs.Service{AddressFamily: 2, FWMark: 7}},
+		},
+	}
+}
+
+// dial serves srv and returns a connection to it.
+func dial(t *testing.T, srv *Server) (*grpc.ClientConn, func()) {
+	lis := bufconn.Listen(1 << 20)
+	s := grpc.NewServer()
+	Register(s, srv)
+	go s.Serve(lis)
+
+	cc, err := grpc.DialContext(context.Background(), "bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NilError(t, err)
+	return cc, func() {
+		cc.Close()
+		s.Stop()
+	}
+}
+
+func TestStats(t *testing.T) {
+	snapshotter := &fakeSnapshotter{snaps: make(chan *ipvs.StatsSnapshot, 2)}
+	srv := NewServer(snapshotter)
+	srv.MinInterval = time.Millisecond
+	cc, stop := dial(t, srv)
+	defer stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	snapshotter.snaps <- testSnapshot(1)
+	snapshotter.snaps <- testSnapshot(2)
+	sub, err := Subscribe(ctx, cc, &ipvspb.StatsRequest{
+		Interval:       durationpb.New(time.Millisecond),
+		Services:       []*ipvspb.Service{{Protocol: uint32(ipvs.ProtocolTCP), Address: net.ParseIP("10.0.0.1").To4(), Port: 80}},
+		NoDestinations: true,
+	})
+	assert.NilError(t, err)
+
+	for _, conns := range []uint64{1, 2} {
+		snap, err := sub.Recv()
+		assert.NilError(t, err)
+		assert.Equal(t, snap.Time, time.Unix(1577836800, 0).UTC())
+		assert.Equal(t, len(snap.Services), 1)
+		assert.Equal(t, snap.Services[0].Service.Stats.Connections, conns)
+		assert.Equal(t, len(snap.Services[0].Destinations), 0)
+	}
+}
+
+func TestStatsFailure(t *testing.T) {
+	cc, stop := dial(t, NewServer(&fakeSnapshotter{err: errors.New("dump failed")}))
+	defer stop()
+
+	sub, err := Subscribe(context.Background(), cc, &ipvspb.StatsRequest{})
+	assert.NilError(t, err)
+	_, err = sub.Recv()
+	assert.Equal(t, status.Code(err), codes.Unavailable)
+	assert.ErrorContains(t, err, "dump failed")
+}
+
+func TestInterval(t *testing.T) {
+	srv := &Server{}
+	assert.Equal(t, srv.interval(0), DefaultInterval)
+	assert.Equal(t, srv.interval(time.Millisecond), DefaultMinInterval)
+	assert.Equal(t, srv.interval(time.Minute), time.Minute)
+
+	srv = &Server{Interval: time.Minute, MinInterval: time.Millisecond}
+	assert.Equal(t, srv.interval(0), time.Minute)
+	assert.Equal(t, srv.interval(time.Millisecond), time.Millisecond)
+}
+
+func TestFilter(t *testing.T) {
+	snap := testSnapshot(1)
+	assert.Equal(t, len(filter(snap, nil, false).Services), 2)
+	assert.Equal(t, len(filter(snap, []*ipvs.Service{{FWMark: 7}}, false).Services), 1)
+	assert.Equal(t, len(filter(snap, []*ipvs.Service{{AddressFamily: 10, FWMark: 7}}, false).Services), 0)
+	assert.Equal(t, len(filter(snap, nil, true).Services[0].Destinations), 0)
+	assert.Equal(t, len(snap.Services[0].Destinations), 1)
+}
@@ -0,0 +1,198 @@
+// +build linux
+
+package ipvs
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/vishvananda/netlink"
+)
+
+// procThreadNetIPVSConn is the connection table of the network namespace of
+// the calling thread, which /proc/net, following the main thread, is not.
+var procThreadNetIPVSConn = "/proc/thread-self/net/ip_vs_conn"
+
+// linkStatistics returns the statistics of the interface name of the
+// network namespace of the calling thread.
+var linkStatistics = func(name string) (*netlink.LinkStatistics, error) {
+	link, err := netlink.LinkByName(name)
+	if err != nil {
+		return nil, err
+	}
+	if link.Attrs().Statistics == nil {
+		return nil, fmt.Errorf("no statistics for interface %s", name)
+	}
+	return link.Attrs().Statistics, nil
+}
+
+// SyncDaemonHealth describes whether a connection synchronization daemon is
+// actually exchanging sync messages.
+type SyncDaemonHealth struct {
+	Daemon *Daemon
+
+	// Packets is the number of packets sent (master) or multicast packets
+	// received (backup) on the daemon interface during the check window.
+	// The kernel does not account sync messages on their own, so every
+	// packet of the interface is counted, see SyncHealth.
+	Packets uint64
+
+	// Connections is the number of entries of the connection table, only
+	// set for a backup daemon.
+	Connections int
+
+	Healthy bool
+
+	// Reason explains why the daemon is not healthy.
+	Reason string
+}
+
+// SyncHealth is the result of a connection synchronization check. Master
+// and Backup are nil when the corresponding daemon is not running.
+type SyncHealth struct {
+	Master *SyncDaemonHealth
+	Backup *SyncDaemonHealth
+}
+
+// Healthy reports whether at least one daemon runs and every running daemon
+// is healthy.
+func (h *SyncHealth) Healthy() bool {
+	if h.Master == nil && h.Backup == nil {
+		return false
+	}
+	return (h.Master == nil || h.Master.Healthy) && (h.Backup == nil || h.Backup.Healthy)
+}
+
+// SyncHealth verifies that connection synchronization is working. A master
+// daemon is healthy when packets leave its multicast interface during window;
+// a backup daemon when multicast packets arrive on its interface during
+// window and the connection table is populated.
+//
+// The packets are a weak liveness signal: the kernel does not count the
+// packets of the sync group, so any traffic of the interface counts, and a
+// daemon whose interface carries other traffic is healthy even if it stopped
+// syncing. The signal is only reliable on an interface dedicated to
+// synchronization.
+//
+// The interface counters and the connection table are read in the network
+// namespace of the handle.
+func (i *Handle) SyncHealth(window time.Duration) (*SyncHealth, error) {
+	daemons, err := i.GetDaemons()
+	if err != nil {
+		return nil, err
+	}
+	return checkSyncHealth(daemons, window, i.inNamespace)
+}
+
+// checkSyncHealth checks daemons, reading the counters with the functions
+// run by inNamespace.
+func checkSyncHealth(daemons []*Daemon, window time.Duration, inNamespace func(fn func() error) error) (*SyncHealth, error) {
+	health := &SyncHealth{}
+	var checks []*SyncDaemonHealth
+	for _, d := range daemons {
+		dh := &SyncDaemonHealth{Daemon: d}
+		switch d.State {
+		case DaemonStateMaster:
+			health.Master = dh
+		case DaemonStateBackup:
+			health.Backup = dh
+		default:
+			continue
+		}
+		checks = append(checks, dh)
+	}
+	if len(checks) == 0 {
+		return health, nil
+	}
+
+	sample := func() ([]uint64, error) {
+		counters := make([]uint64, len(checks))
+		err := inNamespace(func() error {
+			for n, dh := range checks {
+				v, err := syncPacketCounter(dh.Daemon)
+				if err != nil {
+					return err
+				}
+				counters[n] = v
+			}
+			return nil
+		})
+		return counters, err
+	}
+
+	before, err := sample()
+	if err != nil {
+		return nil, err
+	}
+	time.Sleep(window)
+	after, err := sample()
+	if err != nil {
+		return nil, err
+	}
+
+	for n, dh := range checks {
+		dh.Packets = counterDelta(before[n], after[n])
+		dh.Healthy = dh.Packets > 0
+		if !dh.Healthy {
+			dh.Reason = fmt.Sprintf("no packets on %s during %s", dh.Daemon.McastIfn, window)
+		}
+	}
+
+	if b := health.Backup; b != nil {
+		var conns int
+		err := inNamespace(func() (err error) {
+			conns, err = countConnections()
+			return err
+		})
+		if err != nil {
+			return nil, err
+		}
+		b.Connections = conns
+		if b.Healthy && conns == 0 {
+			b.Healthy = false
+			b.Reason = "connection table is empty"
+		}
+	}
+
+	return health, nil
+}
+
+// syncPacketCounter returns the counter of the daemon interface reflecting
+// its sync traffic: transmitted packets for a master, received multicast
+// packets for a backup.
+func syncPacketCounter(d *Daemon) (uint64, error) {
+	st, err := linkStatistics(d.McastIfn)
+	if err != nil {
+		return 0, err
+	}
+	if d.State == DaemonStateBackup {
+		return st.Multicast, nil
+	}
+	return st.TxPackets, nil
+}
+
+// countConnections returns the number of entries of the connection table.
+func countConnections() (int, error) {
+	f, err := os.Open(procThreadNetIPVSConn)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n++
+	}
+	if err := scanner.Err(); err != nil {
+		return 0, err
+	}
+
+	// The first line is a header.
+	if n > 0 {
+		n--
+	}
+	return n, nil
+}
@@ -0,0 +1,101 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/vishvananda/netlink"
+	"gotest.tools/v3/assert"
+)
+
+func TestSyncHealth(t *testing.T) {
+	dir, err := ioutil.TempDir("", "synchealth")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	var (
+		mu    sync.Mutex
+		links = map[string]*netlink.LinkStatistics{
+			"eth0": {TxPackets: 100},
+			"eth1": {Multicast: 50},
+		}
+		samples int
+	)
+	setCounters := func(tx, multicast uint64) {
+		mu.Lock()
+		defer mu.Unlock()
+		links["eth0"].TxPackets = tx
+		links["eth1"].Multicast = multicast
+	}
+	defer func(stats func(string) (*netlink.LinkStatistics, error), conn string) {
+		linkStatistics, procThreadNetIPVSConn = stats, conn
+	}(linkStatistics, procThreadNetIPVSConn)
+	linkStatistics = func(name string) (*netlink.LinkStatistics, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		st, ok := links[name]
+		if !ok {
+			return nil, fmt.Errorf("no interface %s", name)
+		}
+		res := *st
+		return &res, nil
+	}
+	procThreadNetIPVSConn = filepath.Join(dir, "ip_vs_conn")
+	inNamespace := func(fn func() error) error {
+		samples++
+		return fn()
+	}
+
+	writeFile := func(name, content string) {
+		assert.NilError(t, ioutil.WriteFile(name, []byte(content), 0644))
+	}
+	writeFile(procThreadNetIPVSConn, "Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData\n")
+
+	daemons := []*Daemon{
+		{State: DaemonStateMaster, McastIfn: "eth0", SyncId: 1},
+		{State: DaemonStateBackup, McastIfn: "eth1", SyncId: 1},
+	}
+
+	health, err := checkSyncHealth(daemons, 10*time.Millisecond, inNamespace)
+	assert.NilError(t, err)
+	assert.Equal(t, samples, 3)
+	assert.Assert(t, !health.Healthy())
+	assert.Assert(t, !health.Master.Healthy)
+	assert.Assert(t, !health.Backup.Healthy)
+
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		setCounters(110, 55)
+	}()
+	health, err = checkSyncHealth(daemons, 100*time.Millisecond, inNamespace)
+	assert.NilError(t, err)
+	assert.Assert(t, health.Master.Healthy)
+	assert.Equal(t, health.Master.Packets, uint64(10))
+	assert.Assert(t, !health.Backup.Healthy)
+	assert.Equal(t, health.Backup.Reason, "connection table is empty")
+
+	writeFile(procThreadNetIPVSConn, "Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData\n"+
+		"TCP 0A000001 D431 0A000002 0050 0A010001 0050 ESTABLISHED     899\n")
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		setCounters(120, 60)
+	}()
+	health, err = checkSyncHealth(daemons, 100*time.Millisecond, inNamespace)
+	assert.NilError(t, err)
+	assert.Assert(t, health.Healthy())
+	assert.Equal(t, health.Backup.Connections, 1)
+
+	_, err = checkSyncHealth([]*Daemon{{State: DaemonStateMaster, McastIfn: "eth2"}}, time.Millisecond, inNamespace)
+	assert.ErrorContains(t, err, "no interface eth2")
+
+	health, err = checkSyncHealth(nil, time.Second, inNamespace)
+	assert.NilError(t, err)
+	assert.Assert(t, !health.Healthy())
+}
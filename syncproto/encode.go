@@ -0,0 +1,240 @@
+// +build linux
+
+package syncproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"golang.org/x/sys/unix"
+)
+
+// maxConnV1Len is the largest version 1 connection, whose size is 12 bits
+// wide.
+const maxConnV1Len = sizeMask
+
+// Encode encodes m in the format of its Version, as sent by a master. The
+// sequence data of version 0 messages is encoded in little endian, see
+// Decode. Version 0 only supports IPv4 connections and drops the fields it
+// has no room for: FWMark, Timeout, the persistence engine and the flags
+// past the 16th bit.
+func Encode(m *Message) ([]byte, error) {
+	if len(m.Conns) > 255 {
+		return nil, fmt.Errorf("too many connections in a sync message: %d", len(m.Conns))
+	}
+
+	var b []byte
+	switch m.Version {
+	case 0:
+		b = []byte{byte(len(m.Conns)), m.SyncID, 0, 0}
+		for _, c := range m.Conns {
+			var err error
+			if b, err = appendConnV0(b, c); err != nil {
+				return nil, err
+			}
+		}
+	case syncVersion1:
+		b = []byte{0, m.SyncID, 0, 0, byte(len(m.Conns)), syncVersion1, 0, 0}
+		for _, c := range m.Conns {
+			var err error
+			if b, err = appendConnV1(b, c); err != nil {
+				return nil, err
+			}
+		}
+	default:
+		return nil, fmt.Errorf("unsupported sync message version %d", m.Version)
+	}
+
+	if len(b) > 0xffff {
+		return nil, errors.New("sync message too large")
+	}
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	return b, nil
+}
+
+func appendConnV0(b []byte, c *Conn) ([]byte, error) {
+	client, virtual, dest := c.Client.Address.To4(), c.Virtual.Address.To4(), c.Destination.Address.To4()
+	if client == nil || virtual == nil || dest == nil {
+		return nil, errors.New("version 0 sync messages only support IPv4 connections")
+	}
+
+	flags := c.Flags &^ (ipvs.ConnectionFlagInSeq | ipvs.ConnectionFlagOutSeq)
+	if c.InSeq != nil || c.OutSeq != nil {
+		flags |= ipvs.ConnectionFlagInSeq | ipvs.ConnectionFlagOutSeq
+	}
+
+	// The layout is the one of struct ip_vs_sync_conn_v0.
+	b = append(b, 0, byte(c.Protocol))
+	b = appendUint16(b, c.Client.Port)
+	b = appendUint16(b, c.Virtual.Port)
+	b = appendUint16(b, c.Destination.Port)
+	b = append(b, client...)
+	b = append(b, virtual...)
+	b = append(b, dest...)
+	b = appendUint16(b, uint16(flags))
+	b = appendUint16(b, c.State)
+	if c.InSeq != nil || c.OutSeq != nil {
+		b = appendSeqs(b, c, binary.LittleEndian)
+	}
+	return b, nil
+}
+
+func appendConnV1(b []byte, c *Conn) ([]byte, error) {
+	start := len(b)
+
+	typ, addrs := byte(0), [][]byte{c.Client.Address.To4(), c.Virtual.Address.To4(), c.Destination.Address.To4()}
+	if addrs[0] == nil || addrs[1] == nil || addrs[2] == nil {
+		typ = typeInet6
+		addrs = [][]byte{c.Client.Address.To16(), c.Virtual.Address.To16(), c.Destination.Address.To16()}
+		if addrs[0] == nil || addrs[1] == nil || addrs[2] == nil {
+			return nil, errors.New("invalid connection address")
+		}
+	}
+
+	b = append(b, typ, byte(c.Protocol), 0, 0)
+	b = appendUint32(b, uint32(c.Flags))
+	b = appendUint16(b, c.State)
+	b = appendUint16(b, c.Client.Port)
+	b = appendUint16(b, c.Virtual.Port)
+	b = appendUint16(b, c.Destination.Port)
+	b = appendUint32(b, c.FWMark)
+	b = appendUint32(b, uint32(c.Timeout/time.Second))
+	for _, addr := range addrs {
+		b = append(b, addr...)
+	}
+
+	if c.InSeq != nil || c.OutSeq != nil {
+		b = append(b, optSeqData, optionsLen)
+		b = appendSeqs(b, c, binary.BigEndian)
+	}
+	if len(c.PEData) > 0 {
+		if len(c.PEData) > 255 || len(c.PEName) > 255 {
+			return nil, errors.New("persistence engine data too large")
+		}
+		b = append(b, optPEData, byte(len(c.PEData)))
+		b = append(b, c.PEData...)
+		b = append(b, optPEName, byte(len(c.PEName)))
+		b = append(b, c.PEName...)
+	}
+
+	size := len(b) - start
+	if size > maxConnV1Len {
+		return nil, errors.New("sync connection too large")
+	}
+	binary.BigEndian.PutUint16(b[start+2:start+4], uint16(size))
+
+	// Connections are padded to 4 bytes.
+	for (len(b)-start)%4 != 0 {
+		b = append(b, 0)
+	}
+	return b, nil
+}
+
+func appendSeqs(b []byte, c *Conn, order binary.ByteOrder) []byte {
+	for _, seq := range []*Seq{c.InSeq, c.OutSeq} {
+		if seq == nil {
+			seq = &Seq{}
+		}
+		for _, v := range []uint32{seq.InitSeq, uint32(seq.Delta), uint32(seq.PreviousDelta)} {
+			buf := make([]byte, 4)
+			order.PutUint32(buf, v)
+			b = append(b, buf...)
+		}
+	}
+	return b
+}
+
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v>>8), byte(v))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// Sender sends sync messages to a multicast group, like a master director,
+// e.g. to seed the connection table of a backup before a migration. The
+// backups only accept the messages of their sync ID.
+type Sender struct {
+	conn *net.UDPConn
+}
+
+// Dial returns a Sender of sync messages to group and port through the
+// interface named ifname, with the multicast TTL ttl. A nil group, a zero
+// port and a zero ttl select DefaultGroup, DefaultPort and a TTL of 1.
+func Dial(ifname string, group net.IP, port, ttl int) (*Sender, error) {
+	if group == nil {
+		group = DefaultGroup
+	}
+	if port == 0 {
+		port = DefaultPort
+	}
+	if ttl == 0 {
+		ttl = 1
+	}
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+
+	network := "udp4"
+	if group.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.DialUDP(network, nil, &net.UDPAddr{IP: group, Port: port})
+	if err != nil {
+		return nil, err
+	}
+	if err := setMulticastOptions(conn, group.To4() == nil, ifi.Index, ttl); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &Sender{conn: conn}, nil
+}
+
+// setMulticastOptions sends the multicast packets of conn through the
+// interface index with ttl.
+func setMulticastOptions(conn *net.UDPConn, inet6 bool, index, ttl int) error {
+	rc, err := conn.SyscallConn()
+	if err != nil {
+		return err
+	}
+
+	var sockErr error
+	err = rc.Control(func(fd uintptr) {
+		if inet6 {
+			if sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_IF, index); sockErr != nil {
+				return
+			}
+			sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IPV6, unix.IPV6_MULTICAST_HOPS, ttl)
+			return
+		}
+		if sockErr = unix.SetsockoptIPMreqn(int(fd), unix.IPPROTO_IP, unix.IP_MULTICAST_IF, &unix.IPMreqn{Ifindex: int32(index)}); sockErr != nil {
+			return
+		}
+		sockErr = unix.SetsockoptInt(int(fd), unix.IPPROTO_IP, unix.IP_MULTICAST_TTL, ttl)
+	})
+	if err != nil {
+		return err
+	}
+	return sockErr
+}
+
+// Send encodes and sends m.
+func (s *Sender) Send(m *Message) error {
+	b, err := Encode(m)
+	if err != nil {
+		return err
+	}
+	_, err = s.conn.Write(b)
+	return err
+}
+
+// Close closes the Sender.
+func (s *Sender) Close() error {
+	return s.conn.Close()
+}
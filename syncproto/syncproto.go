@@ -0,0 +1,342 @@
+// +build linux
+
+// Package syncproto decodes the messages of the IPVS connection
+// synchronization protocol, sent by master directors to the multicast group
+// of their backups, in both the version 0 and the version 1 formats.
+package syncproto
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+)
+
+// Default multicast group and port of the sync daemons.
+var (
+	DefaultGroup  = net.IPv4(224, 0, 0, 81)
+	DefaultGroup6 = net.ParseIP("ff02::81")
+)
+
+// DefaultPort is the default destination port of sync messages.
+const DefaultPort = 8848
+
+// Sizes of the fixed parts of the sync messages.
+const (
+	headerV0Len  = 4
+	connV0Len    = 24
+	optionsLen   = 24
+	headerV1Len  = 8
+	connV1Len    = 24
+	connV1Addr4  = 3 * net.IPv4len
+	connV1Addr6  = 3 * net.IPv6len
+	syncVersion1 = 1
+)
+
+// Version 1 connection attributes.
+const (
+	typeInet6 = 0x01
+
+	sizeMask = 0x0fff
+
+	optSeqData = 1
+	optPEData  = 2
+	optPEName  = 3
+	// optParam flags the parameters the receiver may ignore, the others
+	// being mandatory.
+	optParam = 0x40
+)
+
+// TCP connection states, as numbered by the kernel.
+var tcpStates = []string{
+	"NONE", "ESTABLISHED", "SYN_SENT", "SYN_RECV", "FIN_WAIT", "TIME_WAIT",
+	"CLOSE", "CLOSE_WAIT", "LAST_ACK", "LISTEN", "SYNACK",
+}
+
+// TCPStateName returns the name of the TCP state, as in
+// /proc/net/ip_vs_conn.
+func TCPStateName(state uint16) string {
+	if int(state) < len(tcpStates) {
+		return tcpStates[state]
+	}
+	return fmt.Sprintf("STATE(%d)", state)
+}
+
+// Seq is the sequence number adjustment of a connection, used by
+// application helpers rewriting payloads such as FTP.
+type Seq struct {
+	InitSeq       uint32
+	Delta         int32
+	PreviousDelta int32
+}
+
+// Conn is a synchronized connection.
+type Conn struct {
+	Protocol    ipvs.IPProto
+	Flags       ipvs.ConnectionFlags
+	State       uint16
+	Client      ipvs.Endpoint
+	Virtual     ipvs.Endpoint
+	Destination ipvs.Endpoint
+
+	// FWMark and Timeout are only carried by version 1 messages.
+	FWMark  uint32
+	Timeout time.Duration
+
+	// InSeq and OutSeq are set for connections with sequence number
+	// adjustments.
+	InSeq  *Seq
+	OutSeq *Seq
+
+	PEName string
+	PEData []byte
+}
+
+// Message is a sync message.
+type Message struct {
+	Version int
+	SyncID  uint8
+	Conns   []*Conn
+}
+
+// ErrTruncated is returned for messages shorter than they claim.
+var ErrTruncated = errors.New("truncated sync message")
+
+// Decode decodes the sync message b. The sequence data of version 0
+// messages is in the byte order of the master, assumed to be little endian.
+func Decode(b []byte) (*Message, error) {
+	if len(b) < headerV0Len {
+		return nil, ErrTruncated
+	}
+	// The first byte is the connection count in version 0, zero in
+	// version 1.
+	if b[0] != 0 {
+		return decodeV0(b)
+	}
+	if len(b) < headerV1Len {
+		return nil, ErrTruncated
+	}
+	if b[5] != syncVersion1 {
+		return nil, fmt.Errorf("unsupported sync message version %d", b[5])
+	}
+	return decodeV1(b)
+}
+
+func messageSize(b []byte) ([]byte, error) {
+	size := int(binary.BigEndian.Uint16(b[2:4]))
+	if size > len(b) {
+		return nil, ErrTruncated
+	}
+	return b[:size], nil
+}
+
+func decodeV0(b []byte) (*Message, error) {
+	b, err := messageSize(b)
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{Version: 0, SyncID: b[1]}
+	count := int(b[0])
+
+	p := b[headerV0Len:]
+	for n := 0; n < count; n++ {
+		if len(p) < connV0Len {
+			return nil, ErrTruncated
+		}
+		// The layout is the one of struct ip_vs_sync_conn_v0.
+		c := &Conn{
+			Protocol: ipvs.IPProto(p[1]),
+			Flags:    ipvs.ConnectionFlags(binary.BigEndian.Uint16(p[20:22])),
+			State:    binary.BigEndian.Uint16(p[22:24]),
+		}
+		c.Client.Port = binary.BigEndian.Uint16(p[2:4])
+		c.Virtual.Port = binary.BigEndian.Uint16(p[4:6])
+		c.Destination.Port = binary.BigEndian.Uint16(p[6:8])
+		c.Client.Address = copyIP(p[8:12])
+		c.Virtual.Address = copyIP(p[12:16])
+		c.Destination.Address = copyIP(p[16:20])
+		p = p[connV0Len:]
+
+		if c.Flags&(ipvs.ConnectionFlagInSeq|ipvs.ConnectionFlagOutSeq) != 0 {
+			if len(p) < optionsLen {
+				return nil, ErrTruncated
+			}
+			c.InSeq, c.OutSeq = decodeSeqs(p, binary.LittleEndian)
+			p = p[optionsLen:]
+		}
+		m.Conns = append(m.Conns, c)
+	}
+	return m, nil
+}
+
+func decodeV1(b []byte) (*Message, error) {
+	b, err := messageSize(b)
+	if err != nil {
+		return nil, err
+	}
+	m := &Message{Version: syncVersion1, SyncID: b[1]}
+	count := int(b[4])
+
+	p := b[headerV1Len:]
+	for n := 0; n < count; n++ {
+		if len(p) < connV1Len {
+			return nil, ErrTruncated
+		}
+		size := int(binary.BigEndian.Uint16(p[2:4]) & sizeMask)
+		if size > len(p) {
+			return nil, ErrTruncated
+		}
+		c, err := decodeConnV1(p[:size])
+		if err != nil {
+			return nil, err
+		}
+		m.Conns = append(m.Conns, c)
+
+		// Connections are padded to 4 bytes.
+		size = (size + 3) &^ 3
+		if size > len(p) {
+			size = len(p)
+		}
+		p = p[size:]
+	}
+	return m, nil
+}
+
+func decodeConnV1(p []byte) (*Conn, error) {
+	addrLen, ipLen := connV1Addr4, net.IPv4len
+	if p[0]&typeInet6 != 0 {
+		addrLen, ipLen = connV1Addr6, net.IPv6len
+	}
+	if len(p) < connV1Len+addrLen {
+		return nil, ErrTruncated
+	}
+
+	c := &Conn{
+		Protocol: ipvs.IPProto(p[1]),
+		Flags:    ipvs.ConnectionFlags(binary.BigEndian.Uint32(p[4:8])),
+		State:    binary.BigEndian.Uint16(p[8:10]),
+		FWMark:   binary.BigEndian.Uint32(p[16:20]),
+		Timeout:  time.Duration(binary.BigEndian.Uint32(p[20:24])) * time.Second,
+	}
+	c.Client.Port = binary.BigEndian.Uint16(p[10:12])
+	c.Virtual.Port = binary.BigEndian.Uint16(p[12:14])
+	c.Destination.Port = binary.BigEndian.Uint16(p[14:16])
+	addrs := p[connV1Len:]
+	c.Client.Address = copyIP(addrs[:ipLen])
+	c.Virtual.Address = copyIP(addrs[ipLen : 2*ipLen])
+	c.Destination.Address = copyIP(addrs[2*ipLen : 3*ipLen])
+
+	params := p[connV1Len+addrLen:]
+	for len(params) > 0 {
+		if len(params) < 2 || len(params) < 2+int(params[1]) {
+			return nil, ErrTruncated
+		}
+		ptype, data := params[0], params[2:2+int(params[1])]
+		params = params[2+len(data):]
+		if len(data) == 0 {
+			return nil, fmt.Errorf("empty sync parameter %d", ptype&^optParam)
+		}
+
+		switch ptype &^ optParam {
+		case optSeqData:
+			if len(data) < optionsLen {
+				return nil, ErrTruncated
+			}
+			c.InSeq, c.OutSeq = decodeSeqs(data, binary.BigEndian)
+		case optPEData:
+			c.PEData = append([]byte(nil), data...)
+		case optPEName:
+			c.PEName = string(data)
+		default:
+			if ptype&optParam == 0 {
+				return nil, fmt.Errorf("unknown mandatory sync parameter %d", ptype&^optParam)
+			}
+		}
+	}
+	return c, nil
+}
+
+func decodeSeqs(b []byte, order binary.ByteOrder) (*Seq, *Seq) {
+	seq := func(b []byte) *Seq {
+		return &Seq{
+			InitSeq:       order.Uint32(b[0:4]),
+			Delta:         int32(order.Uint32(b[4:8])),
+			PreviousDelta: int32(order.Uint32(b[8:12])),
+		}
+	}
+	return seq(b[0:12]), seq(b[12:24])
+}
+
+func copyIP(b []byte) net.IP {
+	return net.IP(append([]byte(nil), b...))
+}
+
+// Listener receives the sync messages sent to a multicast group.
+type Listener struct {
+	conn   *net.UDPConn
+	syncID int
+	buf    []byte
+}
+
+// Listen joins group on the interface named ifname and returns a Listener
+// for the sync messages sent to port. A nil group and a zero port select
+// DefaultGroup and DefaultPort. A negative syncID accepts the messages of
+// every master, others only the ones of the masters using syncID.
+//
+// The kernel backup daemon listening to the same group and port does not
+// prevent the Listener from receiving the messages too.
+func Listen(ifname string, group net.IP, port int, syncID int) (*Listener, error) {
+	if group == nil {
+		group = DefaultGroup
+	}
+	if port == 0 {
+		port = DefaultPort
+	}
+	ifi, err := net.InterfaceByName(ifname)
+	if err != nil {
+		return nil, err
+	}
+
+	network := "udp4"
+	if group.To4() == nil {
+		network = "udp6"
+	}
+	conn, err := net.ListenMulticastUDP(network, ifi, &net.UDPAddr{IP: group, Port: port})
+	if err != nil {
+		return nil, err
+	}
+	return &Listener{conn: conn, syncID: syncID, buf: make([]byte, 65536)}, nil
+}
+
+// Read returns the next sync message, and the address of the master which
+// sent it. Messages of other sync IDs are skipped. Undecodable messages
+// are returned as errors; the Listener remains usable.
+func (l *Listener) Read() (*Message, net.Addr, error) {
+	for {
+		n, addr, err := l.conn.ReadFrom(l.buf)
+		if err != nil {
+			return nil, nil, err
+		}
+		m, err := Decode(l.buf[:n])
+		if err != nil {
+			return nil, addr, err
+		}
+		if l.syncID >= 0 && int(m.SyncID) != l.syncID {
+			continue
+		}
+		return m, addr, nil
+	}
+}
+
+// SetReadDeadline sets the deadline of the pending and future Read calls.
+func (l *Listener) SetReadDeadline(t time.Time) error {
+	return l.conn.SetReadDeadline(t)
+}
+
+// Close leaves the group.
+func (l *Listener) Close() error {
+	return l.conn.Close()
+}
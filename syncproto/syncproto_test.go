@@ -0,0 +1,227 @@
+// +build linux
+
+package syncproto
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+// testMessageV0 is a version 0 message laid out like the kernel structs
+// ip_vs_sync_mesg_v0, ip_vs_sync_conn_v0 and ip_vs_sync_conn_options.
+var testMessageV0 = []byte{
+	// nr_conns, syncid, size
+	0x02, 0x07, 0x00, 0x4c,
+	// reserved, protocol, cport, vport, dport
+	0x00, 0x06, 0xd4, 0x31, 0x00, 0x50, 0x1f, 0x90,
+	// caddr, vaddr, daddr
+	0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02, 0x0a, 0x01, 0x00, 0x01,
+	// flags (DirectRoute), state (ESTABLISHED)
+	0x00, 0x03, 0x00, 0x01,
+	0x00, 0x06, 0xd4, 0x31, 0x00, 0x50, 0x1f, 0x90,
+	0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02, 0x0a, 0x01, 0x00, 0x01,
+	// flags (Masq, InSeq, OutSeq), state (ESTABLISHED)
+	0x06, 0x00, 0x00, 0x01,
+	// in_seq and out_seq, in the byte order of the master
+	0xe8, 0x03, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00,
+	0xd0, 0x07, 0x00, 0x00, 0x03, 0x00, 0x00, 0x00, 0x04, 0x00, 0x00, 0x00,
+}
+
+func TestDecodeV0(t *testing.T) {
+	b := testMessageV0
+	m, err := Decode(b)
+	assert.NilError(t, err)
+	assert.Equal(t, m.Version, 0)
+	assert.Equal(t, m.SyncID, uint8(7))
+	assert.Equal(t, len(m.Conns), 2)
+
+	c := m.Conns[0]
+	assert.Equal(t, c.Protocol, ipvs.ProtocolTCP)
+	assert.Equal(t, c.Flags, ipvs.ConnectionFlags(ipvs.ConnectionFlagDirectRoute))
+	assert.Equal(t, TCPStateName(c.State), "ESTABLISHED")
+	assert.Equal(t, c.Client.String(), "10.0.0.1:54321")
+	assert.Equal(t, c.Virtual.String(), "10.0.0.2:80")
+	assert.Equal(t, c.Destination.String(), "10.1.0.1:8080")
+	assert.Assert(t, c.InSeq == nil)
+
+	c = m.Conns[1]
+	assert.DeepEqual(t, c.InSeq, &Seq{InitSeq: 1000, Delta: 2, PreviousDelta: 1})
+	assert.DeepEqual(t, c.OutSeq, &Seq{InitSeq: 2000, Delta: 3, PreviousDelta: 4})
+
+	_, err = Decode(b[:len(b)-1])
+	assert.Equal(t, err, ErrTruncated)
+}
+
+func TestDecodeV1(t *testing.T) {
+	conn := func(inet6 bool, params ...[]byte) []byte {
+		typ, addrs := byte(0), []byte{10, 0, 0, 1, 10, 0, 0, 2, 10, 1, 0, 1}
+		if inet6 {
+			typ = 1
+			addrs = nil
+			for _, ip := range []string{"2001:db8::1", "2001:db8::2", "2001:db8::1:1"} {
+				addrs = append(addrs, net.ParseIP(ip)...)
+			}
+		}
+		b := []byte{typ, 17, 0, 0}
+		b = appendUint32(b, ipvs.ConnectionFlagTunnel)
+		b = appendUint16(b, 0)
+		b = appendUint16(b, 5353)
+		b = appendUint16(b, 53)
+		b = appendUint16(b, 53)
+		b = appendUint32(b, 42)  // fwmark
+		b = appendUint32(b, 300) // timeout
+		b = append(b, addrs...)
+		for _, p := range params {
+			b = append(b, p...)
+		}
+		binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+		for len(b)%4 != 0 {
+			b = append(b, 0)
+		}
+		return b
+	}
+	param := func(typ byte, data []byte) []byte {
+		return append([]byte{typ, byte(len(data))}, data...)
+	}
+
+	seqs := make([]byte, 0, optionsLen)
+	for _, v := range []uint32{1000, 2, 1, 2000, 3, 4} {
+		seqs = appendUint32(seqs, v)
+	}
+
+	b := []byte{0, 3, 0, 0, 2, 1, 0, 0}
+	b = append(b, conn(false, param(optPEName, []byte("sip")), param(optPEData, []byte("call-1")))...)
+	b = append(b, conn(true, param(optSeqData, seqs), param(9|optParam, []byte{1, 2}))...)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+
+	m, err := Decode(b)
+	assert.NilError(t, err)
+	assert.Equal(t, m.Version, 1)
+	assert.Equal(t, m.SyncID, uint8(3))
+	assert.Equal(t, len(m.Conns), 2)
+
+	c := m.Conns[0]
+	assert.Equal(t, c.Protocol, ipvs.ProtocolUDP)
+	assert.Equal(t, c.Flags.String(), "Tunnel")
+	assert.Equal(t, c.Client.String(), "10.0.0.1:5353")
+	assert.Equal(t, c.FWMark, uint32(42))
+	assert.Equal(t, c.Timeout, 300*time.Second)
+	assert.Equal(t, c.PEName, "sip")
+	assert.Equal(t, string(c.PEData), "call-1")
+
+	c = m.Conns[1]
+	assert.Equal(t, c.Destination.String(), "[2001:db8::1:1]:53")
+	assert.DeepEqual(t, c.OutSeq, &Seq{InitSeq: 2000, Delta: 3, PreviousDelta: 4})
+
+	// Unknown mandatory parameters and empty parameters are errors.
+	b = []byte{0, 3, 0, 0, 1, 1, 0, 0}
+	b = append(b, conn(false, param(optPEName|optParam, nil))...)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	_, err = Decode(b)
+	assert.ErrorContains(t, err, "empty sync parameter 3")
+
+	b = []byte{0, 3, 0, 0, 1, 1, 0, 0}
+	b = append(b, conn(false, param(9, []byte{1}))...)
+	binary.BigEndian.PutUint16(b[2:4], uint16(len(b)))
+	_, err = Decode(b)
+	assert.ErrorContains(t, err, "unknown mandatory")
+
+	b[5] = 2
+	_, err = Decode(b)
+	assert.ErrorContains(t, err, "unsupported sync message version 2")
+}
+
+func TestEncode(t *testing.T) {
+	conn := func(client, virtual, dest string) *Conn {
+		return &Conn{
+			Protocol:    ipvs.ProtocolTCP,
+			Flags:       ipvs.ConnectionFlagDirectRoute,
+			State:       1,
+			Client:      ipvs.Endpoint{Address: net.ParseIP(client).To4(), Port: 54321},
+			Virtual:     ipvs.Endpoint{Address: net.ParseIP(virtual).To4(), Port: 80},
+			Destination: ipvs.Endpoint{Address: net.ParseIP(dest).To4(), Port: 80},
+		}
+	}
+
+	v0 := &Message{Version: 0, SyncID: 1, Conns: []*Conn{
+		conn("10.0.0.1", "10.0.0.2", "10.1.0.1"),
+		conn("10.0.0.3", "10.0.0.2", "10.1.0.2"),
+	}}
+	v0.Conns[1].Flags |= ipvs.ConnectionFlagInSeq | ipvs.ConnectionFlagOutSeq
+	v0.Conns[1].InSeq = &Seq{InitSeq: 1, Delta: -2, PreviousDelta: 3}
+	v0.Conns[1].OutSeq = &Seq{InitSeq: 4}
+
+	b, err := Encode(v0)
+	assert.NilError(t, err)
+	assert.Equal(t, len(b), headerV0Len+2*connV0Len+optionsLen)
+	m, err := Decode(b)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m, v0)
+
+	v1 := &Message{Version: 1, SyncID: 2, Conns: []*Conn{
+		conn("10.0.0.1", "10.0.0.2", "10.1.0.1"),
+		{
+			Protocol:    ipvs.ProtocolUDP,
+			Flags:       ipvs.ConnectionFlagTunnel | ipvs.ConnectionFlagTemplate,
+			Client:      ipvs.Endpoint{Address: net.ParseIP("2001:db8::1"), Port: 5060},
+			Virtual:     ipvs.Endpoint{Address: net.ParseIP("2001:db8::2"), Port: 5060},
+			Destination: ipvs.Endpoint{Address: net.ParseIP("2001:db8::1:1"), Port: 5060},
+			FWMark:      7,
+			Timeout:     time.Minute,
+			OutSeq:      &Seq{InitSeq: 5},
+			PEName:      "sip",
+			PEData:      []byte("call"),
+		},
+	}}
+	v1.Conns[1].InSeq = &Seq{}
+
+	b, err = Encode(v1)
+	assert.NilError(t, err)
+	assert.Equal(t, len(b)%4, 0)
+	m, err = Decode(b)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, m, v1)
+
+	v0.Conns = v1.Conns[1:]
+	_, err = Encode(v0)
+	assert.ErrorContains(t, err, "only support IPv4")
+}
+
+func TestEncodeKernelLayout(t *testing.T) {
+	m, err := Decode(testMessageV0)
+	assert.NilError(t, err)
+	b, err := Encode(m)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, testMessageV0)
+
+	// A version 1 message laid out like the kernel structs ip_vs_sync_mesg
+	// and ip_vs_sync_v4.
+	v1 := []byte{
+		// reserved, syncid, size, nr_conns, version, spare
+		0x00, 0x07, 0x00, 0x2c, 0x01, 0x01, 0x00, 0x00,
+		// type, protocol, ver_size, flags (DirectRoute)
+		0x00, 0x06, 0x00, 0x24, 0x00, 0x00, 0x00, 0x03,
+		// state (ESTABLISHED), cport, vport, dport
+		0x00, 0x01, 0xd4, 0x31, 0x00, 0x50, 0x1f, 0x90,
+		// fwmark, timeout
+		0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x03, 0x84,
+		// caddr, vaddr, daddr
+		0x0a, 0x00, 0x00, 0x01, 0x0a, 0x00, 0x00, 0x02, 0x0a, 0x01, 0x00, 0x01,
+	}
+	b, err = Encode(&Message{Version: 1, SyncID: 7, Conns: []*Conn{{
+		Protocol:    ipvs.ProtocolTCP,
+		Flags:       ipvs.ConnectionFlagDirectRoute,
+		State:       1,
+		Client:      ipvs.Endpoint{Address: net.IPv4(10, 0, 0, 1), Port: 54321},
+		Virtual:     ipvs.Endpoint{Address: net.IPv4(10, 0, 0, 2), Port: 80},
+		Destination: ipvs.Endpoint{Address: net.IPv4(10, 1, 0, 1), Port: 8080},
+		Timeout:     15 * time.Minute,
+	}}})
+	assert.NilError(t, err)
+	assert.DeepEqual(t, b, v1)
+}
@@ -0,0 +1,241 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/vishvananda/netns"
+)
+
+var procSysNetIPv4VS = "/proc/sys/net/ipv4/vs"
+
+// Sysctl is an IPVS tunable of /proc/sys/net/ipv4/vs, set per network
+// namespace. See the ipvs-sysctl documentation of the kernel for their
+// meaning.
+type Sysctl string
+
+// IPVS tunables. Not every kernel has all of them.
+const (
+	SysctlAmDropRate              Sysctl = "am_droprate"
+	SysctlAmemThresh              Sysctl = "amemthresh"
+	SysctlBackupOnly              Sysctl = "backup_only"
+	SysctlCacheBypass             Sysctl = "cache_bypass"
+	SysctlConnReuseMode           Sysctl = "conn_reuse_mode"
+	SysctlConntrack               Sysctl = "conntrack"
+	SysctlDropEntry               Sysctl = "drop_entry"
+	SysctlDropPacket              Sysctl = "drop_packet"
+	SysctlExpireNodestConn        Sysctl = "expire_nodest_conn"
+	SysctlExpireQuiescentTemplate Sysctl = "expire_quiescent_template"
+	SysctlIgnoreTunneled          Sysctl = "ignore_tunneled"
+	SysctlNatICMPSend             Sysctl = "nat_icmp_send"
+	SysctlPMTUDisc                Sysctl = "pmtu_disc"
+	SysctlRunEstimation           Sysctl = "run_estimation"
+	SysctlScheduleICMP            Sysctl = "schedule_icmp"
+	SysctlSecureTCP               Sysctl = "secure_tcp"
+	SysctlSloppySCTP              Sysctl = "sloppy_sctp"
+	SysctlSloppyTCP               Sysctl = "sloppy_tcp"
+	SysctlSnatReroute             Sysctl = "snat_reroute"
+	SysctlSyncPersistMode         Sysctl = "sync_persist_mode"
+	SysctlSyncPorts               Sysctl = "sync_ports"
+	SysctlSyncQlenMax             Sysctl = "sync_qlen_max"
+	SysctlSyncRefreshPeriod       Sysctl = "sync_refresh_period"
+	SysctlSyncRetries             Sysctl = "sync_retries"
+	SysctlSyncSockSize            Sysctl = "sync_sock_size"
+	SysctlSyncVersion             Sysctl = "sync_version"
+
+	// SysctlSyncThreshold holds two values, the threshold and the period,
+	// see GetSysctlValues.
+	SysctlSyncThreshold Sysctl = "sync_threshold"
+)
+
+// GetSysctl returns the value of the tunable name in the namespace of the
+// handle.
+func (i *Handle) GetSysctl(name Sysctl) (int, error) {
+	values, err := i.GetSysctlValues(name)
+	if err != nil {
+		return 0, err
+	}
+	if len(values) != 1 {
+		return 0, fmt.Errorf("sysctl %s has %d values", name, len(values))
+	}
+	return values[0], nil
+}
+
+// SetSysctl sets the tunable name to value in the namespace of the handle.
+func (i *Handle) SetSysctl(name Sysctl, value int) error {
+	return i.SetSysctlValues(name, value)
+}
+
+// GetSysctlValues returns the values of the tunable name in the namespace
+// of the handle, for the tunables holding several ones.
+func (i *Handle) GetSysctlValues(name Sysctl) ([]int, error) {
+	var b []byte
+	err := i.inNamespace(func() error {
+		var err error
+		b, err = ioutil.ReadFile(sysctlPath(name))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var values []int
+	for _, f := range strings.Fields(string(b)) {
+		v, err := strconv.Atoi(f)
+		if err != nil {
+			return nil, fmt.Errorf("sysctl %s: invalid value %q", name, f)
+		}
+		values = append(values, v)
+	}
+	return values, nil
+}
+
+// SetSysctlValues sets the values of the tunable name in the namespace of
+// the handle, for the tunables holding several ones.
+func (i *Handle) SetSysctlValues(name Sysctl, values ...int) error {
+	s := make([]string, len(values))
+	for n, v := range values {
+		s[n] = strconv.Itoa(v)
+	}
+	return i.inNamespace(func() error {
+		return ioutil.WriteFile(sysctlPath(name), []byte(strings.Join(s, " ")+"\n"), 0644)
+	})
+}
+
+func sysctlPath(name Sysctl) string {
+	return filepath.Join(procSysNetIPv4VS, filepath.Base(string(name)))
+}
+
+// inNamespace runs fn on a thread in the network namespace of the handle,
+// where /proc/sys/net shows the tunables of that namespace.
+func (i *Handle) inNamespace(fn func() error) error {
+	if i.opts == nil || (i.opts.nsPath == "" && i.opts.nsFd == int(netns.None())) {
+		return fn()
+	}
+
+	target := netns.NsHandle(i.opts.nsFd)
+	if i.opts.nsPath != "" {
+		var err error
+		if target, err = netns.GetFromPath(i.opts.nsPath); err != nil {
+			return err
+		}
+		defer target.Close()
+	}
+
+	// fn runs on a goroutine of its own which stays locked to its thread:
+	// the thread is terminated with the goroutine instead of being
+	// switched back, so that no other goroutine ever runs in the
+	// namespace of the handle.
+	errc := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		if err := netns.Set(target); err != nil {
+			errc <- err
+			return
+		}
+		errc <- fn()
+	}()
+	return <-errc
+}
+
+// ConnReuseMode is the value of the conn_reuse_mode tunable, telling how a
+// new connection reusing the client address and port of a connection still
+// in the table is scheduled.
+type ConnReuseMode int
+
+const (
+	// ConnReuseKeep sends the new connection to the destination of the
+	// previous one, even if that destination was removed or has a null
+	// weight, black-holing it.
+	ConnReuseKeep ConnReuseMode = 0
+
+	// ConnReuseReschedule schedules the new connection again when it is
+	// safe: when the destination is unavailable and expire_nodest_conn is
+	// set, or when the previous TCP connection is in TIME_WAIT, which only
+	// happens with masquerading. This is the kernel default.
+	ConnReuseReschedule ConnReuseMode = 1
+
+	// ConnReuseRescheduleFinWait also schedules again the new connections
+	// reusing a TCP connection in FIN_WAIT, the last state seen with
+	// direct routing, which helps new destinations of busy services get
+	// traffic.
+	ConnReuseRescheduleFinWait ConnReuseMode = 2
+)
+
+// GetConnReuseMode returns the conn_reuse_mode of the namespace of the
+// handle.
+func (i *Handle) GetConnReuseMode() (ConnReuseMode, error) {
+	v, err := i.GetSysctl(SysctlConnReuseMode)
+	return ConnReuseMode(v), err
+}
+
+// SetConnReuseMode sets the conn_reuse_mode of the namespace of the handle.
+func (i *Handle) SetConnReuseMode(m ConnReuseMode) error {
+	return i.SetSysctl(SysctlConnReuseMode, int(m))
+}
+
+// GetExpireNodestConn returns the expire_nodest_conn of the namespace of
+// the handle. When set, the connection entries of an unavailable
+// destination, e.g. a removed one, are expired as soon as they get a
+// packet, so the client sees the connection fail; otherwise their packets
+// are dropped until the entries time out, 15 minutes for established TCP
+// connections by default.
+func (i *Handle) GetExpireNodestConn() (bool, error) {
+	v, err := i.GetSysctl(SysctlExpireNodestConn)
+	return v != 0, err
+}
+
+// SetExpireNodestConn sets the expire_nodest_conn of the namespace of the
+// handle, see GetExpireNodestConn.
+func (i *Handle) SetExpireNodestConn(expire bool) error {
+	v := 0
+	if expire {
+		v = 1
+	}
+	return i.SetSysctl(SysctlExpireNodestConn, v)
+}
+
+// CheckSaneDefaults checks the conn_reuse_mode, expire_nodest_conn and
+// conntrack tunables of the namespace of the handle for the settings
+// black-holing or delaying connections once destinations are removed. It
+// logs and returns a warning for each one found.
+func (i *Handle) CheckSaneDefaults() ([]string, error) {
+	reuse, err := i.GetConnReuseMode()
+	if err != nil {
+		return nil, err
+	}
+	expire, err := i.GetExpireNodestConn()
+	if err != nil {
+		return nil, err
+	}
+	conntrack, err := i.GetSysctl(SysctlConntrack)
+	if err != nil {
+		return nil, err
+	}
+
+	warnings := sysctlWarnings(reuse, expire, conntrack != 0)
+	for _, w := range warnings {
+		logrus.Warnf("IPVS sysctl: %s", w)
+	}
+	return warnings, nil
+}
+
+func sysctlWarnings(reuse ConnReuseMode, expire, conntrack bool) []string {
+	var warnings []string
+	if !expire {
+		warnings = append(warnings, "expire_nodest_conn is 0: the packets of the connections to removed destinations are dropped until their entries time out")
+	}
+	if reuse == ConnReuseKeep {
+		warnings = append(warnings, "conn_reuse_mode is 0: new connections reusing the port of a connection to a removed destination are sent to it")
+	} else if conntrack {
+		warnings = append(warnings, "conn_reuse_mode and conntrack are both set: kernels older than 5.9 delay the connections reusing a port by one second")
+	}
+	return warnings
+}
@@ -0,0 +1,73 @@
+// +build linux
+
+package ipvs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestSysctl(t *testing.T) {
+	dir, err := ioutil.TempDir("", "sysctl")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	prev := procSysNetIPv4VS
+	defer func() { procSysNetIPv4VS = prev }()
+	procSysNetIPv4VS = dir
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "conn_reuse_mode"), []byte("1\n"), 0644))
+	assert.NilError(t, ioutil.WriteFile(filepath.Join(dir, "sync_threshold"), []byte("3\t50\n"), 0644))
+
+	i := &Handle{}
+	v, err := i.GetSysctl(SysctlConnReuseMode)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 1)
+
+	assert.NilError(t, i.SetSysctl(SysctlConnReuseMode, 0))
+	v, err = i.GetSysctl(SysctlConnReuseMode)
+	assert.NilError(t, err)
+	assert.Equal(t, v, 0)
+
+	_, err = i.GetSysctl(SysctlSyncThreshold)
+	assert.ErrorContains(t, err, "2 values")
+	values, err := i.GetSysctlValues(SysctlSyncThreshold)
+	assert.NilError(t, err)
+	assert.DeepEqual(t, values, []int{3, 50})
+
+	assert.NilError(t, i.SetSysctlValues(SysctlSyncThreshold, 5, 100))
+	b, err := ioutil.ReadFile(filepath.Join(dir, "sync_threshold"))
+	assert.NilError(t, err)
+	assert.Equal(t, string(b), "5 100\n")
+
+	_, err = i.GetSysctl(SysctlIgnoreTunneled)
+	assert.Assert(t, os.IsNotExist(err))
+
+	assert.NilError(t, i.SetExpireNodestConn(true))
+	expire, err := i.GetExpireNodestConn()
+	assert.NilError(t, err)
+	assert.Assert(t, expire)
+
+	assert.NilError(t, i.SetConnReuseMode(ConnReuseRescheduleFinWait))
+	mode, err := i.GetConnReuseMode()
+	assert.NilError(t, err)
+	assert.Equal(t, mode, ConnReuseRescheduleFinWait)
+}
+
+func TestSysctlWarnings(t *testing.T) {
+	assert.Equal(t, len(sysctlWarnings(ConnReuseReschedule, true, false)), 0)
+	assert.Equal(t, len(sysctlWarnings(ConnReuseRescheduleFinWait, true, false)), 0)
+
+	warnings := sysctlWarnings(ConnReuseKeep, false, true)
+	assert.Equal(t, len(warnings), 2)
+	assert.Assert(t, strings.HasPrefix(warnings[0], "expire_nodest_conn"))
+	assert.Assert(t, strings.HasPrefix(warnings[1], "conn_reuse_mode is 0"))
+
+	warnings = sysctlWarnings(ConnReuseReschedule, true, true)
+	assert.Equal(t, len(warnings), 1)
+	assert.Assert(t, strings.Contains(warnings[0], "conntrack"))
+}
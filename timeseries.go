@@ -0,0 +1,328 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// StatsPoint is a sample of the statistics of a service or destination.
+type StatsPoint struct {
+	Time  time.Time
+	Stats SvcStats
+
+	// ActiveConnections and InactiveConnections are only set for
+	// destinations.
+	ActiveConnections   int
+	InactiveConnections int
+}
+
+// Counter identifies a cumulative counter of SvcStats.
+type Counter int
+
+// Counters usable with StatsStore.Rate.
+const (
+	CounterConnections Counter = iota + 1
+	CounterPacketsIn
+	CounterPacketsOut
+	CounterBytesIn
+	CounterBytesOut
+)
+
+// value returns the counter c of st.
+func (c Counter) value(st *SvcStats) (uint64, error) {
+	switch c {
+	case CounterConnections:
+		return st.Connections, nil
+	case CounterPacketsIn:
+		return st.PacketsIn, nil
+	case CounterPacketsOut:
+		return st.PacketsOut, nil
+	case CounterBytesIn:
+		return st.BytesIn, nil
+	case CounterBytesOut:
+		return st.BytesOut, nil
+	}
+	return 0, fmt.Errorf("unknown counter %d", int(c))
+}
+
+// ring is a fixed capacity buffer of points ordered by time, overwriting the
+// oldest point when full.
+type ring struct {
+	points []StatsPoint
+	start  int
+	n      int
+}
+
+func (r *ring) push(p StatsPoint) {
+	if r.n < len(r.points) {
+		r.points[(r.start+r.n)%len(r.points)] = p
+		r.n++
+		return
+	}
+	r.points[r.start] = p
+	r.start = (r.start + 1) % len(r.points)
+}
+
+func (r *ring) at(n int) StatsPoint {
+	return r.points[(r.start+n)%len(r.points)]
+}
+
+// dropBefore removes the points older than t.
+func (r *ring) dropBefore(t time.Time) {
+	for r.n > 0 && r.at(0).Time.Before(t) {
+		r.start = (r.start + 1) % len(r.points)
+		r.n--
+	}
+}
+
+// StatsStore keeps the recent statistics of every service and destination in
+// memory, in per object ring buffers, for embedders wanting to render short
+// histories without an external time series database. Samples are added with
+// Record, or periodically with Poll.
+type StatsStore struct {
+	retention time.Duration
+	capacity  int
+
+	mu     sync.RWMutex
+	series map[string]*ring
+}
+
+// NewStatsStore returns a StatsStore keeping the samples of the last
+// retention, and at most points samples per service and destination.
+func NewStatsStore(retention time.Duration, points int) *StatsStore {
+	if points < 1 {
+		points = 1
+	}
+	return &StatsStore{
+		retention: retention,
+		capacity:  points,
+		series:    make(map[string]*ring),
+	}
+}
+
+// seriesKey returns the key of the series of s, or of its destination d if
+// not nil.
+func seriesKey(s *Service, d *Destination) string {
+	if d == nil {
+		return serviceKey(s)
+	}
+	return serviceKey(s) + "|" + destinationKey(d)
+}
+
+// Record adds the statistics of snap to the store and drops the samples
+// which fell out of the retention, including the series of the services and
+// destinations which have been removed since.
+func (st *StatsStore) Record(snap *StatsSnapshot) {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	for _, sd := range snap.Services {
+		st.add(seriesKey(sd.Service, nil), StatsPoint{Time: snap.Time, Stats: sd.Service.Stats})
+		for _, d := range sd.Destinations {
+			st.add(seriesKey(sd.Service, d), StatsPoint{
+				Time:                snap.Time,
+				Stats:               SvcStats(d.Stats),
+				ActiveConnections:   d.ActiveConnections,
+				InactiveConnections: d.InactiveConnections,
+			})
+		}
+	}
+
+	oldest := snap.Time.Add(-st.retention)
+	for key, r := range st.series {
+		r.dropBefore(oldest)
+		if r.n == 0 {
+			delete(st.series, key)
+		}
+	}
+}
+
+func (st *StatsStore) add(key string, p StatsPoint) {
+	r, ok := st.series[key]
+	if !ok {
+		r = &ring{points: make([]StatsPoint, st.capacity)}
+		st.series[key] = r
+	}
+	r.push(p)
+}
+
+// Poll records a snapshot of h every interval until ctx is done. Failed
+// snapshots are logged and skipped.
+func (st *StatsStore) Poll(ctx context.Context, h *Handle, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		snap, err := h.GetStatsSnapshot()
+		if err != nil {
+			logrus.Warnf("Failed to get ipvs stats snapshot: %v", err)
+		} else {
+			st.Record(snap)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+// Range returns the samples of s, or of its destination d if not nil, taken
+// between from and to included, oldest first.
+func (st *StatsStore) Range(s *Service, d *Destination, from, to time.Time) []StatsPoint {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	r, ok := st.series[seriesKey(s, d)]
+	if !ok {
+		return nil
+	}
+
+	var res []StatsPoint
+	for n := 0; n < r.n; n++ {
+		p := r.at(n)
+		if !p.Time.Before(from) && !p.Time.After(to) {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+// Last returns the last count samples of s, or of its destination d if not
+// nil, oldest first.
+func (st *StatsStore) Last(s *Service, d *Destination, count int) []StatsPoint {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	r, ok := st.series[seriesKey(s, d)]
+	if !ok || count <= 0 {
+		return nil
+	}
+	if count > r.n {
+		count = r.n
+	}
+
+	res := make([]StatsPoint, count)
+	for n := range res {
+		res[n] = r.at(r.n - count + n)
+	}
+	return res
+}
+
+// Rate returns the per second increase of counter c of s, or of its
+// destination d if not nil, over the samples of the last window. It returns
+// false if less than two samples are available in the window. Counter resets
+// are taken into account.
+func (st *StatsStore) Rate(s *Service, d *Destination, c Counter, window time.Duration) (float64, bool, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	r, ok := st.series[seriesKey(s, d)]
+	if !ok || r.n < 2 {
+		return 0, false, nil
+	}
+
+	last := r.at(r.n - 1)
+	from := last.Time.Add(-window)
+
+	var total uint64
+	first := -1
+	for n := 0; n < r.n; n++ {
+		if r.at(n).Time.Before(from) {
+			continue
+		}
+		if first < 0 {
+			first = n
+			continue
+		}
+		prevStats, curStats := r.at(n-1).Stats, r.at(n).Stats
+		prev, err := c.value(&prevStats)
+		if err != nil {
+			return 0, false, err
+		}
+		cur, _ := c.value(&curStats)
+		total += counterDelta(prev, cur)
+	}
+
+	if first < 0 || first == r.n-1 {
+		return 0, false, nil
+	}
+	elapsed := last.Time.Sub(r.at(first).Time).Seconds()
+	if elapsed <= 0 {
+		return 0, false, nil
+	}
+	return float64(total) / elapsed, true, nil
+}
+
+// RateSummary summarizes the per second increases of a counter between the
+// successive samples of a window.
+type RateSummary struct {
+	// Intervals is the number of intervals between samples the summary is
+	// computed over.
+	Intervals int
+
+	P50 float64
+	P95 float64
+	Max float64
+}
+
+// Summarize returns the median, 95th percentile and maximum of the per
+// second increases of counter c of s, or of its destination d if not nil,
+// between the successive samples of the last window, e.g. to tell whether a
+// service is trending hot. It returns false if less than two samples are
+// available in the window. Counter resets are taken into account.
+func (st *StatsStore) Summarize(s *Service, d *Destination, c Counter, window time.Duration) (RateSummary, bool, error) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	r, ok := st.series[seriesKey(s, d)]
+	if !ok || r.n < 2 {
+		return RateSummary{}, false, nil
+	}
+
+	from := r.at(r.n - 1).Time.Add(-window)
+	var rates []float64
+	for n := 1; n < r.n; n++ {
+		p, q := r.at(n-1), r.at(n)
+		elapsed := q.Time.Sub(p.Time).Seconds()
+		if p.Time.Before(from) || elapsed <= 0 {
+			continue
+		}
+		prev, err := c.value(&p.Stats)
+		if err != nil {
+			return RateSummary{}, false, err
+		}
+		cur, _ := c.value(&q.Stats)
+		rates = append(rates, float64(counterDelta(prev, cur))/elapsed)
+	}
+	if len(rates) == 0 {
+		return RateSummary{}, false, nil
+	}
+
+	sort.Float64s(rates)
+	return RateSummary{
+		Intervals: len(rates),
+		P50:       percentile(rates, 0.5),
+		P95:       percentile(rates, 0.95),
+		Max:       rates[len(rates)-1],
+	}, true, nil
+}
+
+// percentile returns the q quantile of the sorted values, with the nearest
+// rank method.
+func percentile(sorted []float64, q float64) float64 {
+	rank := int(math.Ceil(q*float64(len(sorted)))) - 1
+	if rank < 0 {
+		rank = 0
+	}
+	return sorted[rank]
+}
@@ -0,0 +1,102 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStatsStore(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	dst := &Destination{Address: net.ParseIP("10.1.0.1"), Port: 80}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	snapshot := func(sec int, conns uint64) *StatsSnapshot {
+		s := *svc
+		s.Stats.Connections = conns
+		d := *dst
+		d.Stats.Connections = conns / 2
+		d.ActiveConnections = sec
+		return &StatsSnapshot{
+			Time:     start.Add(time.Duration(sec) * time.Second),
+			Services: []*ServiceDestinations{{Service: &s, Destinations: []*Destination{&d}}},
+		}
+	}
+
+	st := NewStatsStore(time.Minute, 5)
+	// 10 connections per second, with the counters zeroed after 3s.
+	for sec, conns := range []uint64{0, 10, 20, 30, 10, 20, 30} {
+		st.Record(snapshot(sec, conns))
+	}
+
+	last := st.Last(svc, nil, 10)
+	assert.Equal(t, len(last), 5)
+	assert.Equal(t, last[0].Time, start.Add(2*time.Second))
+	assert.Equal(t, last[4].Stats.Connections, uint64(30))
+
+	last = st.Last(svc, dst, 2)
+	assert.Equal(t, len(last), 2)
+	assert.Equal(t, last[1].ActiveConnections, 6)
+
+	points := st.Range(svc, nil, start.Add(3*time.Second), start.Add(4*time.Second))
+	assert.Equal(t, len(points), 2)
+
+	rate, ok, err := st.Rate(svc, nil, CounterConnections, 2*time.Second)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.Equal(t, rate, 10.0)
+
+	rate, ok, err = st.Rate(svc, dst, CounterConnections, time.Hour)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	// 5 connections per second, the reset being counted as an increase
+	// from 0.
+	assert.Equal(t, rate, 5.0)
+
+	_, ok, err = st.Rate(svc, nil, CounterConnections, 0)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	// Series fall out of the retention once their service is gone.
+	st.Record(&StatsSnapshot{Time: start.Add(2 * time.Minute)})
+	assert.Equal(t, len(st.Last(svc, nil, 10)), 0)
+}
+
+func TestStatsStoreSummarize(t *testing.T) {
+	svc := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	start := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	st := NewStatsStore(time.Minute, 30)
+	var conns uint64
+	for sec := 0; sec <= 20; sec++ {
+		// 10 connections per second, with a burst of 100 at 20s.
+		if sec == 20 {
+			conns += 100
+		} else {
+			conns += 10
+		}
+		s := *svc
+		s.Stats.Connections = conns
+		st.Record(&StatsSnapshot{Time: start.Add(time.Duration(sec) * time.Second), Services: []*ServiceDestinations{{Service: &s}}})
+	}
+
+	sum, ok, err := st.Summarize(svc, nil, CounterConnections, 10*time.Second)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, sum, RateSummary{Intervals: 10, P50: 10, P95: 100, Max: 100})
+
+	sum, ok, err = st.Summarize(svc, nil, CounterConnections, time.Minute)
+	assert.NilError(t, err)
+	assert.Assert(t, ok)
+	assert.DeepEqual(t, sum, RateSummary{Intervals: 20, P50: 10, P95: 10, Max: 100})
+
+	_, ok, err = st.Summarize(svc, nil, CounterConnections, 0)
+	assert.NilError(t, err)
+	assert.Assert(t, !ok)
+
+	_, _, err = st.Summarize(svc, nil, Counter(0), time.Minute)
+	assert.ErrorContains(t, err, "unknown counter")
+}
@@ -0,0 +1,118 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"sort"
+	"strconv"
+)
+
+// TopTalkersOptions configures TopTalkers.
+type TopTalkersOptions struct {
+	// IPv4PrefixLen and IPv6PrefixLen group the clients by network, e.g.
+	// by /24 and /64, rather than by address if zero.
+	IPv4PrefixLen int
+	IPv6PrefixLen int
+	// Filter selects the connections counted.
+	Filter ConnectionFilter
+	// Limit is the number of talkers returned, all of them if zero.
+	Limit int
+	// Geo, if set, locates the talkers returned.
+	Geo GeoLookup
+}
+
+// Talker counts the connections of a client, or of the clients of a
+// network.
+type Talker struct {
+	Client *net.IPNet
+	// Location is the location of the network address of Client, only
+	// set with TopTalkersOptions.Geo.
+	Location *GeoLocation
+	Total    int
+	// Services counts the connections per service, by decreasing count.
+	Services []*TalkerService
+}
+
+// TalkerService counts the connections of a Talker to a service.
+type TalkerService struct {
+	Protocol    IPProto
+	Virtual     Endpoint
+	Connections int
+}
+
+// TopTalkers walks the connections of the table selected by opts.Filter, see
+// VisitConnections, and returns their clients by decreasing connection
+// count, with their counts per service. Persistence templates are not
+// counted.
+func TopTalkers(opts TopTalkersOptions) ([]*Talker, error) {
+	talkers := make(map[string]*Talker)
+	services := make(map[string]*TalkerService)
+	err := VisitConnections(func(c *Connection) bool {
+		if c.IsTemplate || !opts.Filter.Match(c) {
+			return true
+		}
+
+		client := clientNetwork(c.Client.Address, opts)
+		key := client.String()
+		t, ok := talkers[key]
+		if !ok {
+			t = &Talker{Client: client}
+			talkers[key] = t
+		}
+		t.Total++
+
+		skey := key + " " + strconv.Itoa(int(c.Protocol)) + " " + c.Virtual.String()
+		ts, ok := services[skey]
+		if !ok {
+			ts = &TalkerService{Protocol: c.Protocol, Virtual: c.Virtual}
+			services[skey] = ts
+			t.Services = append(t.Services, ts)
+		}
+		ts.Connections++
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	res := make([]*Talker, 0, len(talkers))
+	for _, t := range talkers {
+		sort.SliceStable(t.Services, func(a, b int) bool {
+			return t.Services[a].Connections > t.Services[b].Connections
+		})
+		res = append(res, t)
+	}
+	sort.Slice(res, func(a, b int) bool {
+		if res[a].Total != res[b].Total {
+			return res[a].Total > res[b].Total
+		}
+		return res[a].Client.String() < res[b].Client.String()
+	})
+	if opts.Limit > 0 && len(res) > opts.Limit {
+		res = res[:opts.Limit]
+	}
+
+	if opts.Geo != nil {
+		geo := newGeoCache(opts.Geo)
+		for _, t := range res {
+			if t.Location, err = geo.lookup(t.Client.IP); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return res, nil
+}
+
+// clientNetwork returns the network addr is grouped in by opts.
+func clientNetwork(addr net.IP, opts TopTalkersOptions) *net.IPNet {
+	bits, ones := 8*net.IPv6len, opts.IPv6PrefixLen
+	if v4 := addr.To4(); v4 != nil {
+		addr, bits, ones = v4, 8*net.IPv4len, opts.IPv4PrefixLen
+	}
+	if ones <= 0 || ones > bits {
+		ones = bits
+	}
+	mask := net.CIDRMask(ones, bits)
+	return &net.IPNet{IP: addr.Mask(mask), Mask: mask}
+}
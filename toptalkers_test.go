@@ -0,0 +1,51 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testTalkersTable = `Pro FromIP   FPrt ToIP     TPrt DestIP   DPrt State       Expires PEName PEData
+TCP 0A000001 D431 0A000002 0050 0A010001 1F90 ESTABLISHED     899
+TCP 0A000001 D432 0A000002 0050 0A010002 1F90 ESTABLISHED     899
+TCP 0A000001 D433 0A000002 01BB 0A010002 01BB ESTABLISHED     899
+TCP 0A000009 D431 0A000002 0050 0A010001 1F90 ESTABLISHED     899
+TCP 0A000109 D431 0A000002 0050 0A010001 1F90 ESTABLISHED     899
+IP  0A000001 0000 0A000002 0050 0A010001 1F90 NONE            359
+`
+
+func TestTopTalkers(t *testing.T) {
+	defer withConnTables(t, testTalkersTable, testConnSyncTable)()
+
+	talkers, err := TopTalkers(TopTalkersOptions{})
+	assert.NilError(t, err)
+	assert.Equal(t, len(talkers), 3)
+	assert.Equal(t, talkers[0].Client.String(), "10.0.0.1/32")
+	assert.Equal(t, talkers[0].Total, 3)
+	assert.Equal(t, len(talkers[0].Services), 2)
+	assert.Equal(t, talkers[0].Services[0].Virtual.String(), "10.0.0.2:80")
+	assert.Equal(t, talkers[0].Services[0].Connections, 2)
+	assert.Equal(t, talkers[1].Client.String(), "10.0.0.9/32")
+
+	talkers, err = TopTalkers(TopTalkersOptions{
+		IPv4PrefixLen: 24,
+		Limit:         1,
+		Geo: GeoLookupFunc(func(addr net.IP) (*GeoLocation, error) {
+			return &GeoLocation{Country: "FR", Organization: addr.String()}, nil
+		}),
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, len(talkers), 1)
+	assert.Equal(t, talkers[0].Client.String(), "10.0.0.0/24")
+	assert.Equal(t, talkers[0].Total, 4)
+	assert.DeepEqual(t, talkers[0].Location, &GeoLocation{Country: "FR", Organization: "10.0.0.0"})
+
+	talkers, err = TopTalkers(TopTalkersOptions{Filter: ConnectionFilter{Virtual: Endpoint{Port: 443}}})
+	assert.NilError(t, err)
+	assert.Equal(t, len(talkers), 1)
+	assert.Equal(t, talkers[0].Total, 1)
+}
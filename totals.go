@@ -0,0 +1,88 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+var procNetIPVSStats = "/proc/net/ip_vs_stats"
+
+// GetTotals returns the statistics of every service summed up, counters
+// and rate estimates alike.
+func (i *Handle) GetTotals() (*SvcStats, error) {
+	svcs, err := i.GetServices()
+	if err != nil {
+		return nil, err
+	}
+	return sumStats(svcs), nil
+}
+
+func sumStats(svcs []*Service) *SvcStats {
+	var total SvcStats
+	for _, s := range svcs {
+		total.Connections += s.Stats.Connections
+		total.PacketsIn += s.Stats.PacketsIn
+		total.PacketsOut += s.Stats.PacketsOut
+		total.BytesIn += s.Stats.BytesIn
+		total.BytesOut += s.Stats.BytesOut
+		total.CPS += s.Stats.CPS
+		total.PPSIn += s.Stats.PPSIn
+		total.PPSOut += s.Stats.PPSOut
+		total.BPSIn += s.Stats.BPSIn
+		total.BPSOut += s.Stats.BPSOut
+	}
+	return &total
+}
+
+// GetKernelTotals returns the statistics the kernel keeps over all the
+// traffic it scheduled, read from /proc/net/ip_vs_stats of the network
+// namespace of the calling process. Unlike GetTotals, they still count the
+// traffic of the services deleted since.
+func GetKernelTotals() (*SvcStats, error) {
+	b, err := ioutil.ReadFile(procNetIPVSStats)
+	if err != nil {
+		return nil, err
+	}
+	return parseKernelTotals(string(b))
+}
+
+// parseKernelTotals parses the counters, on the third line, and the rates,
+// on the sixth line, of /proc/net/ip_vs_stats. Both are in hexadecimal.
+func parseKernelTotals(s string) (*SvcStats, error) {
+	lines := strings.Split(s, "\n")
+	if len(lines) < 6 {
+		return nil, fmt.Errorf("truncated ipvs stats: %q", s)
+	}
+
+	var values [10]uint64
+	for n, line := range []string{lines[2], lines[5]} {
+		fields := strings.Fields(line)
+		if len(fields) != 5 {
+			return nil, fmt.Errorf("invalid ipvs stats line %q", line)
+		}
+		for m, f := range fields {
+			v, err := strconv.ParseUint(f, 16, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid ipvs stats line %q: %v", line, err)
+			}
+			values[5*n+m] = v
+		}
+	}
+
+	return &SvcStats{
+		Connections: values[0],
+		PacketsIn:   values[1],
+		PacketsOut:  values[2],
+		BytesIn:     values[3],
+		BytesOut:    values[4],
+		CPS:         values[5],
+		PPSIn:       values[6],
+		PPSOut:      values[7],
+		BPSIn:       values[8],
+		BPSOut:      values[9],
+	}, nil
+}
@@ -0,0 +1,55 @@
+// +build linux
+
+package ipvs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+const testStatsTable = `   Total Incoming Outgoing         Incoming         Outgoing
+   Conns  Packets  Packets            Bytes            Bytes
+      1A      3E8        0           1E8480                0
+
+ Conns/s   Pkts/s   Pkts/s          Bytes/s          Bytes/s
+       2       10        0              400                0
+`
+
+func TestGetKernelTotals(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stats")
+	assert.NilError(t, err)
+	defer os.RemoveAll(dir)
+
+	prev := procNetIPVSStats
+	defer func() { procNetIPVSStats = prev }()
+	procNetIPVSStats = filepath.Join(dir, "ip_vs_stats")
+	assert.NilError(t, ioutil.WriteFile(procNetIPVSStats, []byte(testStatsTable), 0644))
+
+	st, err := GetKernelTotals()
+	assert.NilError(t, err)
+	assert.DeepEqual(t, *st, SvcStats{
+		Connections: 26,
+		PacketsIn:   1000,
+		BytesIn:     2000000,
+		CPS:         2,
+		PPSIn:       16,
+		BPSIn:       1024,
+	})
+
+	_, err = parseKernelTotals("   Total Incoming\n")
+	assert.ErrorContains(t, err, "truncated")
+	_, err = parseKernelTotals("\n\n1 2 3 4 Z\n\n\n1 2 3 4 5\n")
+	assert.ErrorContains(t, err, "invalid")
+}
+
+func TestSumStats(t *testing.T) {
+	st := sumStats([]*Service{
+		{Stats: SvcStats{Connections: 1, BytesOut: 10, CPS: 1}},
+		{Stats: SvcStats{Connections: 2, BytesOut: 20, BPSIn: 5}},
+	})
+	assert.DeepEqual(t, *st, SvcStats{Connections: 3, BytesOut: 30, CPS: 1, BPSIn: 5})
+}
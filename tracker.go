@@ -0,0 +1,131 @@
+// +build linux
+
+package ipvs
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// StatsRates are the per second increases of the counters of SvcStats over
+// an interval.
+type StatsRates struct {
+	Connections float64
+	PacketsIn   float64
+	PacketsOut  float64
+	BytesIn     float64
+	BytesOut    float64
+}
+
+// StatsDelta is the increase of the counters of a service, or of one of its
+// destinations, between two samples.
+type StatsDelta struct {
+	Service *Service
+
+	// Destination is nil for the delta of the service itself.
+	Destination *Destination
+
+	Interval time.Duration
+
+	// Delta holds the increase of the counters, its rate estimates are
+	// left to zero.
+	Delta SvcStats
+
+	// Rates are the counter increases divided by Interval, zero if the
+	// interval is not positive.
+	Rates StatsRates
+}
+
+// StatsTracker computes the increase and rate of the counters of services
+// and destinations between successive stats snapshots, which is more precise
+// than the rate estimates of the kernel over short intervals.
+//
+// A counter going backwards either wrapped around, for the 32 bit counters
+// of kernels not reporting 64 bit statistics, or was zeroed in between; it
+// is considered wrapped when its previous value was in the upper half of the
+// 32 bit range. Services and destinations are tracked from the first
+// snapshot they appear in and forgotten once missing from one.
+//
+// The zero value is ready to use.
+type StatsTracker struct {
+	mu      sync.Mutex
+	time    time.Time
+	samples map[string]SvcStats
+}
+
+// Update records the statistics of snap and returns the deltas since the
+// previous snapshot, services first, each followed by its destinations.
+// Services and destinations seen for the first time have no delta, so the
+// first call only records the counters.
+func (t *StatsTracker) Update(snap *StatsSnapshot) []*StatsDelta {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	interval := snap.Time.Sub(t.time)
+	samples := make(map[string]SvcStats, len(snap.Services))
+	var deltas []*StatsDelta
+
+	record := func(s *Service, d *Destination, st SvcStats) {
+		key := seriesKey(s, d)
+		samples[key] = st
+		if prev, ok := t.samples[key]; ok {
+			deltas = append(deltas, statsDelta(s, d, interval, &prev, &st))
+		}
+	}
+	for _, sd := range snap.Services {
+		record(sd.Service, nil, sd.Service.Stats)
+		for _, d := range sd.Destinations {
+			record(sd.Service, d, SvcStats(d.Stats))
+		}
+	}
+
+	t.time = snap.Time
+	t.samples = samples
+	return deltas
+}
+
+// Reset forgets the recorded statistics, so the next Update only records the
+// counters.
+func (t *StatsTracker) Reset() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.time = time.Time{}
+	t.samples = nil
+}
+
+func statsDelta(s *Service, d *Destination, interval time.Duration, prev, cur *SvcStats) *StatsDelta {
+	sd := &StatsDelta{
+		Service:     s,
+		Destination: d,
+		Interval:    interval,
+		Delta: SvcStats{
+			Connections: wrappingDelta(prev.Connections, cur.Connections),
+			PacketsIn:   wrappingDelta(prev.PacketsIn, cur.PacketsIn),
+			PacketsOut:  wrappingDelta(prev.PacketsOut, cur.PacketsOut),
+			BytesIn:     wrappingDelta(prev.BytesIn, cur.BytesIn),
+			BytesOut:    wrappingDelta(prev.BytesOut, cur.BytesOut),
+		},
+	}
+	if secs := interval.Seconds(); secs > 0 {
+		sd.Rates = StatsRates{
+			Connections: float64(sd.Delta.Connections) / secs,
+			PacketsIn:   float64(sd.Delta.PacketsIn) / secs,
+			PacketsOut:  float64(sd.Delta.PacketsOut) / secs,
+			BytesIn:     float64(sd.Delta.BytesIn) / secs,
+			BytesOut:    float64(sd.Delta.BytesOut) / secs,
+		}
+	}
+	return sd
+}
+
+// wrappingDelta is counterDelta for counters which may be 32 bit wide: a
+// counter going backwards from the upper half of the 32 bit range wrapped
+// around rather than being zeroed.
+func wrappingDelta(prev, cur uint64) uint64 {
+	if cur < prev && prev > math.MaxUint32/2 && prev <= math.MaxUint32 {
+		return math.MaxUint32 - prev + cur + 1
+	}
+	return counterDelta(prev, cur)
+}
@@ -0,0 +1,82 @@
+// +build linux
+
+package ipvs
+
+import (
+	"math"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestStatsTracker(t *testing.T) {
+	svc := func(conns uint64) *Service {
+		return &Service{
+			AddressFamily: syscall.AF_INET,
+			Protocol:      syscall.IPPROTO_TCP,
+			Address:       net.ParseIP("10.0.0.1"),
+			Port:          80,
+			Stats:         SvcStats{Connections: conns, BytesIn: 1000 * conns},
+		}
+	}
+	dst := func(ip string, conns uint64) *Destination {
+		return &Destination{Address: net.ParseIP(ip), Port: 8080, Stats: DstStats{Connections: conns}}
+	}
+
+	now := time.Now()
+	var tr StatsTracker
+	deltas := tr.Update(&StatsSnapshot{
+		Time:     now,
+		Services: []*ServiceDestinations{{Service: svc(100), Destinations: []*Destination{dst("10.1.0.1", 100)}}},
+	})
+	assert.Equal(t, len(deltas), 0)
+
+	deltas = tr.Update(&StatsSnapshot{
+		Time: now.Add(10 * time.Second),
+		Services: []*ServiceDestinations{{
+			Service: svc(150),
+			Destinations: []*Destination{
+				// zeroed in between
+				dst("10.1.0.1", 20),
+				// new destination, not tracked yet
+				dst("10.1.0.2", 30),
+			},
+		}},
+	})
+	assert.Equal(t, len(deltas), 2)
+	assert.Assert(t, deltas[0].Destination == nil)
+	assert.Equal(t, deltas[0].Interval, 10*time.Second)
+	assert.Equal(t, deltas[0].Delta.Connections, uint64(50))
+	assert.Equal(t, deltas[0].Rates.Connections, 5.0)
+	assert.Equal(t, deltas[0].Rates.BytesIn, 5000.0)
+	assert.Equal(t, deltas[1].Destination.Address.String(), "10.1.0.1")
+	assert.Equal(t, deltas[1].Delta.Connections, uint64(20))
+
+	// The service was removed, then added back.
+	tr.Update(&StatsSnapshot{Time: now.Add(20 * time.Second)})
+	deltas = tr.Update(&StatsSnapshot{
+		Time:     now.Add(30 * time.Second),
+		Services: []*ServiceDestinations{{Service: svc(10)}},
+	})
+	assert.Equal(t, len(deltas), 0)
+
+	tr.Reset()
+	assert.Equal(t, len(tr.Update(&StatsSnapshot{Time: now, Services: []*ServiceDestinations{{Service: svc(10)}}})), 0)
+}
+
+func TestWrappingDelta(t *testing.T) {
+	testcases := []struct {
+		prev, cur, want uint64
+	}{
+		{10, 25, 15},
+		{100, 5, 5},
+		{math.MaxUint32 - 9, 5, 15},
+		{math.MaxUint32 + 10, 5, 5},
+	}
+	for _, tc := range testcases {
+		assert.Equal(t, wrappingDelta(tc.prev, tc.cur), tc.want)
+	}
+}
@@ -0,0 +1,54 @@
+// +build linux
+
+package ipvs
+
+import "github.com/kwanhur/ipvs/types"
+
+// The IPVS object types are defined in package types and aliased here so
+// that existing users of this package keep working unchanged.
+type (
+	// IPProto specifies the protocol encapsulated within an IP datagram
+	IPProto = types.IPProto
+
+	// Service defines an IPVS service in its entirety.
+	Service = types.Service
+
+	// ServiceFlags is a set of SvcFlag* service flags.
+	ServiceFlags = types.ServiceFlags
+
+	// SvcStats defines an IPVS service statistics
+	SvcStats = types.SvcStats
+
+	// Destination defines an IPVS destination (real server) in its
+	// entirety.
+	Destination = types.Destination
+
+	// ConnectionFlags is a set of ConnectionFlag* flags.
+	ConnectionFlags = types.ConnectionFlags
+
+	// ForwardingMethod is the method used to forward packets to a
+	// destination.
+	ForwardingMethod = types.ForwardingMethod
+
+	// DstStats defines IPVS destination (real server) statistics
+	DstStats = types.DstStats
+
+	// LocalAddress defines an IPVS local address (fullnat) in its entirety.
+	LocalAddress = types.LocalAddress
+
+	// Config defines IPVS timeout configuration
+	Config = types.Config
+
+	// Info defines IPVS info
+	Info = types.Info
+
+	// Version defines IPVS version
+	Version = types.Version
+
+	// Daemon defines an IPVS connection synchronization daemon
+	Daemon = types.Daemon
+
+	// StatsSource reads services and destinations back to refresh their
+	// statistics.
+	StatsSource = types.StatsSource
+)
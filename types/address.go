@@ -0,0 +1,44 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// ParseAddress parses s as an IP address optionally followed by an IPv6
+// zone, e.g. fe80::1%eth0, which net.ParseIP rejects. The zone is only
+// allowed on IPv6 link-local addresses.
+func ParseAddress(s string) (net.IP, string, error) {
+	addr, zone := s, ""
+	if n := strings.LastIndexByte(s, '%'); n >= 0 {
+		addr, zone = s[:n], s[n+1:]
+		if zone == "" {
+			return nil, "", fmt.Errorf("invalid address %q: empty zone", s)
+		}
+	}
+
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, "", fmt.Errorf("invalid address %q", s)
+	}
+	if zone != "" && !IsLinkLocal6(ip) {
+		return nil, "", fmt.Errorf("invalid address %q: zone on a non link-local IPv6 address", s)
+	}
+	return ip, zone, nil
+}
+
+// ZonedAddress returns the textual form of ip with its IPv6 zone, e.g.
+// fe80::1%eth0, as accepted by the net package and ParseAddress.
+func ZonedAddress(ip net.IP, zone string) string {
+	if zone == "" {
+		return ip.String()
+	}
+	return ip.String() + "%" + zone
+}
+
+// IsLinkLocal6 reports whether ip is an IPv6 link-local unicast address,
+// the only addresses with a zone.
+func IsLinkLocal6(ip net.IP) bool {
+	return ip.To4() == nil && ip.IsLinkLocalUnicast()
+}
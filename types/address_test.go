@@ -0,0 +1,41 @@
+package types
+
+import (
+	"net"
+	"testing"
+)
+
+func TestParseAddress(t *testing.T) {
+	testcases := []struct {
+		address string
+		ip      net.IP
+		zone    string
+		invalid bool
+	}{
+		{address: "10.0.0.1", ip: net.ParseIP("10.0.0.1")},
+		{address: "2001:db8::1", ip: net.ParseIP("2001:db8::1")},
+		{address: "fe80::1", ip: net.ParseIP("fe80::1")},
+		{address: "fe80::1%eth0", ip: net.ParseIP("fe80::1"), zone: "eth0"},
+		{address: "fe80::1%", invalid: true},
+		{address: "2001:db8::1%eth0", invalid: true},
+		{address: "10.0.0.1%eth0", invalid: true},
+		{address: "bogus", invalid: true},
+	}
+
+	for _, tc := range testcases {
+		ip, zone, err := ParseAddress(tc.address)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("%s: expected an error", tc.address)
+			}
+			continue
+		}
+		if err != nil || !ip.Equal(tc.ip) || zone != tc.zone {
+			t.Errorf("%s: got %v, %q, %v", tc.address, ip, zone, err)
+			continue
+		}
+		if s := ZonedAddress(ip, zone); s != tc.address {
+			t.Errorf("%s: formatted as %s", tc.address, s)
+		}
+	}
+}
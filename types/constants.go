@@ -0,0 +1,187 @@
+package types
+
+// Destination forwarding methods
+const (
+	// ConnectionFlagFwdmask indicates the mask in the connection
+	// flags which is used by forwarding method bits.
+	ConnectionFlagFwdMask = 0x0007
+
+	// ConnectionFlagMasq is used for masquerade forwarding method.
+	ConnectionFlagMasq = 0x0000
+
+	// ConnectionFlagLocalNode is used for local node forwarding
+	// method.
+	ConnectionFlagLocalNode = 0x0001
+
+	// ConnectionFlagTunnel is used for tunnel mode forwarding
+	// method.
+	ConnectionFlagTunnel = 0x0002
+
+	// ConnectionFlagDirectRoute is used for direct routing
+	// forwarding method.
+	ConnectionFlagDirectRoute = 0x0003
+
+	// ConnectionFlagFullNat is used for fullnat(snat+dnat) forwarding method.
+	ConnectionFlagFullNat = 0x0005
+)
+
+// Connection flags set by the kernel, mostly seen on connections and
+// templates rather than destinations.
+const (
+	// ConnectionFlagSync marks connections synchronized from a master.
+	ConnectionFlagSync = 0x0020
+
+	// ConnectionFlagHashed marks hashed entries.
+	ConnectionFlagHashed = 0x0040
+
+	// ConnectionFlagNoOutput marks connections without output packets.
+	ConnectionFlagNoOutput = 0x0080
+
+	// ConnectionFlagInactive marks inactive connections.
+	ConnectionFlagInactive = 0x0100
+
+	// ConnectionFlagOutSeq and ConnectionFlagInSeq mark connections with
+	// outgoing and incoming sequence number adjustments.
+	ConnectionFlagOutSeq = 0x0200
+	ConnectionFlagInSeq  = 0x0400
+
+	// ConnectionFlagNoClientPort marks connections whose client port is
+	// not known yet.
+	ConnectionFlagNoClientPort = 0x0800
+
+	// ConnectionFlagTemplate marks persistence templates.
+	ConnectionFlagTemplate = 0x1000
+
+	// ConnectionFlagOnePacket marks one-packet scheduled connections.
+	ConnectionFlagOnePacket = 0x2000
+)
+
+// Tunnel destination encapsulations, requiring Linux 5.2 or newer for GUE
+// and 5.3 for GRE.
+const (
+	// TunnelTypeIPIP encapsulates packets in IPIP, the default.
+	TunnelTypeIPIP = 0
+
+	// TunnelTypeGUE encapsulates packets in Generic UDP Encapsulation,
+	// sent to the TunnelPort of the destination.
+	TunnelTypeGUE = 1
+
+	// TunnelTypeGRE encapsulates packets in GRE.
+	TunnelTypeGRE = 2
+)
+
+// Tunnel destination encapsulation flags.
+const (
+	// TunnelFlagNoChecksum disables the encapsulation checksum.
+	TunnelFlagNoChecksum = 0x0000
+
+	// TunnelFlagChecksum enables the encapsulation checksum.
+	TunnelFlagChecksum = 0x0001
+
+	// TunnelFlagRemoteChecksum enables remote checksum offload, GUE
+	// only.
+	TunnelFlagRemoteChecksum = 0x0002
+)
+
+const (
+	// RoundRobin distributes jobs equally amongst the available
+	// real servers.
+	RoundRobin = "rr"
+
+	// LeastConnection assigns more jobs to real servers with
+	// fewer active jobs.
+	LeastConnection = "lc"
+
+	// DestinationHashing assigns jobs to servers through looking
+	// up a statically assigned hash table by their destination IP
+	// addresses.
+	DestinationHashing = "dh"
+
+	// SourceHashing assigns jobs to servers through looking up
+	// a statically assigned hash table by their source IP
+	// addresses.
+	SourceHashing = "sh"
+
+	// WeightedRoundRobin assigns jobs to real servers proportionally
+	// to there real servers' weight. Servers with higher weights
+	// receive new jobs first and get more jobs than servers
+	// with lower weights. Servers with equal weights get
+	// an equal distribution of new jobs
+	WeightedRoundRobin = "wrr"
+
+	// WeightedLeastConnection assigns more jobs to servers
+	// with fewer jobs and relative to the real servers' weight
+	WeightedLeastConnection = "wlc"
+
+	// MaglevHashing assigns jobs to servers through looking up
+	// a Maglev consistent hashing table by their source IP
+	// addresses.
+	MaglevHashing = "mh"
+)
+
+// Virtual service flags
+const (
+	// SvcFlagPersistent makes the service persistent.
+	SvcFlagPersistent = 0x0001
+
+	// SvcFlagHashed is set by the kernel on hashed services.
+	SvcFlagHashed = 0x0002
+
+	// SvcFlagOnePacket schedules every UDP datagram independently.
+	SvcFlagOnePacket = 0x0004
+
+	// SvcFlagSched1, SvcFlagSched2 and SvcFlagSched3 are scheduler
+	// specific: sh-fallback, sh-port and unused for sh, mh-fallback,
+	// mh-port and unused for mh.
+	SvcFlagSched1 = 0x0008
+	SvcFlagSched2 = 0x0010
+	SvcFlagSched3 = 0x0020
+
+	// SvcFlagSHFallback makes the sh scheduler fall back to another
+	// destination when the hashed one is unavailable.
+	SvcFlagSHFallback = SvcFlagSched1
+
+	// SvcFlagSHPort makes the sh scheduler hash the source port too.
+	SvcFlagSHPort = SvcFlagSched2
+
+	// SvcFlagMHFallback makes the mh scheduler fall back to another
+	// destination when the hashed one is unavailable.
+	SvcFlagMHFallback = SvcFlagSched1
+
+	// SvcFlagMHPort makes the mh scheduler hash the source port too.
+	SvcFlagMHPort = SvcFlagSched2
+)
+
+const (
+	// ConnFwdMask is a mask for the fwd methods
+	ConnFwdMask = 0x0007
+
+	// ConnFwdMasq denotes forwarding via masquerading/NAT
+	ConnFwdMasq = 0x0000
+
+	// ConnFwdLocalNode denotes forwarding to a local node
+	ConnFwdLocalNode = 0x0001
+
+	// ConnFwdTunnel denotes forwarding via a tunnel
+	ConnFwdTunnel = 0x0002
+
+	// ConnFwdDirectRoute denotes forwarding via direct routing
+	ConnFwdDirectRoute = 0x0003
+
+	// ConnFwdBypass denotes forwarding while bypassing the cache
+	ConnFwdBypass = 0x0004
+
+	// ConnFwdFullNat denotes forwarding via snat+dnat
+	ConnFwdFullNat = 0x0005
+)
+
+const (
+	// daemon in stop state
+	DaemonStateNone = 0x0000
+
+	// daemon in master state
+	DaemonStateMaster = 0x0001
+
+	// daemon in backup state
+	DaemonStateBackup = 0x0002
+)
@@ -0,0 +1,487 @@
+package types
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// afINET is the value of AF_INET on Linux.
+const afINET = 2
+
+// ParseServiceFlags returns the flags named by names, as returned by String
+// once split on "|".
+func ParseServiceFlags(names []string) (ServiceFlags, error) {
+	var f ServiceFlags
+	for _, name := range names {
+		bits, err := parseFlag(name, func(name string) (uint32, bool) {
+			for _, fn := range serviceFlagNames {
+				if name == fn.name {
+					return uint32(fn.flag), true
+				}
+			}
+			return 0, false
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unknown service flag %q", name)
+		}
+		f |= ServiceFlags(bits)
+	}
+	return f, nil
+}
+
+// parseConnectionFlags returns the flags named by names, which do not
+// include the forwarding method.
+func parseConnectionFlags(names []string) (ConnectionFlags, error) {
+	var f ConnectionFlags
+	for _, name := range names {
+		bits, err := parseFlag(name, func(name string) (uint32, bool) {
+			for _, fn := range connectionFlagNames {
+				if name == fn.name {
+					return uint32(fn.flag), true
+				}
+			}
+			return 0, false
+		})
+		if err != nil {
+			return 0, fmt.Errorf("unknown connection flag %q", name)
+		}
+		f |= ConnectionFlags(bits)
+	}
+	return f, nil
+}
+
+// parseFlag returns the bits of the flag name, looked up with lookup, or
+// given in hexadecimal for the bits without a name.
+func parseFlag(name string, lookup func(string) (uint32, bool)) (uint32, error) {
+	if bits, ok := lookup(name); ok {
+		return bits, nil
+	}
+	if !strings.HasPrefix(name, "0x") {
+		return 0, fmt.Errorf("unknown flag %q", name)
+	}
+	bits, err := strconv.ParseUint(name[2:], 16, 32)
+	return uint32(bits), err
+}
+
+// ParseForwardingMethod returns the forwarding method named name, as
+// returned by String, e.g. "DirectRoute".
+func ParseForwardingMethod(name string) (ForwardingMethod, error) {
+	for m, n := range forwardingMethodNames {
+		if strings.EqualFold(name, n) {
+			return m, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown forwarding method %q", name)
+}
+
+var tunnelTypeNames = []string{
+	TunnelTypeIPIP: "ipip",
+	TunnelTypeGUE:  "gue",
+	TunnelTypeGRE:  "gre",
+}
+
+var tunnelFlagNames = []struct {
+	flag uint16
+	name string
+}{
+	{TunnelFlagChecksum, "Checksum"},
+	{TunnelFlagRemoteChecksum, "RemoteChecksum"},
+}
+
+// familyName returns the name of the address family af, empty if not set.
+func familyName(af uint16) string {
+	switch af {
+	case 0:
+		return ""
+	case afINET:
+		return "IPv4"
+	case afINET6:
+		return "IPv6"
+	}
+	return strconv.Itoa(int(af))
+}
+
+func parseFamily(name string) (uint16, error) {
+	switch name {
+	case "":
+		return 0, nil
+	case "IPv4":
+		return afINET, nil
+	case "IPv6":
+		return afINET6, nil
+	}
+	af, err := strconv.ParseUint(name, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("unknown address family %q", name)
+	}
+	return uint16(af), nil
+}
+
+// protocolName returns the name of the protocol p, empty if not set.
+func protocolName(p IPProto) string {
+	if p == 0 {
+		return ""
+	}
+	return p.String()
+}
+
+func parseProtocol(name string) (IPProto, error) {
+	if name == "" {
+		return 0, nil
+	}
+	var n uint16
+	if _, err := fmt.Sscanf(name, "IP(%d)", &n); err == nil {
+		return IPProto(n), nil
+	}
+	return ParseIPProto(name)
+}
+
+// netmaskString returns the persistence netmask of a service of family af:
+// a dotted mask for IPv4 and a prefix length, e.g. "/64", for IPv6.
+func netmaskString(mask uint32, af uint16) string {
+	switch {
+	case mask == 0:
+		return ""
+	case af == afINET6:
+		return "/" + strconv.Itoa(int(mask))
+	}
+	return net.IPv4(byte(mask>>24), byte(mask>>16), byte(mask>>8), byte(mask)).String()
+}
+
+func parseNetmask(s string) (uint32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	if strings.HasPrefix(s, "/") {
+		plen, err := strconv.ParseUint(s[1:], 10, 8)
+		if err != nil || plen > 128 {
+			return 0, fmt.Errorf("invalid netmask %q", s)
+		}
+		return uint32(plen), nil
+	}
+	ip := net.ParseIP(s).To4()
+	if ip == nil {
+		return 0, fmt.Errorf("invalid netmask %q", s)
+	}
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3]), nil
+}
+
+// durationString returns the duration of secs seconds, e.g. "5m0s".
+func durationString(secs uint32) string {
+	if secs == 0 {
+		return ""
+	}
+	return (time.Duration(secs) * time.Second).String()
+}
+
+func parseDuration(s string) (uint32, error) {
+	if s == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 || d%time.Second != 0 {
+		return 0, fmt.Errorf("invalid timeout %q, must be a positive number of seconds", s)
+	}
+	return uint32(d / time.Second), nil
+}
+
+// addressString returns ip, with its IPv6 zone, empty if not set.
+func addressString(ip net.IP, zone string) string {
+	if ip == nil {
+		return ""
+	}
+	return ZonedAddress(ip, zone)
+}
+
+func parseAddress(s string) (net.IP, string, error) {
+	if s == "" {
+		return nil, "", nil
+	}
+	host, zone := s, ""
+	if n := strings.IndexByte(s, '%'); n >= 0 {
+		host, zone = s[:n], s[n+1:]
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return nil, "", fmt.Errorf("invalid address %q", s)
+	}
+	if ip4 := ip.To4(); ip4 != nil {
+		ip = ip4
+	}
+	return ip, zone, nil
+}
+
+type statsJSON struct {
+	Connections uint64 `json:"connections"`
+	PacketsIn   uint64 `json:"packets_in"`
+	PacketsOut  uint64 `json:"packets_out"`
+	BytesIn     uint64 `json:"bytes_in"`
+	BytesOut    uint64 `json:"bytes_out"`
+	CPS         uint64 `json:"cps"`
+	BPSOut      uint64 `json:"bps_out"`
+	PPSIn       uint64 `json:"pps_in"`
+	PPSOut      uint64 `json:"pps_out"`
+	BPSIn       uint64 `json:"bps_in"`
+}
+
+// MarshalJSON encodes the statistics with snake case keys, e.g.
+// "packets_in".
+func (s SvcStats) MarshalJSON() ([]byte, error) {
+	return json.Marshal(statsJSON(s))
+}
+
+// UnmarshalJSON decodes statistics encoded by MarshalJSON.
+func (s *SvcStats) UnmarshalJSON(b []byte) error {
+	var v statsJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	*s = SvcStats(v)
+	return nil
+}
+
+// MarshalJSON encodes the statistics like SvcStats.MarshalJSON.
+func (s DstStats) MarshalJSON() ([]byte, error) {
+	return SvcStats(s).MarshalJSON()
+}
+
+// UnmarshalJSON decodes statistics encoded by MarshalJSON.
+func (s *DstStats) UnmarshalJSON(b []byte) error {
+	return (*SvcStats)(s).UnmarshalJSON(b)
+}
+
+type serviceJSON struct {
+	Address       string   `json:"address,omitempty"`
+	Protocol      string   `json:"protocol,omitempty"`
+	Port          uint16   `json:"port,omitempty"`
+	FWMark        uint32   `json:"fwmark,omitempty"`
+	Scheduler     string   `json:"scheduler,omitempty"`
+	Flags         []string `json:"flags,omitempty"`
+	Timeout       string   `json:"timeout,omitempty"`
+	Netmask       string   `json:"netmask,omitempty"`
+	AddressFamily string   `json:"address_family,omitempty"`
+	PEName        string   `json:"pe_name,omitempty"`
+	Stats         SvcStats `json:"stats"`
+}
+
+// MarshalJSON encodes the service with symbolic values: the protocol, flags
+// and address family by name, the timeout as a duration, e.g. "5m0s", and
+// the netmask as a dotted mask for IPv4 and a prefix length, e.g. "/64",
+// for IPv6.
+func (svc Service) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&serviceJSON{
+		Address:       addressString(svc.Address, svc.Zone),
+		Protocol:      protocolName(svc.Protocol),
+		Port:          svc.Port,
+		FWMark:        svc.FWMark,
+		Scheduler:     svc.SchedName,
+		Flags:         svc.Flags.names(),
+		Timeout:       durationString(svc.Timeout),
+		Netmask:       netmaskString(svc.Netmask, svc.AddressFamily),
+		AddressFamily: familyName(svc.AddressFamily),
+		PEName:        svc.PEName,
+		Stats:         svc.Stats,
+	})
+}
+
+// UnmarshalJSON decodes a service encoded by MarshalJSON.
+func (svc *Service) UnmarshalJSON(b []byte) error {
+	var v serviceJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	res := Service{
+		Port:      v.Port,
+		FWMark:    v.FWMark,
+		SchedName: v.Scheduler,
+		PEName:    v.PEName,
+		Stats:     v.Stats,
+	}
+	var err error
+	if res.Address, res.Zone, err = parseAddress(v.Address); err != nil {
+		return err
+	}
+	if res.Protocol, err = parseProtocol(v.Protocol); err != nil {
+		return err
+	}
+	if res.Flags, err = ParseServiceFlags(v.Flags); err != nil {
+		return err
+	}
+	if res.Timeout, err = parseDuration(v.Timeout); err != nil {
+		return err
+	}
+	if res.Netmask, err = parseNetmask(v.Netmask); err != nil {
+		return err
+	}
+	if res.AddressFamily, err = parseFamily(v.AddressFamily); err != nil {
+		return err
+	}
+	*svc = res
+	return nil
+}
+
+type destinationJSON struct {
+	Address               string   `json:"address,omitempty"`
+	Port                  uint16   `json:"port,omitempty"`
+	Weight                int      `json:"weight"`
+	ForwardingMethod      string   `json:"forwarding_method"`
+	ConnectionFlags       []string `json:"connection_flags,omitempty"`
+	AddressFamily         string   `json:"address_family,omitempty"`
+	UpperThreshold        uint32   `json:"upper_threshold,omitempty"`
+	LowerThreshold        uint32   `json:"lower_threshold,omitempty"`
+	ActiveConnections     int      `json:"active_connections"`
+	InactiveConnections   int      `json:"inactive_connections"`
+	PersistentConnections int      `json:"persistent_connections"`
+	Stats                 DstStats `json:"stats"`
+	TunnelType            string   `json:"tunnel_type,omitempty"`
+	TunnelPort            uint16   `json:"tunnel_port,omitempty"`
+	TunnelFlags           []string `json:"tunnel_flags,omitempty"`
+}
+
+// MarshalJSON encodes the destination with symbolic values: the forwarding
+// method, the other connection flags, the address family and the tunnel
+// encapsulation by name.
+func (d Destination) MarshalJSON() ([]byte, error) {
+	v := destinationJSON{
+		Address:               addressString(d.Address, d.Zone),
+		Port:                  d.Port,
+		Weight:                d.Weight,
+		ForwardingMethod:      d.ForwardingMethod().String(),
+		ConnectionFlags:       d.ConnectionFlags.otherNames(),
+		AddressFamily:         familyName(d.AddressFamily),
+		UpperThreshold:        d.UpperThreshold,
+		LowerThreshold:        d.LowerThreshold,
+		ActiveConnections:     d.ActiveConnections,
+		InactiveConnections:   d.InactiveConnections,
+		PersistentConnections: d.PersistentConnections,
+		Stats:                 d.Stats,
+		TunnelPort:            d.TunnelPort,
+	}
+	if d.ForwardingMethod() == ForwardTunnel || d.TunnelType != TunnelTypeIPIP {
+		if int(d.TunnelType) < len(tunnelTypeNames) {
+			v.TunnelType = tunnelTypeNames[d.TunnelType]
+		} else {
+			v.TunnelType = strconv.Itoa(int(d.TunnelType))
+		}
+	}
+	flags := d.TunnelFlags
+	for _, fn := range tunnelFlagNames {
+		if flags&fn.flag != 0 {
+			v.TunnelFlags = append(v.TunnelFlags, fn.name)
+			flags &^= fn.flag
+		}
+	}
+	if flags != 0 {
+		v.TunnelFlags = append(v.TunnelFlags, fmt.Sprintf("%#x", flags))
+	}
+	return json.Marshal(&v)
+}
+
+// UnmarshalJSON decodes a destination encoded by MarshalJSON.
+func (d *Destination) UnmarshalJSON(b []byte) error {
+	var v destinationJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+
+	res := Destination{
+		Port:                  v.Port,
+		Weight:                v.Weight,
+		UpperThreshold:        v.UpperThreshold,
+		LowerThreshold:        v.LowerThreshold,
+		ActiveConnections:     v.ActiveConnections,
+		InactiveConnections:   v.InactiveConnections,
+		PersistentConnections: v.PersistentConnections,
+		Stats:                 v.Stats,
+		TunnelPort:            v.TunnelPort,
+	}
+	var err error
+	if res.Address, res.Zone, err = parseAddress(v.Address); err != nil {
+		return err
+	}
+	if res.AddressFamily, err = parseFamily(v.AddressFamily); err != nil {
+		return err
+	}
+	if res.ConnectionFlags, err = parseConnectionFlags(v.ConnectionFlags); err != nil {
+		return err
+	}
+	if v.ForwardingMethod != "" {
+		m, err := ParseForwardingMethod(v.ForwardingMethod)
+		if err != nil {
+			return err
+		}
+		res.SetForwardingMethod(m)
+	}
+	if res.TunnelType, err = parseTunnelType(v.TunnelType); err != nil {
+		return err
+	}
+	for _, name := range v.TunnelFlags {
+		bits, err := parseFlag(name, func(name string) (uint32, bool) {
+			for _, fn := range tunnelFlagNames {
+				if name == fn.name {
+					return uint32(fn.flag), true
+				}
+			}
+			return 0, false
+		})
+		if err != nil || bits > 0xFFFF {
+			return fmt.Errorf("unknown tunnel flag %q", name)
+		}
+		res.TunnelFlags |= uint16(bits)
+	}
+	*d = res
+	return nil
+}
+
+func parseTunnelType(name string) (uint8, error) {
+	if name == "" {
+		return TunnelTypeIPIP, nil
+	}
+	for t, n := range tunnelTypeNames {
+		if strings.EqualFold(name, n) {
+			return uint8(t), nil
+		}
+	}
+	t, err := strconv.ParseUint(name, 10, 8)
+	if err != nil {
+		return 0, fmt.Errorf("unknown tunnel type %q", name)
+	}
+	return uint8(t), nil
+}
+
+type localAddressJSON struct {
+	Address     string `json:"address"`
+	Conflicts   uint64 `json:"conflicts"`
+	Connections uint32 `json:"connections"`
+}
+
+// MarshalJSON encodes the local address with its address as a string.
+func (l LocalAddress) MarshalJSON() ([]byte, error) {
+	return json.Marshal(&localAddressJSON{
+		Address:     addressString(l.Address, ""),
+		Conflicts:   l.Conflicts,
+		Connections: l.Connections,
+	})
+}
+
+// UnmarshalJSON decodes a local address encoded by MarshalJSON.
+func (l *LocalAddress) UnmarshalJSON(b []byte) error {
+	var v localAddressJSON
+	if err := json.Unmarshal(b, &v); err != nil {
+		return err
+	}
+	ip, _, err := parseAddress(v.Address)
+	if err != nil {
+		return err
+	}
+	*l = LocalAddress{Address: ip, Conflicts: v.Conflicts, Connections: v.Connections}
+	return nil
+}
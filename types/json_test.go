@@ -0,0 +1,162 @@
+package types
+
+import (
+	"encoding/json"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestServiceJSON(t *testing.T) {
+	testcases := []struct {
+		svc  Service
+		want []string
+	}{
+		{
+			Service{
+				Address:       net.ParseIP("10.0.0.1").To4(),
+				Protocol:      ProtocolTCP,
+				Port:          80,
+				SchedName:     "rr",
+				Flags:         SvcFlagPersistent | SvcFlagHashed,
+				Timeout:       300,
+				Netmask:       0xFFFFFF00,
+				AddressFamily: afINET,
+				Stats:         SvcStats{PacketsIn: 3},
+			},
+			[]string{`"address":"10.0.0.1"`, `"protocol":"TCP"`, `"flags":["Persistent","Hashed"]`, `"timeout":"5m0s"`, `"netmask":"255.255.255.0"`, `"address_family":"IPv4"`, `"packets_in":3`},
+		},
+		{
+			Service{
+				Address:       net.ParseIP("fe80::1"),
+				Zone:          "eth0",
+				Protocol:      ProtocolUDP,
+				Port:          53,
+				Flags:         SvcFlagOnePacket | 0x100,
+				Netmask:       64,
+				AddressFamily: afINET6,
+			},
+			[]string{`"address":"fe80::1%eth0"`, `"protocol":"UDP"`, `"flags":["OnePacket","0x100"]`, `"netmask":"/64"`, `"address_family":"IPv6"`},
+		},
+		{
+			Service{FWMark: 1, SchedName: "mh", Flags: SvcFlagSched1},
+			[]string{`"fwmark":1`, `"flags":["Sched1"]`},
+		},
+	}
+
+	for _, tc := range testcases {
+		b, err := json.Marshal(&tc.svc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("%s: expected %s", b, want)
+			}
+		}
+
+		var res Service
+		if err := json.Unmarshal(b, &res); err != nil {
+			t.Errorf("%s: %v", b, err)
+		} else if !reflect.DeepEqual(res, tc.svc) {
+			t.Errorf("%s: got %+v, expected %+v", b, res, tc.svc)
+		}
+	}
+}
+
+func TestDestinationJSON(t *testing.T) {
+	testcases := []struct {
+		dst  Destination
+		want []string
+	}{
+		{
+			Destination{
+				Address:           net.ParseIP("10.1.0.1").To4(),
+				Port:              8080,
+				Weight:            2,
+				ConnectionFlags:   ConnectionFlagDirectRoute,
+				AddressFamily:     afINET,
+				ActiveConnections: 4,
+				Stats:             DstStats{BytesOut: 5},
+			},
+			[]string{`"forwarding_method":"DirectRoute"`, `"active_connections":4`, `"bytes_out":5`},
+		},
+		{
+			Destination{
+				Address:         net.ParseIP("2001:db8::1"),
+				ConnectionFlags: ConnectionFlagTunnel | ConnectionFlagNoOutput,
+				AddressFamily:   afINET6,
+				TunnelType:      TunnelTypeGUE,
+				TunnelPort:      6080,
+				TunnelFlags:     TunnelFlagChecksum | TunnelFlagRemoteChecksum,
+			},
+			[]string{`"forwarding_method":"Tunnel"`, `"connection_flags":["NoOutput"]`, `"tunnel_type":"gue"`, `"tunnel_flags":["Checksum","RemoteChecksum"]`},
+		},
+		{
+			Destination{ConnectionFlags: ConnectionFlagTunnel},
+			[]string{`"tunnel_type":"ipip"`},
+		},
+	}
+
+	for _, tc := range testcases {
+		b, err := json.Marshal(&tc.dst)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, want := range tc.want {
+			if !strings.Contains(string(b), want) {
+				t.Errorf("%s: expected %s", b, want)
+			}
+		}
+
+		var res Destination
+		if err := json.Unmarshal(b, &res); err != nil {
+			t.Errorf("%s: %v", b, err)
+		} else if !reflect.DeepEqual(res, tc.dst) {
+			t.Errorf("%s: got %+v, expected %+v", b, res, tc.dst)
+		}
+	}
+}
+
+func TestLocalAddressJSON(t *testing.T) {
+	l := LocalAddress{Address: net.ParseIP("10.2.0.1").To4(), Conflicts: 1, Connections: 2}
+	b, err := json.Marshal(&l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != `{"address":"10.2.0.1","conflicts":1,"connections":2}` {
+		t.Errorf("unexpected encoding %s", b)
+	}
+
+	var res LocalAddress
+	if err := json.Unmarshal(b, &res); err != nil || !reflect.DeepEqual(res, l) {
+		t.Errorf("got %+v, %v", res, err)
+	}
+}
+
+func TestUnmarshalJSONErrors(t *testing.T) {
+	for _, in := range []string{
+		`{"protocol":"ICMP"}`,
+		`{"flags":["Sticky"]}`,
+		`{"timeout":"1.5s"}`,
+		`{"netmask":"/129"}`,
+		`{"address":"10.0.0"}`,
+	} {
+		var svc Service
+		if err := json.Unmarshal([]byte(in), &svc); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+
+	for _, in := range []string{
+		`{"forwarding_method":"Nat"}`,
+		`{"tunnel_type":"vxlan"}`,
+		`{"tunnel_flags":["0x10000"]}`,
+	} {
+		var d Destination
+		if err := json.Unmarshal([]byte(in), &d); err == nil {
+			t.Errorf("%s: expected an error", in)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package types
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"syscall"
+)
+
+// StatsSource reads services and destinations back from IPVS, implemented
+// by the Handle and the Handler of package ipvs.
+type StatsSource interface {
+	GetService(s *Service) (*Service, error)
+	GetDestinations(s *Service) ([]*Destination, error)
+}
+
+// RefreshStats reads the service back from h and updates its Stats in
+// place, leaving the other fields untouched.
+func (svc *Service) RefreshStats(h StatsSource) error {
+	cur, err := h.GetService(svc)
+	if err != nil {
+		return err
+	}
+	svc.Stats = cur.Stats
+	return nil
+}
+
+// RefreshStats reads the destinations of s back from h and updates the
+// Stats of d in place, leaving the other fields untouched. It returns an
+// error wrapping syscall.ENOENT if s has no destination with the address
+// and port of d.
+func (d *Destination) RefreshStats(h StatsSource, s *Service) error {
+	dsts, err := h.GetDestinations(s)
+	if err != nil {
+		return err
+	}
+	for _, dst := range dsts {
+		if dst.Port == d.Port && dst.Address.Equal(d.Address) {
+			d.Stats = dst.Stats
+			return nil
+		}
+	}
+	addr := net.JoinHostPort(d.Address.String(), strconv.Itoa(int(d.Port)))
+	return fmt.Errorf("destination %s not found: %w", addr, syscall.ENOENT)
+}
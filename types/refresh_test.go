@@ -0,0 +1,53 @@
+package types
+
+import (
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+)
+
+type fakeSource struct {
+	service      Service
+	destinations []*Destination
+}
+
+func (f *fakeSource) GetService(s *Service) (*Service, error) {
+	svc := f.service
+	return &svc, nil
+}
+
+func (f *fakeSource) GetDestinations(s *Service) ([]*Destination, error) {
+	return f.destinations, nil
+}
+
+func TestRefreshStats(t *testing.T) {
+	h := &fakeSource{
+		service: Service{SchedName: "wrr", Stats: SvcStats{Connections: 10}},
+		destinations: []*Destination{
+			{Address: net.ParseIP("10.1.0.1"), Port: 80, Weight: 5, Stats: DstStats{Connections: 4}},
+			{Address: net.ParseIP("10.1.0.2"), Port: 80, Weight: 5, Stats: DstStats{Connections: 6}},
+		},
+	}
+
+	svc := &Service{SchedName: "rr"}
+	if err := svc.RefreshStats(h); err != nil {
+		t.Fatal(err)
+	}
+	if svc.Stats.Connections != 10 || svc.SchedName != "rr" {
+		t.Errorf("unexpected service after refresh: %+v", svc)
+	}
+
+	d := &Destination{Address: net.ParseIP("10.1.0.2").To4(), Port: 80, Weight: 1}
+	if err := d.RefreshStats(h, svc); err != nil {
+		t.Fatal(err)
+	}
+	if d.Stats.Connections != 6 || d.Weight != 1 {
+		t.Errorf("unexpected destination after refresh: %+v", d)
+	}
+
+	missing := &Destination{Address: net.ParseIP("10.1.0.2"), Port: 8080}
+	if err := missing.RefreshStats(h, svc); !errors.Is(err, syscall.ENOENT) {
+		t.Errorf("expected ENOENT, got %v", err)
+	}
+}
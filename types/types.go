@@ -0,0 +1,376 @@
+// Package types defines the data structures describing IPVS objects. It has
+// no dependency on netlink and can be used on any platform.
+package types
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+)
+
+// afINET6 is the value of AF_INET6 on Linux, the only platform with IPVS.
+const afINET6 = 10
+
+// IPProto specifies the protocol encapsulated within an IP datagram
+type IPProto uint16
+
+// Protocols supported by IPVS services, numbered as in netinet/in.h.
+const (
+	ProtocolTCP  IPProto = 6
+	ProtocolUDP  IPProto = 17
+	ProtocolSCTP IPProto = 132
+)
+
+// String return name of the protocol
+func (p IPProto) String() string {
+	switch p {
+	case ProtocolTCP:
+		return "TCP"
+	case ProtocolUDP:
+		return "UDP"
+	case ProtocolSCTP:
+		return "SCTP"
+	}
+
+	return fmt.Sprintf("IP(%d)", p)
+}
+
+// ParseIPProto returns the protocol named name, case insensitively, e.g.
+// "sctp".
+func ParseIPProto(name string) (IPProto, error) {
+	for _, p := range []IPProto{ProtocolTCP, ProtocolUDP, ProtocolSCTP} {
+		if strings.EqualFold(name, p.String()) {
+			return p, nil
+		}
+	}
+	return 0, fmt.Errorf("unknown protocol %q", name)
+}
+
+// Value return number of the protocol
+func (p IPProto) Value() uint16 {
+	return uint16(p)
+}
+
+// Service defines an IPVS service in its entirety.
+type Service struct {
+	// Virtual service address.
+	Address  net.IP
+	Protocol IPProto
+	Port     uint16
+	FWMark   uint32 // Firewall mark of the service.
+
+	// Zone is the IPv6 zone, i.e. the interface, of a link-local Address.
+	// The kernel does not store it and never reports it.
+	Zone string
+
+	// Virtual service options.
+	SchedName     string
+	Flags         ServiceFlags
+	Timeout       uint32
+	Netmask       uint32 // IPv4 mask, e.g. 0xffffff00, or IPv6 prefix length, see SetPersistencePrefix.
+	AddressFamily uint16
+	PEName        string
+	Stats         SvcStats
+}
+
+// EnableOnePacketScheduling sets SvcFlagOnePacket on svc so that every
+// datagram is scheduled independently instead of following a connection,
+// as DNS like workloads need. Only UDP services support it.
+func (svc *Service) EnableOnePacketScheduling() error {
+	if svc.Protocol != ProtocolUDP {
+		return fmt.Errorf("service %s: one-packet scheduling is only supported with UDP", svc)
+	}
+	svc.Flags.Set(SvcFlagOnePacket)
+	return nil
+}
+
+// SetPersistencePrefix sets the Netmask of svc, according to its
+// AddressFamily, to group the clients sharing their first plen bits, from
+// 0 to 32 for IPv4 and from 1 to 128 for IPv6.
+func (svc *Service) SetPersistencePrefix(plen int) error {
+	if svc.AddressFamily == afINET6 {
+		if plen < 1 || plen > 128 {
+			return fmt.Errorf("invalid IPv6 persistence prefix length %d", plen)
+		}
+		svc.Netmask = uint32(plen)
+		return nil
+	}
+
+	if plen < 0 || plen > 32 {
+		return fmt.Errorf("invalid IPv4 persistence prefix length %d", plen)
+	}
+	mask := net.CIDRMask(plen, 32)
+	svc.Netmask = uint32(mask[0])<<24 | uint32(mask[1])<<16 | uint32(mask[2])<<8 | uint32(mask[3])
+	return nil
+}
+
+// PersistencePrefix returns the prefix length of the Netmask of svc. It
+// returns false for a non contiguous IPv4 mask.
+func (svc *Service) PersistencePrefix() (int, bool) {
+	if svc.AddressFamily == afINET6 {
+		return int(svc.Netmask), true
+	}
+
+	m := svc.Netmask
+	mask := net.IPv4Mask(byte(m>>24), byte(m>>16), byte(m>>8), byte(m))
+	ones, bits := mask.Size()
+	return ones, bits != 0
+}
+
+// ServiceFlags is a set of SvcFlag* service flags.
+type ServiceFlags uint32
+
+// Has reports whether all of flags are set.
+func (f ServiceFlags) Has(flags ServiceFlags) bool {
+	return f&flags == flags
+}
+
+// Set sets flags.
+func (f *ServiceFlags) Set(flags ServiceFlags) {
+	*f |= flags
+}
+
+// Clear clears flags.
+func (f *ServiceFlags) Clear(flags ServiceFlags) {
+	*f &^= flags
+}
+
+var serviceFlagNames = []struct {
+	flag ServiceFlags
+	name string
+}{
+	{SvcFlagPersistent, "Persistent"},
+	{SvcFlagHashed, "Hashed"},
+	{SvcFlagOnePacket, "OnePacket"},
+	{SvcFlagSched1, "Sched1"},
+	{SvcFlagSched2, "Sched2"},
+	{SvcFlagSched3, "Sched3"},
+}
+
+// names returns the names of the flags set in f, and the unknown bits in
+// hexadecimal.
+func (f ServiceFlags) names() []string {
+	var names []string
+	for _, fn := range serviceFlagNames {
+		if f.Has(fn.flag) {
+			names = append(names, fn.name)
+			f &^= fn.flag
+		}
+	}
+	if f != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(f)))
+	}
+	return names
+}
+
+// String returns the names of the flags, e.g. "Persistent|Hashed".
+func (f ServiceFlags) String() string {
+	return strings.Join(f.names(), "|")
+}
+
+// String returns a string representation of a service
+func (svc Service) String() string {
+	switch {
+	case svc.FWMark > 0:
+		return fmt.Sprintf("FMW %d (%s)", svc.FWMark, svc.SchedName)
+	case svc.Address.To4() == nil:
+		return fmt.Sprintf("%v [%v]:%d (%s)", svc.Protocol, ZonedAddress(svc.Address, svc.Zone), svc.Port, svc.SchedName)
+	default:
+		return fmt.Sprintf("%v %v:%d (%s)", svc.Protocol, svc.Address, svc.Port, svc.SchedName)
+	}
+}
+
+// SvcStats defines an IPVS service statistics. Kernels older than 4.1 only
+// report 32 bit wide connection and packet counters and rates, which wrap
+// around past 2^32.
+type SvcStats struct {
+	Connections uint64
+	PacketsIn   uint64
+	PacketsOut  uint64
+	BytesIn     uint64
+	BytesOut    uint64
+	CPS         uint64
+	BPSOut      uint64
+	PPSIn       uint64
+	PPSOut      uint64
+	BPSIn       uint64
+}
+
+// Destination defines an IPVS destination (real server) in its
+// entirety.
+type Destination struct {
+	Address               net.IP
+	Port                  uint16
+	Weight                int
+	ConnectionFlags       ConnectionFlags
+	AddressFamily         uint16
+	UpperThreshold        uint32
+	LowerThreshold        uint32
+	ActiveConnections     int
+	InactiveConnections   int
+	PersistentConnections int
+	Stats                 DstStats
+
+	// Encapsulation of tunnel destinations: TunnelType* encapsulation,
+	// destination UDP port for GUE and TunnelFlag* flags.
+	TunnelType  uint8
+	TunnelPort  uint16
+	TunnelFlags uint16
+
+	// Zone is the IPv6 zone, i.e. the interface, of a link-local Address.
+	// The kernel does not store it and never reports it.
+	Zone string
+}
+
+// ConnectionFlags is a set of ConnectionFlag* flags, including the
+// forwarding method in the ConnectionFlagFwdMask bits.
+type ConnectionFlags uint32
+
+var connectionFlagNames = []struct {
+	flag ConnectionFlags
+	name string
+}{
+	{ConnectionFlagSync, "Sync"},
+	{ConnectionFlagHashed, "Hashed"},
+	{ConnectionFlagNoOutput, "NoOutput"},
+	{ConnectionFlagInactive, "Inactive"},
+	{ConnectionFlagOutSeq, "OutSeq"},
+	{ConnectionFlagInSeq, "InSeq"},
+	{ConnectionFlagNoClientPort, "NoClientPort"},
+	{ConnectionFlagTemplate, "Template"},
+	{ConnectionFlagOnePacket, "OnePacket"},
+}
+
+// Has reports whether all of flags are set.
+func (f ConnectionFlags) Has(flags ConnectionFlags) bool {
+	return f&flags == flags
+}
+
+// Set sets flags.
+func (f *ConnectionFlags) Set(flags ConnectionFlags) {
+	*f |= flags
+}
+
+// Clear clears flags.
+func (f *ConnectionFlags) Clear(flags ConnectionFlags) {
+	*f &^= flags
+}
+
+// String returns the forwarding method followed by the names of the other
+// flags, e.g. "DirectRoute|Hashed", and the unknown bits in hexadecimal.
+func (f ConnectionFlags) String() string {
+	names := []string{ForwardingMethod(f & ConnectionFlagFwdMask).String()}
+	return strings.Join(append(names, f.otherNames()...), "|")
+}
+
+// otherNames returns the names of the flags set in f except the forwarding
+// method, and the unknown bits in hexadecimal.
+func (f ConnectionFlags) otherNames() []string {
+	var names []string
+	rest := f &^ ConnectionFlagFwdMask
+	for _, fn := range connectionFlagNames {
+		if rest.Has(fn.flag) {
+			names = append(names, fn.name)
+			rest &^= fn.flag
+		}
+	}
+	if rest != 0 {
+		names = append(names, fmt.Sprintf("%#x", uint32(rest)))
+	}
+	return names
+}
+
+// ForwardingMethod is the method used to forward packets to a destination,
+// stored in the ConnectionFlagFwdMask bits of its ConnectionFlags.
+type ForwardingMethod uint32
+
+// Forwarding methods.
+const (
+	ForwardMasq        ForwardingMethod = ConnectionFlagMasq
+	ForwardLocalNode   ForwardingMethod = ConnectionFlagLocalNode
+	ForwardTunnel      ForwardingMethod = ConnectionFlagTunnel
+	ForwardDirectRoute ForwardingMethod = ConnectionFlagDirectRoute
+	ForwardBypass      ForwardingMethod = ConnFwdBypass
+	ForwardFullNat     ForwardingMethod = ConnectionFlagFullNat
+)
+
+var forwardingMethodNames = map[ForwardingMethod]string{
+	ForwardMasq:        "Masq",
+	ForwardLocalNode:   "LocalNode",
+	ForwardTunnel:      "Tunnel",
+	ForwardDirectRoute: "DirectRoute",
+	ForwardBypass:      "Bypass",
+	ForwardFullNat:     "FullNat",
+}
+
+// String returns the name of the forwarding method
+func (m ForwardingMethod) String() string {
+	if name, ok := forwardingMethodNames[m]; ok {
+		return name
+	}
+	return fmt.Sprintf("ForwardingMethod(%d)", uint32(m))
+}
+
+// ForwardingMethod returns the forwarding method of d.
+func (d *Destination) ForwardingMethod() ForwardingMethod {
+	return ForwardingMethod(d.ConnectionFlags & ConnectionFlagFwdMask)
+}
+
+// SetForwardingMethod sets the forwarding method of d, leaving the other
+// ConnectionFlags untouched.
+func (d *Destination) SetForwardingMethod(m ForwardingMethod) {
+	d.ConnectionFlags = d.ConnectionFlags&^ConnectionFlagFwdMask | ConnectionFlags(m)&ConnectionFlagFwdMask
+}
+
+// DstStats defines IPVS destination (real server) statistics
+type DstStats SvcStats
+
+// LocalAddress defines in IPVS laddr in its entirety
+type LocalAddress struct {
+	Address     net.IP
+	Conflicts   uint64
+	Connections uint32
+}
+
+// Config defines IPVS timeout configuration
+type Config struct {
+	TimeoutTCP    time.Duration
+	TimeoutTCPFin time.Duration
+	TimeoutUDP    time.Duration
+}
+
+// Info defines IPVS info
+type Info struct {
+	Version       *Version
+	ConnTableSize uint32
+}
+
+// Version defines IPVS version
+type Version struct {
+	Major uint
+	Minor uint
+	Patch uint
+}
+
+// String returns a string of IPVS version
+func (v *Version) String() string {
+	return fmt.Sprintf("%d.%d.%d", v.Major, v.Minor, v.Patch)
+}
+
+// Daemon defines an IPVS connection synchronization daemon
+type Daemon struct {
+	State    uint32
+	SyncId   uint32
+	McastIfn string
+
+	// Multicast tuning, requiring Linux 4.3 or newer. Zero values select
+	// the kernel defaults: group 224.0.0.81, port 8848, TTL 1 and a
+	// maximum sync message length derived from the MTU of McastIfn.
+	// McastGroup6 selects an IPv6 multicast group instead of McastGroup.
+	McastGroup  net.IP
+	McastGroup6 net.IP
+	McastPort   uint16
+	McastTTL    uint8
+	SyncMaxLen  uint16
+}
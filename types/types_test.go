@@ -0,0 +1,156 @@
+package types
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestIPProto(t *testing.T) {
+	testcases := []struct {
+		proto IPProto
+		name  string
+	}{
+		{ProtocolTCP, "TCP"},
+		{ProtocolUDP, "UDP"},
+		{ProtocolSCTP, "SCTP"},
+	}
+
+	for _, tc := range testcases {
+		if tc.proto.String() != tc.name {
+			t.Errorf("expected %s, got %s", tc.name, tc.proto)
+		}
+		for _, name := range []string{tc.name, strings.ToLower(tc.name)} {
+			if p, err := ParseIPProto(name); err != nil || p != tc.proto {
+				t.Errorf("%s: got %v, %v", name, p, err)
+			}
+		}
+	}
+
+	if s := IPProto(1).String(); s != "IP(1)" {
+		t.Errorf("unexpected name %s", s)
+	}
+	if _, err := ParseIPProto("icmp"); err == nil {
+		t.Errorf("expected an error")
+	}
+}
+
+func TestServiceFlags(t *testing.T) {
+	var f ServiceFlags
+	f.Set(SvcFlagMHFallback | SvcFlagMHPort)
+	if !f.Has(SvcFlagMHFallback) || !f.Has(SvcFlagMHFallback|SvcFlagMHPort) {
+		t.Errorf("expected the mh flags in %#x", f)
+	}
+	if f.Has(SvcFlagPersistent | SvcFlagMHPort) {
+		t.Errorf("unexpected persistent flag in %#x", f)
+	}
+
+	f.Clear(SvcFlagMHPort)
+	if f != SvcFlagSched1 {
+		t.Errorf("expected %#x, got %#x", SvcFlagSched1, f)
+	}
+}
+
+func TestEnableOnePacketScheduling(t *testing.T) {
+	svc := &Service{Protocol: ProtocolUDP, Port: 53}
+	if err := svc.EnableOnePacketScheduling(); err != nil {
+		t.Fatal(err)
+	}
+	if !svc.Flags.Has(SvcFlagOnePacket) {
+		t.Errorf("expected the one-packet flag in %#x", svc.Flags)
+	}
+
+	svc = &Service{Protocol: ProtocolTCP, Port: 80}
+	if err := svc.EnableOnePacketScheduling(); err == nil {
+		t.Errorf("expected an error for TCP")
+	}
+	if svc.Flags != 0 {
+		t.Errorf("unexpected flags %#x", svc.Flags)
+	}
+}
+
+func TestPersistencePrefix(t *testing.T) {
+	testcases := []struct {
+		family  uint16
+		plen    int
+		netmask uint32
+		invalid bool
+	}{
+		{family: 2, plen: 24, netmask: 0xFFFFFF00},
+		{family: 2, plen: 32, netmask: 0xFFFFFFFF},
+		{family: 2, plen: 0, netmask: 0},
+		{family: 2, plen: 33, invalid: true},
+		{family: afINET6, plen: 64, netmask: 64},
+		{family: afINET6, plen: 0, invalid: true},
+		{family: afINET6, plen: 129, invalid: true},
+	}
+
+	for _, tc := range testcases {
+		svc := &Service{AddressFamily: tc.family}
+		err := svc.SetPersistencePrefix(tc.plen)
+		if tc.invalid {
+			if err == nil {
+				t.Errorf("family %d /%d: expected an error", tc.family, tc.plen)
+			}
+			continue
+		}
+		if err != nil || svc.Netmask != tc.netmask {
+			t.Errorf("family %d /%d: got %#x, %v", tc.family, tc.plen, svc.Netmask, err)
+			continue
+		}
+		if plen, ok := svc.PersistencePrefix(); !ok || plen != tc.plen {
+			t.Errorf("family %d /%d: got prefix %d, %v", tc.family, tc.plen, plen, ok)
+		}
+	}
+
+	svc := &Service{AddressFamily: 2, Netmask: 0xFF00FF00}
+	if _, ok := svc.PersistencePrefix(); ok {
+		t.Errorf("expected a non contiguous mask")
+	}
+}
+
+func TestForwardingMethod(t *testing.T) {
+	d := &Destination{ConnectionFlags: 0x0040 | ConnectionFlagTunnel}
+	if m := d.ForwardingMethod(); m != ForwardTunnel || m.String() != "Tunnel" {
+		t.Errorf("expected Tunnel, got %v", m)
+	}
+
+	d.SetForwardingMethod(ForwardFullNat)
+	if d.ConnectionFlags != 0x0040|ConnectionFlagFullNat {
+		t.Errorf("unexpected connection flags %#x", d.ConnectionFlags)
+	}
+	d.SetForwardingMethod(ForwardMasq)
+	if d.ForwardingMethod() != ForwardMasq || d.ConnectionFlags != 0x0040 {
+		t.Errorf("unexpected connection flags %#x", d.ConnectionFlags)
+	}
+
+	if s := ForwardingMethod(7).String(); s != "ForwardingMethod(7)" {
+		t.Errorf("unexpected name %s", s)
+	}
+}
+
+func TestConnectionFlags(t *testing.T) {
+	testcases := []struct {
+		flags ConnectionFlags
+		str   string
+	}{
+		{ConnectionFlagMasq, "Masq"},
+		{ConnectionFlagDirectRoute | ConnectionFlagHashed, "DirectRoute|Hashed"},
+		{ConnectionFlagTunnel | ConnectionFlagTemplate | ConnectionFlagOnePacket, "Tunnel|Template|OnePacket"},
+		{ConnectionFlagFullNat | 0x10000, "FullNat|0x10000"},
+	}
+	for _, tc := range testcases {
+		if s := tc.flags.String(); s != tc.str {
+			t.Errorf("%#x: expected %s, got %s", uint32(tc.flags), tc.str, s)
+		}
+	}
+
+	var f ConnectionFlags
+	f.Set(ConnectionFlagSync | ConnectionFlagInactive)
+	if !f.Has(ConnectionFlagSync) || f.Has(ConnectionFlagSync|ConnectionFlagHashed) {
+		t.Errorf("unexpected flags %v", f)
+	}
+	f.Clear(ConnectionFlagSync)
+	if f != ConnectionFlagInactive {
+		t.Errorf("unexpected flags %v", f)
+	}
+}
@@ -0,0 +1,206 @@
+// +build linux
+
+package ipvs
+
+import (
+	"fmt"
+	"net"
+	"syscall"
+
+	"github.com/kwanhur/ipvs/types"
+)
+
+// ProtocolError is returned for a service whose protocol is not supported
+// by IPVS.
+type ProtocolError struct {
+	Service *Service
+}
+
+func (e *ProtocolError) Error() string {
+	return fmt.Sprintf("service %s: protocol %v is not supported, only TCP, UDP and SCTP are", e.Service, e.Service.Protocol)
+}
+
+// OnePacketError is returned for a service with SvcFlagOnePacket whose
+// protocol is not UDP.
+type OnePacketError struct {
+	Service *Service
+}
+
+func (e *OnePacketError) Error() string {
+	return fmt.Sprintf("service %s: one-packet scheduling is only supported with UDP", e.Service)
+}
+
+// PersistenceNetmaskError is returned for a service with a persistence
+// netmask but without SvcFlagPersistent.
+type PersistenceNetmaskError struct {
+	Service *Service
+}
+
+func (e *PersistenceNetmaskError) Error() string {
+	return fmt.Sprintf("service %s: persistence netmask %#x set on a non persistent service", e.Service, e.Service.Netmask)
+}
+
+// NetmaskError is returned for a service whose persistence netmask is not
+// a contiguous IPv4 mask, or not an IPv6 prefix length.
+type NetmaskError struct {
+	Service *Service
+}
+
+func (e *NetmaskError) Error() string {
+	if e.Service.AddressFamily == syscall.AF_INET6 {
+		return fmt.Sprintf("service %s: invalid persistence prefix length %d", e.Service, e.Service.Netmask)
+	}
+	return fmt.Sprintf("service %s: persistence netmask %#x is not contiguous, e.g. 0xffffff00 for a /24", e.Service, e.Service.Netmask)
+}
+
+// SchedulerFlagsError is returned for a service with scheduler specific
+// flags whose scheduler is neither sh nor mh.
+type SchedulerFlagsError struct {
+	Service *Service
+}
+
+func (e *SchedulerFlagsError) Error() string {
+	return fmt.Sprintf("service %s: scheduler flags are only supported by the sh and mh schedulers", e.Service)
+}
+
+// FWMarkAddressError is returned for a firewall mark service which also has
+// an address or a port.
+type FWMarkAddressError struct {
+	Service *Service
+}
+
+func (e *FWMarkAddressError) Error() string {
+	return fmt.Sprintf("service %s: firewall mark services have no address nor port", e.Service)
+}
+
+// FullNatError is returned for a fullnat destination of a service without
+// local addresses.
+type FullNatError struct {
+	Service     *Service
+	Destination *Destination
+}
+
+func (e *FullNatError) Error() string {
+	return fmt.Sprintf("service %s: fullnat destination %s:%d requires local addresses", e.Service, e.Destination.Address, e.Destination.Port)
+}
+
+// ZoneError is returned for an address with an IPv6 zone which is not an
+// IPv6 link-local address.
+type ZoneError struct {
+	Address net.IP
+	Zone    string
+}
+
+func (e *ZoneError) Error() string {
+	return fmt.Sprintf("address %s: zones are only supported on IPv6 link-local addresses", types.ZonedAddress(e.Address, e.Zone))
+}
+
+// TunnelError is returned for a destination with an invalid tunnel
+// encapsulation.
+type TunnelError struct {
+	Service     *Service
+	Destination *Destination
+	Reason      string
+}
+
+func (e *TunnelError) Error() string {
+	return fmt.Sprintf("service %s: destination %s:%d: %s", e.Service, e.Destination.Address, e.Destination.Port, e.Reason)
+}
+
+// schedulerFlags is the mask of the scheduler specific service flags.
+const schedulerFlags = SvcFlagSched1 | SvcFlagSched2 | SvcFlagSched3
+
+// ValidateService checks the combination of the fields of s against the
+// rules enforced, or silently ignored, by the kernel and returns the error
+// describing the first violation found.
+func ValidateService(s *Service) error {
+	if s.Zone != "" && !types.IsLinkLocal6(s.Address) {
+		return &ZoneError{Address: s.Address, Zone: s.Zone}
+	}
+	if s.FWMark > 0 && ((s.Address != nil && !s.Address.IsUnspecified()) || s.Port != 0) {
+		return &FWMarkAddressError{Service: s}
+	}
+	if s.FWMark == 0 && s.Protocol != ProtocolTCP && s.Protocol != ProtocolUDP && s.Protocol != ProtocolSCTP {
+		return &ProtocolError{Service: s}
+	}
+	if s.Flags&SvcFlagOnePacket != 0 && s.Protocol != ProtocolUDP {
+		return &OnePacketError{Service: s}
+	}
+	if plen, ok := s.PersistencePrefix(); s.Netmask != 0 && (!ok || plen > 128) {
+		return &NetmaskError{Service: s}
+	}
+	if s.Flags&SvcFlagPersistent == 0 && s.Netmask != 0 && s.Netmask != fullNetmask(s.AddressFamily) {
+		return &PersistenceNetmaskError{Service: s}
+	}
+	if s.Flags&schedulerFlags != 0 && s.SchedName != SourceHashing && s.SchedName != MaglevHashing {
+		return &SchedulerFlagsError{Service: s}
+	}
+	return nil
+}
+
+// ValidateDestination checks d, to be added to s whose local addresses are
+// laddrs, and returns the error describing the first violation found.
+func ValidateDestination(s *Service, d *Destination, laddrs []*LocalAddress) error {
+	if d.Zone != "" && !types.IsLinkLocal6(d.Address) {
+		return &ZoneError{Address: d.Address, Zone: d.Zone}
+	}
+	if d.ConnectionFlags&ConnectionFlagFwdMask == ConnectionFlagFullNat && len(laddrs) == 0 {
+		return &FullNatError{Service: s, Destination: d}
+	}
+	if reason := checkTunnel(d); reason != "" {
+		return &TunnelError{Service: s, Destination: d, Reason: reason}
+	}
+	return nil
+}
+
+// checkTunnel returns why the tunnel encapsulation of d is invalid, if it
+// is.
+func checkTunnel(d *Destination) string {
+	if d.ConnectionFlags&ConnectionFlagFwdMask != ConnectionFlagTunnel {
+		if d.TunnelType != TunnelTypeIPIP || d.TunnelPort != 0 || d.TunnelFlags != 0 {
+			return "tunnel encapsulation set on a non tunnel destination"
+		}
+		return ""
+	}
+
+	switch d.TunnelType {
+	case TunnelTypeIPIP, TunnelTypeGRE:
+		if d.TunnelPort != 0 {
+			return "tunnel port is only used by GUE"
+		}
+	case TunnelTypeGUE:
+		if d.TunnelPort == 0 {
+			return "GUE requires a tunnel port"
+		}
+	default:
+		return fmt.Sprintf("unknown tunnel type %d", d.TunnelType)
+	}
+	if d.TunnelFlags&TunnelFlagRemoteChecksum != 0 && d.TunnelType != TunnelTypeGUE {
+		return "remote checksum offload is only supported by GUE"
+	}
+	return ""
+}
+
+// ValidateDestination checks d against the current local addresses of s,
+// see ValidateDestination. Only fullnat destinations need the local
+// addresses to be fetched.
+func (i *Handle) ValidateDestination(s *Service, d *Destination) error {
+	if d.ConnectionFlags&ConnectionFlagFwdMask != ConnectionFlagFullNat {
+		return ValidateDestination(s, d, nil)
+	}
+
+	laddrs, err := i.GetLocalAddresses(s)
+	if err != nil {
+		return err
+	}
+	return ValidateDestination(s, d, laddrs)
+}
+
+// fullNetmask returns the netmask of a service of family which does not
+// group clients: all ones for IPv4, a prefix length of 128 for IPv6.
+func fullNetmask(family uint16) uint32 {
+	if family == syscall.AF_INET6 {
+		return 128
+	}
+	return 0xFFFFFFFF
+}
@@ -0,0 +1,189 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestValidateService(t *testing.T) {
+	tcp := Service{
+		AddressFamily: syscall.AF_INET,
+		Protocol:      syscall.IPPROTO_TCP,
+		Address:       net.ParseIP("10.0.0.1"),
+		Port:          80,
+		SchedName:     RoundRobin,
+		Netmask:       0xFFFFFFFF,
+	}
+	with := func(f func(s *Service)) *Service {
+		s := tcp
+		f(&s)
+		return &s
+	}
+
+	testcases := []struct {
+		name     string
+		service  *Service
+		expected error
+	}{
+		{
+			name:    "valid",
+			service: &tcp,
+		},
+		{
+			name: "one packet udp",
+			service: with(func(s *Service) {
+				s.Protocol = syscall.IPPROTO_UDP
+				s.Flags = SvcFlagOnePacket
+			}),
+		},
+		{
+			name:     "one packet tcp",
+			service:  with(func(s *Service) { s.Flags = SvcFlagOnePacket }),
+			expected: &OnePacketError{},
+		},
+		{
+			name: "persistent netmask",
+			service: with(func(s *Service) {
+				s.Flags = SvcFlagPersistent
+				s.Netmask = 0xFFFFFF00
+			}),
+		},
+		{
+			name:     "netmask without persistence",
+			service:  with(func(s *Service) { s.Netmask = 0xFFFFFF00 }),
+			expected: &PersistenceNetmaskError{},
+		},
+		{
+			name: "byte swapped netmask",
+			service: with(func(s *Service) {
+				s.Flags = SvcFlagPersistent
+				s.Netmask = 0x00FFFFFF
+			}),
+			expected: &NetmaskError{},
+		},
+		{
+			name: "ipv6 prefix length out of range",
+			service: with(func(s *Service) {
+				s.AddressFamily = syscall.AF_INET6
+				s.Address = net.ParseIP("2001:db8::1")
+				s.Flags = SvcFlagPersistent
+				s.Netmask = 0xFFFFFFFF
+			}),
+			expected: &NetmaskError{},
+		},
+		{
+			name: "ipv6 full netmask",
+			service: with(func(s *Service) {
+				s.AddressFamily = syscall.AF_INET6
+				s.Address = net.ParseIP("2001:db8::1")
+				s.Netmask = 128
+			}),
+		},
+		{
+			name: "sh flags",
+			service: with(func(s *Service) {
+				s.SchedName = SourceHashing
+				s.Flags = SvcFlagSched1 | SvcFlagSched2
+			}),
+		},
+		{
+			name:     "rr with scheduler flags",
+			service:  with(func(s *Service) { s.Flags = SvcFlagSched1 }),
+			expected: &SchedulerFlagsError{},
+		},
+		{
+			name:    "fwmark",
+			service: &Service{AddressFamily: syscall.AF_INET, FWMark: 1, SchedName: RoundRobin},
+		},
+		{
+			name:     "fwmark with address",
+			service:  with(func(s *Service) { s.FWMark = 1 }),
+			expected: &FWMarkAddressError{},
+		},
+		{
+			name:    "sctp",
+			service: with(func(s *Service) { s.Protocol = ProtocolSCTP }),
+		},
+		{
+			name:     "unsupported protocol",
+			service:  with(func(s *Service) { s.Protocol = syscall.IPPROTO_ICMP }),
+			expected: &ProtocolError{},
+		},
+		{
+			name: "ipv6 link-local zone",
+			service: with(func(s *Service) {
+				s.AddressFamily = syscall.AF_INET6
+				s.Address = net.ParseIP("fe80::1")
+				s.Zone = "eth0"
+				s.Netmask = 128
+			}),
+		},
+		{
+			name:     "ipv4 zone",
+			service:  with(func(s *Service) { s.Zone = "eth0" }),
+			expected: &ZoneError{},
+		},
+	}
+
+	for _, tc := range testcases {
+		err := ValidateService(tc.service)
+		if reflect.TypeOf(err) != reflect.TypeOf(tc.expected) {
+			t.Logf("case: %s", tc.name)
+			t.Errorf("expected error %T, got %v", tc.expected, err)
+		}
+	}
+}
+
+func TestValidateDestination(t *testing.T) {
+	s := &Service{Protocol: syscall.IPPROTO_TCP, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	d := &Destination{Address: net.ParseIP("10.1.0.1"), Port: 80, ConnectionFlags: ConnectionFlagFullNat}
+	laddrs := []*LocalAddress{{Address: net.ParseIP("10.2.0.1")}}
+
+	if err := ValidateDestination(s, d, laddrs); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	if _, ok := ValidateDestination(s, d, nil).(*FullNatError); !ok {
+		t.Errorf("expected a FullNatError")
+	}
+	d.ConnectionFlags = ConnectionFlagMasq
+	if err := ValidateDestination(s, d, nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	d.ConnectionFlags = ConnectionFlagTunnel
+	d.TunnelType = TunnelTypeGUE
+	d.TunnelPort = 6080
+	d.TunnelFlags = TunnelFlagChecksum | TunnelFlagRemoteChecksum
+	if err := ValidateDestination(s, d, nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	d.TunnelPort = 0
+	if _, ok := ValidateDestination(s, d, nil).(*TunnelError); !ok {
+		t.Errorf("expected a TunnelError for GUE without port")
+	}
+	d.TunnelType = TunnelTypeGRE
+	if _, ok := ValidateDestination(s, d, nil).(*TunnelError); !ok {
+		t.Errorf("expected a TunnelError for GRE with remote checksum")
+	}
+	d.TunnelFlags = TunnelFlagChecksum
+	if err := ValidateDestination(s, d, nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+	d.ConnectionFlags = ConnectionFlagMasq
+	if _, ok := ValidateDestination(s, d, nil).(*TunnelError); !ok {
+		t.Errorf("expected a TunnelError for a masquerade destination")
+	}
+	d.TunnelType, d.TunnelFlags = TunnelTypeIPIP, 0
+
+	d.Zone = "eth0"
+	if _, ok := ValidateDestination(s, d, nil).(*ZoneError); !ok {
+		t.Errorf("expected a ZoneError")
+	}
+	d.Address = net.ParseIP("fe80::2")
+	if err := ValidateDestination(s, d, nil); err != nil {
+		t.Errorf("unexpected error %v", err)
+	}
+}
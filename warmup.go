@@ -0,0 +1,122 @@
+// +build linux
+
+package ipvs
+
+import "fmt"
+
+// UpdateWeights updates the weight of every destination of dsts, which
+// should already be existing in the passed ipvs service.
+func (i *Handle) UpdateWeights(s *Service, dsts []*Destination) error {
+	for _, d := range dsts {
+		if err := i.UpdateDestination(s, d); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Warmup is a service created by PrepareService whose destinations do not
+// receive traffic yet.
+type Warmup struct {
+	h    Handler
+	svc  *Service
+	dsts []*Destination
+
+	// batch runs the changes of the warmup, holding the host lock of the
+	// handle if any.
+	batch func(fn func() error) error
+}
+
+// PrepareService creates the service s and its destinations with all
+// weights at zero: the virtual service exists but no new connection is
+// scheduled to any real server. Once health and bindings are verified the
+// caller enables traffic with Enable, or removes everything with Abort.
+//
+// IPVS has no service flag disabling scheduling: a service whose
+// destinations all have weight zero is how the kernel expresses it, new
+// connections being handled as if the service had no destination.
+//
+// If any step fails, whatever was created is removed before returning the
+// error.
+func (i *Handle) PrepareService(s *Service, dsts []*Destination) (w *Warmup, err error) {
+	err = i.batch(func() error {
+		w, err = prepareService(i, s, dsts)
+		return err
+	})
+	if w != nil {
+		w.batch = i.batch
+	}
+	return w, err
+}
+
+func prepareService(h Handler, s *Service, dsts []*Destination) (*Warmup, error) {
+	if err := h.NewService(s); err != nil {
+		return nil, err
+	}
+
+	w := &Warmup{h: h, svc: s, dsts: dsts}
+	for _, d := range dsts {
+		quiesced := *d
+		quiesced.Weight = 0
+		if err := h.NewDestination(s, &quiesced); err != nil {
+			if derr := h.DelService(s); derr != nil {
+				return nil, fmt.Errorf("%w (removing the service: %v)", err, derr)
+			}
+			return nil, err
+		}
+	}
+
+	return w, nil
+}
+
+// Service returns the service being warmed up.
+func (w *Warmup) Service() *Service {
+	return w.svc
+}
+
+// Enable sets every destination to the weight it was passed with to
+// PrepareService. IPVS has no transactions, so the weights are restored in
+// a single tight loop without any other kernel round trip in between. If a
+// destination cannot be updated, the ones already enabled are set back to
+// weight zero, so that the service is left as PrepareService created it.
+func (w *Warmup) Enable() error {
+	return w.run(func() error {
+		for n, d := range w.dsts {
+			if err := w.h.UpdateDestination(w.svc, d); err != nil {
+				if rerr := w.quiesce(w.dsts[:n]); rerr != nil {
+					return fmt.Errorf("%w (rolling back: %v)", err, rerr)
+				}
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// quiesce sets the weight of dsts back to zero, returning the first error
+// but trying them all.
+func (w *Warmup) quiesce(dsts []*Destination) error {
+	var first error
+	for _, d := range dsts {
+		quiesced := *d
+		quiesced.Weight = 0
+		if err := w.h.UpdateDestination(w.svc, &quiesced); err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Abort deletes the service and its destinations.
+func (w *Warmup) Abort() error {
+	return w.run(func() error {
+		return w.h.DelService(w.svc)
+	})
+}
+
+func (w *Warmup) run(fn func() error) error {
+	if w.batch == nil {
+		return fn()
+	}
+	return w.batch(fn)
+}
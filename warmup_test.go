@@ -0,0 +1,100 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"gotest.tools/v3/assert"
+)
+
+// warmupHandler programs destinations in memory, failing the operations
+// on the destinations of port fail.
+type warmupHandler struct {
+	Handler
+
+	service *Service
+	weights map[uint16]int
+	fail    uint16
+	delErr  error
+}
+
+func (h *warmupHandler) NewService(s *Service) error {
+	h.service = s
+	h.weights = map[uint16]int{}
+	return nil
+}
+
+func (h *warmupHandler) DelService(s *Service) error {
+	if h.delErr != nil {
+		return h.delErr
+	}
+	h.service, h.weights = nil, nil
+	return nil
+}
+
+func (h *warmupHandler) NewDestination(s *Service, d *Destination) error {
+	if d.Port == h.fail {
+		return errors.New("new destination failed")
+	}
+	h.weights[d.Port] = d.Weight
+	return nil
+}
+
+func (h *warmupHandler) UpdateDestination(s *Service, d *Destination) error {
+	if d.Port == h.fail {
+		return errors.New("update destination failed")
+	}
+	h.weights[d.Port] = d.Weight
+	return nil
+}
+
+func TestWarmup(t *testing.T) {
+	s := &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	dsts := []*Destination{
+		{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 1},
+		{Address: net.ParseIP("10.1.0.2"), Port: 8081, Weight: 3},
+	}
+
+	h := &warmupHandler{}
+	w, err := prepareService(h, s, dsts)
+	assert.NilError(t, err)
+	assert.Equal(t, w.Service(), s)
+	assert.DeepEqual(t, h.weights, map[uint16]int{8080: 0, 8081: 0})
+	assert.Equal(t, dsts[1].Weight, 3)
+
+	assert.NilError(t, w.Enable())
+	assert.DeepEqual(t, h.weights, map[uint16]int{8080: 1, 8081: 3})
+
+	assert.NilError(t, w.Abort())
+	assert.Assert(t, h.service == nil)
+}
+
+func TestWarmupFailures(t *testing.T) {
+	s := &Service{Protocol: ProtocolTCP, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	dsts := []*Destination{
+		{Address: net.ParseIP("10.1.0.1"), Port: 8080, Weight: 1},
+		{Address: net.ParseIP("10.1.0.2"), Port: 8081, Weight: 3},
+	}
+
+	// A failed destination removes the service.
+	h := &warmupHandler{fail: 8081}
+	_, err := prepareService(h, s, dsts)
+	assert.ErrorContains(t, err, "new destination failed")
+	assert.Assert(t, h.service == nil)
+
+	// Unless it cannot be removed either.
+	h = &warmupHandler{fail: 8081, delErr: errors.New("del service failed")}
+	_, err = prepareService(h, s, dsts)
+	assert.ErrorContains(t, err, "new destination failed (removing the service: del service failed)")
+
+	// A failed Enable sets the weights back to zero.
+	h = &warmupHandler{}
+	w, err := prepareService(h, s, dsts)
+	assert.NilError(t, err)
+	h.fail = 8081
+	assert.ErrorContains(t, w.Enable(), "update destination failed")
+	assert.DeepEqual(t, h.weights, map[uint16]int{8080: 0, 8081: 0})
+}
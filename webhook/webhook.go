@@ -0,0 +1,164 @@
+// +build linux
+
+// Package webhook posts IPVS change events to HTTP endpoints.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"github.com/sirupsen/logrus"
+)
+
+// SignatureHeader is the header carrying the HMAC-SHA256 signature of the
+// request body, formatted as "sha256=<hex digest>".
+const SignatureHeader = "X-IPVS-Signature"
+
+// Payload is the JSON document posted for every event.
+type Payload struct {
+	Type         string             `json:"type"`
+	Time         time.Time          `json:"time"`
+	Service      *ipvs.Service      `json:"service,omitempty"`
+	Destination  *ipvs.Destination  `json:"destination,omitempty"`
+	LocalAddress *ipvs.LocalAddress `json:"local_address,omitempty"`
+	Daemon       *ipvs.Daemon       `json:"daemon,omitempty"`
+	Config       *ipvs.Config       `json:"config,omitempty"`
+	Anomaly      *ipvs.Anomaly      `json:"anomaly,omitempty"`
+	Alert        *ipvs.Alert        `json:"alert,omitempty"`
+}
+
+// NewPayload returns the payload of e.
+func NewPayload(e ipvs.Event) *Payload {
+	return &Payload{
+		Type:         e.Type.String(),
+		Time:         e.Time,
+		Service:      e.Service,
+		Destination:  e.Destination,
+		LocalAddress: e.LocalAddress,
+		Daemon:       e.Daemon,
+		Config:       e.Config,
+		Anomaly:      e.Anomaly,
+		Alert:        e.Alert,
+	}
+}
+
+// Notifier posts events to a set of webhook URLs.
+type Notifier struct {
+	// URLs receive a POST request for every event.
+	URLs []string
+
+	// Secret, if set, is used to sign request bodies with HMAC-SHA256.
+	Secret []byte
+
+	// Retries is the number of additional attempts made for a URL when a
+	// request fails or gets a non 2xx answer.
+	Retries int
+
+	// Backoff is the delay before the first retry, doubled on every
+	// subsequent one. Defaults to one second.
+	Backoff time.Duration
+
+	// Client is used to send requests. Defaults to a client with a 10
+	// seconds timeout.
+	Client *http.Client
+}
+
+// Run posts every event received on events until the channel is closed or
+// ctx is done. Delivery failures are logged.
+func (n *Notifier) Run(ctx context.Context, events <-chan ipvs.Event) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case e, ok := <-events:
+			if !ok {
+				return
+			}
+			if err := n.Notify(ctx, e); err != nil {
+				logrus.Warnf("webhook: %v", err)
+			}
+		}
+	}
+}
+
+// Notify posts e to every URL, retrying failed deliveries. It returns the
+// last delivery error, if any.
+func (n *Notifier) Notify(ctx context.Context, e ipvs.Event) error {
+	body, err := json.Marshal(NewPayload(e))
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, url := range n.URLs {
+		if err := n.deliver(ctx, url, body); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (n *Notifier) deliver(ctx context.Context, url string, body []byte) error {
+	backoff := n.Backoff
+	if backoff <= 0 {
+		backoff = time.Second
+	}
+
+	var err error
+	for attempt := 0; attempt <= n.Retries; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(backoff):
+			}
+			backoff *= 2
+		}
+
+		if err = n.post(ctx, url, body); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("delivery to %s failed: %v", url, err)
+}
+
+func (n *Notifier) post(ctx context.Context, url string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if len(n.Secret) > 0 {
+		req.Header.Set(SignatureHeader, Sign(n.Secret, body))
+	}
+
+	client := n.Client
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// Sign returns the value of SignatureHeader for body signed with secret.
+func Sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
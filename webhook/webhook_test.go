@@ -0,0 +1,56 @@
+// +build linux
+
+package webhook
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/kwanhur/ipvs"
+	"gotest.tools/v3/assert"
+)
+
+func TestNotify(t *testing.T) {
+	secret := []byte("secret")
+
+	var calls int
+	var got Payload
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		body, err := ioutil.ReadAll(r.Body)
+		assert.NilError(t, err)
+		assert.Equal(t, r.Header.Get(SignatureHeader), Sign(secret, body))
+		assert.NilError(t, json.Unmarshal(body, &got))
+	}))
+	defer srv.Close()
+
+	n := &Notifier{
+		URLs:    []string{srv.URL},
+		Secret:  secret,
+		Retries: 1,
+		Backoff: time.Millisecond,
+	}
+	err := n.Notify(context.Background(), ipvs.Event{
+		Type:    ipvs.EventServiceAdded,
+		Service: &ipvs.Service{SchedName: ipvs.RoundRobin},
+	})
+	assert.NilError(t, err)
+	assert.Equal(t, calls, 2)
+	assert.Equal(t, got.Type, "ServiceAdded")
+	assert.Equal(t, got.Service.SchedName, ipvs.RoundRobin)
+
+	n.Retries = 0
+	calls = 0
+	err = n.Notify(context.Background(), ipvs.Event{Type: ipvs.EventFlushed})
+	assert.ErrorContains(t, err, "503")
+}
@@ -0,0 +1,124 @@
+// +build linux
+
+package ipvs
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// MaxWeight is the largest destination weight accepted by ipvsadm.
+const MaxWeight = 65535
+
+// NormalizeWeights rescales relative weights into integer IPVS weights in
+// the range [0, max], preserving their ratios as closely as possible. The
+// smallest scale expressing the ratios exactly is used, so {0.5, 0.25} gives
+// {2, 1}; ratios which cannot be expressed exactly within max are
+// approximated with the largest weight mapped to max. Every positive weight
+// stays at least 1 so that no destination gets quiesced by rounding. A max
+// of 0 means MaxWeight, a max out of [0, MaxWeight] is an error.
+func NormalizeWeights(weights []float64, max int) ([]int, error) {
+	if max < 0 || max > MaxWeight {
+		return nil, fmt.Errorf("invalid maximum weight %d", max)
+	}
+	if max == 0 {
+		max = MaxWeight
+	}
+
+	var largest float64
+	for _, w := range weights {
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return nil, fmt.Errorf("invalid weight %v", w)
+		}
+		if w > largest {
+			largest = w
+		}
+	}
+
+	res := make([]int, len(weights))
+	if largest == 0 {
+		return res, nil
+	}
+
+	// The smallest exact scale is the least common multiple of the
+	// denominators of the ratios to the largest weight.
+	scale := 1
+	for _, w := range weights {
+		if w == 0 {
+			continue
+		}
+		d, ok := ratioDenominator(w/largest, max)
+		if !ok {
+			scale = max
+			break
+		}
+		if scale = scale / gcd(scale, d) * d; scale > max {
+			scale = max
+			break
+		}
+	}
+
+	for i, w := range weights {
+		if w == 0 {
+			continue
+		}
+		n := math.Round(w / largest * float64(scale))
+		if n < 1 {
+			n = 1
+		}
+		res[i] = int(n)
+	}
+	return res, nil
+}
+
+// ratioDenominator returns the denominator of the fraction equal to r, in
+// (0, 1], found among its continued fraction convergents, and false if the
+// denominator would exceed max.
+func ratioDenominator(r float64, max int) (int, bool) {
+	// h/k is the current convergent, ph/pk the previous one.
+	ph, h := 0.0, 1.0
+	pk, k := 1.0, 0.0
+	x := r
+	for {
+		a := math.Floor(x)
+		ph, h = h, a*h+ph
+		pk, k = k, a*k+pk
+		if k > float64(max) {
+			return 0, false
+		}
+		if math.Abs(h/k-r) <= 1e-9*r {
+			return int(k), true
+		}
+		x = 1 / (x - a)
+	}
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
+// ApplyRelativeWeights normalizes weights with NormalizeWeights and applies
+// them to dsts, the destinations of s in the same order, with UpdateWeights.
+func (i *Handle) ApplyRelativeWeights(s *Service, dsts []*Destination, weights []float64) error {
+	if len(dsts) != len(weights) {
+		return errors.New("destinations and weights have different lengths")
+	}
+
+	normalized, err := NormalizeWeights(weights, MaxWeight)
+	if err != nil {
+		return err
+	}
+
+	updated := make([]*Destination, len(dsts))
+	for n, d := range dsts {
+		u := *d
+		u.Weight = normalized[n]
+		updated[n] = &u
+	}
+
+	return i.UpdateWeights(s, updated)
+}
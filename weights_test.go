@@ -0,0 +1,87 @@
+// +build linux
+
+package ipvs
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestNormalizeWeights(t *testing.T) {
+	testcases := []struct {
+		name     string
+		weights  []float64
+		max      int
+		expected []int
+		err      bool
+	}{
+		{
+			name:     "small integers",
+			weights:  []float64{3, 1},
+			expected: []int{3, 1},
+		},
+		{
+			name:     "fractions",
+			weights:  []float64{0.5, 0.25, 0.25},
+			expected: []int{2, 1, 1},
+		},
+		{
+			name:     "large integers",
+			weights:  []float64{4000000, 1000000, 0},
+			expected: []int{4, 1, 0},
+		},
+		{
+			name:     "tiny weight stays enabled",
+			weights:  []float64{1e9, 1},
+			expected: []int{65535, 1},
+		},
+		{
+			name:     "custom range",
+			weights:  []float64{2, 3},
+			max:      100,
+			expected: []int{2, 3},
+		},
+		{
+			name:     "inexact ratios",
+			weights:  []float64{1, 1.0 / 3, 0.0001},
+			max:      100,
+			expected: []int{100, 33, 1},
+		},
+		{
+			name:     "common denominator",
+			weights:  []float64{1.0 / 6, 0.25, 1},
+			expected: []int{2, 3, 12},
+		},
+		{
+			name:     "all zero",
+			weights:  []float64{0, 0},
+			expected: []int{0, 0},
+		},
+		{
+			name:    "negative weight",
+			weights: []float64{1, -1},
+			err:     true,
+		},
+		{
+			name:    "maximum out of range",
+			weights: []float64{1, 2},
+			max:     MaxWeight + 1,
+			err:     true,
+		},
+	}
+
+	for _, testcase := range testcases {
+		t.Run(testcase.name, func(t *testing.T) {
+			weights, err := NormalizeWeights(testcase.weights, testcase.max)
+			if (err != nil) != testcase.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if !reflect.DeepEqual(weights, testcase.expected) {
+				t.Logf("got weights: %v", weights)
+				t.Logf("expected weights: %v", testcase.expected)
+				t.Errorf("unexpected weights")
+			}
+		})
+	}
+}
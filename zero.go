@@ -0,0 +1,196 @@
+// +build linux
+
+package ipvs
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// ZeroRecord is the audit record of a counter reset done by a
+// ZeroScheduler.
+type ZeroRecord struct {
+	Time time.Time
+	// Service is the service whose counters were reset, nil when the
+	// counters of every service were.
+	Service *Service
+	Err     error
+}
+
+// ZeroScheduler resets the packet, byte and rate counters of services on a
+// cadence, for reporting pipelines expecting interval based counters.
+type ZeroScheduler struct {
+	Handle *Handle
+
+	// Services are reset with ZeroService. Every service is reset with
+	// Zero when empty.
+	Services []*Service
+
+	// Next returns the time of the reset following t, see ZeroInterval
+	// and ZeroDaily.
+	Next func(t time.Time) time.Time
+
+	// Audit is called with the record of every reset. Records are logged
+	// when nil.
+	Audit func(ZeroRecord)
+}
+
+// ZeroInterval returns a ZeroScheduler.Next function resetting counters
+// every d.
+func ZeroInterval(d time.Duration) func(time.Time) time.Time {
+	return func(t time.Time) time.Time {
+		return t.Add(d)
+	}
+}
+
+// ZeroDaily returns a ZeroScheduler.Next function resetting counters every
+// day at hour:min in loc, e.g. ZeroDaily(0, 0, time.Local) for midnight.
+func ZeroDaily(hour, min int, loc *time.Location) func(time.Time) time.Time {
+	return func(t time.Time) time.Time {
+		t = t.In(loc)
+		next := time.Date(t.Year(), t.Month(), t.Day(), hour, min, 0, 0, loc)
+		if !next.After(t) {
+			next = time.Date(t.Year(), t.Month(), t.Day()+1, hour, min, 0, 0, loc)
+		}
+		return next
+	}
+}
+
+// Run resets the counters at every time given by Next until ctx is done.
+func (z *ZeroScheduler) Run(ctx context.Context) error {
+	for {
+		timer := time.NewTimer(time.Until(z.Next(time.Now())))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+			z.ZeroNow()
+		}
+	}
+}
+
+// ZeroNow resets the counters immediately, e.g. right after a successful
+// stats scrape, and returns the first error encountered.
+func (z *ZeroScheduler) ZeroNow() error {
+	if len(z.Services) == 0 {
+		err := z.Handle.Zero()
+		z.audit(ZeroRecord{Time: time.Now(), Err: err})
+		return err
+	}
+
+	var firstErr error
+	for _, s := range z.Services {
+		err := z.Handle.ZeroService(s)
+		z.audit(ZeroRecord{Time: time.Now(), Service: s, Err: err})
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+func (z *ZeroScheduler) audit(r ZeroRecord) {
+	if z.Audit != nil {
+		z.Audit(r)
+		return
+	}
+
+	target := "all services"
+	if r.Service != nil {
+		target = r.Service.String()
+	}
+	if r.Err != nil {
+		logrus.Warnf("Resetting counters of %s failed: %v", target, r.Err)
+		return
+	}
+	logrus.Infof("Reset counters of %s", target)
+}
+
+// ZeroDestination resets the connection, packet and byte counters of the
+// destination d of s, as read through the handle. The kernel only zeroes
+// the counters of whole services, so the handle records the current
+// counters of d as a baseline, subtracted from the ones it reads afterwards
+// with GetDestinations, GetDestination and Destinations. The counters of
+// the kernel, those of s and of its other destinations are unchanged, and so
+// are the rates of d, which the kernel estimates.
+//
+// The baseline is dropped when s or every service is zeroed or deleted
+// through the handle, when d is deleted through it, and when the counters
+// of d are read lower than the baseline, e.g. once another process zeroed
+// s. It returns an error wrapping syscall.ENOENT if s has no such
+// destination.
+func (i *Handle) ZeroDestination(s *Service, d *Destination) error {
+	dst, err := i.getDestination(s, d)
+	if err != nil {
+		return err
+	}
+
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if i.baselines == nil {
+		i.baselines = make(map[string]DstStats)
+	}
+	i.baselines[baselineKey(s, dst)] = dst.Stats
+	return nil
+}
+
+// baselineKey returns the key of the baseline of the destination d of s.
+func baselineKey(s *Service, d *Destination) string {
+	return serviceKey(s) + " " + destinationKey(d)
+}
+
+// applyBaselines subtracts their baselines from the counters of dsts, the
+// destinations of s, see ZeroDestination.
+func (i *Handle) applyBaselines(s *Service, dsts []*Destination) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	if len(i.baselines) == 0 {
+		return
+	}
+
+	for _, d := range dsts {
+		key := baselineKey(s, d)
+		base, ok := i.baselines[key]
+		if !ok {
+			continue
+		}
+		st := &d.Stats
+		if st.Connections < base.Connections || st.PacketsIn < base.PacketsIn || st.PacketsOut < base.PacketsOut ||
+			st.BytesIn < base.BytesIn || st.BytesOut < base.BytesOut {
+			// The counters were zeroed since the baseline was taken.
+			delete(i.baselines, key)
+			continue
+		}
+		st.Connections -= base.Connections
+		st.PacketsIn -= base.PacketsIn
+		st.PacketsOut -= base.PacketsOut
+		st.BytesIn -= base.BytesIn
+		st.BytesOut -= base.BytesOut
+	}
+}
+
+// dropBaselines drops the baseline of the destination d of s, of every
+// destination of s if d is nil, or every baseline if s is nil.
+func (i *Handle) dropBaselines(s *Service, d *Destination) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	switch {
+	case len(i.baselines) == 0:
+	case s == nil:
+		i.baselines = nil
+	case d != nil:
+		delete(i.baselines, baselineKey(s, d))
+	default:
+		prefix := serviceKey(s) + " "
+		for key := range i.baselines {
+			if strings.HasPrefix(key, prefix) {
+				delete(i.baselines, key)
+			}
+		}
+	}
+}
@@ -0,0 +1,76 @@
+// +build linux
+
+package ipvs
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"gotest.tools/v3/assert"
+)
+
+func TestZeroDaily(t *testing.T) {
+	next := ZeroDaily(0, 0, time.UTC)
+
+	testcases := []struct {
+		now      time.Time
+		expected time.Time
+	}{
+		{
+			now:      time.Date(2020, 3, 1, 12, 30, 0, 0, time.UTC),
+			expected: time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			now:      time.Date(2020, 3, 2, 0, 0, 0, 0, time.UTC),
+			expected: time.Date(2020, 3, 3, 0, 0, 0, 0, time.UTC),
+		},
+		{
+			now:      time.Date(2020, 12, 31, 23, 59, 59, 0, time.UTC),
+			expected: time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC),
+		},
+	}
+
+	for _, testcase := range testcases {
+		assert.Equal(t, next(testcase.now), testcase.expected)
+	}
+
+	next = ZeroDaily(6, 30, time.UTC)
+	now := time.Date(2020, 3, 1, 5, 0, 0, 0, time.UTC)
+	assert.Equal(t, next(now), time.Date(2020, 3, 1, 6, 30, 0, 0, time.UTC))
+
+	assert.Equal(t, ZeroInterval(time.Minute)(now), now.Add(time.Minute))
+}
+
+func TestBaselines(t *testing.T) {
+	s := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.1"), Port: 80}
+	other := &Service{Protocol: 6, Address: net.ParseIP("10.0.0.2"), Port: 80}
+	d := &Destination{Address: net.ParseIP("10.1.0.1"), Port: 80}
+	base := DstStats{Connections: 10, PacketsIn: 100, PacketsOut: 90, BytesIn: 1000, BytesOut: 900, CPS: 5}
+	i := &Handle{baselines: map[string]DstStats{
+		baselineKey(s, d):     base,
+		baselineKey(other, d): base,
+	}}
+
+	dst := *d
+	dst.Stats = DstStats{Connections: 15, PacketsIn: 150, PacketsOut: 140, BytesIn: 1500, BytesOut: 1400, CPS: 7}
+	i.applyBaselines(s, []*Destination{&dst})
+	assert.Equal(t, dst.Stats, DstStats{Connections: 5, PacketsIn: 50, PacketsOut: 50, BytesIn: 500, BytesOut: 500, CPS: 7})
+
+	// Counters lower than the baseline were zeroed in between.
+	dst.Stats = DstStats{Connections: 1, PacketsIn: 150, PacketsOut: 140, BytesIn: 1500, BytesOut: 1400}
+	i.applyBaselines(s, []*Destination{&dst})
+	assert.Equal(t, dst.Stats.Connections, uint64(1))
+	assert.Equal(t, dst.Stats.PacketsIn, uint64(150))
+	_, ok := i.baselines[baselineKey(s, d)]
+	assert.Assert(t, !ok)
+
+	i.baselines[baselineKey(s, d)] = base
+	i.dropBaselines(s, nil)
+	assert.Equal(t, len(i.baselines), 1)
+	i.dropBaselines(other, d)
+	assert.Equal(t, len(i.baselines), 0)
+	i.baselines[baselineKey(s, d)] = base
+	i.dropBaselines(nil, nil)
+	assert.Equal(t, len(i.baselines), 0)
+}